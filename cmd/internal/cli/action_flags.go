@@ -30,6 +30,7 @@ var (
 	network           string
 	networkArgs       []string
 	dns               string
+	annotations       map[string]string
 	security          []string
 	cgroupsTOMLFile   string
 	containLibsPath   []string
@@ -99,6 +100,14 @@ var (
 
 	runscriptTimeout string // runscript timeout
 
+	restartPolicy  string // instance restart policy
+	healthCmd      string // instance health check command
+	healthInterval string // time between instance health checks
+	healthRetries  int    // failed health checks before unhealthy
+	logMaxSize     string // size from which instance logs are rotated
+	logMaxFiles    int    // number of rotated instance log files
+	instanceTTY    bool   // allocate a pseudo-terminal for the instance
+
 	intelHpu bool
 )
 
@@ -273,6 +282,16 @@ var actionDNSFlag = cmdline.Flag{
 	EnvKeys:      []string{"DNS"},
 }
 
+// --annotation
+var actionAnnotationFlag = cmdline.Flag{
+	ID:           "actionAnnotationFlag",
+	Value:        &annotations,
+	DefaultValue: map[string]string{},
+	Name:         "annotation",
+	Usage:        "set an annotation on the container, matched against and passed to OCI hooks",
+	Tag:          "<key=value>",
+}
+
 // --security
 var actionSecurityFlag = cmdline.Flag{
 	ID:           "actionSecurityFlag",
@@ -922,6 +941,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionAllowSetuidFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionAppFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionApplyCgroupsFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionAnnotationFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionBindFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCleanEnvFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCompatFlag, actionsInstanceCmd...)
@@ -18,6 +18,7 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/cache"
@@ -33,6 +34,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/uri"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
 	"github.com/apptainer/apptainer/pkg/util/fs/lock"
 	"github.com/spf13/cobra"
 	"golang.org/x/sys/unix"
@@ -44,10 +46,23 @@ const (
 )
 
 func getCacheHandle(cfg cache.Config) *cache.Handle {
+	var maxSize int64
+	var sharedDir string
+	if conf := apptainerconf.GetCurrentConfig(); conf != nil {
+		var err error
+		maxSize, err = cache.ParseMaxSize(conf.CacheMaxSize)
+		if err != nil {
+			sylog.Warningf("Ignoring invalid 'cache max size' configuration %q: %s", conf.CacheMaxSize, err)
+		}
+		sharedDir = conf.SharedCacheDir
+	}
+
 	envKey := env.TrimApptainerKey(cache.DirEnv)
 	h, err := cache.New(cache.Config{
 		ParentDir: env.GetenvLegacy(envKey, envKey),
 		Disable:   cfg.Disable,
+		MaxSize:   maxSize,
+		SharedDir: sharedDir,
 	})
 	if err != nil {
 		sylog.Fatalf("Failed to create an image cache handle: %s", err)
@@ -314,6 +329,14 @@ func launchContainer(cmd *cobra.Command, image string, args []string, instanceNa
 		return err
 	}
 
+	var healthCheckInterval time.Duration
+	if healthCmd != "" {
+		healthCheckInterval, err = time.ParseDuration(healthInterval)
+		if err != nil {
+			return fmt.Errorf("invalid health check interval %q: %s", healthInterval, err)
+		}
+	}
+
 	opts := []launch.Option{
 		launch.OptWritable(isWritable),
 		launch.OptWritableTmpfs(isWritableTmpfs),
@@ -342,6 +365,7 @@ func launchContainer(cmd *cobra.Command, image string, args []string, instanceNa
 		launch.OptNetwork(network, networkArgs),
 		launch.OptHostname(hostname),
 		launch.OptDNS(dns),
+		launch.OptAnnotations(annotations),
 		launch.OptCaps(addCaps, dropCaps),
 		launch.OptAllowSUID(allowSUID),
 		launch.OptKeepPrivs(keepPrivs),
@@ -374,6 +398,10 @@ func launchContainer(cmd *cobra.Command, image string, args []string, instanceNa
 		launch.OptShareNSMode(shareNS),
 		launch.OptShareNSFd(fd),
 		launch.OptRunscriptTimeout(runscriptTimeout),
+		launch.OptRestartPolicy(restartPolicy),
+		launch.OptHealthCheck(healthCmd, healthCheckInterval, healthRetries),
+		launch.OptLogRotation(logMaxSize, logMaxFiles),
+		launch.OptTerminal(instanceTTY),
 		launch.OptIntelHpu(intelHpu),
 	}
 
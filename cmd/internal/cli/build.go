@@ -38,6 +38,7 @@ var buildArgs struct {
 	keyServerURL        string
 	webURL              string
 	mksquashfsArgs      string
+	fsType              string
 	encrypt             bool
 	fakeroot            bool
 	fakefakeroot        bool
@@ -58,7 +59,13 @@ var buildArgs struct {
 	ignoreUserns        bool     // Ignore user namespace(hidden)
 	remote              bool     // Remote flag(hidden, only for helpful error message)
 	reproducible        bool     // Reproducible build
+	lint                bool     // Lint the definition file before building
+	jobs                int      // Maximum number of stages built concurrently
+	buildCache          bool     // Reuse unchanged stages from the build cache
+	noBuildCache        bool     // Bypass the build cache
+	target              string   // Name of the stage to build
 	buildVarArgs        []string // Variables passed to build procedure.
+	recipients          []string // Additional public keys to encrypt the image for.
 	buildVarArgFile     string   // Variables file passed to build procedure.
 	buildArgsUnusedWarn bool     // Variables passed to build procedure to turn fatal error to warn.
 }
@@ -197,6 +204,15 @@ var buildEncryptFlag = cmdline.Flag{
 	Usage:        "build an image with an encrypted file system",
 }
 
+// --recipient
+var buildRecipientFlag = cmdline.Flag{
+	ID:           "buildRecipientFlag",
+	Value:        &buildArgs.recipients,
+	DefaultValue: []string{},
+	Name:         "recipient",
+	Usage:        "path to an additional PEM formatted RSA public key able to decrypt the encrypted container (can be specified multiple times)",
+}
+
 // TODO: Deprecate at 3.6, remove at 3.8
 // --fix-perms
 var buildFixPermsFlag = cmdline.Flag{
@@ -218,6 +234,16 @@ var buildMksquashfsArgsFlag = cmdline.Flag{
 	EnvKeys:      []string{"MKSQUASHFS_ARGS"},
 }
 
+// --fs-type
+var buildFsTypeFlag = cmdline.Flag{
+	ID:           "buildFsTypeFlag",
+	Value:        &buildArgs.fsType,
+	DefaultValue: "squashfs",
+	Name:         "fs-type",
+	Usage:        "filesystem type of the root filesystem of SIF files (squashfs or erofs)",
+	EnvKeys:      []string{"FS_TYPE"},
+}
+
 // --nv
 var buildNvFlag = cmdline.Flag{
 	ID:           "nvFlag",
@@ -371,6 +397,54 @@ var buildArgUnusedWarn = cmdline.Flag{
 	Usage:        "shows warning instead of fatal message when build args are not exact matched",
 }
 
+// --lint
+var buildLintFlag = cmdline.Flag{
+	ID:           "buildLintFlag",
+	Value:        &buildArgs.lint,
+	DefaultValue: false,
+	Name:         "lint",
+	Usage:        "check the definition file for common mistakes before building, and abort if any is found",
+}
+
+// -j|--jobs
+var buildJobsFlag = cmdline.Flag{
+	ID:           "buildJobsFlag",
+	Value:        &buildArgs.jobs,
+	DefaultValue: 1,
+	Name:         "jobs",
+	ShortHand:    "j",
+	Usage:        "maximum number of independent stages of a multi-stage build to build concurrently",
+	EnvKeys:      []string{"BUILD_JOBS"},
+}
+
+// --build-cache
+var buildCacheFlag = cmdline.Flag{
+	ID:           "buildCacheFlag",
+	Value:        &buildArgs.buildCache,
+	DefaultValue: false,
+	Name:         "build-cache",
+	Usage:        "reuse stages with unchanged base image, files and sections from the build cache, and save built stages to it",
+	EnvKeys:      []string{"BUILD_CACHE"},
+}
+
+// --no-build-cache
+var buildNoBuildCacheFlag = cmdline.Flag{
+	ID:           "buildNoBuildCacheFlag",
+	Value:        &buildArgs.noBuildCache,
+	DefaultValue: false,
+	Name:         "no-build-cache",
+	Usage:        "bypass the build cache, even if enabled with --build-cache",
+}
+
+// --target
+var buildTargetFlag = cmdline.Flag{
+	ID:           "buildTargetFlag",
+	Value:        &buildArgs.target,
+	DefaultValue: "",
+	Name:         "target",
+	Usage:        "name of the stage of a multi-stage build to build into the image, instead of the last stage",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(buildCmd)
@@ -380,6 +454,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildFakerootFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildFixPermsFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildMksquashfsArgsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildFsTypeFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildJSONFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildArchFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildArchVariantFlag, buildCmd)
@@ -401,6 +476,7 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(&commonPromptForPassphraseFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonPEMFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildRecipientFlag, buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&buildNvFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildNvCCLIFlag, buildCmd)
@@ -419,6 +495,11 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildVarArgsFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildVarArgFileFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildArgUnusedWarn, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildLintFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildJobsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildCacheFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildNoBuildCacheFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildTargetFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonAuthFileFlag, buildCmd)
 	})
 }
@@ -438,7 +519,7 @@ var buildCmd = &cobra.Command{
 }
 
 func preRun(cmd *cobra.Command, args []string) {
-	if promptForPassphrase || cmd.Flags().Lookup("pem-path").Changed {
+	if promptForPassphrase || cmd.Flags().Lookup("pem-path").Changed || len(buildArgs.recipients) > 0 {
 		// these imply --encrypt
 		buildArgs.encrypt = true
 	}
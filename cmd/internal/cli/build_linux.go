@@ -20,6 +20,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/internal/pkg/build"
 	"github.com/apptainer/apptainer/internal/pkg/build/args"
 	"github.com/apptainer/apptainer/internal/pkg/build/oci"
@@ -35,6 +36,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/build/types"
+	"github.com/apptainer/apptainer/pkg/build/types/parser"
 	"github.com/apptainer/apptainer/pkg/image"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -218,6 +220,18 @@ func runBuild(cmd *cobra.Command, args []string) {
 	if len(buildArgs.mounts) > 0 {
 		os.Setenv("APPTAINER_MOUNT", strings.Join(buildArgs.mounts, "\n"))
 	}
+	if buildArgs.jobs < 1 {
+		sylog.Fatalf("The number of --jobs must be at least 1")
+	}
+	switch buildArgs.fsType {
+	case "squashfs":
+	case "erofs":
+		if buildArgs.encrypt {
+			sylog.Fatalf("--encrypt is not supported with --fs-type erofs")
+		}
+	default:
+		sylog.Fatalf("Unknown --fs-type %q, must be squashfs or erofs", buildArgs.fsType)
+	}
 	if buildArgs.writableTmpfs {
 		if buildArgs.fakeroot {
 			sylog.Fatalf("--writable-tmpfs option is not supported for fakeroot build")
@@ -240,6 +254,7 @@ func runBuild(cmd *cobra.Command, args []string) {
 
 func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fakerootPath string) {
 	var keyInfo *cryptkey.KeyInfo
+	var recipients []cryptkey.KeyInfo
 	unprivilege := false
 	if buildArgs.encrypt {
 		if namespaces.IsUnprivileged() {
@@ -252,6 +267,19 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 		}
 		keyInfo = k
 
+		for _, r := range buildArgs.recipients {
+			if _, err := cryptkey.LoadPEMPublicKeyFile(r); err != nil {
+				sylog.Fatalf("Invalid recipient public key %s: %v", r, err)
+			}
+			recipients = append(recipients, cryptkey.KeyInfo{Format: cryptkey.PEM, Path: r})
+		}
+		// the first recipient is the encryption key without
+		// --passphrase or --pem-path
+		if keyInfo == nil && len(recipients) > 0 {
+			keyInfo = &recipients[0]
+			recipients = recipients[1:]
+		}
+
 		if keyInfo == nil && unprivilege {
 			sylog.Errorf("Missing encryption info, please add `--passphrase` or `--pem-path` or corresponding environment variable")
 			return
@@ -275,6 +303,18 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 		sylog.Fatalf("Could not check build sections: %v", err)
 	}
 
+	if buildArgs.lint {
+		if ok, _ := parser.IsDockerfile(spec); ok {
+			sylog.Warningf("Ignoring --lint, %s is a Dockerfile", spec)
+		} else if fs.IsFile(spec) && !isImage(spec) {
+			if err := apptainer.LintDefinitionFile(os.Stderr, spec); err != nil {
+				sylog.Fatalf("%v, fix them or build without --lint", err)
+			}
+		} else {
+			sylog.Warningf("Ignoring --lint, %s is not a definition file", spec)
+		}
+	}
+
 	authConf, err := makeOCICredentials(cmd)
 	if err != nil {
 		sylog.Fatalf("While creating Docker credentials: %v", err)
@@ -371,35 +411,40 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 	}
 
 	config := build.Config{
-		Dest:      dst,
-		Format:    buildFormat,
-		NoCleanUp: buildArgs.noCleanUp,
+		Dest:       dst,
+		Format:     buildFormat,
+		NoCleanUp:  buildArgs.noCleanUp,
+		Jobs:       buildArgs.jobs,
+		BuildCache: buildArgs.buildCache && !buildArgs.noBuildCache,
+		Target:     buildArgs.target,
 		Opts: types.Options{
-			ImgCache:          imgCache,
-			TmpDir:            tmpDir,
-			NoCache:           disableCache,
-			Update:            buildArgs.update,
-			Force:             forceOverwrite,
-			Sections:          buildArgs.sections,
-			NoTest:            buildArgs.noTest,
-			NoHTTPS:           noHTTPS,
-			LibraryURL:        buildArgs.libraryURL,
-			LibraryAuthToken:  authToken,
-			FakerootPath:      fakerootPath,
-			KeyServerOpts:     ko,
-			OCIAuthConfig:     authConf,
-			DockerDaemonHost:  dockerHost,
-			EncryptionKeyInfo: keyInfo,
-			FixPerms:          buildArgs.fixPerms,
-			SandboxTarget:     sandboxTarget,
-			DataPartition:     dataPartition,
-			MksquashfsArgs:    buildArgs.mksquashfsArgs,
-			Binds:             buildArgs.bindPaths,
-			Unprivilege:       unprivilege,
-			ReqAuthFile:       reqAuthFile,
-			Arch:              arch,
-			Platform:          *dp,
-			Reproducible:      buildArgs.reproducible,
+			ImgCache:             imgCache,
+			TmpDir:               tmpDir,
+			NoCache:              disableCache,
+			Update:               buildArgs.update,
+			Force:                forceOverwrite,
+			Sections:             buildArgs.sections,
+			NoTest:               buildArgs.noTest,
+			NoHTTPS:              noHTTPS,
+			LibraryURL:           buildArgs.libraryURL,
+			LibraryAuthToken:     authToken,
+			FakerootPath:         fakerootPath,
+			KeyServerOpts:        ko,
+			OCIAuthConfig:        authConf,
+			DockerDaemonHost:     dockerHost,
+			EncryptionKeyInfo:    keyInfo,
+			EncryptionRecipients: recipients,
+			FixPerms:             buildArgs.fixPerms,
+			SandboxTarget:        sandboxTarget,
+			DataPartition:        dataPartition,
+			MksquashfsArgs:       buildArgs.mksquashfsArgs,
+			FsType:               buildArgs.fsType,
+			Binds:                buildArgs.bindPaths,
+			Unprivilege:          unprivilege,
+			ReqAuthFile:          reqAuthFile,
+			Arch:                 arch,
+			Platform:             *dp,
+			Reproducible:         buildArgs.reproducible,
 		},
 	}
 	b, err := build.New(defs, config)
@@ -0,0 +1,72 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheExportTypesFlag, cacheExportCmd)
+	})
+}
+
+var (
+	cacheExportTypes []string
+
+	// -T|--type
+	cacheExportTypesFlag = cmdline.Flag{
+		ID:           "cacheExportTypes",
+		Value:        &cacheExportTypes,
+		DefaultValue: []string{"all"},
+		Name:         "type",
+		ShortHand:    "T",
+		Usage:        "a list of cache types to export (possible values: library, oci-tmp, shub, blob, net, oras, ipfs, build, all)",
+	}
+
+	// cacheExportCmd is 'apptainer cache export' and will export cache entries to an archive
+	cacheExportCmd = &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Args:                  cobra.MinimumNArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			imgCache := getCacheHandle(cache.Config{})
+			if err := apptainer.ExportApptainerCache(imgCache, args[0], cacheExportTypes, args[1:]); err != nil {
+				sylog.Fatalf("Could not export cache: %v", err)
+			}
+		},
+
+		Use:     docs.CacheExportUse,
+		Short:   docs.CacheExportShort,
+		Long:    docs.CacheExportLong,
+		Example: docs.CacheExportExample,
+	}
+
+	// cacheImportCmd is 'apptainer cache import' and will import cache entries from an archive
+	cacheImportCmd = &cobra.Command{
+		DisableFlagsInUseLine: true,
+		Args:                  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			imgCache := getCacheHandle(cache.Config{})
+			if err := apptainer.ImportApptainerCache(imgCache, args[0]); err != nil {
+				sylog.Fatalf("Could not import cache: %v", err)
+			}
+		},
+
+		Use:     docs.CacheImportUse,
+		Short:   docs.CacheImportShort,
+		Long:    docs.CacheImportLong,
+		Example: docs.CacheImportExample,
+	}
+)
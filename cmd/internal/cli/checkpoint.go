@@ -9,15 +9,19 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"text/tabwriter"
 
 	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/checkpoint"
+	"github.com/apptainer/apptainer/internal/pkg/checkpoint/criu"
 	"github.com/apptainer/apptainer/internal/pkg/checkpoint/dmtcp"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/pkg/cmdline"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/spf13/cobra"
 )
@@ -31,13 +35,63 @@ func init() {
 		cmdManager.RegisterSubCmd(CheckpointCmd, CheckpointInstanceCmd)
 		cmdManager.RegisterSubCmd(CheckpointCmd, CheckpointCreateCmd)
 		cmdManager.RegisterSubCmd(CheckpointCmd, CheckpointDeleteCmd)
+		cmdManager.RegisterSubCmd(CheckpointCmd, CheckpointRestoreCmd)
 
 		cmdManager.RegisterFlagForCmd(&actionHomeFlag, CheckpointInstanceCmd)
+		cmdManager.RegisterFlagForCmd(&checkpointBackendFlag,
+			CheckpointListCmd,
+			CheckpointCreateCmd,
+			CheckpointDeleteCmd,
+			CheckpointInstanceCmd,
+			CheckpointRestoreCmd,
+		)
+		cmdManager.RegisterFlagForCmd(&checkpointLeaveRunningFlag, CheckpointInstanceCmd)
 	})
 }
 
-func checkpointPreRun(_ *cobra.Command, _ []string) {
-	dmtcp.QuickInstallationCheck()
+var (
+	checkpointBackendName  string
+	checkpointLeaveRunning bool
+)
+
+// --backend
+var checkpointBackendFlag = cmdline.Flag{
+	ID:           "checkpointBackendFlag",
+	Value:        &checkpointBackendName,
+	DefaultValue: dmtcp.BackendName,
+	Name:         "backend",
+	Usage:        "checkpoint backend to use (dmtcp, criu) (experimental)",
+	EnvKeys:      []string{"CHECKPOINT_BACKEND"},
+}
+
+// --leave-running
+var checkpointLeaveRunningFlag = cmdline.Flag{
+	ID:           "checkpointLeaveRunningFlag",
+	Value:        &checkpointLeaveRunning,
+	DefaultValue: false,
+	Name:         "leave-running",
+	Usage:        "keep the instance running once checkpointed (criu backend only)",
+}
+
+// checkpointBackend returns the checkpoint backend selected with --backend.
+func checkpointBackend(cmd *cobra.Command) checkpoint.Backend {
+	switch checkpointBackendName {
+	case dmtcp.BackendName:
+		return dmtcp.NewBackend(func(_ context.Context, name string, args []string) error {
+			a := append([]string{"/.singularity.d/actions/exec"}, args...)
+			return launchContainer(cmd, "instance://"+name, a, "", -1)
+		})
+	case criu.BackendName:
+		return criu.NewBackend(criu.Options{
+			LeaveRunning: checkpointLeaveRunning,
+		})
+	}
+	sylog.Fatalf("Unknown checkpoint backend %q, should be one of: %s, %s", checkpointBackendName, dmtcp.BackendName, criu.BackendName)
+	return nil
+}
+
+func checkpointPreRun(cmd *cobra.Command, _ []string) {
+	checkpointBackend(cmd).QuickInstallationCheck()
 }
 
 // CheckpointCmd represents the checkpoint command.
@@ -55,8 +109,8 @@ var CheckpointCmd = &cobra.Command{
 var CheckpointListCmd = &cobra.Command{
 	Args:   cobra.ExactArgs(0),
 	PreRun: checkpointPreRun,
-	Run: func(_ *cobra.Command, _ []string) {
-		m := dmtcp.NewManager()
+	Run: func(cmd *cobra.Command, _ []string) {
+		m := checkpointBackend(cmd)
 
 		entries, err := m.List()
 		if err != nil {
@@ -85,9 +139,9 @@ var CheckpointListCmd = &cobra.Command{
 var CheckpointCreateCmd = &cobra.Command{
 	Args:   cobra.ExactArgs(1),
 	PreRun: checkpointPreRun,
-	Run: func(_ *cobra.Command, args []string) {
+	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		m := dmtcp.NewManager()
+		m := checkpointBackend(cmd)
 
 		_, err := m.Get(name)
 		if err == nil {
@@ -114,9 +168,9 @@ var CheckpointCreateCmd = &cobra.Command{
 var CheckpointDeleteCmd = &cobra.Command{
 	Args:   cobra.ExactArgs(1),
 	PreRun: checkpointPreRun,
-	Run: func(_ *cobra.Command, args []string) {
+	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		m := dmtcp.NewManager()
+		m := checkpointBackend(cmd)
 
 		err := m.Delete(name)
 		if err != nil {
@@ -138,7 +192,10 @@ var CheckpointInstanceCmd = &cobra.Command{
 	Args: cobra.ExactArgs(1),
 	PreRun: func(cmd *cobra.Command, args []string) {
 		checkpointPreRun(cmd, args)
-		actionPreRun(cmd, args)
+		// the dmtcp backend executes its commands within the instance
+		if checkpointBackendName == dmtcp.BackendName {
+			actionPreRun(cmd, args)
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		instanceName := args[0]
@@ -148,28 +205,26 @@ var CheckpointInstanceCmd = &cobra.Command{
 			sylog.Fatalf("Could not retrieve instance file: %s", err)
 		}
 
-		if file.Checkpoint == "" {
-			sylog.Fatalf("This instance was not started with checkpointing.")
-		}
-
-		m := dmtcp.NewManager()
-
-		e, err := m.Get(file.Checkpoint)
+		e, err := checkpointBackend(cmd).Checkpoint(cmd.Context(), file)
 		if err != nil {
-			sylog.Fatalf("Failed to get checkpoint entry: %v", err)
+			sylog.Fatalf("%s", err)
 		}
 
-		port, err := e.CoordinatorPort()
-		if err != nil {
-			sylog.Fatalf("Failed to parse port file for coordinator port: %s", err)
+		ev := instance.Event{
+			Action: instance.EventCheckpoint,
+			Engine: apptainerConfig.Name,
+			ID:     instanceName,
+			Pid:    file.Pid,
+			Attributes: map[string]string{
+				"backend":    checkpointBackendName,
+				"checkpoint": e.Name(),
+			},
 		}
-
-		sylog.Infof("Using checkpoint %q", e.Name())
-
-		a := append([]string{"/.singularity.d/actions/exec"}, dmtcp.CheckpointArgs(port)...)
-		if err := launchContainer(cmd, "instance://"+args[0], a, "", -1); err != nil {
-			sylog.Fatalf("%s", err)
+		if err := instance.WriteEvent(ev); err != nil {
+			sylog.Debugf("Could not write checkpoint event: %s", err)
 		}
+
+		sylog.Infof("Instance %q checkpointed to %q", instanceName, e.Name())
 	},
 
 	Use:     docs.CheckpointInstanceUse,
@@ -179,3 +234,31 @@ var CheckpointInstanceCmd = &cobra.Command{
 
 	DisableFlagsInUseLine: true,
 }
+
+// CheckpointRestoreCmd apptainer checkpoint restore
+var CheckpointRestoreCmd = &cobra.Command{
+	Args:   cobra.ExactArgs(1),
+	PreRun: checkpointPreRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		m := checkpointBackend(cmd)
+
+		e, err := m.Get(name)
+		if err != nil {
+			sylog.Fatalf("Failed to get checkpoint entry: %v", err)
+		}
+
+		if err := m.Restore(cmd.Context(), e); err != nil {
+			sylog.Fatalf("Failed to restore checkpoint: %v", err)
+		}
+
+		sylog.Infof("Checkpoint %q restored.", name)
+	},
+
+	Use:     docs.CheckpointRestoreUse,
+	Short:   docs.CheckpointRestoreShort,
+	Long:    docs.CheckpointRestoreLong,
+	Example: docs.CheckpointRestoreExample,
+
+	DisableFlagsInUseLine: true,
+}
@@ -0,0 +1,130 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(DeffileCmd)
+		cmdManager.RegisterSubCmd(DeffileCmd, DeffileFmtCmd)
+		cmdManager.RegisterSubCmd(DeffileCmd, DeffileLintCmd)
+		cmdManager.RegisterSubCmd(DeffileCmd, DeffileConvertCmd)
+
+		cmdManager.RegisterFlagForCmd(&deffileFmtWriteFlag, DeffileFmtCmd)
+		cmdManager.RegisterFlagForCmd(&deffileConvertToFlag, DeffileConvertCmd)
+	})
+}
+
+// -w|--write
+var deffileFmtWrite bool
+
+var deffileFmtWriteFlag = cmdline.Flag{
+	ID:           "deffileFmtWriteFlag",
+	Value:        &deffileFmtWrite,
+	DefaultValue: false,
+	Name:         "write",
+	ShortHand:    "w",
+	Usage:        "write the result to the definition file instead of the standard output",
+}
+
+// --to
+var deffileConvertTo string
+
+var deffileConvertToFlag = cmdline.Flag{
+	ID:           "deffileConvertToFlag",
+	Value:        &deffileConvertTo,
+	DefaultValue: apptainer.DeffileFormatJSON,
+	Name:         "to",
+	Usage:        "format to convert the definition file to (json|def)",
+}
+
+// DeffileCmd is the 'deffile' command that allows to manage definition files.
+var DeffileCmd = &cobra.Command{
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.DeffileUse,
+	Short:   docs.DeffileShort,
+	Long:    docs.DeffileLong,
+	Example: docs.DeffileExample,
+}
+
+// DeffileFmtCmd is the 'deffile fmt' command that formats definition files.
+var DeffileFmtCmd = &cobra.Command{
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if len(args) > 1 && !deffileFmtWrite {
+			sylog.Fatalf("Formatting several definition files requires --write")
+		}
+		for _, path := range args {
+			if err := apptainer.FormatDefinitionFile(os.Stdout, path, deffileFmtWrite); err != nil {
+				sylog.Fatalf("%v", err)
+			}
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.DeffileFmtUse,
+	Short:   docs.DeffileFmtShort,
+	Long:    docs.DeffileFmtLong,
+	Example: docs.DeffileFmtExample,
+}
+
+// DeffileLintCmd is the 'deffile lint' command that checks definition files
+// for common mistakes.
+var DeffileLintCmd = &cobra.Command{
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		failed := false
+		for _, path := range args {
+			if err := apptainer.LintDefinitionFile(os.Stdout, path); err != nil {
+				sylog.Errorf("%v", err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.DeffileLintUse,
+	Short:   docs.DeffileLintShort,
+	Long:    docs.DeffileLintLong,
+	Example: docs.DeffileLintExample,
+}
+
+// DeffileConvertCmd is the 'deffile convert' command that converts definition
+// files to JSON and back.
+var DeffileConvertCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if err := apptainer.ConvertDefinitionFile(os.Stdout, args[0], deffileConvertTo); err != nil {
+			sylog.Fatalf("%v", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.DeffileConvertUse,
+	Short:   docs.DeffileConvertShort,
+	Long:    docs.DeffileConvertLong,
+	Example: docs.DeffileConvertExample,
+}
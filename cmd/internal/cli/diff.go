@@ -0,0 +1,56 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var diffJSON bool
+
+// -j|--json
+var diffJSONFlag = cmdline.Flag{
+	ID:           "diffJSONFlag",
+	Value:        &diffJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print the differences as json",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(DiffCmd)
+		cmdManager.RegisterFlagForCmd(&diffJSONFlag, DiffCmd)
+	})
+}
+
+// DiffCmd is the 'diff' command that shows the differences between two
+// images.
+var DiffCmd = &cobra.Command{
+	Args: cobra.ExactArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if err := apptainer.Diff(os.Stdout, args[0], args[1], diffJSON); err != nil {
+			sylog.Fatalf("%v", err.Error())
+		}
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.DiffUse,
+	Short:   docs.DiffShort,
+	Long:    docs.DiffLong,
+	Example: docs.DiffExample,
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(eventsCmd)
+		cmdManager.RegisterFlagForCmd(&eventsJSONFlag, eventsCmd)
+		cmdManager.RegisterFlagForCmd(&eventsSinceFlag, eventsCmd)
+	})
+}
+
+// -j|--json
+var eventsJSON bool
+
+var eventsJSONFlag = cmdline.Flag{
+	ID:           "eventsJSONFlag",
+	Value:        &eventsJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print events as json objects, one per line",
+	EnvKeys:      []string{"JSON"},
+}
+
+// --since
+var eventsSince string
+
+var eventsSinceFlag = cmdline.Flag{
+	ID:           "eventsSinceFlag",
+	Value:        &eventsSince,
+	DefaultValue: "",
+	Name:         "since",
+	Usage:        "also show past events since a duration (e.g. 10m) or a timestamp (e.g. 2006-01-02T15:04:05)",
+	Tag:          "<duration|timestamp>",
+}
+
+// apptainer events
+var eventsCmd = &cobra.Command{
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		opts := apptainer.EventsOptions{
+			JSON: eventsJSON,
+		}
+		if eventsSince != "" {
+			since, err := apptainer.ParseLogsSince(eventsSince, time.Now())
+			if err != nil {
+				return err
+			}
+			opts.Since = since
+		}
+		return apptainer.Events(cmd.Context(), os.Stdout, opts)
+	},
+
+	Use:     docs.EventsUse,
+	Short:   docs.EventsShort,
+	Long:    docs.EventsLong,
+	Example: docs.EventsExample,
+}
@@ -0,0 +1,131 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/cryptkey"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rekeyAddRecipients    []string
+	rekeyRemoveRecipients []string
+	rekeyNewPassphrase    bool
+	rekeyRemovePassphrase bool
+)
+
+// --add-recipient
+var imageRekeyAddRecipientFlag = cmdline.Flag{
+	ID:           "imageRekeyAddRecipientFlag",
+	Value:        &rekeyAddRecipients,
+	DefaultValue: []string{},
+	Name:         "add-recipient",
+	Usage:        "path to a PEM formatted RSA public key to add as recipient (can be specified multiple times)",
+}
+
+// --remove-recipient
+var imageRekeyRemoveRecipientFlag = cmdline.Flag{
+	ID:           "imageRekeyRemoveRecipientFlag",
+	Value:        &rekeyRemoveRecipients,
+	DefaultValue: []string{},
+	Name:         "remove-recipient",
+	Usage:        "path to a PEM formatted RSA public key to remove from the recipients (can be specified multiple times)",
+}
+
+// --new-passphrase
+var imageRekeyNewPassphraseFlag = cmdline.Flag{
+	ID:           "imageRekeyNewPassphraseFlag",
+	Value:        &rekeyNewPassphrase,
+	DefaultValue: false,
+	Name:         "new-passphrase",
+	Usage:        "prompt for a new passphrase able to decrypt the image",
+}
+
+// --remove-passphrase
+var imageRekeyRemovePassphraseFlag = cmdline.Flag{
+	ID:           "imageRekeyRemovePassphraseFlag",
+	Value:        &rekeyRemovePassphrase,
+	DefaultValue: false,
+	Name:         "remove-passphrase",
+	Usage:        "remove the passphrase able to decrypt the image",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&commonPromptForPassphraseFlag, ImageRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&commonPEMFlag, ImageRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&imageRekeyAddRecipientFlag, ImageRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&imageRekeyRemoveRecipientFlag, ImageRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&imageRekeyNewPassphraseFlag, ImageRekeyCmd)
+		cmdManager.RegisterFlagForCmd(&imageRekeyRemovePassphraseFlag, ImageRekeyCmd)
+	})
+}
+
+// ImageRekeyCmd is the 'image rekey' command that allows to change the
+// keys able to decrypt an encrypted SIF image.
+var ImageRekeyCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := cryptkey.RekeyOptions{
+			RemovePassphrase: rekeyRemovePassphrase,
+		}
+		for _, r := range rekeyAddRecipients {
+			opts.AddRecipients = append(opts.AddRecipients, cryptkey.KeyInfo{Format: cryptkey.PEM, Path: r})
+		}
+		for _, r := range rekeyRemoveRecipients {
+			opts.RemoveRecipients = append(opts.RemoveRecipients, cryptkey.KeyInfo{Format: cryptkey.PEM, Path: r})
+		}
+
+		if len(opts.AddRecipients) == 0 && len(opts.RemoveRecipients) == 0 && !rekeyNewPassphrase && !rekeyRemovePassphrase {
+			if _, ok := os.LookupEnv("APPTAINER_ENCRYPTION_NEW_PASSPHRASE"); !ok {
+				sylog.Fatalf("Nothing to do, please add --add-recipient, --remove-recipient, --new-passphrase or --remove-passphrase")
+			}
+		}
+
+		keyInfo, err := getEncryptionMaterial(cmd)
+		if err != nil {
+			sylog.Fatalf("While handling encryption material: %v", err)
+		}
+		if keyInfo == nil {
+			sylog.Fatalf("Missing encryption info, please add `--passphrase` or `--pem-path` or corresponding environment variable")
+		}
+
+		newPassphrase, newPassphraseEnvOK := os.LookupEnv("APPTAINER_ENCRYPTION_NEW_PASSPHRASE")
+		if rekeyNewPassphrase {
+			newPassphrase, err = interactive.GetPassphrase("Enter new encryption passphrase: ", 3)
+			if err != nil {
+				sylog.Fatalf("While reading new passphrase: %v", err)
+			}
+		}
+		if (rekeyNewPassphrase || newPassphraseEnvOK) && newPassphrase == "" {
+			sylog.Fatalf("Cannot encrypt container with empty passphrase")
+		}
+		if newPassphrase != "" && rekeyRemovePassphrase {
+			sylog.Fatalf("--new-passphrase and --remove-passphrase are mutually exclusive")
+		}
+		opts.NewPassphrase = newPassphrase
+
+		if err := cryptkey.Rekey(args[0], *keyInfo, opts); err != nil {
+			sylog.Fatalf("While rekeying %s: %v", args[0], err)
+		}
+		sylog.Infof("Image %s rekeyed", args[0])
+	},
+
+	Use:     docs.ImageRekeyUse,
+	Short:   docs.ImageRekeyShort,
+	Long:    docs.ImageRekeyLong,
+	Example: docs.ImageRekeyExample,
+}
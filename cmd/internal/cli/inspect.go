@@ -15,14 +15,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
 
 	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/image/squashfs"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/image"
@@ -179,6 +182,9 @@ func init() {
 const (
 	sectionDelim = "~~##@@> "
 	metadataJSON = "inspect-metadata.json"
+	// inspectRootEnv is the environment variable holding the directory
+	// of the metadata extracted from a squashfs root filesystem
+	inspectRootEnv = "INSPECT_ROOT"
 )
 
 type command struct {
@@ -187,6 +193,12 @@ type command struct {
 	metadata    *inspect.Metadata
 	sifMetadata *inspect.Metadata
 	img         *image.Image
+	// root is the directory holding the container metadata when
+	// they are read from the host rather than from the container
+	root string
+	// sfs is the squashfs root filesystem whose metadata are extracted
+	// to a temporary directory, root is then set to inspectRootVar
+	sfs *squashfs.FS
 }
 
 //nolint:dupword
@@ -196,9 +208,8 @@ func newCommand(allData bool, appName string, img *image.Image) *command {
 	command.metadata = inspect.NewMetadata()
 	command.appName = appName
 
-	prefix := ""
 	if img.Type == image.SANDBOX {
-		prefix = img.Path
+		command.root = img.Path
 	} else if img.Type == image.SIF {
 		metadata, err := getInspectMetadataFromSIF(img)
 		if err == nil {
@@ -211,15 +222,30 @@ func newCommand(allData bool, appName string, img *image.Image) *command {
 		} else if err != image.ErrNoSection {
 			sylog.Warningf("Unable to read %s SIF descriptor: %s", metadataJSON, err)
 		} else {
-			if runtime.GOOS != "linux" {
+			sylog.Debugf("No %s SIF descriptor found", metadataJSON)
+		}
+	}
+
+	// read the metadata of squashfs root filesystems in process
+	// instead of running the container, they are extracted when the
+	// script is run
+	if img.Type != image.SANDBOX && command.sifMetadata == nil {
+		sfs, err := squashfs.OpenImage(img)
+		if err == nil {
+			command.root = "${" + inspectRootEnv + "}"
+			command.sfs = sfs
+		} else {
+			sylog.Debugf("Could not read metadata from %s in process: %s", img.Path, err)
+			if runtime.GOOS != "linux" && img.Type == image.SIF {
 				sylog.Fatalf("Could not inspect %s: %s SIF descriptor not found", img.Path, metadataJSON)
+			} else if runtime.GOOS != "linux" {
+				sylog.Fatalf("Could not inspect image %s on this platform, only SIF and sandbox images are supported", img.Path)
 			}
-			sylog.Debugf("No %s SIF descriptor found", metadataJSON)
 		}
-	} else if runtime.GOOS != "linux" {
-		sylog.Fatalf("Could not inspect image %s on this platform, only SIF and sandbox images are supported", img.Path)
 	}
 
+	prefix := command.root
+
 	pathPrefix := filepath.Join(prefix, "/.singularity.d")
 	if appName != "" && !allData {
 		pathPrefix = fmt.Sprintf("%s/scif/apps/%s/scif", prefix, appName)
@@ -338,11 +364,22 @@ func (c *command) getMetadata() (*inspect.Metadata, error) {
 	}
 
 	args := []string{"/bin/sh", "-c", c.script}
-	prefix := ""
+	prefix := c.root
+	cmdEnv := []string{"PATH=" + env.DefaultPath}
 	outBuf := new(bytes.Buffer)
 
+	if c.sfs != nil {
+		dir, err := extractInspectData(c.sfs)
+		if err != nil {
+			return nil, fmt.Errorf("could not inspect container: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		prefix = dir
+		cmdEnv = append(cmdEnv, inspectRootEnv+"="+dir)
+	}
+
 	// Execute the compound script.
-	if c.img.Type == image.SANDBOX {
+	if c.root != "" {
 		os.Setenv("PATH", env.DefaultPath)
 
 		// look for sh
@@ -353,13 +390,12 @@ func (c *command) getMetadata() (*inspect.Metadata, error) {
 		args[0] = shell
 
 		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Env = []string{"PATH=" + env.DefaultPath}
+		cmd.Env = cmdEnv
 		out, err := cmd.Output()
 		if err != nil {
 			return nil, fmt.Errorf("could not inspect container: %v", err)
 		}
 		outBuf.Write(out)
-		prefix = c.img.Path
 	} else {
 		// single file image, run apptainer exec with the compound script
 		out, err := apptainerExec(c.img.Path, args)
@@ -594,6 +630,69 @@ func getSIFMetadata(img *image.Image, dataType uint32) ([]byte, error) {
 	return nil, errNoSIFMetadata
 }
 
+// extractInspectData extracts the metadata directories of a squashfs root
+// filesystem, i.e. /.singularity.d and the scif directory of each SCIF app,
+// to a temporary directory. Symbolic links are resolved in the image and
+// replaced by the content of their target.
+func extractInspectData(sfs *squashfs.FS) (string, error) {
+	names := []string{".singularity.d"}
+	apps, err := sfs.ReadDir("scif/apps")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("while reading SCIF apps: %w", err)
+	}
+	for _, app := range apps {
+		if app.IsDir() {
+			names = append(names, path.Join("scif/apps", app.Name(), "scif"))
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "inspect-")
+	if err != nil {
+		return "", fmt.Errorf("while creating temporary directory: %s", err)
+	}
+	for _, name := range names {
+		err := sfs.Extract(dir, []string{name}, squashfs.ExtractOptions{})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("while extracting %s: %w", name, err)
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch d.Type() {
+		case fs.ModeDir:
+			// the directory content is modified and removed later
+			return os.Chmod(path, 0o755)
+		case 0:
+			return os.Chmod(path, 0o644)
+		case fs.ModeSymlink:
+		default:
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := sfs.ReadFile(filepath.ToSlash(rel))
+		if err != nil {
+			sylog.Debugf("Ignoring symbolic link %s: %s", rel, err)
+			return nil
+		}
+		return os.WriteFile(path, data, 0o644)
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("while resolving symbolic links: %w", err)
+	}
+	return dir, nil
+}
+
 func inspectDeffilePartition(img *image.Image) (string, error) {
 	data, err := getSIFMetadata(img, uint32(sif.DataDeffile))
 	if err != nil {
@@ -22,6 +22,13 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&instanceStartPidFileFlag, instanceStartCmd, instanceRunCmd)
 		cmdManager.RegisterFlagForCmd(&actionDMTCPLaunchFlag, instanceStartCmd, instanceRunCmd)
 		cmdManager.RegisterFlagForCmd(&actionDMTCPRestartFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceRestartFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthCmdFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthIntervalFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceHealthRetriesFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogMaxSizeFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogMaxFilesFlag, instanceStartCmd, instanceRunCmd)
+		cmdManager.RegisterFlagForCmd(&instanceTTYFlag, instanceStartCmd, instanceRunCmd)
 	})
 }
 
@@ -37,6 +44,75 @@ var instanceStartPidFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"PID_FILE"},
 }
 
+// --restart
+var instanceRestartFlag = cmdline.Flag{
+	ID:           "instanceRestartFlag",
+	Value:        &restartPolicy,
+	DefaultValue: "",
+	Name:         "restart",
+	Usage:        "restart policy of the instance process: no, on-failure[:N] to restart it at most N times when it fails, or always",
+	EnvKeys:      []string{"RESTART"},
+}
+
+// --health-cmd
+var instanceHealthCmdFlag = cmdline.Flag{
+	ID:           "instanceHealthCmdFlag",
+	Value:        &healthCmd,
+	DefaultValue: "",
+	Name:         "health-cmd",
+	Usage:        "shell command run periodically inside the instance to check its health",
+	EnvKeys:      []string{"HEALTH_CMD"},
+}
+
+// --health-interval
+var instanceHealthIntervalFlag = cmdline.Flag{
+	ID:           "instanceHealthIntervalFlag",
+	Value:        &healthInterval,
+	DefaultValue: "30s",
+	Name:         "health-interval",
+	Usage:        "time between two health checks, a check running longer fails",
+	EnvKeys:      []string{"HEALTH_INTERVAL"},
+}
+
+// --health-retries
+var instanceHealthRetriesFlag = cmdline.Flag{
+	ID:           "instanceHealthRetriesFlag",
+	Value:        &healthRetries,
+	DefaultValue: 3,
+	Name:         "health-retries",
+	Usage:        "number of consecutive failed health checks after which the instance is unhealthy",
+	EnvKeys:      []string{"HEALTH_RETRIES"},
+}
+
+// --log-max-size
+var instanceLogMaxSizeFlag = cmdline.Flag{
+	ID:           "instanceLogMaxSizeFlag",
+	Value:        &logMaxSize,
+	DefaultValue: "",
+	Name:         "log-max-size",
+	Usage:        "size from which the instance log files are rotated, e.g. 10M (default from apptainer.conf, 0 disables rotation)",
+	EnvKeys:      []string{"LOG_MAX_SIZE"},
+}
+
+// --log-max-files
+var instanceLogMaxFilesFlag = cmdline.Flag{
+	ID:           "instanceLogMaxFilesFlag",
+	Value:        &logMaxFiles,
+	DefaultValue: -1,
+	Name:         "log-max-files",
+	Usage:        "number of rotated instance log files kept (default from apptainer.conf)",
+	EnvKeys:      []string{"LOG_MAX_FILES"},
+}
+
+// --tty
+var instanceTTYFlag = cmdline.Flag{
+	ID:           "instanceTTYFlag",
+	Value:        &instanceTTY,
+	DefaultValue: false,
+	Name:         "tty",
+	Usage:        "allocate a pseudo-terminal for the instance process, to attach to it with 'instance attach'",
+}
+
 // execute either the instance start or run command
 func instanceAction(cmd *cobra.Command, args []string) {
 	image := args[0]
@@ -0,0 +1,49 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceAttachDetachKeysFlag, instanceAttachCmd)
+	})
+}
+
+// --detach-keys
+var instanceAttachDetachKeys string
+
+var instanceAttachDetachKeysFlag = cmdline.Flag{
+	ID:           "instanceAttachDetachKeysFlag",
+	Value:        &instanceAttachDetachKeys,
+	DefaultValue: apptainer.DefaultDetachKeys,
+	Name:         "detach-keys",
+	Usage:        "key sequence detaching from the instance, empty to disable detaching",
+	Tag:          "<keys>",
+	EnvKeys:      []string{"DETACH_KEYS"},
+}
+
+// apptainer instance attach
+var instanceAttachCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return apptainer.InstanceAttach(cmd.Context(), args[0], instanceAttachDetachKeys)
+	},
+
+	Use:     docs.InstanceAttachUse,
+	Short:   docs.InstanceAttachShort,
+	Long:    docs.InstanceAttachLong,
+	Example: docs.InstanceAttachExample,
+}
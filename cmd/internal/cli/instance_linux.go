@@ -24,6 +24,8 @@ func init() {
 		cmdManager.RegisterSubCmd(instanceCmd, instanceRunCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStopCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceListCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceLogsCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceAttachCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStatsCmd)
 	})
 }
@@ -0,0 +1,103 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceLogsFollowFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsTailFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsSinceFlag, instanceLogsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceLogsStreamFlag, instanceLogsCmd)
+	})
+}
+
+// -f|--follow
+var instanceLogsFollow bool
+
+var instanceLogsFollowFlag = cmdline.Flag{
+	ID:           "instanceLogsFollowFlag",
+	Value:        &instanceLogsFollow,
+	DefaultValue: false,
+	Name:         "follow",
+	ShortHand:    "f",
+	Usage:        "keep printing new log lines until the instance stops",
+}
+
+// -n|--tail
+var instanceLogsTail int
+
+var instanceLogsTailFlag = cmdline.Flag{
+	ID:           "instanceLogsTailFlag",
+	Value:        &instanceLogsTail,
+	DefaultValue: -1,
+	Name:         "tail",
+	ShortHand:    "n",
+	Usage:        "number of lines to show from the end of the logs (all lines by default)",
+	Tag:          "<lines>",
+}
+
+// --since
+var instanceLogsSince string
+
+var instanceLogsSinceFlag = cmdline.Flag{
+	ID:           "instanceLogsSinceFlag",
+	Value:        &instanceLogsSince,
+	DefaultValue: "",
+	Name:         "since",
+	Usage:        "show logs since a duration (e.g. 10m) or a timestamp (e.g. 2006-01-02T15:04:05)",
+	Tag:          "<duration|timestamp>",
+}
+
+// --stream
+var instanceLogsStream string
+
+var instanceLogsStreamFlag = cmdline.Flag{
+	ID:           "instanceLogsStreamFlag",
+	Value:        &instanceLogsStream,
+	DefaultValue: "",
+	Name:         "stream",
+	Usage:        "only show the logs of a stream (stdout or stderr)",
+	Tag:          "<stream>",
+}
+
+// apptainer instance logs
+var instanceLogsCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := apptainer.InstanceLogsOptions{
+			Follow: instanceLogsFollow,
+			Tail:   instanceLogsTail,
+			Stream: instanceLogsStream,
+		}
+		if instanceLogsSince != "" {
+			since, err := apptainer.ParseLogsSince(instanceLogsSince, time.Now())
+			if err != nil {
+				return err
+			}
+			opts.Since = since
+		}
+		return apptainer.InstanceLogs(cmd.Context(), os.Stdout, args[0], opts)
+	},
+
+	Use:     docs.InstanceLogsUse,
+	Short:   docs.InstanceLogsShort,
+	Long:    docs.InstanceLogsLong,
+	Example: docs.InstanceLogsExample,
+}
@@ -10,7 +10,9 @@
 package cli
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
@@ -20,14 +22,20 @@ import (
 )
 
 // Basic Design
-// apptainer instance stats <name>
+// apptainer instance stats [name]
 // apptainer instance stats --json <name>
+// apptainer instance stats --format json|csv --watch [--interval <seconds>] [name]
+// apptainer instance stats --serve <address> [name]
 
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&instanceStatsUserFlag, instanceStatsCmd)
 		cmdManager.RegisterFlagForCmd(&instanceStatsJSONFlag, instanceStatsCmd)
 		cmdManager.RegisterFlagForCmd(&instanceStatsNoStreamFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsFormatFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsWatchFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsIntervalFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsServeFlag, instanceStatsCmd)
 	})
 }
 
@@ -54,7 +62,7 @@ var instanceStatsJSONFlag = cmdline.Flag{
 	DefaultValue: false,
 	Name:         "json",
 	ShortHand:    "j",
-	Usage:        "output stats in json",
+	Usage:        "output the raw cgroup stats of an instance in json",
 }
 
 // --no-stream
@@ -69,9 +77,57 @@ var instanceStatsNoStreamFlag = cmdline.Flag{
 	Usage:        "disable streaming (live update) of instance stats",
 }
 
+// --format
+var instanceStatsFormat string
+
+var instanceStatsFormatFlag = cmdline.Flag{
+	ID:           "instanceStatsFormatFlag",
+	Value:        &instanceStatsFormat,
+	DefaultValue: apptainer.StatsFormatTable,
+	Name:         "format",
+	Usage:        "output format of stats (table, json or csv)",
+	Tag:          "<format>",
+}
+
+// -w|--watch
+var instanceStatsWatch bool
+
+var instanceStatsWatchFlag = cmdline.Flag{
+	ID:           "instanceStatsWatchFlag",
+	Value:        &instanceStatsWatch,
+	DefaultValue: false,
+	Name:         "watch",
+	ShortHand:    "w",
+	Usage:        "continuously output stats, the default with the table format",
+}
+
+// --interval
+var instanceStatsInterval int
+
+var instanceStatsIntervalFlag = cmdline.Flag{
+	ID:           "instanceStatsIntervalFlag",
+	Value:        &instanceStatsInterval,
+	DefaultValue: 1,
+	Name:         "interval",
+	Usage:        "interval between two samples of stats in seconds",
+	Tag:          "<seconds>",
+}
+
+// --serve
+var instanceStatsServe string
+
+var instanceStatsServeFlag = cmdline.Flag{
+	ID:           "instanceStatsServeFlag",
+	Value:        &instanceStatsServe,
+	DefaultValue: "",
+	Name:         "serve",
+	Usage:        "serve stats of all instances, or instances matching the name pattern, in Prometheus format at /metrics on the given address (e.g. :9100)",
+	Tag:          "<address>",
+}
+
 // apptainer instance stats
 var instanceStatsCmd = &cobra.Command{
-	Args:                  cobra.ExactArgs(1),
+	Args:                  cobra.RangeArgs(0, 1),
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		uid := os.Getuid()
@@ -81,9 +137,42 @@ var instanceStatsCmd = &cobra.Command{
 			sylog.Fatalf("Only the root user can look at stats of a user's instance")
 		}
 
-		// Instance name is the only arg
-		name := args[0]
-		return apptainer.InstanceStats(cmd.Context(), name, instanceStatsUser, instanceStatsJSON, instanceStatsNoStream)
+		// Serve the stats of all matching instances for scraping
+		if instanceStatsServe != "" {
+			name := "*"
+			if len(args) > 0 {
+				name = args[0]
+			}
+			return apptainer.ServeInstanceMetrics(cmd.Context(), instanceStatsServe, name, instanceStatsUser)
+		}
+
+		if instanceStatsWatch && instanceStatsNoStream {
+			return fmt.Errorf("--watch and --no-stream can't be used together")
+		}
+		if instanceStatsJSON && cmd.Flags().Changed("format") {
+			return fmt.Errorf("--json and --format can't be used together, use --format json instead")
+		}
+		if instanceStatsInterval <= 0 {
+			return fmt.Errorf("the interval must be a positive number of seconds")
+		}
+
+		// Stats of all instances are shown without an instance name
+		name := "*"
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		opts := apptainer.InstanceStatsOptions{
+			Format:   instanceStatsFormat,
+			RawJSON:  instanceStatsJSON,
+			Watch:    instanceStatsWatch,
+			Interval: time.Duration(instanceStatsInterval) * time.Second,
+		}
+		// The table is refreshed in place unless asking for a single timepoint
+		if instanceStatsFormat == apptainer.StatsFormatTable && !instanceStatsJSON && !instanceStatsNoStream {
+			opts.Watch = true
+		}
+		return apptainer.InstanceStats(cmd.Context(), name, instanceStatsUser, opts)
 	},
 
 	Use:     docs.InstanceStatsUse,
@@ -23,6 +23,14 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&overlayCreateDirFlag, OverlayCreateCmd)
 		cmdManager.RegisterFlagForCmd(&overlayFakerootFlag, OverlayCreateCmd)
 		cmdManager.RegisterFlagForCmd(&overlaySparseFlag, OverlayCreateCmd)
+
+		cmdManager.RegisterSubCmd(OverlayCmd, OverlayInspectCmd)
+		cmdManager.RegisterSubCmd(OverlayCmd, OverlayResizeCmd)
+		cmdManager.RegisterSubCmd(OverlayCmd, OverlaySealCmd)
+		cmdManager.RegisterSubCmd(OverlayCmd, OverlayMergeCmd)
+
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, OverlayResizeCmd, OverlaySealCmd, OverlayMergeCmd)
+		cmdManager.RegisterFlagForCmd(&overlayResizeSizeFlag, OverlayResizeCmd)
 	})
 }
 
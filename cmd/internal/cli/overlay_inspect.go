@@ -0,0 +1,40 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// OverlayInspectCmd is the 'overlay inspect' command that shows the overlay
+// partitions of an image and the changes of its writable overlay.
+var OverlayInspectCmd = &cobra.Command{
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		base := ""
+		if len(args) > 1 {
+			base = args[1]
+		}
+		if err := apptainer.OverlayInspect(os.Stdout, args[0], base); err != nil {
+			sylog.Fatalf("%v", err.Error())
+		}
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.OverlayInspectUse,
+	Short:   docs.OverlayInspectShort,
+	Long:    docs.OverlayInspectLong,
+	Example: docs.OverlayInspectExample,
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var overlayResizeSize int
+
+// -s|--size
+var overlayResizeSizeFlag = cmdline.Flag{
+	ID:           "overlayResizeSizeFlag",
+	Value:        &overlayResizeSize,
+	DefaultValue: 0,
+	Name:         "size",
+	ShortHand:    "s",
+	Usage:        "new size of the EXT3 writable overlay in MiB",
+	Required:     true,
+}
+
+// OverlayResizeCmd is the 'overlay resize' command that allows to resize a
+// writable overlay.
+var OverlayResizeCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if err := apptainer.OverlayResize(args[0], tmpDir, overlayResizeSize); err != nil {
+			sylog.Fatalf("%v", err.Error())
+		}
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.OverlayResizeUse,
+	Short:   docs.OverlayResizeShort,
+	Long:    docs.OverlayResizeLong,
+	Example: docs.OverlayResizeExample,
+}
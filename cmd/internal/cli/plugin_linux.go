@@ -26,6 +26,7 @@ func init() {
 		cmdManager.RegisterSubCmd(PluginCmd, PluginEnableCmd)
 		cmdManager.RegisterSubCmd(PluginCmd, PluginDisableCmd)
 		cmdManager.RegisterSubCmd(PluginCmd, PluginCompileCmd)
+		cmdManager.RegisterSubCmd(PluginCmd, PluginPackCmd)
 		cmdManager.RegisterSubCmd(PluginCmd, PluginInspectCmd)
 		cmdManager.RegisterSubCmd(PluginCmd, PluginCreateCmd)
 	})
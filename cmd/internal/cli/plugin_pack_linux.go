@@ -0,0 +1,55 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, PluginPackCmd)
+		cmdManager.RegisterFlagForCmd(&pluginCompileOutFlag, PluginPackCmd)
+	})
+}
+
+// PluginPackCmd allows a user to pack an executable plugin.
+//
+// apptainer plugin pack <executable> [-o name]
+var PluginPackCmd = &cobra.Command{
+	Run: func(_ *cobra.Command, args []string) {
+		executable, err := filepath.Abs(args[0])
+		if err != nil {
+			sylog.Fatalf("While sanitizing input path: %s", err)
+		}
+
+		destSif := out
+		if destSif == "" {
+			destSif = executable + ".sif"
+		}
+
+		sylog.Debugf("executable: %s; sifPath: %s", executable, destSif)
+		if err := apptainer.PackPlugin(executable, destSif, tmpDir); err != nil {
+			sylog.Fatalf("Plugin pack failed with error: %s", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.PluginPackUse,
+	Short:   docs.PluginPackShort,
+	Long:    docs.PluginPackLong,
+	Example: docs.PluginPackExample,
+}
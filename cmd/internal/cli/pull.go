@@ -47,6 +47,8 @@ const (
 	OrasProtocol = "oras"
 	// IPFSProtocol holds the ipfs URI.
 	IPFSProtocol = "ipfs"
+	// DockerProtocol holds the docker registry URI.
+	DockerProtocol = "docker"
 )
 
 var (
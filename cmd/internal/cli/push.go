@@ -16,6 +16,7 @@ import (
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/client/library"
+	"github.com/apptainer/apptainer/internal/pkg/client/oci"
 	"github.com/apptainer/apptainer/internal/pkg/client/oras"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/signature"
@@ -81,6 +82,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, PushCmd)
 		cmdManager.RegisterFlagForCmd(&commonAuthFileFlag, PushCmd)
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, PushCmd)
 	})
 }
 
@@ -172,6 +174,25 @@ var PushCmd = &cobra.Command{
 				sylog.Fatalf("Unable to push image to oci registry: %v", err)
 			}
 			sylog.Infof("Upload complete")
+		case DockerProtocol:
+			if cmd.Flag(pushDescriptionFlag.Name).Changed {
+				sylog.Warningf("Description is not supported for push to docker. Ignoring it.")
+			}
+			ociAuth, err := makeOCICredentials(cmd)
+			if err != nil {
+				sylog.Fatalf("Unable to make docker oci credentials: %s", err)
+			}
+
+			pushOpts := oci.PushOptions{
+				TmpDir:      tmpDir,
+				OciAuth:     ociAuth,
+				NoHTTPS:     noHTTPS,
+				ReqAuthFile: reqAuthFile,
+			}
+			if err := oci.Push(cmd.Context(), file, strings.TrimPrefix(ref, "//"), pushOpts); err != nil {
+				sylog.Fatalf("Unable to push image to oci registry: %v", err)
+			}
+			sylog.Infof("Upload complete")
 		case "":
 			sylog.Fatalf("Transport type URI required but not supplied")
 		default:
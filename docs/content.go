@@ -49,6 +49,16 @@ Enterprise Performance Computing (EPC)`
   container, and then build it as a default Apptainer image for production
   use. The default format is immutable.
 
+  The root filesystem of the default format is squashfs, --fs-type erofs
+  creates an EROFS root filesystem instead with mkfs.erofs, which gives faster
+  random reads of large file trees. EROFS images are mounted by the kernel,
+  or by erofsfuse in unprivileged mode, and can't be encrypted.
+
+  An encrypted root filesystem (--encrypt) can be decrypted by the
+  --passphrase or --pem-path key, and by the private key of each public key
+  given with --recipient. Recipients and passphrases can be changed later
+  with "apptainer image rekey".
+
   BUILD SPEC:
 
   The build spec target is a definition (def) file, local image, or URI that can 
@@ -56,6 +66,8 @@ Enterprise Performance Computing (EPC)`
   formats exist:
 
       def file  : This is a recipe for building a container (examples below)
+      Dockerfile: A Dockerfile, translated to a def file and built without a
+                  BuildKit daemon, its directory being the build context
       buildkit:   A build context directory, containing a Dockerfile to build
       directory:  A directory structure containing a (ch)root file system
       image:      A local image on your machine (will convert to sif if
@@ -69,6 +81,31 @@ Enterprise Performance Computing (EPC)`
       oras://     an OCI registry that holds SIF files using ORAS
       ipfs://     an IPFS cluster, using a HTTP gateway
 
+  Dockerfiles:
+
+  FROM, RUN, COPY, ADD, ENV, ARG, WORKDIR, ENTRYPOINT, CMD, LABEL, SHELL and
+  multi-stage builds are supported, ARG values being set with --build-arg.
+  COPY and ADD files are copied before RUN commands are executed, USER,
+  EXPOSE, VOLUME and HEALTHCHECK are ignored. Use 'apptainer deffile convert
+  --to def Dockerfile' to show the translated def file.
+
+  Multi-stage builds:
+
+  The last stage of a multi-stage definition file is built into the image by
+  default, --target builds the named stage instead, e.g. to produce a debug or
+  toolchain image and a slim runtime image from the same definition file. Only
+  the stages it copies files from with '%files from' are built along with it.
+
+  Build cache:
+
+  With --build-cache, the root filesystem of each stage is saved to the 'build'
+  type of the cache after its %post section, and reused by later builds instead
+  of copying files and running %setup and %post again. A stage is reused if its
+  base image digest, %files sources, %setup and %post sections, with build
+  arguments substituted, are unchanged. Only stages bootstrapped from OCI
+  sources or scratch are cached. The build cache can also be enabled by setting
+  APPTAINER_BUILD_CACHE, use --no-build-cache to bypass it.
+
   Temporary files:
   
   The location used for temporary directories defaults to '/tmp' but
@@ -178,6 +215,15 @@ Enterprise Performance Computing (EPC)`
       Build a sif file from an Apptainer recipe file:
           $ apptainer build /tmp/debian0.sif /path/to/debian.def
 
+      Build a sif file from a Dockerfile:
+          $ apptainer build /tmp/app.sif /path/to/Dockerfile
+
+      Build a sif file from the stage named "devel" of a multi-stage definition file:
+          $ apptainer build --target devel /tmp/devel.sif /path/to/app.def
+
+      Build a sif file reusing unchanged stages from the build cache:
+          $ apptainer build --build-cache /tmp/debian0.sif /path/to/debian.def
+
       Build a sif image from the Library:
           $ apptainer build /tmp/debian1.sif library://debian:latest
 
@@ -233,6 +279,127 @@ Enterprise Performance Computing (EPC)`
   $ apptainer help cache list --type=library,oci
   $ apptainer cache list --help`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Export
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheExportUse   string = `export [export options...] <archive> [image reference...]`
+	CacheExportShort string = `Export entries of your local Apptainer cache to an archive`
+	CacheExportLong  string = `
+  This will write entries of your local cache to a single archive, along with a
+  manifest listing the digest and source of each entry, to be imported in the
+  cache of another host with 'apptainer cache import', e.g. a host without
+  network access.
+
+  When image references are given, only the cache entries pulled from these
+  references are exported, including the OCI blobs of images fetched during
+  builds. References must be given as they were pulled. Otherwise, all entries
+  of the types selected with --type are exported.`
+	CacheExportExample string = `
+  $ apptainer pull docker://alpine:3.20
+  $ apptainer cache export alpine.tar docker://alpine:3.20
+  $ apptainer cache export --type=library,oras images.tar`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Import
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheImportUse   string = `import <archive>`
+	CacheImportShort string = `Import an archive created with 'cache export' into your local Apptainer cache`
+	CacheImportLong  string = `
+  This will add the entries of an archive created with 'apptainer cache export'
+  to your local cache, verifying their content against the digests listed in
+  the archive. Entries already in the cache are skipped.
+
+  When the source of an image can't be reached, a pull or build of the same
+  image reference uses the imported entry.`
+	CacheImportExample string = `
+  $ apptainer cache import alpine.tar
+  $ apptainer pull docker://alpine:3.20`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// deffile
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DeffileUse   string = `deffile`
+	DeffileShort string = `Check and format definition files`
+	DeffileLong  string = `
+  The deffile command allows you to check definition files for common mistakes
+  and to rewrite them in a canonical form.`
+	DeffileExample string = `
+  All group commands have their own help output:
+
+  $ apptainer help deffile lint
+  $ apptainer deffile fmt --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// deffile fmt
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DeffileFmtUse   string = `fmt [fmt options...] <definition file>...`
+	DeffileFmtShort string = `Format definition files`
+	DeffileFmtLong  string = `
+  This will print the definition file in canonical form on the standard
+  output, or write it back to the file with --write:
+
+    - header keywords are written first, starting with Bootstrap and From,
+    - sections are written in the order %arguments, %pre, %setup, %files,
+      %environment, %post, %runscript, %startscript, %test, %labels, %help,
+      followed by the sections of each SCIF app,
+    - %files and %labels entries are indented by four spaces, scripts are
+      kept as is, as their indentation can be significant, e.g. in Python
+      scripts and here-documents.
+
+  Comments are kept in scripts, but comments in the header, %files and %labels
+  sections are lost.`
+	DeffileFmtExample string = `
+  $ apptainer deffile fmt alpine.def
+  $ apptainer deffile fmt --write alpine.def debian.def`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// deffile lint
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DeffileLintUse   string = `lint <definition file>...`
+	DeffileLintShort string = `Check definition files for common mistakes`
+	DeffileLintLong  string = `
+  This will report the problems found in definition files with their line
+  number and the name of the rule that found them:
+
+    header             unknown header keywords, or keywords not used by the
+                       bootstrap agent
+    section            unknown sections
+    duplicate-section  sections, e.g. %post or %appinstall, defined twice in
+                       a build stage
+    files              %files and %appfiles sources missing on the host,
+                       relative paths are resolved against the current
+                       directory
+    build-args         %arguments never used as {{ }} build arguments
+    errexit            %pre, %setup and %post scripts run with a custom shell
+                       (-c) which don't exit on errors (-e or 'set -e')
+
+  The command exits with a non-zero status if any problem is found. The same
+  checks are run before a build with 'apptainer build --lint'.`
+	DeffileLintExample string = `
+  $ apptainer deffile lint alpine.def
+  $ apptainer build --lint alpine.sif alpine.def`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// deffile convert
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DeffileConvertUse   string = `convert [convert options...] <file>`
+	DeffileConvertShort string = `Convert definition files to JSON and back`
+	DeffileConvertLong  string = `
+  This will print a definition file converted to JSON with --to json, or a
+  JSON definition converted back to a definition file with --to def, to
+  generate or modify build recipes with other tools. Use '-' to read from the
+  standard input. A Dockerfile is translated to a definition file, as done by
+  'apptainer build', before being converted.
+
+  The JSON representation is an array with an object for each build stage of
+  the definition file, holding its header, sections and SCIF apps. When
+  converted back, a single object is also accepted and the definition file is
+  written in the canonical form of 'apptainer deffile fmt'.`
+	DeffileConvertExample string = `
+  $ apptainer deffile convert --to json alpine.def > alpine.json
+  $ jq '.[0].header.from = "alpine:3.20"' alpine.json | apptainer deffile convert --to def - > alpine.def
+  $ apptainer deffile convert --to def Dockerfile`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -514,6 +681,32 @@ Enterprise Performance Computing (EPC)`
   $ apptainer exec instance://my_instance ps -ef
   $ apptainer exec library://centos cat /etc/os-release`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// events
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	EventsUse   string = `events [events options...]`
+	EventsShort string = `Stream the lifecycle events of containers`
+	EventsLong  string = `
+  The events command prints the lifecycle events of the containers and
+  instances run by the current user on this host, as they happen, until it's
+  interrupted. Events are read from an event log in ~/.apptainer/instances/events,
+  written by both the apptainer and oci engines.
+
+  The following events are logged:
+    start          the container process started
+    exit           the container exited, with its exit code and signal
+    oom            processes of the container cgroup were killed by the out
+                   of memory killer
+    restart        an instance process was restarted by its restart policy
+    health_status  the health of an instance changed
+    checkpoint     an instance was checkpointed
+
+  With --since, the logged events since the given time are printed first.
+  With --json, each event is printed as a json object on its own line.`
+	EventsExample string = `
+  $ apptainer events
+  $ apptainer events --since 1h --json`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -528,6 +721,29 @@ Enterprise Performance Computing (EPC)`
   $ apptainer help instance start
   $ apptainer instance start --help`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance attach
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceAttachUse   string = `attach [attach options...] <instance name>`
+	InstanceAttachShort string = `Attach to the terminal of a named instance`
+	InstanceAttachLong  string = `
+  The instance attach command connects the standard input and output to the
+  terminal of a named instance started with --tty. The instance output keeps
+  being written to its log file while attached, and several clients can be
+  attached to the same instance.
+
+  Typing the detach key sequence, ctrl-p followed by ctrl-q by default,
+  detaches from the instance and leaves it running. The sequence is a comma
+  separated list of keys, each being a single character or ctrl-<value> with
+  value a letter or one of @, [, \, ], ^ and _. An empty sequence disables
+  detaching.
+
+  The size of the instance terminal follows the size of the attached terminal.`
+	InstanceAttachExample string = `
+  $ apptainer instance start --tty /tmp/my-shell.sif myshell
+  $ apptainer instance attach myshell
+  $ apptainer instance attach --detach-keys ctrl-x,x myshell`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance list
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -553,6 +769,29 @@ Enterprise Performance Computing (EPC)`
   test               11963     /home/mibauer/apptainer/sinstance/test.sif
   test2              16219     /home/mibauer/apptainer/sinstance/test.sif`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance logs
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceLogsUse   string = `logs [logs options...] <instance name>`
+	InstanceLogsShort string = `Show the logs of a named instance`
+	InstanceLogsLong  string = `
+  The instance logs command prints the standard output and error logs of a
+  named instance, merged in a single view. Logs remain available once the
+  instance has stopped, and the logs of instances started again with the same
+  name are appended to them.
+
+  Log lines written by a log formatter (basic, kubernetes or json) are parsed
+  back to their content, ordered by their timestamp. Lines without timestamp
+  are always shown, --since only filters timestamped lines.
+
+  With --follow, new log lines are printed as they're written, until the
+  instance stops or the command is interrupted.`
+	InstanceLogsExample string = `
+  $ apptainer instance logs mysql
+  $ apptainer instance logs --tail 20 --follow mysql
+  $ apptainer instance logs --since 10m --stream stderr mysql
+  $ apptainer instance logs --since 2024-01-02T15:04:05 mysql`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance start
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -565,6 +804,24 @@ Enterprise Performance Computing (EPC)`
   will be executed with the instance start command as well. You can optionally
   pass arguments to startscript.
 
+  With --restart on-failure[:N], the startscript is restarted when it fails, at
+  most N times if given, and with --restart always whenever it exits. With
+  --health-cmd, a shell command is run inside the instance every
+  --health-interval, and the instance becomes unhealthy after --health-retries
+  consecutive failures, in which case it's restarted if it has a restart
+  policy. The restart count and last health check result are shown by
+  instance list --json.
+
+  The instance output is written to log files in ~/.apptainer/instances/logs.
+  With --log-max-size, or the "instance log max size" directive of
+  apptainer.conf, a log file is rotated while the instance keeps running when
+  it would grow beyond this size, and at most --log-max-files rotated files
+  are kept.
+
+  With --tty, the instance process runs with a pseudo-terminal as standard
+  input and output, which can be attached to with instance attach. The
+  terminal output is written to the standard output log file.
+
   apptainer instance start accepts the following container formats` + formats
 	InstanceStartExample string = `
   $ apptainer instance start /tmp/my-sql.sif mysql
@@ -580,7 +837,10 @@ Enterprise Performance Computing (EPC)`
   Apptainer my-sql.sif>
 
   $ apptainer instance stop /tmp/my-sql.sif mysql
-  Stopping /tmp/my-sql.sif mysql`
+  Stopping /tmp/my-sql.sif mysql
+
+  $ apptainer instance start --restart on-failure:5 \
+      --health-cmd "mysqladmin ping" --health-interval 10s /tmp/my-sql.sif mysql`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance run
@@ -618,19 +878,37 @@ Enterprise Performance Computing (EPC)`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance stats
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-	InstanceStatsUse   string = `stats [stats options...] <instance name>`
-	InstanceStatsShort string = `Get stats for a named instance`
+	InstanceStatsUse   string = `stats [stats options...] [instance name]`
+	InstanceStatsShort string = `Get stats for instances`
 	InstanceStatsLong  string = `
   The instance stats command allows you to get statistics for a named instance,
-  either printed to the terminal or in json. If you are root, you can optionally
-  ask for statistics for a container instance belonging to a specific user. If
-  you add --no-stream, you will only see one timepoint. Asking for json implies
-  the same.`
+  for the instances matching a name pattern, or for all instances if no name
+  is given. If you are root, you can optionally ask for statistics for
+  container instances belonging to a specific user.
+
+  Statistics are printed as a table refreshed every interval (1 second by
+  default, see --interval). If you add --no-stream, you will only see one
+  timepoint. With --format json or --format csv, a single timepoint is
+  printed as JSON lines or CSV rows, one per instance, and --watch appends a
+  new timepoint every interval, which is suited for logging to a file. While
+  watching, instances started later are shown, and instances stopped are
+  removed.
+
+  The --json option prints the raw cgroup statistics of a single instance, for
+  a single timepoint.
+
+  With --serve, the statistics of all instances, or of the instances matching
+  an optional name pattern, are served in the Prometheus text format at
+  /metrics on the given address, until interrupted. Instances are listed on
+  each scrape, and only instances started with cgroups are exported.`
 	InstanceStatsExample string = `
+  $ apptainer instance stats
   $ apptainer instance stats mysql
   $ apptainer instance stats --json mysql
-  $ apptainer instance stats --no-stream mysql
-  $ sudo apptainer instance stats --user <username> user-mysql`
+  $ apptainer instance stats --no-stream 'mysql*'
+  $ apptainer instance stats --format csv --watch --interval 10 > stats.csv
+  $ sudo apptainer instance stats --user <username> user-mysql
+  $ apptainer instance stats --serve :9100`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance stop
@@ -715,6 +993,13 @@ Enterprise Performance Computing (EPC)`
   oras:
       oras://registry/namespace/image:tag
 
+  docker:
+      docker://registry/namespace/image:tag
+
+      The SIF root filesystem is converted into a native OCI image, with
+      labels taken from the SIF metadata and the runscript as entrypoint,
+      so that it can be run by other OCI container runtimes.
+
 
   NOTE: It's always good practice to sign your containers before
   pushing them to the library. An auth token is required to push to the library,
@@ -724,7 +1009,10 @@ Enterprise Performance Computing (EPC)`
   $ apptainer push /home/user/my.sif library://user/collection/my.sif:latest
 
   To supported OCI registry
-  $ apptainer push /home/user/my.sif oras://registry/namespace/image:tag`
+  $ apptainer push /home/user/my.sif oras://registry/namespace/image:tag
+
+  To OCI registry as a native OCI image
+  $ apptainer push /home/user/my.sif docker://registry/namespace/image:tag`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// search
@@ -869,6 +1157,25 @@ Enterprise Performance Computing (EPC)`
   $ apptainer run-help --app foo my_container.sif
 
     Some help for application in this container`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Diff
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DiffUse   string = `diff [diff options...] <old image path> <new image path>`
+	DiffShort string = `Show the differences between two images`
+	DiffLong  string = `
+  Diff compares the files of two images, SIF, squashfs, ext3 or sandbox images,
+  and shows the files added (A), removed (D) or modified (M) in the new image,
+  with their changed type, mode, owner, size, content hash or link target. The
+  differences of the labels, the environment scripts and the runscript of the
+  images follow. The image partitions are read directly without mounting them,
+  the read-only overlay layers of SIF images are applied to their root filesystem
+  but writable overlays are not compared. Use the --json flag to print the
+  differences in json format.`
+	DiffExample string = `
+  $ apptainer diff old.sif new.sif
+
+  To compare an image with the sandbox it was built from, as json:
+  $ apptainer diff --json my_sandbox/ my_container.sif`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Inspect
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -1140,7 +1447,8 @@ Enterprise Performance Computing (EPC)`
 	OverlayUse   string = `overlay`
 	OverlayShort string = `Manage an EXT3 writable overlay image`
 	OverlayLong  string = `
-  The overlay command allows management of EXT3 writable overlay images.`
+  The overlay command allows management of EXT3 writable overlay images, and
+  of the read-only overlay layers they are sealed into in SIF images.`
 	OverlayExample string = `
   All overlay commands have their own help output:
 
@@ -1165,6 +1473,102 @@ Enterprise Performance Computing (EPC)`
   To create an EXT3 writable overlay image for use with --fakeroot actions:
   $ apptainer overlay create --fakeroot --size 1024 /tmp/my_overlay.img`
 
+	OverlayInspectUse   string = `inspect <options> image [base image]`
+	OverlayInspectShort string = `Show the overlay partitions and changes of an image`
+	OverlayInspectLong  string = `
+  The overlay inspect command shows the size and usage of the overlay
+  partitions of a SIF image, or of an EXT3 writable overlay image, followed by
+  the files changed in the writable overlay. Changed files are marked A when
+  added, M when modified and D when deleted compared to the root filesystem and
+  the read-only overlay layers of the image. For a single EXT3 overlay image,
+  changes are compared to the optional base image, and marked C without it.`
+	OverlayInspectExample string = `
+  To inspect the overlay partitions of a SIF image:
+  $ apptainer overlay inspect /tmp/image.sif
+
+  To inspect an EXT3 writable overlay image used with a container image:
+  $ apptainer overlay inspect /tmp/my_overlay.img /tmp/image.sif`
+
+	OverlayResizeUse   string = `resize <options> image`
+	OverlayResizeShort string = `Resize an EXT3 writable overlay image`
+	OverlayResizeLong  string = `
+  The overlay resize command grows or shrinks an EXT3 writable overlay image, or
+  the writable overlay partition of a SIF image, to the given size. It fails if
+  the overlay is in use, its filesystem is checked first with e2fsck and resized
+  with resize2fs. Shrinking fails if the overlay content doesn't fit in the new
+  size.`
+	OverlayResizeExample string = `
+  To resize the writable overlay partition of a SIF image to 2 GiB:
+  $ apptainer overlay resize --size 2048 /tmp/image.sif
+
+  To resize a single EXT3 writable overlay image:
+  $ apptainer overlay resize --size 512 /tmp/my_overlay.img`
+
+	OverlaySealUse   string = `seal <options> image`
+	OverlaySealShort string = `Seal the writable overlay of a SIF image into a read-only layer`
+	OverlaySealLong  string = `
+  The overlay seal command packs the content of the writable overlay partition
+  of a SIF image into a squashfs read-only overlay layer, which replaces the
+  writable overlay partition. The layer is stacked on top of the root
+  filesystem and the previously sealed layers when the container runs, a new
+  writable overlay can be added with 'overlay create'. Signed images and images
+  in use can't be sealed, mksquashfs 4.6 or later is required to keep the ownership of the
+  overlay root directory and the extended attributes.`
+	OverlaySealExample string = `
+  To freeze the changes made in the writable overlay of a SIF image:
+  $ apptainer overlay seal /tmp/image.sif`
+
+	OverlayMergeUse   string = `merge <options> image`
+	OverlayMergeShort string = `Merge the read-only overlay layers of a SIF image`
+	OverlayMergeLong  string = `
+  The overlay merge command merges the read-only overlay layers of a SIF image,
+  created by 'overlay seal', into a single layer replacing them. Files deleted
+  or replaced in an upper layer are removed from the merged layer, the image
+  must not have a writable overlay partition nor be in use.`
+	OverlayMergeExample string = `
+  To merge the sealed overlay layers of a SIF image:
+  $ apptainer overlay merge /tmp/image.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// image
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	ImageUse   string = `image`
+	ImageShort string = `Manage SIF images`
+	ImageLong  string = `
+  The image command allows management of SIF images.`
+	ImageExample string = `
+  All image commands have their own help output:
+
+  $ apptainer help image rekey
+  $ apptainer image rekey --help`
+
+	ImageRekeyUse   string = `rekey [rekey options...] <image path>`
+	ImageRekeyShort string = `Change the keys able to decrypt an encrypted SIF image`
+	ImageRekeyLong  string = `
+  The image rekey command adds or removes the RSA public keys (recipients)
+  and the passphrase able to decrypt the root filesystem of an encrypted SIF
+  image. Only the encrypted copies of the filesystem key stored in the SIF
+  are rewritten, the filesystem itself isn't re-encrypted.
+
+  The image is unlocked with --pem-path, --passphrase or the corresponding
+  APPTAINER_ENCRYPTION_* environment variable. The new passphrase is
+  prompted for with --new-passphrase, or read from the
+  APPTAINER_ENCRYPTION_NEW_PASSPHRASE environment variable.
+
+  The filesystem key of an image built with --passphrase by an older version
+  is the passphrase itself, its passphrase can't be changed or removed, the
+  image must be rebuilt instead. A rekey modifies signed SIF objects, a
+  signed image must be signed again.`
+	ImageRekeyExample string = `
+  To add a recipient to an image encrypted with a RSA key:
+  $ apptainer image rekey --pem-path private.pem --add-recipient alice.pub image.sif
+
+  To remove a recipient:
+  $ apptainer image rekey --pem-path private.pem --remove-recipient bob.pub image.sif
+
+  To add a passphrase to an image encrypted with a RSA key:
+  $ apptainer image rekey --pem-path private.pem --new-passphrase image.sif`
+
 	CheckpointUse   string = `checkpoint`
 	CheckpointShort string = `Manage container checkpoint state (experimental)`
 	CheckpointLong  string = `
@@ -1201,14 +1605,35 @@ Enterprise Performance Computing (EPC)`
   To delete a checkpoint:
   $ apptainer checkpoint delete example-checkpoint`
 
-	CheckpointInstanceUse   string = `instance <instance-name>`
+	CheckpointInstanceUse   string = `instance [instance options...] <instance-name>`
 	CheckpointInstanceShort string = `Checkpoint the state of a running instance (experimental)`
 	CheckpointInstanceLong  string = `
-  The checkpoint instance command checkpoints an active instance by name. The instance must
-  have been started with either --dmtcp-launch or --dmtcp-restart.`
+  The checkpoint instance command checkpoints an active instance by name. With the
+  default dmtcp backend, the instance must have been started with either --dmtcp-launch
+  or --dmtcp-restart.
+
+  With the criu backend, any instance can be checkpointed: its process tree and
+  namespaces are dumped by CRIU to a checkpoint named after the instance, and the
+  instance is stopped unless --leave-running is specified. CRIU requires root
+  privileges or the CAP_CHECKPOINT_RESTORE capability, and can't dump images mounted
+  with FUSE.`
 	CheckpointInstanceExample string = `
   To checkpoint an instance:
-  $ apptainer checkpoint instance example-instance`
+  $ apptainer checkpoint instance example-instance
+
+  To checkpoint an instance with CRIU:
+  $ apptainer checkpoint instance --backend criu example-instance`
+
+	CheckpointRestoreUse   string = `restore [restore options...] <name>`
+	CheckpointRestoreShort string = `Restore an instance from a checkpoint (experimental)`
+	CheckpointRestoreLong  string = `
+  The checkpoint restore command restores the instance saved in a checkpoint created
+  with 'checkpoint instance --backend criu'. The instance processes are restored with
+  their original PIDs, which must not be in use. DMTCP checkpoints are restored by
+  starting an instance with --dmtcp-restart.`
+	CheckpointRestoreExample string = `
+  To restore an instance:
+  $ apptainer checkpoint restore --backend criu example-instance`
 )
 
 // Documentation for sif/siftool command.
@@ -35,10 +35,28 @@ const (
   $ apptainer plugin compile $HOME/apptainer/test-plugin`
 )
 
+// Plugin pack command usage.
+const (
+	PluginPackUse   string = `pack [pack options...] <executable>`
+	PluginPackShort string = `Pack an executable Apptainer plugin`
+	PluginPackLong  string = `
+  The 'plugin pack' command packs an executable plugin into a SIF file ready to
+  be installed. Executable plugins don't need to be compiled against Apptainer,
+  they're run for each callback and speak a versioned JSON protocol over their
+  standard input and output. The plugin manifest and the callbacks it
+  implements are requested from the executable with the "init" method.
+
+  The supported callbacks are "cli.Command" to add flags to commands,
+  "cli.ApptainerEngineConfig" to modify the runtime engine configuration and
+  "apptainer.PostStartProcess" to run once the container process started.`
+	PluginPackExample string = `
+  $ apptainer plugin pack -o my-plugin.sif ./my-plugin`
+)
+
 // Plugin install command usage.
 const (
 	PluginInstallUse   string = `install <plugin_path>`
-	PluginInstallShort string = `Install a compiled Apptainer plugin`
+	PluginInstallShort string = `Install a compiled or packed Apptainer plugin`
 	PluginInstallLong  string = `
   The 'plugin install' command installs the compiled plugin found at plugin_path
   into the appropriate directory on the host.`
@@ -145,6 +145,48 @@ func (c ctx) testPushCmd(t *testing.T) {
 	}
 }
 
+func (c ctx) testPushDocker(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpdir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "push_docker-", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			cleanup(t)
+		}
+	})
+
+	dstURI := fmt.Sprintf("docker://%s/standard_sif_oci:test", c.env.InsecureRegistry)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("push"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("push"),
+		e2e.WithArgs(c.env.ImagePath, dstURI),
+		e2e.ExpectExit(0),
+	)
+
+	// pull back the native OCI image, which must run like the original
+	pulledImage := filepath.Join(tmpdir, "pulled.sif")
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("pull"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("pull"),
+		e2e.WithArgs("--no-https", pulledImage, dstURI),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("exec"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs(pulledImage, "true"),
+		e2e.ExpectExit(0),
+	)
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -154,5 +196,6 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	return testhelper.Tests{
 		"invalid transport": c.testInvalidTransport,
 		"oras":              c.testPushCmd,
+		"docker":            c.testPushDocker,
 	}
 }
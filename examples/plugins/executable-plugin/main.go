@@ -0,0 +1,94 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// This is an example of executable plugin, it's built as a regular program
+// and doesn't need to be rebuilt when Apptainer is upgraded:
+//
+//	$ go build -o executable-plugin .
+//	$ apptainer plugin pack executable-plugin
+//	$ sudo apptainer plugin install executable-plugin.sif
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+)
+
+var manifest = pluginapi.Manifest{
+	Name:        "example.com/executable-plugin",
+	Author:      "Apptainer Team",
+	Version:     "0.1.0",
+	Description: "This is a short example executable plugin for Apptainer",
+}
+
+func main() {
+	var req pluginapi.Request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintf(os.Stderr, "executable-plugin: while decoding request: %s\n", err)
+		os.Exit(1)
+	}
+
+	resp := pluginapi.Response{Version: pluginapi.ProtocolVersion}
+	result, err := handle(req)
+	if err != nil {
+		resp.Error = err.Error()
+	} else if result != nil {
+		resp.Result, err = json.Marshal(result)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "executable-plugin: while encoding response: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func handle(req pluginapi.Request) (interface{}, error) {
+	if req.Version != pluginapi.ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d", req.Version)
+	}
+
+	switch req.Method {
+	case pluginapi.MethodInit:
+		return pluginapi.InitResult{
+			Manifest: manifest,
+			Callbacks: []string{
+				pluginapi.MethodCommand,
+				pluginapi.MethodApptainerEngineConfig,
+			},
+		}, nil
+	case pluginapi.MethodCommand:
+		return pluginapi.CommandResult{
+			Flags: []pluginapi.FlagSpec{
+				{
+					Name:     "hello",
+					Usage:    "say hello before starting the container",
+					Type:     pluginapi.FlagTypeBool,
+					Commands: []string{"actions_instance"},
+				},
+			},
+		}, nil
+	case pluginapi.MethodApptainerEngineConfig:
+		var params pluginapi.EngineConfigParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if hello, _ := params.Flags["hello"].(bool); hello {
+			fmt.Fprintln(os.Stderr, "Hello from the executable plugin!")
+		}
+		// the configuration is returned unchanged
+		return pluginapi.EngineConfigResult{Config: params.Config}, nil
+	default:
+		return nil, fmt.Errorf("unknown method %q", req.Method)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/client/library"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+)
+
+// normalizeSource returns the image reference as recorded as source of cache
+// entries, e.g. with the default tag of library references.
+func normalizeSource(ref string) string {
+	if strings.HasPrefix(ref, "library:") {
+		if r, err := library.NormalizeLibraryRef(ref); err == nil {
+			return r.String()
+		}
+	}
+	return ref
+}
+
+// ExportApptainerCache writes the cache entries of the types specified by
+// cacheTypes, and pulled from the image references refs, to a cache archive
+// at path. If cacheTypes contains the value "all" or is empty, entries of all
+// types are considered. If refs is empty, entries are selected by type only.
+func ExportApptainerCache(imgCache *cache.Handle, path string, cacheTypes, refs []string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	if slice.ContainsString(cacheTypes, "all") {
+		cacheTypes = nil
+	}
+	sources := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		sources = append(sources, normalizeSource(ref))
+	}
+
+	entries, err := imgCache.SelectEntries(cacheTypes, sources)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no cache entries to export")
+	}
+
+	var size int64
+	found := make(map[string]bool)
+	for _, e := range entries {
+		size += e.Size
+		found[e.Source] = true
+	}
+	for i, s := range sources {
+		if !found[s] {
+			sylog.Warningf("No cache entry pulled from %s, it must be pulled with the same reference first", refs[i])
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("while creating cache archive: %v", err)
+	}
+	if err := imgCache.Export(f, entries); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("while writing cache archive: %v", err)
+	}
+
+	sylog.Infof("Exported %d cache entries using %s to %s", len(entries), fs.FindSize(size), path)
+	return nil
+}
+
+// ImportApptainerCache adds the entries of the cache archive at path to the
+// cache. Entries already present in the cache are skipped.
+func ImportApptainerCache(imgCache *cache.Handle, path string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("while opening cache archive: %v", err)
+	}
+	defer f.Close()
+
+	imported, err := imgCache.Import(f)
+	for _, e := range imported {
+		if e.Source != "" {
+			sylog.Verbosef("Imported %s cache entry %s from %s", e.Type, e.Name, e.Source)
+		} else {
+			sylog.Verbosef("Imported %s cache entry %s", e.Type, e.Name)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("while importing %s: %v", path, err)
+	}
+
+	sylog.Infof("Imported %d cache entries from %s", len(imported), path)
+	return nil
+}
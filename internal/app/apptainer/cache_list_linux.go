@@ -68,8 +68,8 @@ func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheLi
 	}
 
 	var (
-		containerCount, blobCount             int
-		containerSpace, blobSpace, totalSpace int64
+		containerCount, blobCount, buildCount             int
+		containerSpace, blobSpace, buildSpace, totalSpace int64
 	)
 
 	if cacheListVerbose {
@@ -78,6 +78,7 @@ func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheLi
 
 	containersShown := false
 	blobsShown := false
+	buildsShown := false
 
 	// If types requested includes "all" then we don't want to filter anything
 	if slice.ContainsString(cacheListTypes, "all") {
@@ -119,9 +120,17 @@ func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheLi
 			fmt.Print(err)
 			return err
 		}
+		totalSpace += size
+		// build stage snapshots are not containers, they have their
+		// own counter
+		if cacheType == cache.BuildCacheType {
+			buildCount = count
+			buildSpace = size
+			buildsShown = true
+			continue
+		}
 		containerCount += count
 		containerSpace += size
-		totalSpace += size
 		containersShown = true
 	}
 
@@ -129,17 +138,20 @@ func ListApptainerCache(imgCache *cache.Handle, cacheListTypes []string, cacheLi
 		fmt.Print("\n")
 	}
 
-	out := new(strings.Builder)
-	out.WriteString("There are")
+	var counts []string
 	if containersShown {
-		fmt.Fprintf(out, " %d container file(s) using %s", containerCount, fs.FindSize(containerSpace))
-	}
-	if containersShown && blobsShown {
-		fmt.Fprintf(out, " and")
+		counts = append(counts, fmt.Sprintf("%d container file(s) using %s", containerCount, fs.FindSize(containerSpace)))
 	}
 	if blobsShown {
-		fmt.Fprintf(out, " %d oci blob file(s) using %s", blobCount, fs.FindSize(blobSpace))
+		counts = append(counts, fmt.Sprintf("%d oci blob file(s) using %s", blobCount, fs.FindSize(blobSpace)))
+	}
+	if buildsShown {
+		counts = append(counts, fmt.Sprintf("%d build stage snapshot(s) using %s", buildCount, fs.FindSize(buildSpace)))
 	}
+
+	out := new(strings.Builder)
+	out.WriteString("There are ")
+	out.WriteString(strings.Join(counts, " and "))
 	out.WriteString(" of space\n")
 
 	fmt.Print(out.String())
@@ -0,0 +1,155 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/pkg/build/types"
+	"github.com/apptainer/apptainer/pkg/build/types/parser"
+)
+
+// LintDefinitionFile writes the problems found in the definition file at
+// path to w, one per line, and returns an error if there are any. Relative
+// %files sources are resolved against the current working directory, as
+// during builds.
+func LintDefinitionFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("while opening definition file: %v", err)
+	}
+	defer f.Close()
+
+	diags, err := parser.Lint(f, parser.LintOptions{})
+	if err != nil {
+		return err
+	}
+	for _, d := range diags {
+		fmt.Fprintf(w, "%s:%d: %s (%s)\n", path, d.Line, d.Message, d.Rule)
+	}
+	if len(diags) > 0 {
+		return fmt.Errorf("found %d problem(s) in definition file %s", len(diags), path)
+	}
+	return nil
+}
+
+// FormatDefinitionFile writes the definition file at path in canonical form
+// to w, or back to path if write is set.
+func FormatDefinitionFile(w io.Writer, path string, write bool) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("while reading definition file: %v", err)
+	}
+	defs, err := parser.All(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("while parsing definition file %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := parser.Format(&buf, defs); err != nil {
+		return err
+	}
+	if !write {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	if bytes.Equal(raw, buf.Bytes()) {
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	// replace the definition file atomically
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("while creating temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("while writing definition file: %v", err)
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("while writing definition file: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+const (
+	// DeffileFormatJSON is the JSON representation of a definition file, an
+	// array with the build stages of the definition.
+	DeffileFormatJSON = "json"
+	// DeffileFormatDef is the definition file format.
+	DeffileFormatDef = "def"
+)
+
+// ConvertDefinitionFile writes the definition file at path to w in the
+// format to, reading a JSON representation to write a definition file and a
+// definition file to write its JSON representation. A Dockerfile is
+// translated to a definition file first. The standard input is read if path
+// is "-".
+func ConvertDefinitionFile(w io.Writer, path string, to string) error {
+	if to != DeffileFormatJSON && to != DeffileFormatDef {
+		return fmt.Errorf("unknown definition format %q, must be %s or %s", to, DeffileFormatJSON, DeffileFormatDef)
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("while opening definition file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var defs []types.Definition
+	var err error
+	if ok, _ := parser.IsDockerfile(path); ok {
+		opts := parser.DockerfileOptions{Context: filepath.Dir(path)}
+		if defs, err = parser.ParseDockerfile(r, opts); err != nil {
+			return fmt.Errorf("while translating Dockerfile %s: %w", path, err)
+		}
+	}
+
+	if to == DeffileFormatDef {
+		if defs == nil {
+			if defs, err = types.NewDefinitionsFromJSON(r); err != nil {
+				return fmt.Errorf("while parsing JSON definition %s: %v", path, err)
+			}
+		}
+		return parser.Format(w, defs)
+	}
+
+	if defs == nil {
+		if defs, err = parser.All(r); err != nil {
+			return fmt.Errorf("while parsing definition file %s: %w", path, err)
+		}
+	}
+	// raw data is regenerated from the definition content when converting
+	// back, don't duplicate it in the JSON output
+	for i := range defs {
+		defs[i].Raw = nil
+		defs[i].FullRaw = nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(defs)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/build/types/parser"
+)
+
+const convertDef = `Bootstrap: docker
+From: python:3
+
+%post
+    cat > /etc/motd <<EOF
+Welcome
+EOF
+
+%runscript
+#!/usr/bin/env python3
+import sys
+for arg in sys.argv[1:]:
+    print(arg)
+`
+
+func TestConvertDefinitionFile(t *testing.T) {
+	dir := t.TempDir()
+	defPath := filepath.Join(dir, "python.def")
+	if err := os.WriteFile(defPath, []byte(convertDef), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ConvertDefinitionFile(&buf, defPath, DeffileFormatJSON); err != nil {
+		t.Fatalf("while converting to JSON: %v", err)
+	}
+	jsonPath := filepath.Join(dir, "python.json")
+	if err := os.WriteFile(jsonPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := ConvertDefinitionFile(&buf, jsonPath, DeffileFormatDef); err != nil {
+		t.Fatalf("while converting to definition file: %v", err)
+	}
+	if buf.String() != convertDef {
+		t.Errorf("unexpected definition file:\n%s\nexpected:\n%s", buf.String(), convertDef)
+	}
+
+	// RUN here-documents are kept as is
+	dockerfile := "FROM alpine\nRUN <<EOF\ncat > /etc/motd <<EOT\n  Welcome\nEOT\nEOF\nENTRYPOINT [\"cat\", \"/etc/motd\"]\n"
+	dockerPath := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(dockerPath, []byte(dockerfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := ConvertDefinitionFile(&buf, dockerPath, DeffileFormatDef); err != nil {
+		t.Fatalf("while converting Dockerfile: %v", err)
+	}
+	defs, err := parser.All(&buf)
+	if err != nil {
+		t.Fatalf("while parsing converted Dockerfile: %v", err)
+	}
+	post := defs[0].BuildData.Post.Script
+	if !strings.HasPrefix(post, "cat > /etc/motd <<EOT\n  Welcome\nEOT\n") {
+		t.Errorf("unexpected %%post script %q", post)
+	}
+}
@@ -0,0 +1,807 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// Change kinds reported by Diff.
+const (
+	diffAdded    = "added"
+	diffRemoved  = "removed"
+	diffModified = "modified"
+)
+
+// diffKinds are the change kinds written in the text output.
+var diffKinds = map[string]string{
+	diffAdded:    overlayAdded,
+	diffRemoved:  overlayDeleted,
+	diffModified: overlayModified,
+}
+
+// Container metadata compared by Diff.
+const (
+	diffLabelsFile    = ".singularity.d/labels.json"
+	diffRunscriptFile = ".singularity.d/runscript"
+	diffEnvDir        = ".singularity.d/env"
+)
+
+// diffEnvPatterns match the environment scripts set by the image build, as
+// shown by inspect.
+var diffEnvPatterns = []string{"10-docker*.sh", "9*-environment.sh"}
+
+// maxSymlinks is the maximum number of symbolic links resolved to read
+// a metadata file.
+const maxSymlinks = 40
+
+// imageFS is the read-only filesystem of an image compared by Diff.
+type imageFS interface {
+	fs.ReadDirFS
+	Lstat(name string) (fs.FileInfo, error)
+	ReadLink(name string) (string, error)
+}
+
+// Lstat returns the information of the file name visible through the
+// layers.
+func (b baseLayers) Lstat(name string) (fs.FileInfo, error) {
+	_, fi, err := b.lookup(name)
+	return fi, err
+}
+
+// ReadLink returns the target of the symbolic link name.
+func (b baseLayers) ReadLink(name string) (string, error) {
+	l, _, err := b.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return l.ReadLink(name)
+}
+
+// Open opens the file name visible through the layers.
+func (b baseLayers) Open(name string) (fs.File, error) {
+	l, _, err := b.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return l.Open(name)
+}
+
+// ReadDir returns the merged content of the directory name, sorted by
+// file name.
+func (b baseLayers) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	found := false
+	for _, l := range b {
+		fi, err := l.Lstat(name)
+		if err != nil {
+			if hidesLower(l, name) {
+				break
+			}
+			continue
+		}
+		// whiteouts and other files hide the lower directories
+		if !fi.IsDir() {
+			break
+		}
+		found = true
+
+		layerEntries, err := l.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range layerEntries {
+			if seen[e.Name()] {
+				continue
+			}
+			seen[e.Name()] = true
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			if !isWhiteout(info) {
+				entries = append(entries, e)
+			}
+		}
+
+		xattrs, err := l.Xattrs(name)
+		if err != nil {
+			return nil, err
+		}
+		if isOpaque(xattrs) {
+			break
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	slices.SortFunc(entries, func(x, y fs.DirEntry) int {
+		return strings.Compare(x.Name(), y.Name())
+	})
+	return entries, nil
+}
+
+// sandboxFS reads the files of a sandbox image.
+type sandboxFS string
+
+func (d sandboxFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
+
+// Open opens the file name, without following a final symbolic link.
+func (d sandboxFS) Open(name string) (fs.File, error) {
+	p, err := d.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, os.O_RDONLY|unix.O_NOFOLLOW, 0)
+}
+
+func (d sandboxFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := d.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(p)
+}
+
+func (d sandboxFS) Lstat(name string) (fs.FileInfo, error) {
+	p, err := d.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(p)
+}
+
+func (d sandboxFS) ReadLink(name string) (string, error) {
+	p, err := d.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(p)
+}
+
+// statImageFile returns the ownership of a file of an image layer or of a
+// sandbox image.
+func statImageFile(fi fs.FileInfo) layerStat {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return layerStat{uid: st.Uid, gid: st.Gid, rdev: uint64(st.Rdev)}
+	}
+	return statLayerFile(fi)
+}
+
+// diffFile holds the compared attributes of a file.
+type diffFile struct {
+	Type   string `json:"type"`
+	Mode   string `json:"mode"`
+	UID    uint32 `json:"uid"`
+	GID    uint32 `json:"gid"`
+	Size   int64  `json:"size"`
+	Target string `json:"target,omitempty"`
+	Device string `json:"device,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// fileChange is an added, removed or modified file, Changes holds the
+// modified attributes.
+type fileChange struct {
+	Path    string    `json:"path"`
+	Change  string    `json:"change"`
+	Changes []string  `json:"changes,omitempty"`
+	Old     *diffFile `json:"old,omitempty"`
+	New     *diffFile `json:"new,omitempty"`
+}
+
+// valueChange is an added, removed or modified label or script.
+type valueChange struct {
+	Change string `json:"change"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// imageDiff holds the differences between two images.
+type imageDiff struct {
+	Files []fileChange `json:"files"`
+	// Labels are indexed by label name
+	Labels map[string]valueChange `json:"labels,omitempty"`
+	// Environment is indexed by environment script name
+	Environment map[string]valueChange `json:"environment,omitempty"`
+	Runscript   *valueChange           `json:"runscript,omitempty"`
+}
+
+func (d *imageDiff) empty() bool {
+	return len(d.Files) == 0 && len(d.Labels) == 0 && len(d.Environment) == 0 && d.Runscript == nil
+}
+
+func fileTypeName(mode fs.FileMode) string {
+	switch mode.Type() {
+	case 0:
+		return "file"
+	case fs.ModeDir:
+		return "directory"
+	case fs.ModeSymlink:
+		return "symlink"
+	case fs.ModeDevice:
+		return "block device"
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return "character device"
+	case fs.ModeNamedPipe:
+		return "fifo"
+	case fs.ModeSocket:
+		return "socket"
+	}
+	return "unknown"
+}
+
+// describeFile returns the compared attributes of the file name, the
+// content hash of regular files is computed by compareFile.
+func describeFile(fsys imageFS, name string, fi fs.FileInfo) (*diffFile, error) {
+	st := statImageFile(fi)
+	f := &diffFile{
+		Type: fileTypeName(fi.Mode()),
+		Mode: pseudoMode(fi.Mode()),
+		UID:  st.uid,
+		GID:  st.gid,
+	}
+	switch fi.Mode().Type() {
+	case 0:
+		f.Size = fi.Size()
+	case fs.ModeSymlink:
+		target, err := fsys.ReadLink(name)
+		if err != nil {
+			return nil, err
+		}
+		f.Target = target
+	case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice:
+		f.Device = fmt.Sprintf("%d:%d", unix.Major(st.rdev), unix.Minor(st.rdev))
+	}
+	return f, nil
+}
+
+func hashFile(fsys imageFS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("while reading %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// modifiedAttributes returns the names of the attributes differing
+// between two versions of a file.
+func modifiedAttributes(o, n *diffFile) []string {
+	var changes []string
+	if o.Type != n.Type {
+		changes = append(changes, "type")
+	}
+	if o.Mode != n.Mode {
+		changes = append(changes, "mode")
+	}
+	if o.UID != n.UID || o.GID != n.GID {
+		changes = append(changes, "owner")
+	}
+	if o.Type != n.Type {
+		return changes
+	}
+	if o.Size != n.Size {
+		changes = append(changes, "size")
+	}
+	if o.SHA256 != n.SHA256 {
+		changes = append(changes, "sha256")
+	}
+	if o.Target != n.Target {
+		changes = append(changes, "target")
+	}
+	if o.Device != n.Device {
+		changes = append(changes, "device")
+	}
+	return changes
+}
+
+// inodeKey identifies a hard linked file of an image layer.
+type inodeKey struct {
+	layer layerFS
+	ino   uint32
+}
+
+// fileDiffer compares the files of two images.
+type fileDiffer struct {
+	old     imageFS
+	new     imageFS
+	changes []fileChange
+	// hashes holds the content hash of the hard linked files of the
+	// image layers, read once
+	hashes map[inodeKey]string
+}
+
+func (d *fileDiffer) hash(fsys imageFS, name string, fi fs.FileInfo) (string, error) {
+	layers, ok := fsys.(baseLayers)
+	st := statLayerFile(fi)
+	if !ok || st.nlink < 2 {
+		return hashFile(fsys, name)
+	}
+	l, _, err := layers.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	key := inodeKey{layer: l, ino: st.ino}
+	if h, ok := d.hashes[key]; ok {
+		return h, nil
+	}
+	h, err := hashFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	d.hashes[key] = h
+	return h, nil
+}
+
+// compareDir compares the content of the directory name, missing in the
+// old or in the new image when inOld or inNew is false.
+func (d *fileDiffer) compareDir(name string, inOld, inNew bool) error {
+	var oldEntries, newEntries []fs.DirEntry
+	var err error
+	if inOld {
+		if oldEntries, err = d.old.ReadDir(name); err != nil {
+			return err
+		}
+	}
+	if inNew {
+		if newEntries, err = d.new.ReadDir(name); err != nil {
+			return err
+		}
+	}
+
+	// entries are sorted by name
+	i, j := 0, 0
+	for i < len(oldEntries) || j < len(newEntries) {
+		var o, n fs.DirEntry
+		switch {
+		case j == len(newEntries) || (i < len(oldEntries) && oldEntries[i].Name() < newEntries[j].Name()):
+			o = oldEntries[i]
+			i++
+		case i == len(oldEntries) || newEntries[j].Name() < oldEntries[i].Name():
+			n = newEntries[j]
+			j++
+		default:
+			o, n = oldEntries[i], newEntries[j]
+			i++
+			j++
+		}
+
+		var oi, ni fs.FileInfo
+		var entryName string
+		if o != nil {
+			entryName = o.Name()
+			if oi, err = o.Info(); err != nil {
+				return err
+			}
+		}
+		if n != nil {
+			entryName = n.Name()
+			if ni, err = n.Info(); err != nil {
+				return err
+			}
+		}
+		if err := d.compareFile(path.Join(name, entryName), oi, ni); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareFile compares the file name, missing in the old or in the new
+// image when its information is nil, and the content of directories.
+func (d *fileDiffer) compareFile(name string, oi, ni fs.FileInfo) error {
+	var o, n *diffFile
+	var err error
+	if oi != nil {
+		if o, err = describeFile(d.old, name, oi); err != nil {
+			return err
+		}
+	}
+	if ni != nil {
+		if n, err = describeFile(d.new, name, ni); err != nil {
+			return err
+		}
+	}
+
+	change := fileChange{Path: path.Join("/", name), Old: o, New: n}
+	switch {
+	case n == nil:
+		change.Change = diffRemoved
+	case o == nil:
+		change.Change = diffAdded
+	default:
+		if oi.Mode().IsRegular() && ni.Mode().IsRegular() {
+			if o.SHA256, err = d.hash(d.old, name, oi); err != nil {
+				return err
+			}
+			if n.SHA256, err = d.hash(d.new, name, ni); err != nil {
+				return err
+			}
+		}
+		if change.Changes = modifiedAttributes(o, n); len(change.Changes) > 0 {
+			change.Change = diffModified
+		}
+	}
+	if change.Change != "" {
+		d.changes = append(d.changes, change)
+	}
+
+	inOld := oi != nil && oi.IsDir()
+	inNew := ni != nil && ni.IsDir()
+	if inOld || inNew {
+		return d.compareDir(name, inOld, inNew)
+	}
+	return nil
+}
+
+// readImageFile returns the content of the regular file name, resolving
+// the symbolic links in the image. It returns nil if the file doesn't
+// exist.
+func readImageFile(fsys imageFS, name string) ([]byte, error) {
+	for range maxSymlinks {
+		fi, err := fsys.Lstat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if fi.Mode().Type() != fs.ModeSymlink {
+			if !fi.Mode().IsRegular() {
+				return nil, fmt.Errorf("%s is not a regular file", name)
+			}
+			return fs.ReadFile(fsys, name)
+		}
+		target, err := fsys.ReadLink(name)
+		if err != nil {
+			return nil, err
+		}
+		if !path.IsAbs(target) {
+			target = path.Join("/", path.Dir(name), target)
+		}
+		if name = strings.TrimPrefix(path.Clean(target), "/"); name == "" {
+			name = "."
+		}
+	}
+	return nil, fmt.Errorf("while reading %s: too many levels of symbolic links", name)
+}
+
+// compareValue returns the change between two versions of a label or a
+// script, or nil if they are equal.
+func compareValue(o, n string, inOld, inNew bool) *valueChange {
+	switch {
+	case inOld && !inNew:
+		return &valueChange{Change: diffRemoved, Old: o}
+	case !inOld && inNew:
+		return &valueChange{Change: diffAdded, New: n}
+	case o != n:
+		return &valueChange{Change: diffModified, Old: o, New: n}
+	}
+	return nil
+}
+
+// imageMetadata holds the container metadata compared by Diff.
+type imageMetadata struct {
+	labels      map[string]string
+	environment map[string]string
+	runscript   []byte
+}
+
+func readImageMetadata(fsys imageFS) (*imageMetadata, error) {
+	m := &imageMetadata{
+		labels:      make(map[string]string),
+		environment: make(map[string]string),
+	}
+
+	data, err := readImageFile(fsys, diffLabelsFile)
+	if err != nil {
+		return nil, fmt.Errorf("while reading labels: %w", err)
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &m.labels); err != nil {
+			sylog.Warningf("Unable to parse labels: %s", err)
+		}
+	}
+
+	if m.runscript, err = readImageFile(fsys, diffRunscriptFile); err != nil {
+		return nil, fmt.Errorf("while reading runscript: %w", err)
+	}
+
+	entries, err := fsys.ReadDir(diffEnvDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("while reading environment scripts: %w", err)
+	}
+	for _, e := range entries {
+		if !slices.ContainsFunc(diffEnvPatterns, func(pattern string) bool {
+			matched, _ := path.Match(pattern, e.Name())
+			return matched
+		}) {
+			continue
+		}
+		data, err := readImageFile(fsys, path.Join(diffEnvDir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("while reading environment scripts: %w", err)
+		}
+		if data != nil {
+			m.environment[e.Name()] = string(data)
+		}
+	}
+	return m, nil
+}
+
+// compareValues returns the changes between two sets of labels or scripts.
+func compareValues(o, n map[string]string) map[string]valueChange {
+	changes := make(map[string]valueChange)
+	for _, k := range slices.Concat(slices.Collect(maps.Keys(o)), slices.Collect(maps.Keys(n))) {
+		ov, inOld := o[k]
+		nv, inNew := n[k]
+		if c := compareValue(ov, nv, inOld, inNew); c != nil {
+			changes[k] = *c
+		}
+	}
+	return changes
+}
+
+// openImageFS returns the filesystem of an image, with its read-only
+// overlay layers applied. The image file must be closed by the caller.
+func openImageFS(imgPath string) (*image.Image, imageFS, error) {
+	img, err := image.Init(imgPath, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while opening image file %s: %s", imgPath, err)
+	}
+	if img.Type == image.SANDBOX {
+		return img, sandboxFS(img.Path), nil
+	}
+
+	layers, err := imageLayers(img)
+	if err != nil {
+		img.File.Close()
+		return nil, nil, err
+	}
+	if overlays, err := img.GetOverlayPartitions(); err == nil {
+		for _, overlay := range overlays {
+			if overlay.Type == image.EXT3 {
+				sylog.Warningf("Writable overlay partition %d of %s is not compared", overlay.ID, imgPath)
+			}
+		}
+	}
+	return img, layers, nil
+}
+
+// diffImages returns the differences between the files and the container
+// metadata of two images.
+func diffImages(oldPath, newPath string) (*imageDiff, error) {
+	oldImg, oldFS, err := openImageFS(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	defer oldImg.File.Close()
+
+	newImg, newFS, err := openImageFS(newPath)
+	if err != nil {
+		return nil, err
+	}
+	defer newImg.File.Close()
+
+	oldRoot, err := oldFS.Lstat(".")
+	if err != nil {
+		return nil, fmt.Errorf("while reading root directory of %s: %w", oldPath, err)
+	}
+	newRoot, err := newFS.Lstat(".")
+	if err != nil {
+		return nil, fmt.Errorf("while reading root directory of %s: %w", newPath, err)
+	}
+	d := &fileDiffer{
+		old:     oldFS,
+		new:     newFS,
+		changes: []fileChange{},
+		hashes:  make(map[inodeKey]string),
+	}
+	if err := d.compareFile(".", oldRoot, newRoot); err != nil {
+		return nil, fmt.Errorf("while comparing files: %w", err)
+	}
+
+	oldMeta, err := readImageMetadata(oldFS)
+	if err != nil {
+		return nil, fmt.Errorf("while reading metadata of %s: %w", oldPath, err)
+	}
+	newMeta, err := readImageMetadata(newFS)
+	if err != nil {
+		return nil, fmt.Errorf("while reading metadata of %s: %w", newPath, err)
+	}
+
+	return &imageDiff{
+		Files:       d.changes,
+		Labels:      compareValues(oldMeta.labels, newMeta.labels),
+		Environment: compareValues(oldMeta.environment, newMeta.environment),
+		Runscript: compareValue(
+			string(oldMeta.runscript), string(newMeta.runscript),
+			oldMeta.runscript != nil, newMeta.runscript != nil,
+		),
+	}, nil
+}
+
+// diffLines returns the lines of two versions of a script, prefixed with
+// "-" when removed, "+" when added and " " when unchanged.
+func diffLines(o, n string) []string {
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	}
+	x, y := split(o), split(n)
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(x)+len(y)-lcs[0][0])
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, " "+x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "-"+x[i])
+			i++
+		default:
+			lines = append(lines, "+"+y[j])
+			j++
+		}
+	}
+	return lines
+}
+
+// fileChangeDetails returns the description of the modified attributes
+// of a file.
+func fileChangeDetails(c fileChange) string {
+	details := make([]string, 0, len(c.Changes))
+	for _, attr := range c.Changes {
+		var o, n string
+		switch attr {
+		case "type":
+			o, n = c.Old.Type, c.New.Type
+		case "mode":
+			o, n = c.Old.Mode, c.New.Mode
+		case "owner":
+			o, n = fmt.Sprintf("%d:%d", c.Old.UID, c.Old.GID), fmt.Sprintf("%d:%d", c.New.UID, c.New.GID)
+		case "size":
+			o, n = fmt.Sprint(c.Old.Size), fmt.Sprint(c.New.Size)
+		case "sha256":
+			o, n = c.Old.SHA256[:12], c.New.SHA256[:12]
+		case "target":
+			o, n = c.Old.Target, c.New.Target
+		case "device":
+			o, n = c.Old.Device, c.New.Device
+		}
+		details = append(details, fmt.Sprintf("%s %s -> %s", attr, o, n))
+	}
+	return strings.Join(details, ", ")
+}
+
+// writeDiff writes the differences between two images as text, in
+// sections separated by an empty line.
+func writeDiff(w io.Writer, d *imageDiff) {
+	sections := 0
+	section := func(title string) {
+		if sections > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:\n", title)
+		sections++
+	}
+	script := func(title string, c valueChange) {
+		section(fmt.Sprintf("%s (%s)", title, c.Change))
+		for _, line := range diffLines(c.Old, c.New) {
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if len(d.Files) > 0 {
+		section("Files")
+	}
+	for _, c := range d.Files {
+		name := c.Path
+		if (c.New != nil && c.New.Type == "directory") || (c.New == nil && c.Old.Type == "directory") {
+			name = strings.TrimSuffix(name, "/") + "/"
+		}
+		if c.Change == diffModified {
+			fmt.Fprintf(w, "%s %s: %s\n", diffKinds[c.Change], name, fileChangeDetails(c))
+		} else {
+			fmt.Fprintf(w, "%s %s\n", diffKinds[c.Change], name)
+		}
+	}
+
+	if len(d.Labels) > 0 {
+		section("Labels")
+	}
+	for _, k := range slices.Sorted(maps.Keys(d.Labels)) {
+		c := d.Labels[k]
+		switch c.Change {
+		case diffAdded:
+			fmt.Fprintf(w, "%s %s: %s\n", diffKinds[c.Change], k, c.New)
+		case diffRemoved:
+			fmt.Fprintf(w, "%s %s: %s\n", diffKinds[c.Change], k, c.Old)
+		default:
+			fmt.Fprintf(w, "%s %s: %s -> %s\n", diffKinds[c.Change], k, c.Old, c.New)
+		}
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(d.Environment)) {
+		script("Environment "+k, d.Environment[k])
+	}
+	if d.Runscript != nil {
+		script("Runscript", *d.Runscript)
+	}
+}
+
+// Diff writes the files added, removed or modified between two images, and
+// the changes of their labels, environment and runscript. The images are
+// SIF, squashfs, ext3 or sandbox images, their partitions are read directly
+// without being mounted.
+func Diff(w io.Writer, oldPath, newPath string, jsonFmt bool) error {
+	d, err := diffImages(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	if jsonFmt {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(d)
+	}
+	if d.empty() {
+		fmt.Fprintf(w, "No differences found between %s and %s\n", oldPath, newPath)
+		return nil
+	}
+	writeDiff(w, d)
+	return nil
+}
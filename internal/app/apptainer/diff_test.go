@@ -0,0 +1,239 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sandboxFile is a file of a sandbox image created by createSandbox, a
+// symbolic link when link is set.
+type sandboxFile struct {
+	name    string
+	content string
+	mode    os.FileMode
+	link    string
+}
+
+func createSandbox(t *testing.T, files []sandboxFile) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(dir, f.name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if f.link != "" {
+			if err := os.Symlink(f.link, p); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		mode := f.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		if err := os.WriteFile(p, []byte(f.content), mode); err != nil {
+			t.Fatal(err)
+		}
+		// not altered by the umask
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []string
+	}{
+		{
+			name: "Equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: []string{" a", " b"},
+		},
+		{
+			name: "Added",
+			old:  "",
+			new:  "a\nb",
+			want: []string{"+a", "+b"},
+		},
+		{
+			name: "Removed",
+			old:  "a\nb\n",
+			new:  "",
+			want: []string{"-a", "-b"},
+		},
+		{
+			name: "Modified",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\nd\n",
+			want: []string{" a", "-b", "+B", " c", "+d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffLines(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	oldImg := createSandbox(t, []sandboxFile{
+		{name: ".singularity.d/labels.json", content: `{"A": "1", "B": "2"}`},
+		{name: ".singularity.d/runscript", content: "#!/bin/sh\necho old\n", mode: 0o755},
+		{name: ".singularity.d/env/01-base.sh", content: "# base\n"},
+		{name: ".singularity.d/env/90-environment.sh", content: "export A=1\nexport B=2\n"},
+		{name: "bin/sh", content: "shell", mode: 0o755},
+		{name: "etc/passwd", content: "root\n"},
+		{name: "link", link: "etc/passwd"},
+		{name: "old.txt", content: "old"},
+	})
+	newImg := createSandbox(t, []sandboxFile{
+		{name: ".singularity.d/labels.json", content: `{"A": "1", "B": "3", "C": "4"}`},
+		{name: ".singularity.d/runscript", content: "#!/bin/sh\necho new\n", mode: 0o755},
+		{name: ".singularity.d/env/01-base.sh", content: "# new base\n"},
+		{name: ".singularity.d/env/90-environment.sh", content: "export A=1\nexport B=3\n"},
+		{name: "bin/sh", content: "shell", mode: 0o700},
+		{name: "etc/passwd", content: "root\nuser\n"},
+		{name: "link", link: "etc/group"},
+		{name: "opt/app/file", content: "app"},
+	})
+
+	d, err := diffImages(oldImg, newImg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type change struct {
+		path    string
+		change  string
+		changes string
+	}
+	wantFiles := []change{
+		{"/.singularity.d/env/01-base.sh", diffModified, "size,sha256"},
+		{"/.singularity.d/env/90-environment.sh", diffModified, "sha256"},
+		{"/.singularity.d/labels.json", diffModified, "size,sha256"},
+		{"/.singularity.d/runscript", diffModified, "sha256"},
+		{"/bin/sh", diffModified, "mode"},
+		{"/etc/passwd", diffModified, "size,sha256"},
+		{"/link", diffModified, "target"},
+		{"/old.txt", diffRemoved, ""},
+		{"/opt", diffAdded, ""},
+		{"/opt/app", diffAdded, ""},
+		{"/opt/app/file", diffAdded, ""},
+	}
+	var gotFiles []change
+	for _, c := range d.Files {
+		gotFiles = append(gotFiles, change{c.Path, c.Change, strings.Join(c.Changes, ",")})
+	}
+	if !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf("got file changes %v, want %v", gotFiles, wantFiles)
+	}
+
+	wantLabels := map[string]valueChange{
+		"B": {Change: diffModified, Old: "2", New: "3"},
+		"C": {Change: diffAdded, New: "4"},
+	}
+	if !reflect.DeepEqual(d.Labels, wantLabels) {
+		t.Errorf("got label changes %v, want %v", d.Labels, wantLabels)
+	}
+	wantEnv := map[string]valueChange{
+		"90-environment.sh": {Change: diffModified, Old: "export A=1\nexport B=2\n", New: "export A=1\nexport B=3\n"},
+	}
+	if !reflect.DeepEqual(d.Environment, wantEnv) {
+		t.Errorf("got environment changes %v, want %v", d.Environment, wantEnv)
+	}
+	if d.Runscript == nil || d.Runscript.Change != diffModified {
+		t.Errorf("got runscript change %v, want modified", d.Runscript)
+	}
+
+	var buf bytes.Buffer
+	if err := Diff(&buf, oldImg, newImg, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"M /bin/sh: mode 0755 -> 0700\n",
+		"M /link: target etc/passwd -> etc/group\n",
+		"D /old.txt\n",
+		"A /opt/app/\n",
+		"M B: 2 -> 3\n",
+		"A C: 4\n",
+		"\nEnvironment 90-environment.sh (modified):\n export A=1\n-export B=2\n+export B=3\n",
+		"\nRunscript (modified):\n #!/bin/sh\n-echo old\n+echo new\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := Diff(&buf, oldImg, newImg, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded imageDiff
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("while decoding JSON output: %s", err)
+	}
+	if !reflect.DeepEqual(&decoded, d) {
+		t.Errorf("got JSON output %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Diff(&buf, oldImg, oldImg, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "No differences found") {
+		t.Errorf("got output %q for the same image", buf.String())
+	}
+}
+
+func TestDiffSIF(t *testing.T) {
+	// the writable overlay isn't compared
+	sifPath := createOverlaySIF(t, []overlayFile{{name: "upper/file", content: "file"}})
+
+	d, err := diffImages(busyboxSIF, sifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.empty() {
+		t.Errorf("unexpected differences: %+v", d)
+	}
+
+	sandbox := createSandbox(t, []sandboxFile{{name: "bin/busybox", content: "busybox"}})
+	d, err = diffImages(busyboxSIF, sandbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range d.Files {
+		if c.Path == "/bin/busybox" {
+			found = true
+			if c.Change != diffModified || c.Old.SHA256 == "" || c.Old.SHA256 == c.New.SHA256 {
+				t.Errorf("unexpected change of /bin/busybox: %+v", c)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("modification of /bin/busybox not found")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+// EventsOptions are the options of Events.
+type EventsOptions struct {
+	// Since prints the events logged at or after this time before the
+	// new events, if not zero.
+	Since time.Time
+	// JSON prints the events as JSON objects, one per line.
+	JSON bool
+}
+
+// Events prints the lifecycle events of the containers run by the current
+// user on this host as they're logged, until the context is canceled.
+func Events(ctx context.Context, w io.Writer, opts EventsOptions) error {
+	paths, err := instance.GetEventLogPaths()
+	if err != nil {
+		return fmt.Errorf("could not find event log: %w", err)
+	}
+	r := instance.NewEventReader(paths)
+
+	// past events are only printed with a since time
+	events, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("while reading events: %w", err)
+	}
+	if !opts.Since.IsZero() {
+		for _, e := range events {
+			if e.Time.Before(opts.Since) {
+				continue
+			}
+			if err := printEvent(w, e, opts.JSON); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logsFollowInterval):
+		}
+
+		events, err := r.Read()
+		if err != nil {
+			return fmt.Errorf("while reading events: %w", err)
+		}
+		for _, e := range events {
+			if err := printEvent(w, e, opts.JSON); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func printEvent(w io.Writer, e instance.Event, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(e)
+	}
+	_, err := fmt.Fprintln(w, formatEvent(e))
+	return err
+}
+
+// formatEvent formats an event on a single line, starting with its time,
+// engine, action and ID, followed by its pid and attributes sorted by name.
+func formatEvent(e instance.Event) string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Time.Format(time.RFC3339Nano))
+	sb.WriteString(" " + e.Engine + " " + e.Action)
+	if e.ID != "" {
+		sb.WriteString(" " + e.ID)
+	}
+
+	var attrs []string
+	if e.Pid != 0 {
+		attrs = append(attrs, "pid="+strconv.Itoa(e.Pid))
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Attributes)) {
+		attrs = append(attrs, k+"="+e.Attributes[k])
+	}
+	if len(attrs) > 0 {
+		sb.WriteString(" (" + strings.Join(attrs, ", ") + ")")
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+func TestFormatEvent(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		event instance.Event
+		want  string
+	}{
+		{
+			name: "Instance",
+			event: instance.Event{
+				Time:       at,
+				Action:     instance.EventExit,
+				Engine:     "apptainer",
+				ID:         "web",
+				Pid:        42,
+				Attributes: map[string]string{"signal": "SIGKILL", "exitCode": "137"},
+			},
+			want: "2024-01-02T03:04:05Z apptainer exit web (pid=42, exitCode=137, signal=SIGKILL)",
+		},
+		{
+			name: "NoID",
+			event: instance.Event{
+				Time:       at,
+				Action:     instance.EventStart,
+				Engine:     "apptainer",
+				Attributes: map[string]string{"image": "alpine.sif"},
+			},
+			want: "2024-01-02T03:04:05Z apptainer start (image=alpine.sif)",
+		},
+		{
+			name: "NoAttributes",
+			event: instance.Event{
+				Time:   at,
+				Action: instance.EventStart,
+				Engine: "oci",
+				ID:     "c1",
+			},
+			want: "2024-01-02T03:04:05Z oci start c1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatEvent(tt.event); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
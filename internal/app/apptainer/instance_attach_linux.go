@@ -0,0 +1,217 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osignal "os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/unix"
+	"golang.org/x/term"
+)
+
+// DefaultDetachKeys is the key sequence detaching from an instance by default.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// errDetached is returned when the detach key sequence is read.
+var errDetached = errors.New("detached")
+
+// ParseDetachKeys parses a comma separated sequence of keys, each key being
+// either a single character or ctrl-<value> where value is a letter or one
+// of @, [, \, ], ^ and _. An empty sequence disables detaching.
+func ParseDetachKeys(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var keys []byte
+	for _, key := range strings.Split(s, ",") {
+		if len(key) == 1 {
+			keys = append(keys, key[0])
+			continue
+		}
+		value, ok := strings.CutPrefix(key, "ctrl-")
+		if !ok || len(value) != 1 {
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+		c := value[0]
+		switch {
+		case c >= 'a' && c <= 'z':
+			keys = append(keys, c-'a'+1)
+		case c >= '@' && c <= '_' && (c < 'A' || c > 'Z'):
+			keys = append(keys, c-'@')
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return keys, nil
+}
+
+// detachReader reads from r until the detach key sequence is read, the
+// keys partially matching the sequence are held back until they don't
+// match anymore.
+type detachReader struct {
+	r       io.Reader
+	keys    []byte
+	matched int
+	buf     []byte
+	pending []byte
+	err     error
+}
+
+func newDetachReader(r io.Reader, keys []byte) io.Reader {
+	if len(keys) == 0 {
+		return r
+	}
+	return &detachReader{
+		r:    r,
+		keys: keys,
+		buf:  make([]byte, 1024),
+	}
+}
+
+func (d *detachReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := d.r.Read(d.buf)
+		for _, b := range d.buf[:n] {
+			if d.feed(b) {
+				d.err = errDetached
+				break
+			}
+		}
+		if err != nil && d.err == nil {
+			// keys held back are sent along with the end of input
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+			d.err = err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// feed processes a key read and returns true once the detach key sequence
+// is complete.
+func (d *detachReader) feed(b byte) bool {
+	if b != d.keys[d.matched] && d.matched > 0 {
+		d.pending = append(d.pending, d.keys[:d.matched]...)
+		d.matched = 0
+	}
+	if b != d.keys[d.matched] {
+		d.pending = append(d.pending, b)
+		return false
+	}
+	d.matched++
+	return d.matched == len(d.keys)
+}
+
+// InstanceAttach attaches the standard streams to the terminal of the named
+// instance, until the instance stops or the detach key sequence is typed.
+func InstanceAttach(ctx context.Context, name string, detachKeys string) error {
+	if err := instance.CheckName(name); err != nil {
+		return err
+	}
+	keys, err := ParseDetachKeys(detachKeys)
+	if err != nil {
+		return err
+	}
+
+	ii, err := instance.List("", name, instance.AppSubDir, false)
+	if err != nil {
+		return fmt.Errorf("could not retrieve instance list: %w", err)
+	}
+	if len(ii) != 1 {
+		return fmt.Errorf("no instance found with name %s", name)
+	}
+	file := ii[0]
+	if file.AttachSocket == "" {
+		return fmt.Errorf("instance %s has no terminal, it must be started with --tty", name)
+	}
+
+	conn, err := unix.Dial(file.AttachSocket)
+	if err != nil {
+		return fmt.Errorf("while connecting to instance %s: %w", name, err)
+	}
+	defer conn.Close()
+
+	if term.IsTerminal(0) {
+		state, err := term.MakeRaw(0)
+		if err != nil {
+			return fmt.Errorf("while setting terminal in raw mode: %w", err)
+		}
+		defer func() {
+			fmt.Printf("\r")
+			term.Restore(0, state)
+		}()
+
+		// the terminal is first oversized to force the instance process
+		// to redraw its output
+		resize(file.ControlSocket, true)
+		resize(file.ControlSocket, false)
+
+		signals := make(chan os.Signal, 1)
+		osignal.Notify(signals, syscall.SIGWINCH)
+		defer osignal.Stop(signals)
+
+		go func() {
+			for {
+				select {
+				case <-signals:
+					resize(file.ControlSocket, false)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	outputDone := make(chan struct{})
+	go func() {
+		io.Copy(os.Stdout, conn)
+		close(outputDone)
+	}()
+
+	inputDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, newDetachReader(os.Stdin, keys))
+		inputDone <- err
+	}()
+
+	select {
+	case <-outputDone:
+	case <-ctx.Done():
+	case err := <-inputDone:
+		if errors.Is(err, errDetached) {
+			sylog.Debugf("Detached from instance %s", name)
+			return nil
+		}
+		// the instance output is read until the connection is
+		// closed once the input is exhausted
+		if c, ok := conn.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		}
+		select {
+		case <-outputDone:
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	tests := []struct {
+		keys    string
+		want    []byte
+		wantErr bool
+	}{
+		{keys: DefaultDetachKeys, want: []byte{0x10, 0x11}},
+		{keys: "ctrl-a,x", want: []byte{0x01, 'x'}},
+		{keys: `ctrl-@,ctrl-[,ctrl-\,ctrl-],ctrl-^,ctrl-_`, want: []byte{0, 27, 28, 29, 30, 31}},
+		{keys: "", want: nil},
+		{keys: "ctrl-A", wantErr: true},
+		{keys: "ctrl-1", wantErr: true},
+		{keys: "alt-a", wantErr: true},
+		{keys: "ctrl-p,,ctrl-q", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keys, func(t *testing.T) {
+			got, err := ParseDetachKeys(tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v (want error %v)", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetachReader(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		detached bool
+	}{
+		{name: "NoKeys", input: "hello", want: "hello"},
+		{name: "Detach", input: "hello\x10\x11world", want: "hello", detached: true},
+		{name: "Partial", input: "a\x10b", want: "a\x10b"},
+		{name: "PartialAtEnd", input: "a\x10", want: "a\x10"},
+		{name: "Repeated", input: "a\x10\x10\x11b", want: "a\x10", detached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// read one byte at a time to match keys across reads
+			r := newDetachReader(iotest.OneByteReader(strings.NewReader(tt.input)), keys)
+			got, err := io.ReadAll(r)
+			if errors.Is(err, errDetached) != tt.detached {
+				t.Fatalf("unexpected error: %v (want detached %v)", err, tt.detached)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
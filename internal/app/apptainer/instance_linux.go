@@ -13,7 +13,6 @@
 package apptainer
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,23 +23,23 @@ import (
 	"text/tabwriter"
 	"time"
 
-	"github.com/apptainer/apptainer/internal/pkg/cgroups"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
-	"github.com/buger/goterm"
 	"github.com/ccoveille/go-safecast"
-	units "github.com/docker/go-units"
 	libcgroups "github.com/opencontainers/cgroups"
 )
 
 type instanceInfo struct {
-	Instance   string `json:"instance"`
-	Pid        int    `json:"pid"`
-	Image      string `json:"img"`
-	IP         string `json:"ip"`
-	LogErrPath string `json:"logErrPath"`
-	LogOutPath string `json:"logOutPath"`
+	Instance      string           `json:"instance"`
+	Pid           int              `json:"pid"`
+	Image         string           `json:"img"`
+	IP            string           `json:"ip"`
+	LogErrPath    string           `json:"logErrPath"`
+	LogOutPath    string           `json:"logOutPath"`
+	RestartPolicy string           `json:"restartPolicy,omitempty"`
+	RestartCount  int              `json:"restartCount"`
+	Health        *instance.Health `json:"health,omitempty"`
 }
 
 // PrintInstanceList fetches instance list, applying name and
@@ -98,6 +97,9 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 		instances[i].IP = ii[i].IP
 		instances[i].LogErrPath = ii[i].LogErrPath
 		instances[i].LogOutPath = ii[i].LogOutPath
+		instances[i].RestartPolicy = ii[i].RestartPolicy
+		instances[i].RestartCount = ii[i].RestartCount
+		instances[i].Health = ii[i].Health
 	}
 
 	enc := json.NewEncoder(w)
@@ -198,117 +200,6 @@ func calculateCPUUsage(prevTime, prevCPU uint64, cpuStats *libcgroups.CpuStats)
 	return cpuPercent, curTime, curCPU, nil
 }
 
-// InstanceStats uses underlying cgroups to get statistics for a named instance
-func InstanceStats(ctx context.Context, name, instanceUser string, formatJSON bool, noStream bool) error {
-	ii, err := instanceListOrError(instanceUser, name)
-	if err != nil {
-		return err
-	}
-	// Instance stats required 1 instance
-	if len(ii) != 1 {
-		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
-	}
-
-	// Grab our instance to interact with!
-	i := ii[0]
-	if !formatJSON {
-		sylog.Infof("Stats for %s instance of %s (PID=%d)\n", i.Name, i.Image, i.Pid)
-	}
-
-	// If asking for json and not nostream, not possible
-	if formatJSON && !noStream {
-		sylog.Warningf("JSON output is only available for a single timepoint (--no-stream)")
-		noStream = true
-	}
-
-	// Cut out early if we do not have cgroups
-	if !i.Cgroup {
-		url := "the Apptainer instance user guide for instructions"
-		return fmt.Errorf("stats are only available if cgroups are enabled, see %s", url)
-	}
-
-	// Get a cgroupfs managed cgroup from the pid
-	manager, err := cgroups.GetManagerForPid(i.Pid)
-	if err != nil {
-		return fmt.Errorf("while getting cgroup manager for pid: %v", err)
-	}
-
-	// Otherwise print shortened table
-	tabWriter := tabwriter.NewWriter(os.Stdout, 0, 8, 4, ' ', 0)
-	defer tabWriter.Flush()
-
-	// Retrieve initial state, for first CPU measurement
-	stats, err := manager.GetStats()
-	if err != nil {
-		return fmt.Errorf("while getting stats for pid: %v", err)
-	}
-	prevCPU := stats.CpuStats.CpuUsage.TotalUsage
-	prevTime, err := safecast.Convert[uint64](time.Now().UnixNano())
-	if err != nil {
-		return err
-	}
-	cpuPercent := 0.0
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-
-		case <-time.After(1 * time.Second):
-
-			// Stream clears the terminal and reprint header and stats each time
-			if !noStream {
-				goterm.Clear()
-				goterm.MoveCursor(1, 1)
-				goterm.Flush()
-			}
-
-			// Retrieve new stats
-			stats, err := manager.GetStats()
-			if err != nil {
-				return fmt.Errorf("while getting stats for pid: %v", err)
-			}
-
-			// Do we want json?
-			if formatJSON {
-				enc := json.NewEncoder(os.Stdout)
-				enc.SetIndent("", "\t")
-				err = enc.Encode(stats)
-				return err
-			}
-
-			// Stats can be added from this set
-			// https://github.com/opencontainers/cgroups/blob/main/stats.go
-			_, err = fmt.Fprintln(tabWriter, "INSTANCE NAME\tCPU USAGE\tMEM USAGE / LIMIT\tMEM %\tBLOCK I/O\tPIDS")
-			if err != nil {
-				return fmt.Errorf("could not write stats header: %v", err)
-			}
-
-			cpuPercent, prevTime, prevCPU, err = calculateCPUUsage(prevTime, prevCPU, &stats.CpuStats)
-			if err != nil {
-				return err
-			}
-			memUsage, memLimit, memPercent := calculateMemoryUsage(&stats.MemoryStats)
-			blockRead, blockWrite := calculateBlockIO(&stats.BlkioStats)
-
-			// Generate a shortened stats list
-			_, err = fmt.Fprintf(tabWriter, "%s\t%.2f%%\t%s / %s\t%.2f%s\t%s / %s\t%d\n", i.Name,
-				cpuPercent, units.BytesSize(memUsage), units.BytesSize(memLimit),
-				memPercent, "%", units.BytesSize(blockRead), units.BytesSize(blockWrite),
-				stats.PidsStats.Current)
-			tabWriter.Flush()
-			if err != nil {
-				return fmt.Errorf("could not write instance stats: %v", err)
-			}
-
-			// We don't want a stream, return after just one record
-			if noStream {
-				return nil
-			}
-		}
-	}
-}
-
 // StopInstance fetches instance list, applying name and
 // user filters, and stops them by sending a signal sig. If an instance
 // is still running after a grace period defined by timeout is expired,
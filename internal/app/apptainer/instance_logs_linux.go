@@ -0,0 +1,172 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+// Streams of instance logs.
+const (
+	LogsStreamStdout = "stdout"
+	LogsStreamStderr = "stderr"
+)
+
+// logsFollowInterval is the time between two reads of followed log files.
+const logsFollowInterval = 250 * time.Millisecond
+
+// InstanceLogsOptions are the options of InstanceLogs.
+type InstanceLogsOptions struct {
+	// Follow keeps printing new log lines until the context is canceled
+	// or the instance stops.
+	Follow bool
+	// Tail is the number of lines to print from the end of the logs, all
+	// lines are printed if negative.
+	Tail int
+	// Since only prints the lines logged at or after this time, if not
+	// zero. Lines without timestamp are always printed.
+	Since time.Time
+	// Stream only prints the lines of this stream, if not empty.
+	Stream string
+}
+
+// ParseLogsSince parses the value of the since option of instance logs,
+// either a duration relative to now or a timestamp.
+func ParseLogsSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, must be a duration (e.g. 10m) or a timestamp (e.g. 2006-01-02T15:04:05)", s)
+}
+
+// InstanceLogs prints the logs of the named instance to w, merging the
+// standard output and error streams. Logs of stopped instances are printed
+// as long as their log files remain.
+func InstanceLogs(ctx context.Context, w io.Writer, name string, opts InstanceLogsOptions) error {
+	if err := instance.CheckName(name); err != nil {
+		return err
+	}
+	if opts.Stream != "" && opts.Stream != LogsStreamStdout && opts.Stream != LogsStreamStderr {
+		return fmt.Errorf("invalid stream %q, must be %s or %s", opts.Stream, LogsStreamStdout, LogsStreamStderr)
+	}
+
+	ii, err := instance.List("", name, instance.AppSubDir, true)
+	if err != nil {
+		return fmt.Errorf("could not retrieve instance list: %w", err)
+	}
+	running := len(ii) == 1
+
+	errPath, outPath, err := instance.GetLogFilePaths(name, instance.LogSubDir)
+	if err != nil {
+		return fmt.Errorf("could not find log paths: %w", err)
+	}
+	if running {
+		errPath, outPath = ii[0].LogErrPath, ii[0].LogOutPath
+	}
+
+	var readers []*instance.LogFileReader
+	found := false
+	for _, l := range []struct{ stream, path string }{
+		{LogsStreamStdout, outPath},
+		{LogsStreamStderr, errPath},
+	} {
+		if _, err := os.Stat(l.path); err == nil {
+			found = true
+		}
+		if opts.Stream == "" || opts.Stream == l.stream {
+			readers = append(readers, instance.NewLogFileReader(l.path, l.stream))
+		}
+	}
+	if !found {
+		return fmt.Errorf("no logs found for instance %s", name)
+	}
+
+	follow := opts.Follow && running
+	entries, err := readLogs(readers, !follow, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Tail >= 0 && len(entries) > opts.Tail {
+		entries = entries[len(entries)-opts.Tail:]
+	}
+	if err := printLogs(w, entries); err != nil || !follow {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logsFollowInterval):
+		}
+
+		ii, err := instance.List("", name, instance.AppSubDir, true)
+		if err != nil {
+			return fmt.Errorf("could not retrieve instance list: %w", err)
+		}
+		stopped := len(ii) == 0
+
+		entries, err := readLogs(readers, stopped, opts)
+		if err != nil {
+			return err
+		}
+		if err := printLogs(w, entries); err != nil || stopped {
+			return err
+		}
+	}
+}
+
+// readLogs reads the new entries of the log files, in time order, keeping
+// those selected by opts. Lines not terminated by a newline are only read
+// if flush is set.
+func readLogs(readers []*instance.LogFileReader, flush bool, opts InstanceLogsOptions) ([]instance.LogEntry, error) {
+	lists := make([][]instance.LogEntry, 0, len(readers))
+	for _, r := range readers {
+		entries, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("while reading logs: %w", err)
+		}
+		if flush {
+			entries = append(entries, r.Flush()...)
+		}
+		lists = append(lists, entries)
+	}
+
+	var entries []instance.LogEntry
+	for _, e := range instance.MergeLogEntries(lists...) {
+		if opts.Stream != "" && e.Stream != opts.Stream {
+			continue
+		}
+		if !opts.Since.IsZero() && !e.Time.IsZero() && e.Time.Before(opts.Since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func printLogs(w io.Writer, entries []instance.LogEntry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(w, e.Log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLogsSince(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+
+	tests := []struct {
+		since   string
+		want    time.Time
+		wantErr bool
+	}{
+		{since: "10m", want: now.Add(-10 * time.Minute)},
+		{since: "1h30m", want: now.Add(-90 * time.Minute)},
+		{since: "2024-01-01T10:00:00Z", want: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{since: "2024-01-01T10:00:00", want: time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)},
+		{since: "2024-01-01", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+		{since: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.since, func(t *testing.T) {
+			got, err := ParseLogsSince(tt.since, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v (want error %v)", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/metric"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	libcgroups "github.com/opencontainers/cgroups"
+)
+
+// metricsPath is the HTTP path serving instance metrics.
+const metricsPath = "/metrics"
+
+// instanceStat holds the cgroup statistics of an instance.
+type instanceStat struct {
+	file  *instance.File
+	stats *libcgroups.Stats
+}
+
+// instanceMetric describes a metric exported for each instance. value
+// returns false if the metric is not available from the statistics.
+type instanceMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func(*libcgroups.Stats) (float64, bool)
+}
+
+var instanceMetrics = []instanceMetric{
+	{
+		name: "apptainer_instance_cpu_usage_seconds_total",
+		help: "Total CPU time consumed by the instance in seconds.",
+		typ:  metric.CounterType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.CpuStats.CpuUsage.TotalUsage) / float64(time.Second), true
+		},
+	},
+	{
+		name: "apptainer_instance_cpu_user_seconds_total",
+		help: "CPU time consumed by the instance in user mode in seconds.",
+		typ:  metric.CounterType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.CpuStats.CpuUsage.UsageInUsermode) / float64(time.Second), true
+		},
+	},
+	{
+		name: "apptainer_instance_cpu_system_seconds_total",
+		help: "CPU time consumed by the instance in kernel mode in seconds.",
+		typ:  metric.CounterType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.CpuStats.CpuUsage.UsageInKernelmode) / float64(time.Second), true
+		},
+	},
+	{
+		name: "apptainer_instance_cpu_throttled_seconds_total",
+		help: "Time the instance was throttled by its CPU limit in seconds.",
+		typ:  metric.CounterType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.CpuStats.ThrottlingData.ThrottledTime) / float64(time.Second), true
+		},
+	},
+	{
+		name: "apptainer_instance_memory_usage_bytes",
+		help: "Current memory usage of the instance in bytes.",
+		typ:  metric.GaugeType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.MemoryStats.Usage.Usage), true
+		},
+	},
+	{
+		name: "apptainer_instance_memory_max_usage_bytes",
+		help: "Maximum memory usage recorded for the instance in bytes.",
+		typ:  metric.GaugeType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.MemoryStats.Usage.MaxUsage), s.MemoryStats.Usage.MaxUsage != 0
+		},
+	},
+	{
+		name: "apptainer_instance_memory_limit_bytes",
+		help: "Memory limit of the instance in bytes.",
+		typ:  metric.GaugeType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			limit := s.MemoryStats.Usage.Limit
+			return float64(limit), limit != 0 && limit != math.MaxUint64
+		},
+	},
+	{
+		name: "apptainer_instance_swap_usage_bytes",
+		help: "Current swap usage of the instance in bytes.",
+		typ:  metric.GaugeType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.MemoryStats.SwapUsage.Usage), true
+		},
+	},
+	{
+		name: "apptainer_instance_blkio_read_bytes_total",
+		help: "Total bytes read from block devices by the instance.",
+		typ:  metric.CounterType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			read, _ := calculateBlockIO(&s.BlkioStats)
+			return read, true
+		},
+	},
+	{
+		name: "apptainer_instance_blkio_write_bytes_total",
+		help: "Total bytes written to block devices by the instance.",
+		typ:  metric.CounterType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			_, write := calculateBlockIO(&s.BlkioStats)
+			return write, true
+		},
+	},
+	{
+		name: "apptainer_instance_pids",
+		help: "Current number of processes of the instance.",
+		typ:  metric.GaugeType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			return float64(s.PidsStats.Current), true
+		},
+	},
+	{
+		name: "apptainer_instance_pids_limit",
+		help: "Maximum number of processes of the instance.",
+		typ:  metric.GaugeType,
+		value: func(s *libcgroups.Stats) (float64, bool) {
+			limit := s.PidsStats.Limit
+			return float64(limit), limit != 0 && limit != math.MaxUint64
+		},
+	},
+}
+
+// instanceFamilies returns the metric families for the statistics of
+// instances.
+func instanceFamilies(stats []instanceStat) []metric.Family {
+	info := metric.Family{
+		Name: "apptainer_instance_info",
+		Help: "Information about the instance, with a constant value of 1.",
+		Type: metric.GaugeType,
+	}
+	families := make([]metric.Family, 0, len(instanceMetrics)+2)
+
+	for _, st := range stats {
+		info.Samples = append(info.Samples, metric.Sample{
+			Labels: map[string]string{
+				"instance": st.file.Name,
+				"user":     st.file.User,
+				"image":    st.file.Image,
+				"pid":      strconv.Itoa(st.file.Pid),
+				"ip":       st.file.IP,
+			},
+			Value: 1,
+		})
+	}
+	families = append(families, metric.Family{
+		Name:    "apptainer_instances",
+		Help:    "Number of instances with cgroup statistics.",
+		Type:    metric.GaugeType,
+		Samples: []metric.Sample{{Value: float64(len(stats))}},
+	}, info)
+
+	for _, m := range instanceMetrics {
+		f := metric.Family{
+			Name: m.name,
+			Help: m.help,
+			Type: m.typ,
+		}
+		for _, st := range stats {
+			v, ok := m.value(st.stats)
+			if !ok {
+				continue
+			}
+			f.Samples = append(f.Samples, metric.Sample{
+				Labels: map[string]string{"instance": st.file.Name, "user": st.file.User},
+				Value:  v,
+			})
+		}
+		families = append(families, f)
+	}
+
+	return families
+}
+
+// collectInstanceStats returns the cgroup statistics of the instances of
+// instanceUser matching name. Instances without cgroup, or whose statistics
+// can't be retrieved, are skipped.
+func collectInstanceStats(instanceUser, name string) ([]instanceStat, error) {
+	ii, err := instance.List(instanceUser, name, instance.AppSubDir, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve instance list: %w", err)
+	}
+
+	stats := make([]instanceStat, 0, len(ii))
+	for _, i := range ii {
+		if !i.Cgroup {
+			sylog.Debugf("Skipping instance %s without cgroup", i.Name)
+			continue
+		}
+		manager, err := cgroups.GetManagerForPid(i.Pid)
+		if err != nil {
+			sylog.Debugf("While getting cgroup manager for instance %s: %v", i.Name, err)
+			continue
+		}
+		s, err := manager.GetStats()
+		if err != nil {
+			sylog.Debugf("While getting stats for instance %s: %v", i.Name, err)
+			continue
+		}
+		stats = append(stats, instanceStat{file: i, stats: s})
+	}
+	return stats, nil
+}
+
+// ServeInstanceMetrics serves the cgroup statistics of the instances of
+// instanceUser matching name in Prometheus text format, on addr at /metrics,
+// until ctx is canceled. Instances are listed on each scrape, so that
+// instances started later are exported.
+func ServeInstanceMetrics(ctx context.Context, addr, name, instanceUser string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, func(w http.ResponseWriter, _ *http.Request) {
+		stats, err := collectInstanceStats(instanceUser, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", metric.TextContentType)
+		if err := metric.WriteText(w, instanceFamilies(stats)); err != nil {
+			sylog.Debugf("While writing metrics: %v", err)
+		}
+	})
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("while listening on %s: %v", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	sylog.Infof("Serving instance metrics on http://%s%s", ln.Addr(), metricsPath)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/metric"
+	libcgroups "github.com/opencontainers/cgroups"
+)
+
+func TestInstanceFamilies(t *testing.T) {
+	stats := []instanceStat{
+		{
+			file: &instance.File{Name: "web", User: "alice", Image: "/tmp/web.sif", Pid: 42},
+			stats: &libcgroups.Stats{
+				CpuStats: libcgroups.CpuStats{
+					CpuUsage: libcgroups.CpuUsage{TotalUsage: 1500000000},
+				},
+				MemoryStats: libcgroups.MemoryStats{
+					Usage: libcgroups.MemoryData{Usage: 1024, Limit: math.MaxUint64},
+				},
+				BlkioStats: libcgroups.BlkioStats{
+					IoServiceBytesRecursive: []libcgroups.BlkioStatEntry{
+						{Op: "Read", Value: 10},
+						{Op: "Write", Value: 20},
+						{Op: "read", Value: 5},
+					},
+				},
+				PidsStats: libcgroups.PidsStats{Current: 3, Limit: 100},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := metric.WriteText(&buf, instanceFamilies(stats)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"apptainer_instances 1\n",
+		`apptainer_instance_info{image="/tmp/web.sif",instance="web",ip="",pid="42",user="alice"} 1` + "\n",
+		`apptainer_instance_cpu_usage_seconds_total{instance="web",user="alice"} 1.5` + "\n",
+		`apptainer_instance_memory_usage_bytes{instance="web",user="alice"} 1024` + "\n",
+		`apptainer_instance_blkio_read_bytes_total{instance="web",user="alice"} 15` + "\n",
+		`apptainer_instance_blkio_write_bytes_total{instance="web",user="alice"} 20` + "\n",
+		`apptainer_instance_pids{instance="web",user="alice"} 3` + "\n",
+		`apptainer_instance_pids_limit{instance="web",user="alice"} 100` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+	// unlimited memory is not exported as a limit
+	if strings.Contains(out, "apptainer_instance_memory_limit_bytes") {
+		t.Errorf("unexpected memory limit in output:\n%s", out)
+	}
+}
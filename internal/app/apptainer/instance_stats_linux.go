@@ -0,0 +1,409 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/buger/goterm"
+	units "github.com/docker/go-units"
+)
+
+// Output formats of instance statistics.
+const (
+	StatsFormatTable = "table"
+	StatsFormatJSON  = "json"
+	StatsFormatCSV   = "csv"
+)
+
+// defaultStatsInterval is the time between two samples of instance statistics.
+const defaultStatsInterval = time.Second
+
+// InstanceStatsOptions are the options of InstanceStats.
+type InstanceStatsOptions struct {
+	// Format is the output format, one of table, json or csv.
+	Format string
+	// RawJSON prints the raw cgroup statistics of a single instance in json,
+	// for a single timepoint.
+	RawJSON bool
+	// Watch samples statistics until the context is canceled. Tables are
+	// refreshed in place, while json and csv records are appended.
+	Watch bool
+	// Interval is the time between two samples.
+	Interval time.Duration
+}
+
+// instanceStatsRecord is a sample of the statistics of an instance.
+type instanceStatsRecord struct {
+	Time       time.Time `json:"time"`
+	Instance   string    `json:"instance"`
+	Pid        int       `json:"pid"`
+	CPUPercent float64   `json:"cpuPercent"`
+	MemUsage   uint64    `json:"memUsage"`
+	MemLimit   uint64    `json:"memLimit"`
+	MemPercent float64   `json:"memPercent"`
+	BlockRead  uint64    `json:"blockRead"`
+	BlockWrite uint64    `json:"blockWrite"`
+	Pids       uint64    `json:"pids"`
+}
+
+var statsCSVHeader = []string{
+	"time",
+	"instance",
+	"pid",
+	"cpu_percent",
+	"mem_usage_bytes",
+	"mem_limit_bytes",
+	"mem_percent",
+	"block_read_bytes",
+	"block_write_bytes",
+	"pids",
+}
+
+func (r instanceStatsRecord) csvFields() []string {
+	return []string{
+		r.Time.Format(time.RFC3339),
+		r.Instance,
+		strconv.Itoa(r.Pid),
+		strconv.FormatFloat(r.CPUPercent, 'f', 2, 64),
+		strconv.FormatUint(r.MemUsage, 10),
+		strconv.FormatUint(r.MemLimit, 10),
+		strconv.FormatFloat(r.MemPercent, 'f', 2, 64),
+		strconv.FormatUint(r.BlockRead, 10),
+		strconv.FormatUint(r.BlockWrite, 10),
+		strconv.FormatUint(r.Pids, 10),
+	}
+}
+
+// statsWriter writes samples of instance statistics.
+type statsWriter interface {
+	write(records []instanceStatsRecord) error
+}
+
+// tableStatsWriter writes samples as a table, clearing the terminal before
+// each sample if clear is set.
+type tableStatsWriter struct {
+	w     io.Writer
+	clear bool
+}
+
+func (t *tableStatsWriter) write(records []instanceStatsRecord) error {
+	if t.clear {
+		goterm.Clear()
+		goterm.MoveCursor(1, 1)
+		goterm.Flush()
+	}
+
+	tabWriter := tabwriter.NewWriter(t.w, 0, 8, 4, ' ', 0)
+
+	// Stats can be added from this set
+	// https://github.com/opencontainers/cgroups/blob/main/stats.go
+	_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tCPU USAGE\tMEM USAGE / LIMIT\tMEM %\tBLOCK I/O\tPIDS")
+	if err != nil {
+		return fmt.Errorf("could not write stats header: %v", err)
+	}
+
+	for _, r := range records {
+		// Generate a shortened stats list
+		_, err = fmt.Fprintf(tabWriter, "%s\t%.2f%%\t%s / %s\t%.2f%s\t%s / %s\t%d\n", r.Instance,
+			r.CPUPercent, units.BytesSize(float64(r.MemUsage)), units.BytesSize(float64(r.MemLimit)),
+			r.MemPercent, "%", units.BytesSize(float64(r.BlockRead)), units.BytesSize(float64(r.BlockWrite)),
+			r.Pids)
+		if err != nil {
+			return fmt.Errorf("could not write instance stats: %v", err)
+		}
+	}
+	return tabWriter.Flush()
+}
+
+// jsonStatsWriter writes samples as JSON lines, one object per instance.
+type jsonStatsWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonStatsWriter) write(records []instanceStatsRecord) error {
+	for _, r := range records {
+		if err := j.enc.Encode(r); err != nil {
+			return fmt.Errorf("could not write instance stats: %v", err)
+		}
+	}
+	return nil
+}
+
+// csvStatsWriter writes samples as CSV rows, one per instance, after a
+// header written with the first sample.
+type csvStatsWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvStatsWriter) write(records []instanceStatsRecord) error {
+	if !c.header {
+		if err := c.w.Write(statsCSVHeader); err != nil {
+			return fmt.Errorf("could not write stats header: %v", err)
+		}
+		c.header = true
+	}
+	for _, r := range records {
+		if err := c.w.Write(r.csvFields()); err != nil {
+			return fmt.Errorf("could not write instance stats: %v", err)
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// newStatsWriter returns a writer of samples to w in the output format. Tables
+// are refreshed in place when watching.
+func newStatsWriter(w io.Writer, format string, watch bool) (statsWriter, error) {
+	switch format {
+	case StatsFormatTable:
+		return &tableStatsWriter{w: w, clear: watch}, nil
+	case StatsFormatJSON:
+		return &jsonStatsWriter{enc: json.NewEncoder(w)}, nil
+	case StatsFormatCSV:
+		return &csvStatsWriter{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown stats format %q, must be one of %s, %s or %s", format, StatsFormatTable, StatsFormatJSON, StatsFormatCSV)
+}
+
+// instanceStatsTracker samples the cgroup statistics of an instance, keeping
+// the CPU usage of the previous sample to compute the CPU percentage.
+type instanceStatsTracker struct {
+	file     *instance.File
+	manager  *cgroups.Manager
+	prevCPU  uint64
+	prevTime uint64
+}
+
+func newInstanceStatsTracker(file *instance.File) (*instanceStatsTracker, error) {
+	// Get a cgroupfs managed cgroup from the pid
+	manager, err := cgroups.GetManagerForPid(file.Pid)
+	if err != nil {
+		return nil, fmt.Errorf("while getting cgroup manager for pid: %v", err)
+	}
+	t := &instanceStatsTracker{
+		file:    file,
+		manager: manager,
+	}
+	// Retrieve initial state, for first CPU measurement
+	if _, err := t.sample(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// sample returns the current statistics of the instance.
+func (t *instanceStatsTracker) sample() (instanceStatsRecord, error) {
+	stats, err := t.manager.GetStats()
+	if err != nil {
+		return instanceStatsRecord{}, fmt.Errorf("while getting stats for pid: %v", err)
+	}
+
+	cpuPercent, curTime, curCPU, err := calculateCPUUsage(t.prevTime, t.prevCPU, &stats.CpuStats)
+	if err != nil {
+		return instanceStatsRecord{}, err
+	}
+	t.prevTime, t.prevCPU = curTime, curCPU
+
+	memUsage, memLimit, memPercent := calculateMemoryUsage(&stats.MemoryStats)
+	blockRead, blockWrite := calculateBlockIO(&stats.BlkioStats)
+
+	return instanceStatsRecord{
+		Time:       time.Now(),
+		Instance:   t.file.Name,
+		Pid:        t.file.Pid,
+		CPUPercent: cpuPercent,
+		MemUsage:   uint64(memUsage),
+		MemLimit:   uint64(memLimit),
+		MemPercent: memPercent,
+		BlockRead:  uint64(blockRead),
+		BlockWrite: uint64(blockWrite),
+		Pids:       stats.PidsStats.Current,
+	}, nil
+}
+
+// errNoCgroups is returned for instances started without cgroups.
+var errNoCgroups = errors.New("stats are only available if cgroups are enabled, see the Apptainer instance user guide for instructions")
+
+// trackInstances adds a tracker for the instances of ii not already tracked.
+// With strict, an error is returned for an instance whose statistics are not
+// available, otherwise it is skipped with a warning if warn is set.
+func trackInstances(trackers map[string]*instanceStatsTracker, ii []*instance.File, strict, warn bool) error {
+	logf := sylog.Debugf
+	if warn {
+		logf = sylog.Warningf
+	}
+
+	for _, i := range ii {
+		if _, ok := trackers[i.Name]; ok {
+			continue
+		}
+		if !i.Cgroup {
+			if strict {
+				return errNoCgroups
+			}
+			logf("Skipping instance %s started without cgroups", i.Name)
+			continue
+		}
+		t, err := newInstanceStatsTracker(i)
+		if err != nil {
+			if strict {
+				return err
+			}
+			logf("Skipping instance %s: %v", i.Name, err)
+			continue
+		}
+		trackers[i.Name] = t
+	}
+	return nil
+}
+
+// sampleInstances returns the statistics of the tracked instances, sorted by
+// instance name. Instances whose statistics can't be retrieved anymore, as
+// they were stopped, are not tracked anymore.
+func sampleInstances(trackers map[string]*instanceStatsTracker) []instanceStatsRecord {
+	names := make([]string, 0, len(trackers))
+	for name := range trackers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	records := make([]instanceStatsRecord, 0, len(names))
+	for _, name := range names {
+		r, err := trackers[name].sample()
+		if err != nil {
+			sylog.Verbosef("Instance %s is not tracked anymore: %v", name, err)
+			delete(trackers, name)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// printRawInstanceStats prints the raw cgroup statistics of the instance file
+// in json.
+func printRawInstanceStats(file *instance.File) error {
+	if !file.Cgroup {
+		return errNoCgroups
+	}
+	manager, err := cgroups.GetManagerForPid(file.Pid)
+	if err != nil {
+		return fmt.Errorf("while getting cgroup manager for pid: %v", err)
+	}
+	stats, err := manager.GetStats()
+	if err != nil {
+		return fmt.Errorf("while getting stats for pid: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(stats)
+}
+
+// InstanceStats uses underlying cgroups to get statistics for the instances
+// matching name, or all instances if name is empty. When watching, instances
+// are listed on each sample, so that instances started later are shown, and
+// the command returns when the context is canceled or when no instance
+// matching a name other than the "*" wildcard is left.
+func InstanceStats(ctx context.Context, name, instanceUser string, opts InstanceStatsOptions) error {
+	if name == "" {
+		name = "*"
+	}
+	if opts.Format == "" {
+		opts.Format = StatsFormatTable
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultStatsInterval
+	}
+
+	ii, err := instanceListOrError(instanceUser, name)
+	if err != nil {
+		return err
+	}
+
+	if opts.RawJSON {
+		// Raw stats required 1 instance
+		if len(ii) != 1 {
+			return fmt.Errorf("query returned more than one instance (%d)", len(ii))
+		}
+		if opts.Watch {
+			sylog.Warningf("JSON output is only available for a single timepoint (--no-stream), use --format json to watch an instance")
+		}
+		return printRawInstanceStats(ii[0])
+	}
+
+	w, err := newStatsWriter(os.Stdout, opts.Format, opts.Watch)
+	if err != nil {
+		return err
+	}
+
+	trackers := make(map[string]*instanceStatsTracker)
+	if err := trackInstances(trackers, ii, len(ii) == 1, true); err != nil {
+		return err
+	}
+	if len(trackers) == 0 {
+		return errNoCgroups
+	}
+	if len(ii) == 1 && opts.Format == StatsFormatTable {
+		sylog.Infof("Stats for %s instance of %s (PID=%d)\n", ii[0].Name, ii[0].Image, ii[0].Pid)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Interval):
+		}
+
+		if opts.Watch {
+			ii, err := instance.List(instanceUser, name, instance.AppSubDir, true)
+			if err != nil {
+				return fmt.Errorf("could not retrieve instance list: %w", err)
+			}
+			listed := make(map[string]bool, len(ii))
+			for _, i := range ii {
+				listed[i.Name] = true
+			}
+			for n := range trackers {
+				if !listed[n] {
+					delete(trackers, n)
+				}
+			}
+			// Errors are ignored when not strict
+			_ = trackInstances(trackers, ii, false, false)
+		}
+
+		records := sampleInstances(trackers)
+		if len(records) == 0 && name != "*" {
+			return fmt.Errorf("no instance found")
+		}
+		if err := w.write(records); err != nil {
+			return err
+		}
+
+		// We don't want a stream, return after just one record
+		if !opts.Watch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsWriters(t *testing.T) {
+	records := []instanceStatsRecord{
+		{
+			Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Instance:   "db",
+			Pid:        42,
+			CPUPercent: 12.345,
+			MemUsage:   1024 * 1024,
+			MemLimit:   250 * 1024 * 1024,
+			MemPercent: 0.4,
+			BlockRead:  10,
+			BlockWrite: 20,
+			Pids:       3,
+		},
+		{
+			Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Instance: "web",
+			Pid:      43,
+		},
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: StatsFormatTable,
+			want: []string{
+				"INSTANCE NAME    CPU USAGE    MEM USAGE / LIMIT    MEM %    BLOCK I/O    PIDS\n",
+				"db               12.35%       1MiB / 250MiB",
+				"web              0.00%",
+			},
+		},
+		{
+			format: StatsFormatCSV,
+			want: []string{
+				"time,instance,pid,cpu_percent,mem_usage_bytes,mem_limit_bytes,mem_percent,block_read_bytes,block_write_bytes,pids\n",
+				"2024-01-02T03:04:05Z,db,42,12.35,1048576,262144000,0.40,10,20,3\n",
+				"2024-01-02T03:04:05Z,web,43,0.00,0,0,0.00,0,0,0\n",
+			},
+		},
+		{
+			format: StatsFormatJSON,
+			want: []string{
+				`{"time":"2024-01-02T03:04:05Z","instance":"db","pid":42,"cpuPercent":12.345,"memUsage":1048576,"memLimit":262144000,"memPercent":0.4,"blockRead":10,"blockWrite":20,"pids":3}` + "\n",
+				`{"time":"2024-01-02T03:04:05Z","instance":"web","pid":43,`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := newStatsWriter(&buf, tt.format, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := w.write(records); err != nil {
+				t.Fatalf("while writing first sample: %v", err)
+			}
+			first := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(first, want) {
+					t.Errorf("output does not contain %q:\n%s", want, first)
+				}
+			}
+
+			// records are appended, the csv header is written once
+			buf.Reset()
+			if err := w.write(records); err != nil {
+				t.Fatalf("while writing second sample: %v", err)
+			}
+			hasHeader := strings.HasPrefix(buf.String(), "time,") || strings.HasPrefix(buf.String(), "INSTANCE NAME")
+			if want := tt.format == StatsFormatTable; hasHeader != want {
+				t.Errorf("header in second sample = %v, expected %v", hasHeader, want)
+			}
+		})
+	}
+
+	if _, err := newStatsWriter(&bytes.Buffer{}, "xml", false); err == nil {
+		t.Errorf("unexpected success with unknown format")
+	}
+}
+
+func TestStatsJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newStatsWriter(&buf, StatsFormatJSON, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.write([]instanceStatsRecord{{Instance: "a"}, {Instance: "b"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, expected 2", len(lines))
+	}
+	for i, name := range []string{"a", "b"} {
+		var r instanceStatsRecord
+		if err := json.Unmarshal([]byte(lines[i]), &r); err != nil {
+			t.Fatalf("line %d is not a json object: %v", i, err)
+		}
+		if r.Instance != name {
+			t.Errorf("line %d is for instance %q, expected %q", i, r.Instance, name)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/ext3"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	units "github.com/docker/go-units"
+)
+
+// Change kinds reported by OverlayInspect.
+const (
+	overlayAdded    = "A"
+	overlayModified = "M"
+	overlayDeleted  = "D"
+	// overlayChanged is reported when the base image isn't known
+	overlayChanged = "C"
+)
+
+// baseLayers holds the read-only layers below a writable overlay, from the
+// top one to the root filesystem.
+type baseLayers []layerFS
+
+// lookup returns the layer holding the file name visible through the
+// layers, and its information.
+func (b baseLayers) lookup(name string) (layerFS, fs.FileInfo, error) {
+	for _, l := range b {
+		fi, err := l.Lstat(name)
+		if err == nil {
+			if isWhiteout(fi) {
+				break
+			}
+			return l, fi, nil
+		}
+		if hidesLower(l, name) {
+			break
+		}
+	}
+	return nil, nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+}
+
+// hidesLower returns whether a parent directory of name is replaced,
+// deleted or opaque in the layer, hiding name in the lower layers.
+func hidesLower(l layerFS, name string) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		fi, err := l.Lstat(dir)
+		if err != nil {
+			continue
+		}
+		if !fi.IsDir() {
+			return true
+		}
+		if xattrs, err := l.Xattrs(dir); err == nil && isOpaque(xattrs) {
+			return true
+		}
+	}
+	return false
+}
+
+// exists returns whether the file name is visible through the layers.
+func (b baseLayers) exists(name string) bool {
+	_, _, err := b.lookup(name)
+	return err == nil
+}
+
+// imageLayers returns the root filesystem and the read-only overlay layers
+// of an image, from the top layer to the root filesystem. The writable
+// overlay partitions are ignored.
+func imageLayers(img *image.Image) (baseLayers, error) {
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return nil, fmt.Errorf("while getting root filesystem of %s: %w", img.Path, err)
+	}
+	rootfs, err := openLayerPartition(img, *part)
+	if err != nil {
+		return nil, fmt.Errorf("while reading root filesystem of %s: %w", img.Path, err)
+	}
+	layers := baseLayers{rootfs}
+
+	overlays, err := img.GetOverlayPartitions()
+	if err != nil {
+		return nil, fmt.Errorf("while getting overlay partitions of %s: %w", img.Path, err)
+	}
+	for _, overlay := range overlays {
+		if overlay.Type != image.SQUASHFS {
+			continue
+		}
+		l, err := openLayerPartition(img, overlay)
+		if err != nil {
+			return nil, fmt.Errorf("while reading overlay partition %d of %s: %w", overlay.ID, img.Path, err)
+		}
+		layers = append(baseLayers{l}, layers...)
+	}
+	return layers, nil
+}
+
+// readBaseLayers returns the root filesystem and the read-only overlay
+// layers of an image, or nil if they can't be read.
+func readBaseLayers(img *image.Image) baseLayers {
+	layers, err := imageLayers(img)
+	if err != nil {
+		sylog.Warningf("Could not read the base layers, changes are not compared: %s", err)
+		return nil
+	}
+	return layers
+}
+
+func overlayTypeName(t uint32) string {
+	switch t {
+	case image.EXT3:
+		return "ext3"
+	case image.SQUASHFS:
+		return "squashfs"
+	case image.EROFS:
+		return "erofs"
+	case image.ENCRYPTSQUASHFS:
+		return "encrypted squashfs"
+	}
+	return "unknown"
+}
+
+// OverlayInspect writes the overlay partitions of a SIF image, or the ext3
+// overlay image, with their usage and the changes of the writable overlay
+// to the base image. The base image of an ext3 overlay image is optional,
+// without it the changes aren't compared.
+func OverlayInspect(w io.Writer, imgPath, basePath string) error {
+	img, err := image.Init(imgPath, false)
+	if err != nil {
+		return fmt.Errorf("while opening image file %s: %s", imgPath, err)
+	}
+	defer img.File.Close()
+
+	var base baseLayers
+	var overlays []image.Section
+	switch img.Type {
+	case image.SIF:
+		if basePath != "" {
+			return fmt.Errorf("a base image can only be provided for an ext3 overlay image")
+		}
+		base = readBaseLayers(img)
+		if overlays, err = img.GetOverlayPartitions(); err != nil {
+			return fmt.Errorf("while getting SIF overlay partitions: %s", err)
+		}
+	case image.EXT3:
+		// image usage is only set to overlay by the runtime
+		overlays = img.Partitions
+		if basePath != "" {
+			baseImg, err := image.Init(basePath, false)
+			if err != nil {
+				return fmt.Errorf("while opening image file %s: %s", basePath, err)
+			}
+			defer baseImg.File.Close()
+			base = readBaseLayers(baseImg)
+		}
+	default:
+		return fmt.Errorf("%s is not an ext3 overlay image or a SIF image", imgPath)
+	}
+
+	if len(overlays) == 0 {
+		fmt.Fprintf(w, "No overlay partition found in %s\n", imgPath)
+		return nil
+	}
+
+	var writable []*ext3.FS
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tSIZE\tUSED\tINODES")
+	for _, overlay := range overlays {
+		l, err := openLayerPartition(img, overlay)
+		if err != nil {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t-\t-\n", overlay.ID, overlayTypeName(overlay.Type), units.BytesSize(float64(overlay.Size)))
+			continue
+		}
+		efs, ok := l.(*ext3.FS)
+		if !ok {
+			fmt.Fprintf(tw, "%d\tsquashfs (read-only)\t%s\t-\t-\n", overlay.ID, units.BytesSize(float64(overlay.Size)))
+			continue
+		}
+		u := efs.Usage()
+		used := (u.Blocks - u.FreeBlocks) * uint64(u.BlockSize)
+		total := u.Blocks * uint64(u.BlockSize)
+		fmt.Fprintf(tw, "%d\text3 (writable)\t%s\t%s (%d%%)\t%d/%d\n",
+			overlay.ID, units.BytesSize(float64(overlay.Size)),
+			units.BytesSize(float64(used)), used*100/max(total, 1),
+			u.Inodes-u.FreeInodes, u.Inodes,
+		)
+		writable = append(writable, efs)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, efs := range writable {
+		if efs.NeedsRecovery() {
+			sylog.Warningf("Writable overlay was not cleanly unmounted, reported changes may be outdated")
+		}
+		fmt.Fprintln(w, "\nChanges:")
+		if err := writeOverlayChanges(w, efs, base, "upper", "/"); err != nil {
+			return fmt.Errorf("while reading writable overlay changes: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeOverlayChanges writes the changes held by the directory dir of a
+// writable overlay, rel being its path in the container.
+func writeOverlayChanges(w io.Writer, efs *ext3.FS, base baseLayers, dir, rel string) error {
+	entries, err := efs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		src := path.Join(dir, e.Name())
+		name := path.Join(rel, e.Name())
+		fi, err := e.Info()
+		if err != nil {
+			return err
+		}
+
+		// paths are relative in the base layers
+		exists := base.exists(name[1:])
+		kind := overlayAdded
+		switch {
+		case base == nil:
+			kind = overlayChanged
+		case exists:
+			kind = overlayModified
+		}
+
+		if isWhiteout(fi) {
+			fmt.Fprintf(w, "%s %s\n", overlayDeleted, name)
+			continue
+		}
+		if !fi.IsDir() {
+			fmt.Fprintf(w, "%s %s\n", kind, name)
+			continue
+		}
+
+		xattrs, err := efs.Xattrs(src)
+		if err != nil {
+			return err
+		}
+		// directories are copied up with any change of their content,
+		// they are only reported when added or replacing the base one
+		if isOpaque(xattrs) || (base != nil && !exists) {
+			fmt.Fprintf(w, "%s %s/\n", kind, name)
+		}
+		if err := writeOverlayChanges(w, efs, base, src, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+const busyboxSIF = "../../../e2e/testdata/busybox_" + runtime.GOARCH + ".sif"
+
+// createOverlaySIF returns an unsigned copy of the busybox SIF image with
+// an ext3 overlay partition holding the files.
+func createOverlaySIF(t *testing.T, files []overlayFile) string {
+	t.Helper()
+
+	overlay := createExt3Overlay(t, files)
+
+	src, err := os.Open(busyboxSIF)
+	if err != nil {
+		t.Skipf("busybox image not available: %s", err)
+	}
+	defer src.Close()
+	sifPath := filepath.Join(t.TempDir(), "image.sif")
+	dst, err := os.Create(sifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// signed images can't be modified
+	f, err := sif.LoadContainerFromPath(sifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs, err := f.GetDescriptors(sif.WithDataType(sif.DataSignature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sig := range sigs {
+		if err := f.DeleteObject(sig.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := addOverlayToImage(sifPath, overlay); err != nil {
+		t.Fatal(err)
+	}
+	return sifPath
+}
+
+func TestOverlayInspect(t *testing.T) {
+	files := []overlayFile{
+		{name: "new", content: "new\n"},
+		{name: "etc/passwd", content: "root:x:0:0:root:/root:/bin/sh\n"},
+		{name: "etc/group", whiteout: true},
+		{name: "newdir/file", content: "file\n"},
+	}
+	sifPath := createOverlaySIF(t, files)
+
+	var buf bytes.Buffer
+	if err := OverlayInspect(&buf, sifPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"ext3 (writable)",
+		"A /new\n",
+		"M /etc/passwd\n",
+		"D /etc/group\n",
+		"A /newdir/\n",
+		"A /newdir/file\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q not found in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "/etc/\n") {
+		t.Errorf("unexpected modified directory in output:\n%s", out)
+	}
+
+	// without base image, the changes of a single overlay image aren't
+	// compared
+	buf.Reset()
+	overlay := createExt3Overlay(t, files)
+	if err := OverlayInspect(&buf, overlay, ""); err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	for _, want := range []string{"C /new\n", "C /etc/passwd\n", "D /etc/group\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q not found in output:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := OverlayInspect(&buf, overlay, busyboxSIF); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "M /etc/passwd\n") {
+		t.Errorf("changes not compared to the base image:\n%s", out)
+	}
+}
+
+func TestBaseLayersExists(t *testing.T) {
+	lower := openExt3(t, createExt3Overlay(t, []overlayFile{
+		{name: "dir/a", content: "a"},
+		{name: "dir/b", content: "b"},
+		{name: "gone/c", content: "c"},
+		{name: "file", content: "file"},
+	}))
+	upper := openExt3(t, createExt3Overlay(t, []overlayFile{
+		{name: "dir", directory: true, opaque: true},
+		{name: "dir/b", content: "new b"},
+		{name: "gone", whiteout: true},
+		{name: "new", content: "new"},
+	}))
+	layers := baseLayers{upper, lower}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"upper/dir/a", false},
+		{"upper/dir/b", true},
+		{"upper/gone", false},
+		{"upper/gone/c", false},
+		{"upper/file", true},
+		{"upper/new", true},
+		{"upper/missing", false},
+	}
+	for _, tt := range tests {
+		if got := layers.exists(tt.name); got != tt.want {
+			t.Errorf("exists(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/ext3"
+	"github.com/apptainer/apptainer/internal/pkg/image/packer"
+	"github.com/apptainer/apptainer/internal/pkg/image/squashfs"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/ccoveille/go-safecast"
+	"golang.org/x/sys/unix"
+)
+
+// opaqueXattrs are the extended attributes marking an overlay directory
+// as opaque, hiding the content of the lower layers.
+var opaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// layerFS is a read-only filesystem holding an overlay layer.
+type layerFS interface {
+	fs.ReadDirFS
+	Lstat(name string) (fs.FileInfo, error)
+	ReadLink(name string) (string, error)
+	Xattrs(name string) (map[string][]byte, error)
+}
+
+// layerStat holds the ownership and inode information of a layer file.
+type layerStat struct {
+	uid   uint32
+	gid   uint32
+	ino   uint32
+	nlink uint32
+	rdev  uint64
+}
+
+func statLayerFile(fi fs.FileInfo) layerStat {
+	switch st := fi.Sys().(type) {
+	case *squashfs.Stat:
+		return layerStat{uid: st.Uid, gid: st.Gid, ino: st.Ino, nlink: st.Nlink, rdev: st.Rdev}
+	case *ext3.Stat:
+		return layerStat{uid: st.Uid, gid: st.Gid, ino: st.Ino, nlink: st.Nlink, rdev: st.Rdev}
+	}
+	return layerStat{}
+}
+
+// isWhiteout returns whether the file hides the same path in the lower
+// layers.
+func isWhiteout(fi fs.FileInfo) bool {
+	return fi.Mode().Type() == fs.ModeDevice|fs.ModeCharDevice && statLayerFile(fi).rdev == 0
+}
+
+// isOpaque returns whether the extended attributes mark an opaque directory.
+func isOpaque(xattrs map[string][]byte) bool {
+	for _, name := range opaqueXattrs {
+		if string(xattrs[name]) == "y" {
+			return true
+		}
+	}
+	return false
+}
+
+// stagedEntry holds the attributes of a staged file, applied once all the
+// layers are staged.
+type stagedEntry struct {
+	mode   fs.FileMode
+	uid    uint32
+	gid    uint32
+	rdev   uint64
+	mtime  int64
+	xattrs map[string][]byte
+}
+
+func newStagedEntry(fi fs.FileInfo, xattrs map[string][]byte) *stagedEntry {
+	st := statLayerFile(fi)
+	return &stagedEntry{
+		mode:   fi.Mode(),
+		uid:    st.uid,
+		gid:    st.gid,
+		rdev:   st.rdev,
+		mtime:  fi.ModTime().UnixNano(),
+		xattrs: xattrs,
+	}
+}
+
+// layerStager stages the content of overlay layers in a directory, to be
+// packed as a single squashfs layer with mksquashfs. The ownership, the
+// device files and the extended attributes, which can't be created
+// without privileges, are described in a mksquashfs pseudo file.
+type layerStager struct {
+	dir     string
+	entries map[string]*stagedEntry
+	// links holds the staged path of the layer inodes with several links
+	links map[uint32]string
+}
+
+func newLayerStager(dir string) *layerStager {
+	return &layerStager{
+		dir:     dir,
+		entries: make(map[string]*stagedEntry),
+	}
+}
+
+// addLayer stages the content of the directory root of a layer on top of
+// the layers already staged, following the overlay semantics.
+func (s *layerStager) addLayer(l layerFS, root string) error {
+	s.links = make(map[uint32]string)
+
+	fi, err := l.Lstat(root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	s.entries["."] = newStagedEntry(fi, nil)
+	return s.addDir(l, root, ".")
+}
+
+func (s *layerStager) addDir(l layerFS, src, rel string) error {
+	entries, err := l.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), "\n") {
+			return fmt.Errorf("unsupported file name %q in %s", e.Name(), src)
+		}
+		if err := s.add(l, path.Join(src, e.Name()), path.Join(rel, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add stages the layer file src at rel.
+func (s *layerStager) add(l layerFS, src, rel string) error {
+	fi, err := l.Lstat(src)
+	if err != nil {
+		return err
+	}
+	xattrs, err := l.Xattrs(src)
+	if err != nil {
+		return err
+	}
+	entry := newStagedEntry(fi, xattrs)
+	target := filepath.Join(s.dir, filepath.FromSlash(rel))
+	cur, exists := s.entries[rel]
+
+	if fi.IsDir() {
+		opaque := isOpaque(xattrs)
+		if exists && cur.mode.IsDir() {
+			// the lower directory hides the content below it
+			opaque = opaque || isOpaque(cur.xattrs)
+		} else if exists {
+			// a directory replacing a file or a whiteout hides the
+			// content of the layers below them
+			opaque = true
+		}
+		if exists && (opaque || !cur.mode.IsDir()) {
+			if err := s.remove(rel); err != nil {
+				return err
+			}
+			exists = false
+		}
+		if opaque && !isOpaque(xattrs) {
+			entry.xattrs = maps.Clone(xattrs)
+			if entry.xattrs == nil {
+				entry.xattrs = make(map[string][]byte)
+			}
+			entry.xattrs[opaqueXattrs[0]] = []byte("y")
+		}
+		if !exists {
+			if err := os.Mkdir(target, 0o700); err != nil {
+				return err
+			}
+		}
+		s.entries[rel] = entry
+		return s.addDir(l, src, rel)
+	}
+
+	if exists {
+		if err := s.remove(rel); err != nil {
+			return err
+		}
+	}
+
+	st := statLayerFile(fi)
+	switch fi.Mode().Type() {
+	case 0:
+		if linked, ok := s.links[st.ino]; ok {
+			if err := os.Link(filepath.Join(s.dir, filepath.FromSlash(linked)), target); err != nil {
+				return err
+			}
+			break
+		}
+		if err := copyLayerFile(l, src, target); err != nil {
+			return err
+		}
+		if st.nlink > 1 {
+			s.links[st.ino] = rel
+		}
+	case fs.ModeSymlink:
+		link, err := l.ReadLink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(link, target); err != nil {
+			return err
+		}
+	case fs.ModeNamedPipe:
+		if err := unix.Mkfifo(target, 0o600); err != nil {
+			return fmt.Errorf("while creating fifo %s: %w", target, err)
+		}
+	case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice:
+		// described in the pseudo file
+	default:
+		sylog.Warningf("Skipping %s with unsupported type %s", rel, fi.Mode().Type())
+		return nil
+	}
+	s.entries[rel] = entry
+	return nil
+}
+
+func copyLayerFile(l layerFS, src, target string) error {
+	in, err := l.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("while copying %s: %w", src, err)
+	}
+	return out.Close()
+}
+
+// remove removes the staged file rel and its content.
+func (s *layerStager) remove(rel string) error {
+	if err := os.RemoveAll(filepath.Join(s.dir, filepath.FromSlash(rel))); err != nil {
+		return err
+	}
+	delete(s.entries, rel)
+	prefix := rel + "/"
+	for name := range s.entries {
+		if strings.HasPrefix(name, prefix) {
+			delete(s.entries, name)
+		}
+	}
+	return nil
+}
+
+// pseudoMode returns the octal permissions of a file mode.
+func pseudoMode(mode fs.FileMode) string {
+	perm := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+// pseudoName returns a file name quoted for a mksquashfs pseudo file.
+func pseudoName(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// finish applies the staged attributes to the staged files and writes the
+// pseudo file, it returns the mksquashfs options packing the staged layer.
+func (s *layerStager) finish(pseudoFile string) ([]string, error) {
+	f, err := os.OpenFile(pseudoFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	names := slices.Sorted(maps.Keys(s.entries))
+	for _, name := range names {
+		e := s.entries[name]
+		if name == "." {
+			continue
+		}
+		switch e.mode.Type() {
+		case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice:
+			typ := "b"
+			if e.mode&fs.ModeCharDevice != 0 {
+				typ = "c"
+			}
+			fmt.Fprintf(w, "%s %s %s %d %d %d %d\n", pseudoName(name), typ, pseudoMode(e.mode), e.uid, e.gid, unix.Major(e.rdev), unix.Minor(e.rdev))
+		default:
+			fmt.Fprintf(w, "%s m %s %d %d\n", pseudoName(name), pseudoMode(e.mode), e.uid, e.gid)
+		}
+		for _, x := range slices.Sorted(maps.Keys(e.xattrs)) {
+			fmt.Fprintf(w, "%s x %s=0x%s\n", pseudoName(name), x, hex.EncodeToString(e.xattrs[x]))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	// the content of the directories is changed first, the deepest
+	// paths being sorted last
+	for _, name := range slices.Backward(names) {
+		e := s.entries[name]
+		target := filepath.Join(s.dir, filepath.FromSlash(name))
+		switch e.mode.Type() {
+		case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice:
+			continue
+		case fs.ModeSymlink:
+		default:
+			if err := os.Chmod(target, e.mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+				return nil, err
+			}
+		}
+		ts := unix.NsecToTimespec(e.mtime)
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, target, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return nil, fmt.Errorf("while changing modification time of %s: %w", target, err)
+		}
+	}
+
+	opts := []string{"-noappend", "-pf", pseudoFile}
+	if root, ok := s.entries["."]; ok {
+		if int(root.uid) != os.Getuid() {
+			opts = append(opts, "-root-uid", fmt.Sprint(root.uid))
+		}
+		if int(root.gid) != os.Getgid() {
+			opts = append(opts, "-root-gid", fmt.Sprint(root.gid))
+		}
+	}
+	return opts, nil
+}
+
+// packLayer stages the layers, in order from the lowest one, and packs
+// them as a single squashfs layer written to dest.
+func packLayer(tmpDir, dest string, stage func(*layerStager) error) error {
+	sqfs := packer.NewSquashfs()
+	if !sqfs.HasMksquashfs() {
+		return fmt.Errorf("could not create overlay layer, mksquashfs not found")
+	}
+
+	dir, err := os.MkdirTemp(tmpDir, "overlay-layer-")
+	if err != nil {
+		return fmt.Errorf("while creating temporary directory: %w", err)
+	}
+	defer func() {
+		// staged directories may not be writable
+		_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				_ = os.Chmod(p, 0o700)
+			}
+			return nil
+		})
+		_ = os.RemoveAll(dir)
+	}()
+
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0o700); err != nil {
+		return err
+	}
+	s := newLayerStager(root)
+	if err := stage(s); err != nil {
+		return fmt.Errorf("while staging overlay layer: %w", err)
+	}
+	opts, err := s.finish(filepath.Join(dir, "pseudo"))
+	if err != nil {
+		return fmt.Errorf("while staging overlay layer: %w", err)
+	}
+	if err := sqfs.Create([]string{root}, dest, opts); err != nil {
+		return fmt.Errorf("while creating squashfs layer: %w", err)
+	}
+	return nil
+}
+
+// openLayerPartition returns the filesystem of an ext3 or squashfs
+// partition of an image, holding a root filesystem or an overlay layer.
+func openLayerPartition(img *image.Image, part image.Section) (layerFS, error) {
+	r := io.NewSectionReader(img.File, int64(part.Offset), int64(part.Size))
+	switch part.Type {
+	case image.EXT3:
+		return ext3.New(r)
+	case image.SQUASHFS:
+		return squashfs.New(r)
+	}
+	return nil, fmt.Errorf("unsupported %s partition", overlayTypeName(part.Type))
+}
+
+// addOverlayPartition adds the partition file of type fstype to the SIF
+// image opened for writing as rw, on top of its other overlay partitions,
+// and deletes the replaced partitions. As the image can only be compacted
+// by truncating it, the replaced partitions are deleted first when they
+// are at the end of the image so the new partition takes their place.
+// Otherwise the partition is added first, so an interrupted operation
+// leaves the image usable.
+func addOverlayPartition(rw sif.ReadWriter, partPath string, fstype sif.FSType, replaced []uint32) error {
+	f, err := sif.LoadContainer(rw, sif.OptLoadWithCloseOnUnload(false))
+	if err != nil {
+		return err
+	}
+	defer f.UnloadContainer()
+
+	pf, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+
+	arch := f.PrimaryArch()
+	if arch == "unknown" {
+		arch = runtime.GOARCH
+	}
+
+	di, err := sif.NewDescriptorInput(sif.DataPartition, pf,
+		sif.OptPartitionMetadata(fstype, sif.PartOverlay, arch),
+	)
+	if err != nil {
+		return err
+	}
+
+	deleteReplaced := func(opts ...sif.DeleteOpt) error {
+		opts = append(opts, sif.OptDeleteCompact(true))
+		for _, id := range replaced {
+			if err := f.DeleteObject(id, opts...); err != nil {
+				return fmt.Errorf("while deleting overlay partition %d: %w", id, err)
+			}
+		}
+		return nil
+	}
+
+	// the space of trailing partitions is reclaimed by truncating the image
+	if trailingObjects(f, replaced) {
+		if err := deleteReplaced(); err != nil {
+			return err
+		}
+		replaced = nil
+	}
+	if err := f.AddObject(di); err != nil {
+		return fmt.Errorf("while adding overlay partition: %w", err)
+	}
+	return deleteReplaced(sif.OptDeleteZero(true))
+}
+
+// trailingObjects returns whether the objects ids are the last objects of
+// the data section of the SIF image f.
+func trailingObjects(f *sif.FileImage, ids []uint32) bool {
+	start, last := int64(-1), int64(-1)
+	f.WithDescriptors(func(d sif.Descriptor) bool {
+		if !slices.Contains(ids, d.ID()) {
+			last = max(last, d.Offset())
+		} else if start < 0 || d.Offset() < start {
+			start = d.Offset()
+		}
+		return false
+	})
+	return start >= 0 && last < start
+}
+
+// lockOverlay opens the image file for writing and puts a write lock on
+// its overlay partitions, replacing the read locks taken when img was
+// opened, it fails if they are in use by a container. The locks are held
+// until the returned file is closed.
+func lockOverlay(img *image.Image) (*os.File, error) {
+	rw, err := os.OpenFile(img.Path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("while opening %s for writing: %w", img.Path, err)
+	}
+	for _, part := range img.Partitions {
+		if part.AllowedUsage&image.OverlayUsage == 0 {
+			continue
+		}
+		start, err := safecast.Convert[int64](part.Offset)
+		if err != nil {
+			rw.Close()
+			return nil, err
+		}
+		size, err := safecast.Convert[int64](part.Size)
+		if err != nil {
+			rw.Close()
+			return nil, err
+		}
+		if err := lock.NewByteRange(int(img.Fd), start, size).Unlock(); err != nil && !errors.Is(err, lock.ErrLockNotSupported) {
+			rw.Close()
+			return nil, fmt.Errorf("while unlocking overlay of %s: %w", img.Path, err)
+		}
+		err = lock.NewByteRange(int(rw.Fd()), start, size).Lock()
+		if errors.Is(err, lock.ErrByteRangeAcquired) {
+			rw.Close()
+			return nil, fmt.Errorf("overlay of %s is currently in use by another process", img.Path)
+		} else if errors.Is(err, lock.ErrLockNotSupported) {
+			sylog.Verbosef("Could not lock overlay of %s, underlying filesystem seems to not support lock", img.Path)
+		} else if err != nil {
+			rw.Close()
+			return nil, fmt.Errorf("while locking overlay of %s: %w", img.Path, err)
+		}
+	}
+	return rw, nil
+}
+
+// openOverlaySIF opens a SIF image for the modification of its overlay
+// partitions, which isn't possible for signed images.
+func openOverlaySIF(imgPath string) (*image.Image, error) {
+	img, err := image.Init(imgPath, false)
+	if err != nil {
+		return nil, fmt.Errorf("while opening image file %s: %s", imgPath, err)
+	}
+	if img.Type != image.SIF {
+		img.File.Close()
+		return nil, fmt.Errorf("%s is not a SIF image", imgPath)
+	}
+	signed, err := isSigned(img.File)
+	if err != nil {
+		img.File.Close()
+		return nil, fmt.Errorf("while getting SIF info: %s", err)
+	} else if signed {
+		img.File.Close()
+		return nil, fmt.Errorf("SIF image %s is signed: could not modify overlay partitions", imgPath)
+	}
+	return img, nil
+}
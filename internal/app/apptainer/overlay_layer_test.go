@@ -0,0 +1,223 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/ext3"
+	"github.com/apptainer/apptainer/internal/pkg/image/squashfs"
+	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
+	"golang.org/x/sys/unix"
+)
+
+// overlayFile describes a file of a test overlay, an empty content
+// creating a directory unless a link target is set.
+type overlayFile struct {
+	name    string
+	content string
+	link    string
+	// hardlink is the name of the file hard linked to
+	hardlink  string
+	whiteout  bool
+	opaque    bool
+	directory bool
+}
+
+// createExt3Overlay creates an ext3 overlay image, with the overlay layout
+// and the files in its upper directory.
+func createExt3Overlay(t *testing.T, files []overlayFile) string {
+	t.Helper()
+	require.MkfsExt3(t)
+	if os.Getuid() != 0 {
+		t.Skip("creating whiteouts and trusted extended attributes requires privileges")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, d := range []string{"upper", "work"} {
+		if err := os.MkdirAll(filepath.Join(src, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		p := filepath.Join(src, "upper", f.name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		switch {
+		case f.whiteout:
+			err = unix.Mknod(p, unix.S_IFCHR, 0)
+		case f.link != "":
+			err = os.Symlink(f.link, p)
+		case f.hardlink != "":
+			err = os.Link(filepath.Join(src, "upper", f.hardlink), p)
+		case f.directory:
+			err = os.Mkdir(p, 0o755)
+		default:
+			err = os.WriteFile(p, []byte(f.content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.opaque {
+			if err := unix.Setxattr(p, "trusted.overlay.opaque", []byte("y"), 0); err != nil {
+				t.Skipf("could not set opaque extended attribute: %s", err)
+			}
+		}
+	}
+
+	img := filepath.Join(dir, "overlay.img")
+	cmd := exec.Command("mkfs.ext3", "-q", "-F", "-d", src, img, "64M")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("while creating ext3 image: %s: %s", err, out)
+	}
+	return img
+}
+
+func openExt3(t *testing.T, path string) *ext3.FS {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	efs, err := ext3.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return efs
+}
+
+func TestLayerStager(t *testing.T) {
+	lower := openExt3(t, createExt3Overlay(t, []overlayFile{
+		{name: "dir/replaced", content: "lower\n"},
+		{name: "dir/deleted", content: "deleted\n"},
+		{name: "hidden/file", content: "hidden\n"},
+		{name: "file", content: "file\n"},
+		{name: "hardlink", hardlink: "file"},
+		{name: "symlink", link: "file"},
+		{name: "whiteout", whiteout: true},
+	}))
+	upper := openExt3(t, createExt3Overlay(t, []overlayFile{
+		{name: "dir/replaced", content: "upper\n"},
+		{name: "dir/deleted", whiteout: true},
+		{name: "hidden", directory: true, opaque: true},
+		{name: "hidden/new", content: "new\n"},
+		{name: "symlink/file", content: "replaces a symlink\n"},
+		{name: "whiteout/file", content: "replaces a whiteout\n"},
+	}))
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	s := newLayerStager(root)
+	for _, l := range []*ext3.FS{lower, upper} {
+		if err := s.addLayer(l, "upper"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pseudo := filepath.Join(dir, "pseudo")
+	opts, err := s.finish(pseudo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts) < 3 || opts[1] != "-pf" || opts[2] != pseudo {
+		t.Errorf("unexpected mksquashfs options %v", opts)
+	}
+
+	contents := map[string]string{
+		"dir/replaced":  "upper\n",
+		"hidden/new":    "new\n",
+		"file":          "file\n",
+		"hardlink":      "file\n",
+		"symlink/file":  "replaces a symlink\n",
+		"whiteout/file": "replaces a whiteout\n",
+	}
+	for name, content := range contents {
+		if b, err := os.ReadFile(filepath.Join(root, name)); err != nil || string(b) != content {
+			t.Errorf("unexpected %s content %q: %v", name, b, err)
+		}
+	}
+	for _, name := range []string{"dir/deleted", "hidden/file"} {
+		if _, err := os.Lstat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("unexpected staged file %s: %v", name, err)
+		}
+	}
+	fi1, err1 := os.Stat(filepath.Join(root, "file"))
+	fi2, err2 := os.Stat(filepath.Join(root, "hardlink"))
+	if err1 != nil || err2 != nil || !os.SameFile(fi1, fi2) {
+		t.Errorf("hard link not preserved: %v %v", err1, err2)
+	}
+
+	b, err := os.ReadFile(pseudo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	for _, want := range []string{
+		`"dir/deleted" c 0000 0 0 0 0`,
+		`"dir/replaced" m 0644 0 0`,
+		`"hidden" x trusted.overlay.opaque=0x79`,
+		// directories replacing non-directories are opaque
+		`"symlink" x trusted.overlay.opaque=0x79`,
+		`"whiteout" x trusted.overlay.opaque=0x79`,
+	} {
+		found := false
+		for _, l := range lines {
+			found = found || l == want
+		}
+		if !found {
+			t.Errorf("pseudo file line %q not found in:\n%s", want, b)
+		}
+	}
+	if strings.Contains(string(b), `"dir" x`) {
+		t.Errorf("unexpected opaque merged directory:\n%s", b)
+	}
+}
+
+func TestLayerStagerSquashfs(t *testing.T) {
+	f, err := os.Open("../../pkg/image/squashfs/testdata/xattr.sqfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sfs, err := squashfs.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	s := newLayerStager(dir)
+	if err := s.addLayer(sfs, "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.finish(filepath.Join(t.TempDir(), "pseudo")); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := s.entries["wh"]; e == nil || e.mode.Type()&os.ModeCharDevice == 0 || e.rdev != 0 {
+		t.Errorf("unexpected whiteout entry %+v", e)
+	}
+	if e := s.entries["opaque"]; e == nil || !isOpaque(e.xattrs) {
+		t.Errorf("unexpected opaque directory entry %+v", e)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "link")); err != nil || target != "opaque/file" {
+		t.Errorf("unexpected link target %q: %v", target, err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// OverlayMerge merges the read-only squashfs overlay layers of a SIF image
+// into a single layer, which replaces them.
+func OverlayMerge(imgPath, tmpDir string) error {
+	img, err := openOverlaySIF(imgPath)
+	if err != nil {
+		return err
+	}
+	defer img.File.Close()
+	rw, err := lockOverlay(img)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+
+	overlays, err := img.GetOverlayPartitions()
+	if err != nil {
+		return fmt.Errorf("while getting SIF overlay partitions: %s", err)
+	}
+
+	var layers []image.Section
+	for _, overlay := range overlays {
+		switch overlay.Type {
+		case image.SQUASHFS:
+			layers = append(layers, overlay)
+		case image.EXT3:
+			// the merged layer is added on top of the partitions
+			return fmt.Errorf("a writable overlay partition exists in %s (ID: %d), seal or delete it first", imgPath, overlay.ID)
+		default:
+			return fmt.Errorf("unsupported overlay partition %d in %s", overlay.ID, imgPath)
+		}
+	}
+	if len(layers) < 2 {
+		return fmt.Errorf("%s doesn't have several squashfs overlay layers to merge", imgPath)
+	}
+
+	tmpDir, err = os.MkdirTemp(tmpDir, "overlay-merge-")
+	if err != nil {
+		return fmt.Errorf("while creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layer := filepath.Join(tmpDir, "layer.sqfs")
+	ids := make([]uint32, 0, len(layers))
+	err = packLayer(tmpDir, layer, func(s *layerStager) error {
+		for _, l := range layers {
+			lfs, err := openLayerPartition(img, l)
+			if err != nil {
+				return fmt.Errorf("while reading overlay partition %d: %w", l.ID, err)
+			}
+			if err := s.addLayer(lfs, "."); err != nil {
+				return fmt.Errorf("while merging overlay partition %d: %w", l.ID, err)
+			}
+			ids = append(ids, l.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := addOverlayPartition(rw, layer, sif.FsSquash, ids); err != nil {
+		return fmt.Errorf("while merging overlay layers of %s: %w", imgPath, err)
+	}
+	sylog.Infof("Merged %d overlay layers of %s", len(ids), imgPath)
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+const (
+	e2fsckBinary    = "e2fsck"
+	resize2fsBinary = "resize2fs"
+)
+
+// copyOverlayPartition copies an overlay partition of an image to the
+// file dest.
+func copyOverlayPartition(img *image.Image, part image.Section, dest string) error {
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	r := io.NewSectionReader(img.File, int64(part.Offset), int64(part.Size))
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("while copying overlay partition: %w", err)
+	}
+	return f.Close()
+}
+
+// checkExt3 checks and repairs the ext3 filesystem image at path.
+func checkExt3(path string) error {
+	e2fsck, err := bin.FindBin(e2fsckBinary)
+	if err != nil {
+		return err
+	}
+
+	errBuf := new(bytes.Buffer)
+	cmd := exec.Command(e2fsck, "-f", "-y", path)
+	cmd.Stdout = errBuf
+	cmd.Stderr = errBuf
+	err = cmd.Run()
+
+	// exit codes lower than 4 report errors which were corrected
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() < 4 {
+		sylog.Infof("Errors were corrected in the ext3 filesystem %s", path)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("while checking ext3 filesystem %s: %s\nCommand error: %s", path, err, errBuf)
+	}
+	return nil
+}
+
+// resizeExt3 resizes the ext3 filesystem image at path to size MiB.
+func resizeExt3(path string, size int) error {
+	resize2fs, err := bin.FindBin(resize2fsBinary)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	newSize := int64(size) << 20
+	if fi.Size() == newSize {
+		return nil
+	}
+
+	if err := checkExt3(path); err != nil {
+		return err
+	}
+
+	errBuf := new(bytes.Buffer)
+	if newSize > fi.Size() {
+		if err := os.Truncate(path, newSize); err != nil {
+			return fmt.Errorf("while growing %s: %s", path, err)
+		}
+		// the filesystem fills the image without size argument
+		cmd := exec.Command(resize2fs, path)
+		cmd.Stderr = errBuf
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("while resizing ext3 filesystem %s: %s\nCommand error: %s", path, err, errBuf)
+		}
+		return nil
+	}
+
+	cmd := exec.Command(resize2fs, path, fmt.Sprintf("%dM", size))
+	cmd.Stderr = errBuf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("while resizing ext3 filesystem %s: %s\nCommand error: %s", path, err, errBuf)
+	}
+	if err := os.Truncate(path, newSize); err != nil {
+		return fmt.Errorf("while shrinking %s: %s", path, err)
+	}
+	return nil
+}
+
+// OverlayResize resizes an ext3 overlay image, or the writable overlay
+// partition of a SIF image, to size MiB. It fails if the overlay is in use,
+// shrinking it fails if its content doesn't fit in the new size.
+func OverlayResize(imgPath, tmpDir string, size int) error {
+	if size < 64 {
+		return fmt.Errorf("image size must be equal or greater than 64 MiB")
+	}
+
+	img, err := image.Init(imgPath, false)
+	if err != nil {
+		return fmt.Errorf("while opening image file %s: %s", imgPath, err)
+	}
+	defer img.File.Close()
+
+	switch img.Type {
+	case image.EXT3, image.SIF:
+	default:
+		return fmt.Errorf("%s is not an ext3 overlay image or a SIF image", imgPath)
+	}
+	rw, err := lockOverlay(img)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+	if img.Type == image.EXT3 {
+		return resizeExt3(imgPath, size)
+	}
+
+	signed, err := isSigned(img.File)
+	if err != nil {
+		return fmt.Errorf("while getting SIF info: %s", err)
+	} else if signed {
+		return fmt.Errorf("SIF image %s is signed: could not resize writable overlay", imgPath)
+	}
+	overlay, err := writableOverlay(img)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err = os.MkdirTemp(tmpDir, "overlay-resize-")
+	if err != nil {
+		return fmt.Errorf("while creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, "overlay.ext3")
+	if err := copyOverlayPartition(img, overlay, tmpFile); err != nil {
+		return err
+	}
+	if err := resizeExt3(tmpFile, size); err != nil {
+		return err
+	}
+
+	if err := addOverlayPartition(rw, tmpFile, sif.FsExt3, []uint32{overlay.ID}); err != nil {
+		return fmt.Errorf("while replacing ext3 overlay partition of %s: %w", imgPath, err)
+	}
+	return nil
+}
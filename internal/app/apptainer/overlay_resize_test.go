@@ -0,0 +1,199 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/ext3"
+	"github.com/apptainer/apptainer/pkg/image"
+	"golang.org/x/sys/unix"
+)
+
+func TestOverlayResize(t *testing.T) {
+	for _, name := range []string{e2fsckBinary, resize2fsBinary} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not found", name)
+		}
+	}
+
+	files := []overlayFile{{name: "file", content: "content\n"}}
+
+	// checkOverlay checks the size and content of the ext3 overlay of the
+	// image.
+	checkOverlay := func(t *testing.T, path string, size int) {
+		t.Helper()
+
+		img, err := image.Init(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer img.File.Close()
+
+		overlay := img.Partitions[0]
+		if img.Type == image.SIF {
+			if overlay, err = writableOverlay(img); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if overlay.Size != uint64(size)<<20 {
+			t.Errorf("unexpected overlay size %d instead of %d MiB", overlay.Size, size)
+		}
+		l, err := openLayerPartition(img, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		efs := l.(*ext3.FS)
+		if u := efs.Usage(); u.Blocks*uint64(u.BlockSize) != uint64(size)<<20 {
+			t.Errorf("unexpected filesystem size %d instead of %d MiB", u.Blocks*uint64(u.BlockSize), size)
+		}
+		if b, err := efs.ReadFile("upper/file"); err != nil || string(b) != "content\n" {
+			t.Errorf("unexpected overlay content %q: %v", b, err)
+		}
+	}
+
+	t.Run("Image", func(t *testing.T) {
+		overlay := createExt3Overlay(t, files)
+		for _, size := range []int{128, 64} {
+			if err := OverlayResize(overlay, t.TempDir(), size); err != nil {
+				t.Fatal(err)
+			}
+			checkOverlay(t, overlay, size)
+		}
+		if err := OverlayResize(overlay, t.TempDir(), 32); err == nil {
+			t.Errorf("unexpected success with a size lower than 64 MiB")
+		}
+	})
+
+	t.Run("SIF", func(t *testing.T) {
+		sifPath := createOverlaySIF(t, files)
+		offset := lastOverlayPartition(t, sifPath).Offset
+		for _, size := range []int{256, 64} {
+			if err := OverlayResize(sifPath, t.TempDir(), size); err != nil {
+				t.Fatal(err)
+			}
+			checkOverlay(t, sifPath, size)
+			checkImageEnd(t, sifPath, offset, uint64(size)<<20)
+		}
+	})
+}
+
+// lastOverlayPartition returns the last overlay partition of a SIF image.
+func lastOverlayPartition(t *testing.T, path string) image.Section {
+	t.Helper()
+
+	img, err := image.Init(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.File.Close()
+
+	overlays, err := img.GetOverlayPartitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overlays) == 0 {
+		t.Fatalf("no overlay partition in %s", path)
+	}
+	return overlays[len(overlays)-1]
+}
+
+// checkImageEnd checks that the SIF image ends with its last overlay
+// partition, of size bytes at offset, i.e. that the space of the partitions
+// it replaced was reclaimed.
+func checkImageEnd(t *testing.T, path string, offset, size uint64) {
+	t.Helper()
+
+	overlay := lastOverlayPartition(t, path)
+	if overlay.Offset != offset || overlay.Size != size {
+		t.Errorf("last overlay partition of %d bytes at offset %d, expected %d bytes at offset %d", overlay.Size, overlay.Offset, size, offset)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end := offset + size; uint64(fi.Size()) != end {
+		t.Errorf("image size %d, expected %d", fi.Size(), end)
+	}
+}
+
+// lockOverlayForReading locks the overlay partition of an image for
+// reading, like a container using it. An open file description lock
+// conflicts with the locks of the same process.
+func lockOverlayForReading(t *testing.T, path string) *os.File {
+	t.Helper()
+
+	img, err := image.Init(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := img.Partitions[0]
+	if img.Type == image.SIF {
+		if overlay, err = writableOverlay(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	img.File.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lk := &unix.Flock_t{
+		Type:   unix.F_RDLCK,
+		Whence: io.SeekStart,
+		Start:  int64(overlay.Offset),
+		Len:    int64(overlay.Size),
+	}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, lk); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestOverlayInUse(t *testing.T) {
+	for _, name := range []string{e2fsckBinary, resize2fsBinary} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not found", name)
+		}
+	}
+
+	files := []overlayFile{{name: "file", content: "content\n"}}
+
+	t.Run("Image", func(t *testing.T) {
+		overlay := createExt3Overlay(t, files)
+		f := lockOverlayForReading(t, overlay)
+		if err := OverlayResize(overlay, t.TempDir(), 128); err == nil {
+			t.Errorf("unexpected resize success with an overlay in use")
+		}
+		f.Close()
+		if err := OverlayResize(overlay, t.TempDir(), 128); err != nil {
+			t.Errorf("unexpected error with an overlay not in use: %v", err)
+		}
+	})
+
+	t.Run("SIF", func(t *testing.T) {
+		sifPath := createOverlaySIF(t, files)
+		f := lockOverlayForReading(t, sifPath)
+		if err := OverlayResize(sifPath, t.TempDir(), 96); err == nil {
+			t.Errorf("unexpected resize success with an overlay in use")
+		}
+		if err := OverlaySeal(sifPath, t.TempDir()); err == nil {
+			t.Errorf("unexpected seal success with an overlay in use")
+		}
+		f.Close()
+		if err := OverlayResize(sifPath, t.TempDir(), 96); err != nil {
+			t.Errorf("unexpected error with an overlay not in use: %v", err)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/ext3"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// writableOverlay returns the ext3 overlay partition of a SIF image.
+func writableOverlay(img *image.Image) (image.Section, error) {
+	overlays, err := img.GetOverlayPartitions()
+	if err != nil {
+		return image.Section{}, fmt.Errorf("while getting SIF overlay partitions: %s", err)
+	}
+	for _, overlay := range overlays {
+		if overlay.Type == image.EXT3 {
+			return overlay, nil
+		}
+	}
+	return image.Section{}, fmt.Errorf("no writable overlay partition found in %s", img.Path)
+}
+
+// OverlaySeal converts the writable overlay partition of a SIF image into a
+// read-only squashfs overlay layer, stacked on top of the image root
+// filesystem and its other layers. The writable overlay partition is
+// replaced by the new layer.
+func OverlaySeal(imgPath, tmpDir string) error {
+	img, err := openOverlaySIF(imgPath)
+	if err != nil {
+		return err
+	}
+	defer img.File.Close()
+	rw, err := lockOverlay(img)
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+
+	overlay, err := writableOverlay(img)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err = os.MkdirTemp(tmpDir, "overlay-seal-")
+	if err != nil {
+		return fmt.Errorf("while creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	r := io.NewSectionReader(img.File, int64(overlay.Offset), int64(overlay.Size))
+	efs, err := ext3.New(r)
+	if err != nil {
+		return fmt.Errorf("while reading writable overlay partition: %w", err)
+	}
+	if efs.NeedsRecovery() {
+		// the changes held by the journal are applied on a copy of the
+		// partition
+		sylog.Infof("Writable overlay was not cleanly unmounted, checking a copy of it")
+		copyPath := filepath.Join(tmpDir, "overlay.ext3")
+		if err := copyOverlayPartition(img, overlay, copyPath); err != nil {
+			return err
+		}
+		if err := checkExt3(copyPath); err != nil {
+			return err
+		}
+		f, err := os.Open(copyPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if efs, err = ext3.New(f); err != nil {
+			return fmt.Errorf("while reading writable overlay partition: %w", err)
+		}
+	}
+
+	layer := filepath.Join(tmpDir, "layer.sqfs")
+	err = packLayer(tmpDir, layer, func(s *layerStager) error {
+		return s.addLayer(efs, "upper")
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := addOverlayPartition(rw, layer, sif.FsSquash, []uint32{overlay.ID}); err != nil {
+		return fmt.Errorf("while sealing writable overlay of %s: %w", imgPath, err)
+	}
+	sylog.Infof("Writable overlay sealed as a read-only layer of %s", imgPath)
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/squashfs"
+	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
+	"github.com/apptainer/apptainer/pkg/image"
+)
+
+// overlayLayers returns the read-only overlay layers of a SIF image, and
+// whether it has a writable overlay partition. The image must be closed
+// with the returned function before being modified, as it keeps its layers
+// locked.
+func overlayLayers(t *testing.T, path string) ([]*squashfs.FS, bool, func()) {
+	t.Helper()
+
+	img, err := image.Init(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeImage := func() { img.File.Close() }
+	t.Cleanup(closeImage)
+
+	overlays, err := img.GetOverlayPartitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var layers []*squashfs.FS
+	writable := false
+	for _, overlay := range overlays {
+		if overlay.Type == image.EXT3 {
+			writable = true
+			continue
+		}
+		l, err := openLayerPartition(img, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, l.(*squashfs.FS))
+	}
+	return layers, writable, closeImage
+}
+
+func TestOverlaySealMerge(t *testing.T) {
+	require.Command(t, "mksquashfs")
+
+	sifPath := createOverlaySIF(t, []overlayFile{
+		{name: "file", content: "first\n"},
+		{name: "deleted", content: "deleted\n"},
+		{name: "etc/group", whiteout: true},
+	})
+
+	if err := OverlayMerge(sifPath, t.TempDir()); err == nil {
+		t.Errorf("unexpected merge success with a writable overlay")
+	}
+	offset := lastOverlayPartition(t, sifPath).Offset
+	if err := OverlaySeal(sifPath, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// the sealed layer takes the place of the writable overlay
+	checkImageEnd(t, sifPath, offset, lastOverlayPartition(t, sifPath).Size)
+	if err := OverlaySeal(sifPath, t.TempDir()); err == nil {
+		t.Errorf("unexpected seal success without writable overlay")
+	}
+
+	layers, writable, closeImage := overlayLayers(t, sifPath)
+	if len(layers) != 1 || writable {
+		t.Fatalf("unexpected overlay partitions after seal: %d layers, writable %v", len(layers), writable)
+	}
+	if b, err := layers[0].ReadFile("file"); err != nil || string(b) != "first\n" {
+		t.Errorf("unexpected sealed content %q: %v", b, err)
+	}
+	if fi, err := layers[0].Lstat("etc/group"); err != nil || !isWhiteout(fi) {
+		t.Errorf("whiteout not sealed: %v", err)
+	}
+	if fi, err := layers[0].Lstat("file"); err != nil || fi.Sys().(*squashfs.Stat).Uid != uint32(os.Getuid()) {
+		t.Errorf("unexpected sealed file ownership: %v", err)
+	}
+
+	closeImage()
+
+	second := createExt3Overlay(t, []overlayFile{
+		{name: "file", content: "second\n"},
+		{name: "deleted", whiteout: true},
+	})
+	if err := addOverlayToImage(sifPath, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := OverlaySeal(sifPath, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	layers, _, closeImage = overlayLayers(t, sifPath)
+	if len(layers) != 2 {
+		t.Fatalf("unexpected number of layers %d", len(layers))
+	}
+	closeImage()
+
+	if err := OverlayMerge(sifPath, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// the merged layer takes the place of the first layer
+	checkImageEnd(t, sifPath, offset, lastOverlayPartition(t, sifPath).Size)
+	layers, _, _ = overlayLayers(t, sifPath)
+	if len(layers) != 1 {
+		t.Fatalf("unexpected number of layers %d after merge", len(layers))
+	}
+	if b, err := layers[0].ReadFile("file"); err != nil || string(b) != "second\n" {
+		t.Errorf("unexpected merged content %q: %v", b, err)
+	}
+	for _, name := range []string{"deleted", "etc/group"} {
+		if fi, err := layers[0].Lstat(name); err != nil || !isWhiteout(fi) {
+			t.Errorf("%s whiteout not merged: %v", name, err)
+		}
+	}
+}
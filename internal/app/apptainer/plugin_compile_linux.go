@@ -169,7 +169,7 @@ func CompilePlugin(sourceDir, destSif, tmpDir string, buildTags string) error {
 	defer os.Remove(mPath)
 
 	// convert the built plugin object into a sif
-	if err := makeSIF(pluginSrc, destSif); err != nil {
+	if err := makeSIF(soPath, "plugin.so", mPath, destSif); err != nil {
 		return fmt.Errorf("while making sif file: %s", err)
 	}
 
@@ -240,11 +240,10 @@ func generateManifest(sourceDir string, _ buildToolchain) (string, error) {
 	return out, nil
 }
 
-// makeSIF takes in two arguments: sourceDir, the path to the plugin source directory;
+// makeSIF takes in four arguments: objPath, the path to the plugin object stored
+// under objName in the SIF file; manifestPath, the path to the plugin manifest;
 // and sifPath, the path to the final .sif file which is ready to be used.
-func makeSIF(sourceDir, sifPath string) error {
-	objPath := pluginObjPath(sourceDir)
-
+func makeSIF(objPath, objName, manifestPath, sifPath string) error {
 	fp, err := os.Open(objPath)
 	if err != nil {
 		return fmt.Errorf("while opening plugin object file %v: %w", objPath, err)
@@ -252,7 +251,7 @@ func makeSIF(sourceDir, sifPath string) error {
 	defer fp.Close()
 
 	plObjInput, err := sif.NewDescriptorInput(sif.DataPartition, fp,
-		sif.OptObjectName("plugin.so"),
+		sif.OptObjectName(objName),
 		sif.OptPartitionMetadata(sif.FsRaw, sif.PartData, runtime.GOARCH),
 	)
 	if err != nil {
@@ -260,8 +259,6 @@ func makeSIF(sourceDir, sifPath string) error {
 	}
 
 	// create plugin manifest descriptor
-	manifestPath := pluginManifestPath(sourceDir)
-
 	fp, err = os.Open(manifestPath)
 	if err != nil {
 		return fmt.Errorf("while opening plugin manifest file %v: %w", manifestPath, err)
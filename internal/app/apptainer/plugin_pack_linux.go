@@ -0,0 +1,54 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// PackPlugin packs an executable plugin into a plugin SIF file. It takes as
+// input: executable, the path to the plugin executable; and destSif, the path
+// to the intended final location of the plugin SIF file. The plugin manifest
+// is obtained from the executable itself.
+func PackPlugin(executable, destSif, tmpDir string) error {
+	manifest, err := plugin.ExecutableManifest(executable)
+	if err != nil {
+		return fmt.Errorf("while getting plugin manifest: %s", err)
+	}
+	if manifest.Name == "" {
+		return fmt.Errorf("empty plugin name in manifest")
+	}
+
+	f, err := os.CreateTemp(tmpDir, "plugin-manifest-")
+	if err != nil {
+		return fmt.Errorf("while creating manifest: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := json.NewEncoder(f).Encode(manifest); err != nil {
+		f.Close()
+		return fmt.Errorf("while writing manifest %s: %s", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("while writing manifest %s: %s", f.Name(), err)
+	}
+
+	if err := makeSIF(executable, "plugin.exe", f.Name(), destSif); err != nil {
+		return fmt.Errorf("while making sif file: %s", err)
+	}
+
+	sylog.Infof("Plugin packed to: %s", destSif)
+
+	return nil
+}
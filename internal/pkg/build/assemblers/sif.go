@@ -38,11 +38,13 @@ type SIFAssembler struct {
 	MksquashfsMem       string
 	MksquashfsExtraArgs string
 	MksquashfsPath      string
+	MkfsErofsPath       string
 }
 
 type encryptionOptions struct {
-	keyInfo   cryptkey.KeyInfo
-	plaintext []byte
+	keyInfo    cryptkey.KeyInfo
+	recipients []cryptkey.KeyInfo
+	plaintext  []byte
 }
 
 func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encryptionOptions, arch string, data bool) (err error) {
@@ -87,6 +89,10 @@ func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encrypt
 	defer fp.Close()
 
 	fs := sif.FsSquash
+	if b.Opts.FsType == "erofs" && !data {
+		// EROFS partitions are recognized by their superblock
+		fs = sif.FsRaw
+	}
 	if encOpts != nil {
 		fs = sif.FsEncryptedSquashfs
 	}
@@ -112,16 +118,32 @@ func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encrypt
 	dis = append(dis, parinput)
 
 	if encOpts != nil {
-		data, err := cryptkey.EncryptKey(encOpts.keyInfo, encOpts.plaintext)
+		syspartID, err := safecast.Convert[uint32](len(dis))
 		if err != nil {
-			return fmt.Errorf("while encrypting filesystem key: %s", err)
+			return err
 		}
 
-		if data != nil {
-			syspartID, err := safecast.Convert[uint32](len(dis))
+		// the filesystem key is encrypted with the passphrase and for
+		// each recipient
+		keys := encOpts.recipients
+		if encOpts.keyInfo.Format == cryptkey.Passphrase {
+			part, err := cryptkey.NewPassphraseKeyInput(encOpts.keyInfo.Material, encOpts.plaintext, syspartID)
 			if err != nil {
-				return err
+				return fmt.Errorf("while encrypting filesystem key: %s", err)
+			}
+			dis = append(dis, part)
+		} else {
+			keys = append([]cryptkey.KeyInfo{encOpts.keyInfo}, keys...)
+		}
+		for _, k := range keys {
+			data, err := cryptkey.EncryptKey(k, encOpts.plaintext)
+			if err != nil {
+				return fmt.Errorf("while encrypting filesystem key: %s", err)
+			}
+			if data == nil {
+				continue
 			}
+
 			part, err := sif.NewDescriptorInput(sif.DataCryptoMessage, bytes.NewReader(data),
 				sif.OptLinkedID(syspartID),
 				sif.OptCryptoMessageMetadata(sif.FormatPEM, sif.MessageRSAOAEP),
@@ -245,6 +267,25 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 
 		fsPath = b.RootfsImage
 
+	} else if b.Opts.FsType == "erofs" {
+		sylog.Debugf("Creating EROFS image")
+		if b.Opts.EncryptionKeyInfo != nil {
+			return fmt.Errorf("encryption is not supported with EROFS images")
+		}
+
+		e := packer.NewErofs()
+		e.MkfsErofsPath = a.MkfsErofsPath
+		e.SourceDateEpoch = b.SourceDateEpoch
+
+		// mkfs.erofs clamps all timestamps to SourceDateEpoch when set
+		erofsFlags := []string{"-zlz4hc"}
+		// build EROFS with all-root flag when building as a user
+		if syscall.Getuid() != 0 {
+			erofsFlags = append(erofsFlags, "--all-root")
+		}
+		if err := e.Create(b.RootfsPath, fsPath, erofsFlags); err != nil {
+			return fmt.Errorf("while creating EROFS image: %v", err)
+		}
 	} else if b.Opts.Unprivilege {
 		sylog.Debugf("Creating squashfs image and will use gocryptfs")
 		if b.Opts.EncryptionKeyInfo == nil {
@@ -253,19 +294,22 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 
 		g := packer.NewGocryptfs(b.Opts.EncryptionKeyInfo)
 		g.MksquashfsPath = a.MksquashfsPath
+		g.SourceDateEpoch = b.SourceDateEpoch
 
 		if err := g.Create([]string{b.RootfsPath}, fsPath, flags, b.TmpDir); err != nil {
 			return fmt.Errorf("while employing gocryptfs to create image, err: %v", err)
 		}
 
 		encOpts = &encryptionOptions{
-			keyInfo:   *b.Opts.EncryptionKeyInfo,
-			plaintext: []byte(g.Pass),
+			keyInfo:    *b.Opts.EncryptionKeyInfo,
+			recipients: b.Opts.EncryptionRecipients,
+			plaintext:  []byte(g.Pass),
 		}
 	} else {
 		sylog.Debugf("Creating squashfs image")
 		s := packer.NewSquashfs()
 		s.MksquashfsPath = a.MksquashfsPath
+		s.SourceDateEpoch = b.SourceDateEpoch
 
 		if err := s.Create([]string{b.RootfsPath}, fsPath, flags); err != nil {
 			return fmt.Errorf("while creating squashfs: %v", err)
@@ -294,8 +338,9 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 			fsPath = loopPath
 
 			encOpts = &encryptionOptions{
-				keyInfo:   *b.Opts.EncryptionKeyInfo,
-				plaintext: plaintext,
+				keyInfo:    *b.Opts.EncryptionKeyInfo,
+				recipients: b.Opts.EncryptionRecipients,
+				plaintext:  plaintext,
 			}
 
 		}
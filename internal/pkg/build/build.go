@@ -13,10 +13,14 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
@@ -26,6 +30,8 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/build/args"
 	"github.com/apptainer/apptainer/internal/pkg/build/assemblers"
 	"github.com/apptainer/apptainer/internal/pkg/build/sources"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/squashfs"
 	"github.com/apptainer/apptainer/internal/pkg/util/uri"
 	"github.com/apptainer/apptainer/pkg/build/types"
@@ -59,6 +65,16 @@ type Config struct {
 	NoCleanUp bool
 	// Opts for bundles.
 	Opts types.Options
+	// Jobs is the maximum number of independent stages built concurrently,
+	// stages are built one after the other if lower than 2.
+	Jobs int
+	// BuildCache enables the reuse of stages from the build cache, stages
+	// built are saved to the cache.
+	BuildCache bool
+	// Target is the name of the stage assembled into the container, only
+	// the stages it copies files from are built along with it. The last
+	// stage is assembled if empty.
+	Target string
 }
 
 // NewBuild creates a new Build struct from a spec (URI, definition file, etc...).
@@ -92,6 +108,13 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 		conf.Format = "sandbox"
 	}
 
+	if conf.Target != "" {
+		defs, err = targetDefs(defs, conf.Target)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	b := &Build{
 		Conf: conf,
 	}
@@ -191,6 +214,17 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	case "sandbox":
 		b.stages[lastStageIndex].a = &assemblers.SandboxAssembler{Copy: sandboxCopy}
 	case "sif":
+		if conf.Opts.FsType == "erofs" {
+			mkfsErofsPath, err := bin.FindBin("mkfs.erofs")
+			if err != nil {
+				return nil, fmt.Errorf("while searching for mkfs.erofs: %v", err)
+			}
+			b.stages[lastStageIndex].a = &assemblers.SIFAssembler{
+				MkfsErofsPath: mkfsErofsPath,
+			}
+			break
+		}
+
 		mksquashfsPath, err := squashfs.GetPath()
 		if err != nil {
 			return nil, fmt.Errorf("while searching for mksquashfs: %v", err)
@@ -272,53 +306,97 @@ func (b *Build) Full(ctx context.Context) error {
 
 	oldumask := syscall.Umask(0o002)
 
-	// build each stage one after the other
-	for i, stage := range b.stages {
-		if err := stage.runHostScript("pre", stage.b.Recipe.BuildData.Pre); err != nil {
+	if err := b.buildStages(ctx); err != nil {
+		return err
+	}
+
+	syscall.Umask(oldumask)
+
+	sylog.Debugf("Calling assembler")
+	if err := b.stages[len(b.stages)-1].Assemble(b.Conf.Dest); err != nil {
+		return err
+	}
+
+	sylog.Verbosef("Build complete: %s", b.Conf.Dest)
+	return nil
+}
+
+// buildStage builds the stage at index i, the stages it copies files from
+// being already built.
+func (b *Build) buildStage(ctx context.Context, i int) error {
+	stage := &b.stages[i]
+
+	if err := stage.runHostScript("pre", stage.b.Recipe.BuildData.Pre); err != nil {
+		return err
+	}
+
+	// entry is the stage entry in the build cache, cached is true if the
+	// stage is restored from it, in which case files are not copied and
+	// %setup and %post are not run
+	var entry *cache.Entry
+	cached := false
+
+	var err error
+
+	// only update last stage if specified
+	update := stage.b.Opts.Update && !stage.b.Opts.Force && i == len(b.stages)-1
+	if update {
+		// updating, extract dest container to bundle
+		sylog.Infof("Building into existing container: %s", b.Conf.Dest)
+		p, err := sources.GetLocalPacker(ctx, b.Conf.Dest, stage.b)
+		if err != nil {
 			return err
 		}
 
-		// only update last stage if specified
-		update := stage.b.Opts.Update && !stage.b.Opts.Force && i == len(b.stages)-1
-		if update {
-			// updating, extract dest container to bundle
-			sylog.Infof("Building into existing container: %s", b.Conf.Dest)
-			p, err := sources.GetLocalPacker(ctx, b.Conf.Dest, stage.b)
-			if err != nil {
-				return err
+		_, err = p.Pack(ctx)
+		if err != nil {
+			return err
+		}
+	} else {
+		// regular build or force, start build from scratch
+		if b.Conf.Opts.ImgCache == nil {
+			return fmt.Errorf("undefined image cache")
+		}
+		attempt := 0
+		for {
+			err := stage.c.Get(ctx, stage.b)
+			if err == nil {
+				break
+			}
+			attempt++
+			if !strings.Contains(err.Error(), "no descriptor found for reference") || attempt == 5 {
+				return fmt.Errorf("conveyor failed to get: %v", err)
 			}
+			// This happens during random tests in about 50% of e2e runs,
+			// so try a few times before giving up
+			sylog.Infof("Conveyor failed to get reference descriptor, trying again")
+			sylog.Debugf("Error from getting conveyor: %v", err)
+		}
 
-			_, err = p.Pack(ctx)
+		if b.Conf.BuildCache && !b.Conf.Opts.NoCache {
+			entry, err = b.getCachedStage(i)
 			if err != nil {
-				return err
+				return fmt.Errorf("while looking for stage in build cache: %v", err)
 			}
-		} else {
-			// regular build or force, start build from scratch
-			if b.Conf.Opts.ImgCache == nil {
-				return fmt.Errorf("undefined image cache")
-			}
-			attempt := 0
-			for {
-				err := stage.c.Get(ctx, stage.b)
-				if err == nil {
-					break
-				}
-				attempt++
-				if !strings.Contains(err.Error(), "no descriptor found for reference") || attempt == 5 {
-					return fmt.Errorf("conveyor failed to get: %v", err)
+			if entry != nil && entry.Exists {
+				if err := stage.restoreSnapshot(entry); err != nil {
+					return err
 				}
-				// This happens during random tests in about 50% of e2e runs,
-				// so try a few times before giving up
-				sylog.Infof("Conveyor failed to get reference descriptor, trying again")
-				sylog.Debugf("Error from getting conveyor: %v", err)
+				cached = true
+			} else if entry != nil {
+				defer entry.CleanTmp()
 			}
+		}
 
+		if !cached {
 			_, err := stage.c.Pack(ctx)
 			if err != nil {
 				return fmt.Errorf("packer failed to pack: %v", err)
 			}
 		}
+	}
 
+	if !cached {
 		// create apps in bundle
 		a := apps.New()
 		for k, v := range stage.b.Recipe.CustomData {
@@ -349,59 +427,205 @@ func (b *Build) Full(ctx context.Context) error {
 				return fmt.Errorf("unable to copy files from host to container fs: %v", err)
 			}
 		}
+	}
 
-		// create stage file for /etc/resolv.conf and /etc/hosts
-		// skip, if there is an explicit --bind
-		sessionResolv := ""
-		if !haveBindFor(stage.b.Opts.Binds, "/etc/resolv.conf") {
-			sessionResolv, err = createStageFile("/etc/resolv.conf", stage.b, "Name resolution could fail")
-			if err != nil {
-				return err
-			} else if sessionResolv != "" {
-				defer os.Remove(sessionResolv)
-			}
+	// create stage file for /etc/resolv.conf and /etc/hosts
+	// skip, if there is an explicit --bind
+	sessionResolv := ""
+	if !haveBindFor(stage.b.Opts.Binds, "/etc/resolv.conf") {
+		sessionResolv, err = createStageFile("/etc/resolv.conf", stage.b, "Name resolution could fail")
+		if err != nil {
+			return err
+		} else if sessionResolv != "" {
+			defer os.Remove(sessionResolv)
 		}
-		sessionHosts := ""
-		if !haveBindFor(stage.b.Opts.Binds, "/etc/hosts") {
-			sessionHosts, err = createStageFile("/etc/hosts", stage.b, "Host resolution could fail")
-			if err != nil {
+	}
+	sessionHosts := ""
+	if !haveBindFor(stage.b.Opts.Binds, "/etc/hosts") {
+		sessionHosts, err = createStageFile("/etc/hosts", stage.b, "Host resolution could fail")
+		if err != nil {
+			return err
+		} else if sessionHosts != "" {
+			defer os.Remove(sessionHosts)
+		}
+	}
+
+	if !cached && stage.b.Recipe.BuildData.Post.Script != "" {
+		if err := stage.runPostScript(sessionResolv, sessionHosts); err != nil {
+			return fmt.Errorf("while running engine: %v", err)
+		}
+	}
+
+	if entry != nil && !cached {
+		if err := stage.saveSnapshot(entry); err != nil {
+			return fmt.Errorf("while saving stage to build cache: %v", err)
+		}
+	}
+
+	sylog.Debugf("Inserting Metadata")
+	if b.Conf.Opts.DataPartition {
+		if err := stage.insertMetadataForData(); err != nil {
+			return fmt.Errorf("while inserting metadata to bundle: %v", err)
+		}
+	} else {
+		if err := stage.insertMetadata(); err != nil {
+			return fmt.Errorf("while inserting metadata to bundle: %v", err)
+		}
+	}
+
+	if err := stage.runTestScript(sessionResolv, sessionHosts); err != nil {
+		return fmt.Errorf("failed to execute %%test script: %v", err)
+	}
+
+	return nil
+}
+
+// buildStages builds the stages one after the other, or up to Jobs stages
+// concurrently if set, a stage being built once all the stages it copies
+// files from with '%files from' are built.
+func (b *Build) buildStages(ctx context.Context) error {
+	if b.Conf.Jobs < 2 || len(b.stages) < 2 {
+		for i := range b.stages {
+			if err := b.buildStage(ctx, i); err != nil {
 				return err
-			} else if sessionHosts != "" {
-				defer os.Remove(sessionHosts)
 			}
 		}
+		return nil
+	}
+
+	deps, err := b.stageDependencies()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		if stage.b.Recipe.BuildData.Post.Script != "" {
-			if err := stage.runPostScript(sessionResolv, sessionHosts); err != nil {
-				return fmt.Errorf("while running engine: %v", err)
+	jobs := make(chan struct{}, b.Conf.Jobs)
+	done := make([]chan struct{}, len(b.stages))
+	errs := make([]error, len(b.stages))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for i := range b.stages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, d := range deps[i] {
+				select {
+				case <-done[d]:
+				case <-ctx.Done():
+					return
+				}
+				if errs[d] != nil {
+					return
+				}
+			}
+			select {
+			case jobs <- struct{}{}:
+			case <-ctx.Done():
+				return
 			}
+			defer func() { <-jobs }()
+
+			sylog.Infof("Building stage %s", b.stageName(i))
+			if err := b.buildStage(ctx, i); err != nil {
+				errs[i] = fmt.Errorf("stage %s: %w", b.stageName(i), err)
+				// abort the build of the other stages
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
 		}
+	}
+	return ctx.Err()
+}
 
-		sylog.Debugf("Inserting Metadata")
-		if b.Conf.Opts.DataPartition {
-			if err := stage.insertMetadataForData(); err != nil {
-				return fmt.Errorf("while inserting metadata to bundle: %v", err)
+// stageDependencies returns the indexes of the stages each stage copies
+// files from.
+func (b *Build) stageDependencies() ([][]int, error) {
+	deps := make([][]int, len(b.stages))
+	for i, s := range b.stages {
+		for _, f := range s.b.Recipe.BuildData.Files {
+			name := filesFromStage(f)
+			if name == "" {
+				continue
 			}
-		} else {
-			if err := stage.insertMetadata(); err != nil {
-				return fmt.Errorf("while inserting metadata to bundle: %v", err)
+			j, err := b.findStageIndex(name)
+			if err != nil {
+				return nil, err
+			}
+			if j >= i {
+				return nil, fmt.Errorf("stage %s copies files from stage %s, which must be defined before it", b.stageName(i), name)
 			}
+			deps[i] = append(deps[i], j)
 		}
+	}
+	return deps, nil
+}
 
-		if err := stage.runTestScript(sessionResolv, sessionHosts); err != nil {
-			return fmt.Errorf("failed to execute %%test script: %v", err)
-		}
+// targetDefs returns the definitions of the stages needed to build the stage
+// named target, which is the last one returned, preceded by the stages it
+// copies files from, directly or not, in definition order.
+func targetDefs(defs []types.Definition, target string) ([]types.Definition, error) {
+	stageIndex := func(name string) int {
+		return slices.IndexFunc(defs, func(d types.Definition) bool {
+			return d.Header["stage"] == name
+		})
 	}
 
-	syscall.Umask(oldumask)
+	index := stageIndex(target)
+	if index < 0 {
+		return nil, fmt.Errorf("target stage %s was not found", target)
+	}
 
-	sylog.Debugf("Calling assembler")
-	if err := b.stages[len(b.stages)-1].Assemble(b.Conf.Dest); err != nil {
-		return err
+	needed := make([]bool, index+1)
+	needed[index] = true
+	for i := index; i >= 0; i-- {
+		if !needed[i] {
+			continue
+		}
+		for _, f := range defs[i].BuildData.Files {
+			name := filesFromStage(f)
+			if name == "" {
+				continue
+			}
+			j := stageIndex(name)
+			if j < 0 {
+				return nil, fmt.Errorf("stage %s was not found", name)
+			}
+			if j >= i {
+				return nil, fmt.Errorf("stage %s copies files from stage %s, which must be defined before it", defs[i].Header["stage"], name)
+			}
+			needed[j] = true
+		}
 	}
 
-	sylog.Verbosef("Build complete: %s", b.Conf.Dest)
-	return nil
+	var selected []types.Definition
+	for i, d := range defs[:index+1] {
+		if needed[i] {
+			selected = append(selected, d)
+		}
+	}
+	return selected, nil
+}
+
+// stageName returns the name of the stage at index i, or its number if the
+// stage has no name.
+func (b *Build) stageName(i int) string {
+	if b.stages[i].name != "" {
+		return b.stages[i].name
+	}
+	return strconv.Itoa(i + 1)
 }
 
 // makeDef gets a definition object from a spec.
@@ -453,6 +677,17 @@ func MakeAllDefs(spec string, buildArgsMap map[string]string) ([]types.Definitio
 	}
 	defer defFile.Close()
 
+	if ok, _ := parser.IsDockerfile(spec); ok {
+		// translate the Dockerfile, its directory being the build context
+		sylog.Infof("Translating Dockerfile %s to a definition file", spec)
+		opts := parser.DockerfileOptions{Context: filepath.Dir(spec)}
+		defs, err := parser.ParseDockerfile(defFile, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("while translating Dockerfile: %s: %w", spec, err)
+		}
+		return dockerfileDefs(spec, defs, buildArgsMap)
+	}
+
 	defsPreBuildArgs, err := parser.All(defFile)
 	nDefs := len(defsPreBuildArgs)
 	if err != nil {
@@ -499,6 +734,108 @@ func MakeAllDefs(spec string, buildArgsMap map[string]string) ([]types.Definitio
 	return revisedDefs, unusedArgs, nil
 }
 
+// dockerfileDefs returns the build stages defs translated from the
+// Dockerfile spec with build arguments replaced. Unlike definition files,
+// the stages aren't parsed again from their text, scripts being kept as they
+// are translated.
+func dockerfileDefs(spec string, defs []types.Definition, buildArgsMap map[string]string) ([]types.Definition, []string, error) {
+	var consumedArgs []string
+	for i := range defs {
+		if err := replaceBuildArgs(&defs[i], buildArgsMap, &consumedArgs); err != nil {
+			return nil, nil, fmt.Errorf("while translating Dockerfile: %s: %w", spec, err)
+		}
+		var raw bytes.Buffer
+		if err := parser.Format(&raw, defs[i:i+1]); err != nil {
+			return nil, nil, err
+		}
+		defs[i].Raw = raw.Bytes()
+	}
+	// the translation is stored in the image as its definition file
+	var fullRaw bytes.Buffer
+	if err := parser.Format(&fullRaw, defs); err != nil {
+		return nil, nil, err
+	}
+	for i := range defs {
+		defs[i].FullRaw = fullRaw.Bytes()
+	}
+	sylog.Debugf("Definition file translated from %s:\n%s", spec, fullRaw.String())
+
+	unusedArgs, _ := lo.Difference(lo.Keys(buildArgsMap), lo.Uniq(consumedArgs))
+	return defs, unusedArgs, nil
+}
+
+// replaceBuildArgs replaces build arguments in the header, scripts, files
+// and labels of def, as done in the text of definition files.
+func replaceBuildArgs(def *types.Definition, buildArgsMap map[string]string, consumedArgs *[]string) error {
+	defaultArgsMap := args.ReadDefaults(*def)
+	replace := func(s *string) error {
+		if *s == "" {
+			return nil
+		}
+		r, err := args.NewReader(strings.NewReader(*s), buildArgsMap, defaultArgsMap, consumedArgs)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		*s = string(b)
+		return nil
+	}
+
+	for k, v := range def.Header {
+		if err := replace(&v); err != nil {
+			return err
+		}
+		def.Header[k] = v
+	}
+	labels := make(map[string]string, len(def.Labels))
+	for k, v := range def.Labels {
+		if err := replace(&k); err != nil {
+			return err
+		}
+		if err := replace(&v); err != nil {
+			return err
+		}
+		labels[k] = v
+	}
+	def.Labels = labels
+
+	var values []*string
+	for i := range def.BuildData.Files {
+		f := &def.BuildData.Files[i]
+		values = append(values, &f.Args)
+		for j := range f.Files {
+			values = append(values, &f.Files[j].Src, &f.Files[j].Dst)
+		}
+	}
+	values = append(values,
+		&def.Help.Script,
+		&def.Environment.Script,
+		&def.Runscript.Script,
+		&def.Test.Script,
+		&def.Startscript.Script,
+		&def.BuildData.Pre.Script,
+		&def.BuildData.Setup.Script,
+		&def.BuildData.Post.Script,
+		&def.BuildData.Post.Args,
+		&def.BuildData.Test.Script,
+	)
+	for _, v := range values {
+		if err := replace(v); err != nil {
+			return err
+		}
+	}
+	for k, v := range def.CustomData {
+		if err := replace(&v); err != nil {
+			return err
+		}
+		def.CustomData[k] = v
+	}
+	return nil
+}
+
 func (b *Build) findStageIndex(name string) (int, error) {
 	for i, s := range b.stages {
 		if name == s.name {
@@ -1,10 +1,14 @@
 package build
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/apptainer/apptainer/internal/pkg/build/sources"
+	"github.com/apptainer/apptainer/pkg/build/types"
+	"github.com/apptainer/apptainer/pkg/build/types/parser"
 	"gotest.tools/v3/assert"
 )
 
@@ -58,3 +62,191 @@ func TestProcessWithAdditionalArgs(t *testing.T) {
 	assert.Equal(t, len(unusedArgs), 1)
 	assert.Equal(t, "ADDITION", unusedArgs[0])
 }
+
+func TestProcessDockerfile(t *testing.T) {
+	dockerfile := `ARG BASE=alpine
+FROM ${BASE}
+ARG VERSION=dev
+LABEL version=$VERSION
+RUN <<EOF
+cat > /etc/motd <<EOT
+  Welcome
+EOT
+EOF
+`
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	assert.NilError(t, os.WriteFile(path, []byte(dockerfile), 0o644))
+
+	d, unusedArgs, err := MakeAllDefs(path, map[string]string{
+		"VERSION":  "1.0",
+		"ADDITION": "1",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(d), 1)
+	assert.Equal(t, d[0].Header["from"], "alpine")
+	assert.Equal(t, d[0].Labels["version"], "1.0")
+	assert.DeepEqual(t, unusedArgs, []string{"ADDITION"})
+
+	// the here-document delimiter of the RUN command is kept as is
+	post := d[0].BuildData.Post.Script
+	assert.Assert(t, strings.HasSuffix(post, "\ncat > /etc/motd <<EOT\n  Welcome\nEOT"), post)
+	assert.Assert(t, strings.Contains(string(d[0].FullRaw), "version 1.0"))
+}
+
+func TestStageDependencies(t *testing.T) {
+	def := `Bootstrap: docker
+From: alpine
+Stage: tools
+
+Bootstrap: docker
+From: golang
+Stage: compile
+
+%files from tools
+    /usr/bin/make
+
+Bootstrap: docker
+From: alpine
+
+%files from compile
+    /go/bin/app
+%files from tools
+    /usr/bin/make
+`
+	defs, err := parser.All(strings.NewReader(def))
+	assert.NilError(t, err)
+
+	b := &Build{}
+	for _, d := range defs {
+		b.stages = append(b.stages, stage{
+			name: d.Header["stage"],
+			b:    &types.Bundle{Recipe: d},
+		})
+	}
+	deps, err := b.stageDependencies()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, deps, [][]int{nil, {0}, {1, 0}})
+	assert.Equal(t, b.stageName(2), "3")
+
+	// files can't be copied from a stage defined later
+	b.stages[0].b.Recipe.BuildData.Files = []types.Files{{Args: "from compile"}}
+	_, err = b.stageDependencies()
+	assert.ErrorContains(t, err, "must be defined before it")
+}
+
+func TestStageCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	assert.NilError(t, os.WriteFile(file, []byte("v1"), 0o644))
+
+	def := `Bootstrap: scratch
+Stage: base
+
+%files
+    ` + file + ` /opt/
+
+%post
+    echo base
+
+Bootstrap: scratch
+
+%files from base
+    /opt/file.txt
+`
+	defs, err := parser.All(strings.NewReader(def))
+	assert.NilError(t, err)
+
+	b := &Build{}
+	for _, d := range defs {
+		b.stages = append(b.stages, stage{
+			name: d.Header["stage"],
+			c:    &sources.ScratchConveyorPacker{},
+			b:    &types.Bundle{Recipe: d},
+		})
+	}
+	keys := func() []string {
+		t.Helper()
+		var keys []string
+		for i := range b.stages {
+			key, err := b.stageCacheKey(i)
+			assert.NilError(t, err)
+			b.stages[i].cacheKey = key
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	first := keys()
+	assert.Assert(t, first[0] != "" && first[1] != "")
+	assert.DeepEqual(t, keys(), first)
+
+	// changing the content of a file copied from the host changes the key
+	// of the stage and of the stages copying files from it
+	assert.NilError(t, os.WriteFile(file, []byte("v2"), 0o644))
+	second := keys()
+	assert.Assert(t, second[0] != first[0])
+	assert.Assert(t, second[1] != first[1])
+
+	b.stages[0].b.Recipe.BuildData.Post.Script = "echo changed"
+	third := keys()
+	assert.Assert(t, third[0] != second[0])
+
+	// stages which base image has no digest are not cached
+	b.stages[0].c = &sources.BusyBoxConveyorPacker{}
+	assert.DeepEqual(t, keys(), []string{"", ""})
+}
+
+func TestTargetDefs(t *testing.T) {
+	def := `Bootstrap: docker
+From: alpine
+Stage: tools
+
+Bootstrap: docker
+From: alpine
+Stage: unused
+
+Bootstrap: docker
+From: golang
+Stage: devel
+
+%files from tools
+    /usr/bin/make
+
+Bootstrap: docker
+From: alpine
+Stage: runtime
+
+%files from devel
+    /go/bin/app
+`
+	defs, err := parser.All(strings.NewReader(def))
+	assert.NilError(t, err)
+
+	stages := func(defs []types.Definition) []string {
+		var names []string
+		for _, d := range defs {
+			names = append(names, d.Header["stage"])
+		}
+		return names
+	}
+
+	tests := []struct {
+		target string
+		want   []string
+		err    string
+	}{
+		{target: "runtime", want: []string{"tools", "devel", "runtime"}},
+		{target: "devel", want: []string{"tools", "devel"}},
+		{target: "unused", want: []string{"unused"}},
+		{target: "debug", err: "target stage debug was not found"},
+	}
+	for _, tt := range tests {
+		got, err := targetDefs(defs, tt.target)
+		if tt.err != "" {
+			assert.ErrorContains(t, err, tt.err)
+			continue
+		}
+		assert.NilError(t, err)
+		assert.DeepEqual(t, stages(got), tt.want)
+	}
+}
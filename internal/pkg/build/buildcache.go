@@ -0,0 +1,175 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/build/files"
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/image/packer"
+	"github.com/apptainer/apptainer/internal/pkg/image/unpacker"
+	"github.com/apptainer/apptainer/pkg/build/types"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// buildCacheVersion is part of the stage keys, it must be changed when
+	// the content of the snapshots or the way keys are computed changes.
+	buildCacheVersion = "v1"
+	// buildCacheObjects is the file of the root filesystem snapshots holding
+	// the JSON objects of the bundle, it's removed once restored.
+	buildCacheObjects = ".build-cache.json"
+)
+
+// stageCacheKey returns the key of the stage at index i in the build cache,
+// computed from the digest of its base image, the content of the sections
+// run before metadata insertion, with build arguments substituted, and the
+// content of the files copied into the stage. An empty key is returned if
+// the stage can't be cached, the stages it copies files from must have their
+// key computed first.
+func (b *Build) stageCacheKey(i int) (string, error) {
+	s := &b.stages[i]
+
+	d, ok := s.c.(Digester)
+	if !ok || s.b.RootfsImage != "" {
+		return "", nil
+	}
+	digest, err := d.Digest()
+	if err != nil {
+		return "", fmt.Errorf("while getting digest of base image: %v", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", buildCacheVersion, digest)
+	writeMap(h, s.b.Recipe.Header)
+	writeMap(h, s.b.Recipe.CustomData)
+
+	scripts := s.b.Recipe.BuildData.Scripts
+	for _, script := range []types.Script{scripts.Arguments, scripts.Setup, scripts.Post} {
+		fmt.Fprintf(h, "%s\x00%s\x00", script.Args, script.Script)
+	}
+
+	for _, f := range s.b.Recipe.BuildData.Files {
+		fmt.Fprintf(h, "%s\x00", f.Args)
+		from := filesFromStage(f)
+		if from != "" {
+			j, err := b.findStageIndex(from)
+			if err != nil {
+				return "", err
+			}
+			// files copied from a stage that can't be cached are
+			// unknown until it's built
+			if b.stages[j].cacheKey == "" {
+				return "", nil
+			}
+			fmt.Fprintf(h, "%s\x00", b.stages[j].cacheKey)
+		}
+		for _, transfer := range f.Files {
+			fmt.Fprintf(h, "%s\x00%s\x00", transfer.Src, transfer.Dst)
+			if from != "" || transfer.Src == "" {
+				continue
+			}
+			if err := files.HashFromHost(h, transfer.Src); err != nil {
+				return "", fmt.Errorf("while hashing %s: %v", transfer.Src, err)
+			}
+		}
+	}
+
+	// options changing the content of the root filesystem
+	opts := s.b.Opts
+	fmt.Fprintf(h, "%s\x00%t\x00%t\x00", strings.Join(opts.Sections, ","), opts.FixPerms, opts.FakerootPath != "")
+	fmt.Fprintf(h, "%s\x00", strings.Join(opts.Binds, ","))
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeMap writes the keys and values of m to w, in key order.
+func writeMap(w io.Writer, m map[string]string) {
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		fmt.Fprintf(w, "%s\x00%s\x00", k, m[k])
+	}
+	fmt.Fprintf(w, "\x00")
+}
+
+// getCachedStage looks for the stage at index i in the build cache, returning
+// a nil entry if the stage can't be cached. When the returned entry doesn't
+// exist, it must be finalized with saveSnapshot once the stage is built, or
+// cleaned.
+func (b *Build) getCachedStage(i int) (*cache.Entry, error) {
+	s := &b.stages[i]
+
+	key, err := b.stageCacheKey(i)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		sylog.Debugf("Stage %s can't be cached", b.stageName(i))
+		return nil, nil
+	}
+	s.cacheKey = key
+
+	return b.Conf.Opts.ImgCache.GetEntry(cache.BuildCacheType, key)
+}
+
+// saveSnapshot saves a snapshot of the stage root filesystem along with the
+// JSON objects of its bundle to the cache entry.
+func (s *stage) saveSnapshot(e *cache.Entry) error {
+	objects, err := json.Marshal(s.b.JSONObjects)
+	if err != nil {
+		return err
+	}
+	objectsPath := filepath.Join(s.b.RootfsPath, buildCacheObjects)
+	if err := os.WriteFile(objectsPath, objects, 0o600); err != nil {
+		return fmt.Errorf("while writing bundle objects: %v", err)
+	}
+	defer os.Remove(objectsPath)
+
+	sylog.Infof("Saving stage to the build cache")
+	sqfs := packer.NewSquashfs()
+	sqfs.SourceDateEpoch = s.b.SourceDateEpoch
+	if err := sqfs.Create([]string{s.b.RootfsPath}, e.TmpPath, []string{"-noappend"}); err != nil {
+		return fmt.Errorf("while creating root filesystem snapshot: %v", err)
+	}
+	return e.Finalize()
+}
+
+// restoreSnapshot extracts the root filesystem snapshot of the cache entry
+// into the stage bundle.
+func (s *stage) restoreSnapshot(e *cache.Entry) error {
+	f, err := os.Open(e.Path)
+	if err != nil {
+		return fmt.Errorf("while opening root filesystem snapshot: %v", err)
+	}
+	defer f.Close()
+
+	sylog.Infof("Using stage from the build cache")
+	if err := unpacker.NewSquashfs().ExtractAll(f, s.b.RootfsPath); err != nil {
+		return fmt.Errorf("while extracting root filesystem snapshot: %v", err)
+	}
+
+	objectsPath := filepath.Join(s.b.RootfsPath, buildCacheObjects)
+	objects, err := os.ReadFile(objectsPath)
+	if err != nil {
+		return fmt.Errorf("while reading bundle objects: %v", err)
+	}
+	if err := json.Unmarshal(objects, &s.b.JSONObjects); err != nil {
+		return fmt.Errorf("while decoding bundle objects: %v", err)
+	}
+	return os.Remove(objectsPath)
+}
@@ -35,6 +35,13 @@ type ConveyorPacker interface {
 	Packer
 }
 
+// Digester is implemented by the Conveyors able to identify the content of
+// the base image they got, the stages built from them can be reused from the
+// build cache.
+type Digester interface {
+	Digest() (string, error)
+}
+
 // conveyorPacker returns a valid ConveyorPacker for the given image definition.
 func conveyorPacker(def types.Definition) (ConveyorPacker, error) {
 	bs, ok := def.Header["bootstrap"]
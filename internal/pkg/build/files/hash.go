@@ -0,0 +1,75 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package files
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// HashFromHost writes the names, permissions and contents of the host files
+// src resolves to, as copied by CopyFromHost, to w. Symbolic links are
+// followed like CopyFromHost does.
+func HashFromHost(w io.Writer, src string) error {
+	paths, err := expandPath(src)
+	if err != nil {
+		return fmt.Errorf("while expanding source path with bash: %s: %s", src, err)
+	}
+	for _, p := range paths {
+		fmt.Fprintf(w, "%s\x00", p)
+		if err := hashPath(w, p, ".", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashPath writes the name, permissions and content of path to w, recursing
+// into directories. parents holds the directories being walked, to detect
+// symbolic link loops.
+func hashPath(w io.Writer, path, rel string, parents []os.FileInfo) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s\x00%o\x00", rel, fi.Mode())
+
+	if !fi.IsDir() {
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(w, "%d\x00", fi.Size())
+		_, err = io.Copy(w, f)
+		return err
+	}
+
+	for _, p := range parents {
+		if os.SameFile(p, fi) {
+			return fmt.Errorf("symbolic link loop detected at %s", path)
+		}
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if err := hashPath(w, filepath.Join(path, name), filepath.Join(rel, name), append(parents, fi)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 
 	build_oci "github.com/apptainer/apptainer/internal/pkg/build/oci"
 	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/client"
 	"github.com/apptainer/apptainer/internal/pkg/ociimage"
 	"github.com/apptainer/apptainer/internal/pkg/ociplatform"
 	"github.com/apptainer/apptainer/internal/pkg/util/ociauth"
@@ -197,7 +198,12 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 
 	tag, digest, err := build_oci.RepoDigest(ctx, ref, cp.topts)
 	if err != nil {
-		return err
+		if imgCache == nil || !client.IsNetworkError(err) {
+			return err
+		}
+		// the registry may not be reachable while the image is
+		// available from the cache, the base image labels are omitted
+		sylog.Debugf("Could not get digest of %s: %v", ref, err)
 	}
 	b.Opts.Tag = tag
 	b.Opts.Digest = digest
@@ -217,14 +223,25 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 	if b.Opts.Reproducible {
 		sourceDateEpoch := cf.Created.In(time.UTC)
 		sylog.Debugf("Setting SourceDateEpoch to %s", sourceDateEpoch)
+		// the SIF assembler passes it to mksquashfs
 		b.SourceDateEpoch = sourceDateEpoch
-		// Need to set the SOURCE_DATE_EPOCH environment variable, for mksquashfs
-		os.Setenv("SOURCE_DATE_EPOCH", fmt.Sprintf("%d", sourceDateEpoch.Unix()))
 	}
 
 	return nil
 }
 
+// Digest returns the digest of the image manifest fetched by Get.
+func (cp *OCIConveyorPacker) Digest() (string, error) {
+	if cp.srcImg == nil {
+		return "", fmt.Errorf("image not fetched")
+	}
+	d, err := cp.srcImg.Digest()
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
 // Pack puts relevant objects in a Bundle.
 func (cp *OCIConveyorPacker) Pack(ctx context.Context) (*sytypes.Bundle, error) {
 	sylog.Infof("Extracting OCI image...")
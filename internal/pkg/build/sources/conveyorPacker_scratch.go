@@ -35,6 +35,12 @@ func (c *ScratchConveyor) Get(_ context.Context, b *types.Bundle) (err error) {
 	return nil
 }
 
+// Digest returns a constant digest, a build from scratch starting with an
+// empty root filesystem.
+func (c *ScratchConveyor) Digest() (string, error) {
+	return "scratch", nil
+}
+
 // Pack puts relevant objects in a Bundle!
 func (cp *ScratchConveyorPacker) Pack(context.Context) (b *types.Bundle, err error) {
 	err = cp.insertBaseEnv()
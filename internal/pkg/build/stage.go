@@ -34,6 +34,8 @@ type stage struct {
 	a Assembler
 	// b is an intermediate structure that encapsulates all information for the container, e.g., metadata, filesystems.
 	b *types.Bundle
+	// cacheKey is the key of the stage in the build cache, empty if not cached.
+	cacheKey string
 }
 
 const (
@@ -181,21 +183,27 @@ func (s *stage) runTestScript(sessionResolv, sessionHosts string) error {
 	return nil
 }
 
+// filesFromStage returns the name of the stage a %files section copies files
+// from, or an empty string if files are copied from the host.
+func filesFromStage(f types.Files) string {
+	// Trim comments from args
+	cleanArgs := strings.Split(f.Args, "#")[0]
+	args := strings.Fields(cleanArgs)
+	if len(args) != 2 {
+		return ""
+	}
+	return args[1]
+}
+
 func (s *stage) copyFilesFrom(b *Build) error {
 	def := s.b.Recipe
 	for _, f := range def.BuildData.Files {
-		// Trim comments from args
-		cleanArgs := strings.Split(f.Args, "#")[0]
-		if cleanArgs == "" {
-			continue
-		}
-
-		args := strings.Fields(cleanArgs)
-		if len(args) != 2 {
+		name := filesFromStage(f)
+		if name == "" {
 			continue
 		}
 
-		stageIndex, err := b.findStageIndex(args[1])
+		stageIndex, err := b.findStageIndex(name)
 		if err != nil {
 			return err
 		}
@@ -203,7 +211,7 @@ func (s *stage) copyFilesFrom(b *Build) error {
 		srcRootfsPath := b.stages[stageIndex].b.RootfsPath
 		dstRootfsPath := s.b.RootfsPath
 
-		sylog.Debugf("Copying files from stage: %s", args[1])
+		sylog.Debugf("Copying files from stage: %s", name)
 
 		// iterate through filetransfers
 		for _, transfer := range f.Files {
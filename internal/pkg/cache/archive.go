@@ -0,0 +1,520 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	ggcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// archiveVersion is the version of the format of cache archives.
+	archiveVersion = 1
+	// archiveManifestName is the name of the manifest, which must be the
+	// first file of a cache archive.
+	archiveManifestName = "manifest.json"
+	// archiveEntriesDir is the directory holding the entries in a cache
+	// archive, as <archiveEntriesDir>/<cache type>/<name>.
+	archiveEntriesDir = "entries"
+)
+
+// ArchiveEntry describes a cache entry held in a cache archive.
+type ArchiveEntry struct {
+	// Type is the cache type of the entry, e.g. 'library'
+	Type string `json:"type"`
+	// Name is the name of the entry within its cache type. For the OCI
+	// blob cache, it's the hex encoded digest of the blob.
+	Name string `json:"name"`
+	// Digest is the digest of the content of the entry
+	Digest string `json:"digest"`
+	// Size is the size of the entry in bytes
+	Size int64 `json:"size"`
+	// Source is the URI the entry was retrieved from, if known
+	Source string `json:"source,omitempty"`
+	// MediaType is set for OCI image manifests, which are registered in
+	// the index of the OCI layout when imported
+	MediaType string `json:"mediaType,omitempty"`
+
+	// path is the location of the entry in the cache being exported
+	path string
+}
+
+// ArchiveManifest is the manifest of a cache archive, listing its entries.
+type ArchiveManifest struct {
+	Version int            `json:"version"`
+	Created time.Time      `json:"created"`
+	Entries []ArchiveEntry `json:"entries"`
+}
+
+// SelectEntries returns the entries of the cache to export. Only entries of
+// the given cache types are selected if cacheTypes is not empty, and only
+// entries retrieved from one of the given sources if sources is not empty.
+// The config and layer blobs of a selected OCI image manifest are selected
+// along with it.
+func (h *Handle) SelectEntries(cacheTypes, sources []string) ([]ArchiveEntry, error) {
+	if h.disabled {
+		return nil, fmt.Errorf("cache is disabled")
+	}
+	for _, cacheType := range cacheTypes {
+		if !stringInSlice(cacheType, FileCacheTypes) && !stringInSlice(cacheType, OciCacheTypes) {
+			return nil, fmt.Errorf("%w: %s", errInvalidCacheType, cacheType)
+		}
+	}
+
+	items, err := h.listItems()
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := h.ociManifests()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]cacheItem)
+	for _, item := range items {
+		if item.cacheType == OciBlobCacheType {
+			blobs[item.name] = item
+		}
+	}
+
+	var entries []ArchiveEntry
+	selected := make(map[string]bool)
+
+	add := func(item cacheItem, source string) error {
+		key := item.cacheType + "/" + item.name
+		if selected[key] {
+			return nil
+		}
+		e := ArchiveEntry{
+			Type:   item.cacheType,
+			Name:   item.name,
+			Size:   item.size,
+			Source: source,
+			path:   item.path,
+		}
+		if item.cacheType == OciBlobCacheType {
+			e.Digest = digestPrefix + item.name
+			e.MediaType = manifests[item.name]
+		} else {
+			// entries may be symlinks (e.g. ipfs), export their target
+			fi, err := os.Stat(item.path)
+			if err != nil {
+				return err
+			}
+			e.Size = fi.Size()
+			e.Digest, err = fileDigest(item.path)
+			if err != nil {
+				return err
+			}
+		}
+		entries = append(entries, e)
+		selected[key] = true
+		return nil
+	}
+
+	for _, item := range items {
+		if len(cacheTypes) > 0 && !stringInSlice(item.cacheType, cacheTypes) {
+			continue
+		}
+		var source string
+		if md, err := readMetadata(h.getMetadataPath(item.cacheType, item.name)); err == nil {
+			source = md.Source
+		}
+		if len(sources) > 0 && !stringInSlice(source, sources) {
+			continue
+		}
+		if err := add(item, source); err != nil {
+			return nil, err
+		}
+
+		// a selected image manifest requires its config and layers
+		if item.cacheType != OciBlobCacheType || manifests[item.name] == "" || len(sources) == 0 {
+			continue
+		}
+		deps, err := manifestBlobs(item.path)
+		if err != nil {
+			return nil, fmt.Errorf("while reading manifest %s: %v", item.name, err)
+		}
+		for _, d := range deps {
+			blob, ok := blobs[d]
+			if !ok {
+				return nil, fmt.Errorf("blob %s%s of image %s is missing from the cache", digestPrefix, d, source)
+			}
+			if err := add(blob, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type < entries[j].Type
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
+
+// ociManifests returns the media types of the image manifests registered in
+// the index of the OCI blob cache, indexed by hex encoded digest.
+func (h *Handle) ociManifests() (map[string]string, error) {
+	manifests := make(map[string]string)
+
+	lp, err := layout.FromPath(h.getCacheTypeDir(OciBlobCacheType))
+	if err != nil {
+		// no OCI layout yet
+		return manifests, nil
+	}
+	idx, err := lp.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range im.Manifests {
+		manifests[m.Digest.Hex] = string(m.MediaType)
+	}
+	return manifests, nil
+}
+
+// manifestBlobs returns the hex encoded digests of the config and layer blobs
+// referenced by the image manifest stored at path.
+func manifestBlobs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := ggcrv1.ParseManifest(f)
+	if err != nil {
+		return nil, err
+	}
+	blobs := []string{m.Config.Digest.Hex}
+	for _, l := range m.Layers {
+		blobs = append(blobs, l.Digest.Hex)
+	}
+	return blobs, nil
+}
+
+// Export writes a cache archive holding entries to w. The archive is a tar
+// archive starting with a manifest listing the digest and source of each
+// entry.
+func (h *Handle) Export(w io.Writer, entries []ArchiveEntry) error {
+	tw := tar.NewWriter(w)
+
+	manifest := ArchiveManifest{
+		Version: archiveVersion,
+		Created: time.Now().UTC(),
+		Entries: entries,
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    archiveManifestName,
+		Mode:    0o644,
+		Size:    int64(len(b)),
+		ModTime: manifest.Created,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := exportEntry(tw, e); err != nil {
+			return fmt.Errorf("while exporting %s cache entry %s: %v", e.Type, e.Name, err)
+		}
+	}
+
+	return tw.Close()
+}
+
+// exportEntry writes the content of the entry e to tw.
+func exportEntry(tw *tar.Writer, e ArchiveEntry) error {
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != e.Size {
+		return fmt.Errorf("entry was modified during export")
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    path.Join(archiveEntriesDir, e.Type, e.Name),
+		Mode:    0o644,
+		Size:    e.Size,
+		ModTime: fi.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import reads a cache archive created by Export from r, and adds its entries
+// to the cache. The content of each entry is verified against the digest
+// listed in the manifest of the archive. Entries already present in the cache
+// are kept. The imported entries are returned.
+func (h *Handle) Import(r io.Reader) ([]ArchiveEntry, error) {
+	if h.disabled {
+		return nil, fmt.Errorf("cache is disabled")
+	}
+
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("while reading cache archive: %v", err)
+	}
+	if hdr.Name != archiveManifestName {
+		return nil, fmt.Errorf("not a cache archive: %s is not the first file", archiveManifestName)
+	}
+	var manifest ArchiveManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("while decoding cache archive manifest: %v", err)
+	}
+	if manifest.Version != archiveVersion {
+		return nil, fmt.Errorf("unsupported cache archive version %d", manifest.Version)
+	}
+
+	pending := make(map[string]ArchiveEntry)
+	for _, e := range manifest.Entries {
+		if !stringInSlice(e.Type, FileCacheTypes) && !stringInSlice(e.Type, OciCacheTypes) {
+			return nil, fmt.Errorf("%w: %s", errInvalidCacheType, e.Type)
+		}
+		if e.Name == "" || e.Name != filepath.Base(e.Name) || strings.HasPrefix(e.Name, ".") || strings.HasPrefix(e.Name, tmpEntryPrefix) {
+			return nil, fmt.Errorf("invalid cache entry name %q", e.Name)
+		}
+		pending[path.Join(archiveEntriesDir, e.Type, e.Name)] = e
+	}
+
+	var imported, manifests []ArchiveEntry
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return imported, fmt.Errorf("while reading cache archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		e, ok := pending[hdr.Name]
+		if !ok {
+			return imported, fmt.Errorf("unexpected file %s in cache archive", hdr.Name)
+		}
+		delete(pending, hdr.Name)
+
+		var added bool
+		if e.Type == OciBlobCacheType {
+			added, err = h.importBlob(tr, e)
+		} else {
+			added, err = h.importFile(tr, e)
+		}
+		if err != nil {
+			return imported, fmt.Errorf("while importing %s cache entry %s: %v", e.Type, e.Name, err)
+		}
+		if e.MediaType != "" {
+			manifests = append(manifests, e)
+		}
+		if added {
+			imported = append(imported, e)
+		} else {
+			sylog.Debugf("Skipping %s cache entry %s, already cached", e.Type, e.Name)
+		}
+	}
+
+	if len(pending) > 0 {
+		return imported, fmt.Errorf("cache archive is truncated: %d entries are missing", len(pending))
+	}
+
+	if err := h.registerManifests(manifests); err != nil {
+		return imported, err
+	}
+
+	return imported, nil
+}
+
+// importFile adds the content read from r as the entry e of a file cache type.
+// It returns false if the entry already exists.
+func (h *Handle) importFile(r io.Reader, e ArchiveEntry) (bool, error) {
+	ce, err := h.GetEntry(e.Type, e.Name)
+	if err != nil {
+		return false, err
+	}
+	defer ce.CleanTmp()
+
+	if ce.Exists {
+		if !ce.Shared && e.Source != "" {
+			// record the source of entries pulled before it was
+			// tracked, to find them by source
+			err := h.updateMetadata(e.Type, e.Name, func(md *entryMetadata) {
+				if md.Source == "" {
+					md.Source = e.Source
+				}
+			})
+			if err != nil {
+				sylog.Debugf("Could not record source of cache entry '%s': %v", ce.Path, err)
+			}
+		}
+		return false, nil
+	}
+
+	if err := writeVerified(ce.TmpPath, r, e.Digest); err != nil {
+		return false, err
+	}
+	ce.Source = e.Source
+	return true, ce.Finalize()
+}
+
+// importBlob adds the content read from r as the blob e of the OCI blob
+// cache. It returns false if the blob already exists.
+func (h *Handle) importBlob(r io.Reader, e ArchiveEntry) (bool, error) {
+	if e.Digest != digestPrefix+e.Name {
+		return false, fmt.Errorf("digest %s doesn't match blob name", e.Digest)
+	}
+
+	unlock, err := h.LockOciCacheDir(e.Type)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	dir := h.getEntriesDir(e.Type)
+	if err := initCacheDir(dir); err != nil {
+		return false, err
+	}
+	blobPath := filepath.Join(dir, e.Name)
+
+	added := !fs.IsFile(blobPath)
+	if added {
+		f, err := fs.MakeTmpFile(dir, tmpEntryPrefix, 0o600)
+		if err != nil {
+			return false, err
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+
+		if err := writeVerified(f.Name(), r, e.Digest); err != nil {
+			return false, err
+		}
+		if err := os.Rename(f.Name(), blobPath); err != nil {
+			return false, err
+		}
+	}
+
+	err = h.updateMetadata(e.Type, e.Name, func(md *entryMetadata) {
+		md.LastAccess = time.Now()
+		if md.Source == "" {
+			md.Source = e.Source
+		}
+	})
+	return added, err
+}
+
+// registerManifests adds the image manifests to the index of the OCI layout
+// of the blob cache, unless already registered.
+func (h *Handle) registerManifests(manifests []ArchiveEntry) error {
+	if len(manifests) == 0 {
+		return nil
+	}
+
+	unlock, err := h.LockOciCacheDir(OciBlobCacheType)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	layoutDir := h.getCacheTypeDir(OciBlobCacheType)
+	lp, err := layout.FromPath(layoutDir)
+	if err != nil {
+		lp, err = layout.Write(layoutDir, empty.Index)
+		if err != nil {
+			return fmt.Errorf("while creating OCI layout %s: %v", layoutDir, err)
+		}
+	}
+
+	registered, err := h.ociManifests()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range manifests {
+		if _, ok := registered[m.Name]; ok {
+			continue
+		}
+		digest, err := ggcrv1.NewHash(m.Digest)
+		if err != nil {
+			return err
+		}
+		desc := ggcrv1.Descriptor{
+			MediaType: ggcrtypes.MediaType(m.MediaType),
+			Size:      m.Size,
+			Digest:    digest,
+		}
+		if err := lp.AppendDescriptor(desc); err != nil {
+			return fmt.Errorf("while registering image manifest %s: %v", m.Digest, err)
+		}
+	}
+	return nil
+}
+
+// writeVerified writes the content read from r to the file at path, and
+// checks that it matches digest.
+func writeVerified(path string, r io.Reader, digest string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		return err
+	}
+	if got := digestPrefix + hex.EncodeToString(hash.Sum(nil)); got != digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, got)
+	}
+	return f.Close()
+}
@@ -0,0 +1,244 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	ggcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func addSourceEntry(t *testing.T, h *Handle, cacheType, name, source string) string {
+	t.Helper()
+
+	path := addEntry(t, h, cacheType, name, 64, time.Now())
+	if err := h.RecordSource(cacheType, name, source); err != nil {
+		t.Fatalf("while recording source: %v", err)
+	}
+	return path
+}
+
+func TestExportImport(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	src, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	addSourceEntry(t, src, OciTempCacheType, "alpine", "docker://alpine")
+	addSourceEntry(t, src, OrasCacheType, "image", "oras://example.com/image")
+	addEntry(t, src, NetCacheType, "other", 64, time.Now())
+
+	// select by source
+	entries, err := src.SelectEntries(nil, []string{"docker://alpine"})
+	if err != nil {
+		t.Fatalf("while selecting entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "alpine" || entries[0].Source != "docker://alpine" {
+		t.Fatalf("unexpected entries selected by source: %+v", entries)
+	}
+
+	// select by type
+	entries, err = src.SelectEntries([]string{OrasCacheType, NetCacheType}, nil)
+	if err != nil {
+		t.Fatalf("while selecting entries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries selected by type: %+v", entries)
+	}
+	if _, err := src.SelectEntries([]string{"invalid"}, nil); err == nil {
+		t.Errorf("unexpected success with invalid cache type")
+	}
+
+	entries, err = src.SelectEntries(nil, nil)
+	if err != nil {
+		t.Fatalf("while selecting entries: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := src.Export(&buf, entries); err != nil {
+		t.Fatalf("while exporting: %v", err)
+	}
+
+	dst, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	imported, err := dst.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("while importing: %v", err)
+	}
+	if len(imported) != 3 {
+		t.Errorf("imported %d entries, expected 3", len(imported))
+	}
+
+	e, err := dst.FindEntryBySource(OciTempCacheType, "docker://alpine")
+	if err != nil {
+		t.Fatalf("while finding entry: %v", err)
+	}
+	if e == nil || !e.Exists {
+		t.Fatalf("imported entry not found by source")
+	}
+	if e, _ := dst.FindEntryBySource(OciTempCacheType, "docker://busybox"); e != nil {
+		t.Errorf("unexpected entry found for unknown source: %+v", e)
+	}
+
+	// entries already present are skipped
+	imported, err = dst.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("while importing: %v", err)
+	}
+	if len(imported) != 0 {
+		t.Errorf("imported %d entries already present", len(imported))
+	}
+}
+
+func TestImportCorrupted(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	src, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	addSourceEntry(t, src, LibraryCacheType, "image", "library://image:latest")
+	entries, err := src.SelectEntries(nil, nil)
+	if err != nil {
+		t.Fatalf("while selecting entries: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := src.Export(&buf, entries); err != nil {
+		t.Fatalf("while exporting: %v", err)
+	}
+	b := buf.Bytes()
+
+	// an archive whose manifest doesn't match the content of the entry
+	entries[0].Digest = digestPrefix + strings.Repeat("0", 64)
+	var corrupted bytes.Buffer
+	if err := src.Export(&corrupted, entries); err != nil {
+		t.Fatalf("while exporting: %v", err)
+	}
+
+	dst, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	if _, err := dst.Import(&corrupted); err == nil {
+		t.Fatalf("unexpected success importing corrupted archive")
+	}
+	e, err := dst.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	defer e.CleanTmp()
+	if e.Exists {
+		t.Errorf("corrupted entry added to the cache")
+	}
+
+	// truncated archive
+	if _, err := dst.Import(bytes.NewReader(b[:1024])); err == nil {
+		t.Errorf("unexpected success importing truncated archive")
+	}
+}
+
+func TestExportImportOciImage(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	src, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	layoutDir, err := src.GetOciCacheDir(OciBlobCacheType)
+	if err != nil {
+		t.Fatalf("while getting OCI cache directory: %v", err)
+	}
+	lp, err := layout.Write(layoutDir, empty.Index)
+	if err != nil {
+		t.Fatalf("while creating OCI layout: %v", err)
+	}
+	for _, source := range []string{"docker://alpine", "docker://busybox"} {
+		img, err := random.Image(256, 2)
+		if err != nil {
+			t.Fatalf("while creating image: %v", err)
+		}
+		if err := lp.AppendImage(img); err != nil {
+			t.Fatalf("while writing image: %v", err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("while getting image digest: %v", err)
+		}
+		if err := src.RecordSource(OciBlobCacheType, digest.Hex, source); err != nil {
+			t.Fatalf("while recording source: %v", err)
+		}
+	}
+
+	// manifest, config and two layers
+	entries, err := src.SelectEntries(nil, []string{"docker://alpine"})
+	if err != nil {
+		t.Fatalf("while selecting entries: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("selected %d entries, expected 4: %+v", len(entries), entries)
+	}
+	var buf bytes.Buffer
+	if err := src.Export(&buf, entries); err != nil {
+		t.Fatalf("while exporting: %v", err)
+	}
+
+	dst, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	if _, err := dst.Import(&buf); err != nil {
+		t.Fatalf("while importing: %v", err)
+	}
+
+	e, err := dst.FindEntryBySource(OciBlobCacheType, "docker://alpine")
+	if err != nil || e == nil {
+		t.Fatalf("imported image not found by source: %v", err)
+	}
+	dstDir, err := dst.GetOciCacheDir(OciBlobCacheType)
+	if err != nil {
+		t.Fatalf("while getting OCI cache directory: %v", err)
+	}
+	dstLayout, err := layout.FromPath(dstDir)
+	if err != nil {
+		t.Fatalf("while opening OCI layout: %v", err)
+	}
+	manifests, err := dst.ociManifests()
+	if err != nil {
+		t.Fatalf("while reading OCI index: %v", err)
+	}
+	if len(manifests) != 1 {
+		t.Fatalf("%d manifests registered, expected 1", len(manifests))
+	}
+	for hex := range manifests {
+		digest, err := ggcrv1.NewHash(digestPrefix + hex)
+		if err != nil {
+			t.Fatalf("invalid digest: %v", err)
+		}
+		img, err := dstLayout.Image(digest)
+		if err != nil {
+			t.Fatalf("while reading imported image: %v", err)
+		}
+		layers, err := img.Layers()
+		if err != nil || len(layers) != 2 {
+			t.Fatalf("unexpected layers for imported image: %v", err)
+		}
+	}
+	if _, err := os.Stat(e.Path); err != nil {
+		t.Errorf("imported manifest blob missing: %v", err)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/docker/go-units"
 )
 
 var errInvalidCacheType = errors.New("invalid cache type")
@@ -33,6 +34,9 @@ const (
 	DirEnv = "APPTAINER_CACHEDIR"
 	// DisableEnv specifies whether the image should be used
 	DisableEnv = "APPTAINER_DISABLE_CACHE"
+	// MaxSizeEnv specifies the maximum size of the cache, e.g. 10G. When the
+	// cache grows beyond it, least recently used entries are evicted.
+	MaxSizeEnv = "APPTAINER_CACHE_MAX_SIZE"
 	// SubDirName specifies the name of the directory relative to the
 	// ParentDir specified when the cache is created.
 	// By default the cache will be placed at "~/.apptainer/cache" which
@@ -53,6 +57,8 @@ const (
 	IpfsCacheType = "ipfs"
 	// NetCacheType specifies the cache holds images pulled from http(s) internet sources
 	NetCacheType = "net"
+	// BuildCacheType specifies the cache holds root filesystem snapshots of build stages
+	BuildCacheType = "build"
 )
 
 var (
@@ -64,6 +70,7 @@ var (
 		OrasCacheType,
 		IpfsCacheType,
 		NetCacheType,
+		BuildCacheType,
 	}
 	// OciCacheTypes specifies the OCI cache types.
 	OciCacheTypes = []string{
@@ -78,6 +85,13 @@ type Config struct {
 	ParentDir string
 	// Disable specifies whether the user request the cache to be disabled by default.
 	Disable bool
+	// MaxSize specifies the maximum size of the cache in bytes, 0 means unlimited.
+	// It is overridden by the environment variable specified by MaxSizeEnv.
+	MaxSize int64
+	// SharedDir specifies the location of a read-only cache shared between
+	// users, consulted before the user cache. It has the same layout as a
+	// cache created with ParentDir set to the same location.
+	SharedDir string
 }
 
 // Handle is an structure representing the image cache, it's location and subdirectories
@@ -92,6 +106,11 @@ type Handle struct {
 	rootDir string
 	// If the cache is disabled
 	disabled bool
+	// maxSize is the maximum size of the cache in bytes, 0 if unlimited
+	maxSize int64
+	// sharedRootDir is the root directory of the read-only shared cache,
+	// empty if there is no shared cache
+	sharedRootDir string
 }
 
 func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error) {
@@ -101,6 +120,10 @@ func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error)
 	return h.getCacheTypeDir(cacheType), nil
 }
 
+// GetOciCacheDir returns the directory of an OCI cache type within the user
+// cache. Modifications of the OCI layout it holds must be done while holding
+// the lock returned by LockOciCacheDir. See GetSharedOciCacheDir for the
+// shared cache.
 func (h *Handle) GetOciCacheDir(cacheType string) (cacheDir string, err error) {
 	if !stringInSlice(cacheType, OciCacheTypes) {
 		return "", errInvalidCacheType
@@ -108,19 +131,31 @@ func (h *Handle) GetOciCacheDir(cacheType string) (cacheDir string, err error) {
 	return h.getCacheTypeDir(cacheType), nil
 }
 
-// GetEntry returns a cache Entry for a specified file cache type and hash
+// GetEntry returns a cache Entry for a specified file cache type and hash.
+// If a shared cache is configured and holds a valid entry, it is returned in
+// preference to the user cache. When the entry doesn't exist, a lock is held
+// until the entry is finalized or cleaned, so that concurrent processes don't
+// create the same entry at the same time.
 func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	if h.disabled {
 		return nil, nil
 	}
 
-	e = &Entry{}
-
 	cacheDir, err := h.GetFileCacheDir(cacheType)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get '%s' cache directory: %v", cacheType, err)
 	}
 
+	// The shared cache takes precedence over the user cache
+	if e := h.getSharedEntry(cacheType, hash); e != nil {
+		return e, nil
+	}
+
+	e = &Entry{
+		CacheType: cacheType,
+		handle:    h,
+	}
+
 	e.Path = filepath.Join(cacheDir, hash)
 
 	// If there is a directory it's from an older version of Apptainer
@@ -141,19 +176,37 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 		return nil, fmt.Errorf("could not check for cache entry '%s': %v", e.Path, err)
 	}
 
+	if !pathExists {
+		// Serialize the creation of the entry between concurrent processes,
+		// the entry may have been created while waiting for the lock
+		e.lockFd, err = h.lockFile(cacheType, hash)
+		if err != nil {
+			return nil, err
+		}
+		e.locked = true
+		pathExists, err = fs.PathExists(e.Path)
+		if err != nil {
+			e.releaseLock()
+			return nil, fmt.Errorf("could not check for cache entry '%s': %v", e.Path, err)
+		}
+	}
+
 	if !pathExists {
 		e.Exists = false
-		f, err := fs.MakeTmpFile(cacheDir, "tmp_", 0o700)
+		f, err := fs.MakeTmpFile(cacheDir, tmpEntryPrefix, 0o700)
 		if err != nil {
+			e.releaseLock()
 			return nil, err
 		}
 		err = f.Close()
 		if err != nil {
+			e.releaseLock()
 			return nil, err
 		}
 		e.TmpPath = f.Name()
 		return e, nil
 	}
+	e.releaseLock()
 
 	// Double check that there isn't something else weird there
 	if !fs.IsFile(e.Path) {
@@ -162,6 +215,9 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 
 	// It exists in the cache and it's a file. Caller can use the Path directly
 	e.Exists = true
+	if err := h.UpdateAccess(cacheType, hash); err != nil {
+		sylog.Debugf("Could not update access time of cache entry '%s': %v", e.Path, err)
+	}
 	return e, nil
 }
 
@@ -197,6 +253,17 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 			if err != nil {
 				sylog.Errorf("Could not remove cache entry '%s': %v", f.Name(), err)
 				errCount = errCount + 1
+				continue
+			}
+			if stringInSlice(cacheType, OciCacheTypes) {
+				// entries of the OCI cache are the layout components,
+				// all blobs metadata are stale if they are removed
+				err = os.RemoveAll(path.Join(h.rootDir, metadataDirName, cacheType))
+				if err != nil {
+					sylog.Debugf("Could not remove %s cache metadata: %v", cacheType, err)
+				}
+			} else {
+				h.removeMetadata(cacheType, f.Name())
 			}
 		}
 	}
@@ -240,6 +307,15 @@ func New(cfg Config) (h *Handle, err error) {
 	if cacheDisabled || cfg.Disable {
 		h.disabled = true
 	}
+	// The maximum size set in the environment takes precedence over the one
+	// requested by the configuration
+	h.maxSize = cfg.MaxSize
+	if envMaxSize := os.Getenv(MaxSizeEnv); envMaxSize != "" {
+		h.maxSize, err = ParseMaxSize(envMaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse environment variable %s: %s", MaxSizeEnv, err)
+		}
+	}
 	// If the cache is disabled, we stop here. Basically we return a valid handle that is not fully initialized
 	// since it would create the directories required by an enabled cache.
 	if h.disabled {
@@ -253,6 +329,17 @@ func New(cfg Config) (h *Handle, err error) {
 	}
 	h.parentDir = parentDir
 
+	if cfg.SharedDir != "" {
+		sharedRootDir := path.Join(cfg.SharedDir, SubDirName)
+		if !fs.IsDir(sharedRootDir) {
+			sylog.Warningf("Shared cache directory %s doesn't exist, ignoring it", sharedRootDir)
+		} else if filepath.Clean(cfg.SharedDir) != filepath.Clean(parentDir) {
+			// the shared cache is populated as a regular cache, in
+			// which case it's not consulted as an additional tier
+			h.sharedRootDir = sharedRootDir
+		}
+	}
+
 	// If we can't access the parent of the cache directory then don't use the
 	// cache.
 	ep, err := fs.FirstExistingParent(parentDir)
@@ -331,6 +418,22 @@ func initCacheDir(dir string) error {
 	return nil
 }
 
+// ParseMaxSize parses a human readable cache size (e.g. 500M, 10G), an empty
+// string or 0 means unlimited.
+func ParseMaxSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	maxSize, err := units.RAMInBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	if maxSize < 0 {
+		return 0, fmt.Errorf("negative cache size %s", size)
+	}
+	return maxSize, nil
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
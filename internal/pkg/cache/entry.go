@@ -13,9 +13,11 @@ package cache
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
 )
 
 // Entry is a structure representing an entry in the cache. An entry is a file under the
@@ -31,10 +33,26 @@ type Entry struct {
 	// tmpPath is the temporary location that should be used for a new cache entry as it
 	// is created
 	TmpPath string
+	// Shared is true if the entry exists in the read-only shared cache, in
+	// which case Path must not be modified
+	Shared bool
+	// Source is the URI the entry is retrieved from, recorded when the entry
+	// is finalized so that it can be found with FindEntryBySource, and
+	// exported by reference
+	Source string
+	// handle is the cache handle which created the entry
+	handle *Handle
+	// locked is true while the lock on the entry creation is held
+	locked bool
+	// lockFd is the file descriptor of the lock held during creation of the
+	// entry
+	lockFd int
 }
 
 // Finalize an entry by renaming it to its permanent path atomically
 func (e *Entry) Finalize() error {
+	defer e.releaseLock()
+
 	// Try to rename the temporary file to its permanent path
 	// This is a file, so we won't have an IsExist error since...
 	//   If newpath already exists and is not a directory, Rename replaces it.
@@ -43,11 +61,25 @@ func (e *Entry) Finalize() error {
 	if err != nil {
 		return fmt.Errorf("could not finalize cached file: %v", err)
 	}
+
+	if e.handle == nil {
+		return nil
+	}
+	if err := e.handle.recordDigest(e.CacheType, filepath.Base(e.Path), e.Path, e.Source); err != nil {
+		sylog.Debugf("Could not record digest of cache entry '%s': %v", e.Path, err)
+	}
+	// the entry was just added, keep it even if it's larger than the
+	// maximum size of the cache
+	if err := e.handle.EnforceMaxSize(e.Path); err != nil {
+		sylog.Warningf("Could not enforce maximum cache size: %v", err)
+	}
 	return nil
 }
 
 // CleanTmp should be defer'd when an Entry is created and will remove any temporary file
 func (e *Entry) CleanTmp() {
+	e.releaseLock()
+
 	// If there is no TmpPath / file there then there is nothing to clean up
 	if e.TmpPath == "" || !fs.IsFile(e.TmpPath) {
 		return
@@ -57,3 +89,14 @@ func (e *Entry) CleanTmp() {
 		sylog.Errorf("Could not remove cache temporary file '%s': %v", e.TmpPath, err)
 	}
 }
+
+// releaseLock releases the lock held during creation of the entry, if any
+func (e *Entry) releaseLock() {
+	if !e.locked {
+		return
+	}
+	if err := lock.Release(e.lockFd); err != nil {
+		sylog.Debugf("Could not release lock of cache entry '%s': %v", e.Path, err)
+	}
+	e.locked = false
+}
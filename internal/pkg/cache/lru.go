@@ -0,0 +1,355 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+	ggcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// cacheItem describes an entry of the cache considered for eviction. For the
+// OCI blob cache, blobs lists the hex encoded digests of the blobs evicted
+// with the item, and image is set when the item is an image registered in
+// the index of the OCI layout.
+type cacheItem struct {
+	cacheType  string
+	name       string
+	path       string
+	size       int64
+	lastAccess time.Time
+	blobs      []string
+	image      bool
+}
+
+// getEntriesDir returns the directory holding the entries of a cache type.
+// For OCI cache types, entries are the blobs of the OCI layout.
+func (h *Handle) getEntriesDir(cacheType string) string {
+	dir := h.getCacheTypeDir(cacheType)
+	if stringInSlice(cacheType, OciCacheTypes) {
+		dir = filepath.Join(dir, "blobs", "sha256")
+	}
+	return dir
+}
+
+// listItems returns all the entries of the file and OCI caches.
+func (h *Handle) listItems() ([]cacheItem, error) {
+	var items []cacheItem
+
+	cacheTypes := append([]string{}, FileCacheTypes...)
+	cacheTypes = append(cacheTypes, OciCacheTypes...)
+
+	for _, cacheType := range cacheTypes {
+		dir := h.getEntriesDir(cacheType)
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read cache directory %s: %v", dir, err)
+		}
+		for _, entry := range entries {
+			// skip entries being created
+			if strings.HasPrefix(entry.Name(), tmpEntryPrefix) || entry.IsDir() {
+				continue
+			}
+			fi, err := entry.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				// concurrently removed
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("unable to get info for cache entry %s: %v", entry.Name(), err)
+			}
+			items = append(items, cacheItem{
+				cacheType:  cacheType,
+				name:       entry.Name(),
+				path:       filepath.Join(dir, entry.Name()),
+				size:       fi.Size(),
+				lastAccess: h.lastAccess(cacheType, entry.Name(), fi),
+			})
+		}
+	}
+
+	return items, nil
+}
+
+// MaxSize returns the maximum size of the cache in bytes, 0 if unlimited.
+func (h *Handle) MaxSize() int64 {
+	return h.maxSize
+}
+
+// EnforceMaxSize evicts the least recently used entries, across the file and
+// OCI caches, until the total size of the cache doesn't exceed the configured
+// maximum size. Images of the OCI cache are evicted as a whole: the image is
+// removed from the index of the OCI layout along with the blobs no remaining
+// image references. Entries whose path is listed in keep are never evicted.
+func (h *Handle) EnforceMaxSize(keep ...string) error {
+	if h.disabled || h.maxSize <= 0 {
+		return nil
+	}
+
+	// prevent eviction of OCI blobs while the OCI layout is modified
+	unlock, err := h.LockOciCacheDir(OciBlobCacheType)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	items, err := h.listItems()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, item := range items {
+		total += item.size
+	}
+	if total <= h.maxSize {
+		return nil
+	}
+
+	sylog.Debugf("Cache size %s exceeds maximum size %s, evicting least recently used entries",
+		fs.FindSize(total), fs.FindSize(h.maxSize))
+
+	evictable, blobs, err := h.evictionItems(items)
+	if err != nil {
+		return err
+	}
+
+	// number of evictable items referencing each OCI blob
+	refs := make(map[string]int)
+	for _, item := range evictable {
+		for _, b := range item.blobs {
+			refs[b]++
+		}
+	}
+
+	sort.SliceStable(evictable, func(i, j int) bool {
+		return evictable[i].lastAccess.Before(evictable[j].lastAccess)
+	})
+
+	for _, item := range evictable {
+		if total <= h.maxSize {
+			break
+		}
+		if stringInSlice(item.path, keep) {
+			continue
+		}
+		sylog.Debugf("Evicting %s cache entry %s (last access %s)", item.cacheType, item.name, item.lastAccess.Format(time.RFC3339))
+
+		if item.cacheType != OciBlobCacheType {
+			if err := os.Remove(item.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				sylog.Warningf("Could not evict cache entry %s: %v", item.path, err)
+				continue
+			}
+			h.removeMetadata(item.cacheType, item.name)
+			total -= item.size
+			continue
+		}
+
+		if item.image {
+			if err := h.removeOciImage(item.name); err != nil {
+				sylog.Warningf("Could not evict cached image %s%s: %v", digestPrefix, item.name, err)
+				continue
+			}
+		}
+		for _, b := range item.blobs {
+			refs[b]--
+			blob := blobs[b]
+			if refs[b] > 0 || stringInSlice(blob.path, keep) {
+				continue
+			}
+			if err := os.Remove(blob.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				sylog.Warningf("Could not evict cache entry %s: %v", blob.path, err)
+				continue
+			}
+			h.removeMetadata(blob.cacheType, blob.name)
+			total -= blob.size
+		}
+	}
+
+	if total > h.maxSize {
+		sylog.Warningf("Cache size %s still exceeds maximum size %s", fs.FindSize(total), fs.FindSize(h.maxSize))
+	}
+
+	return nil
+}
+
+// evictionItems returns the items evicted by EnforceMaxSize. File cache
+// entries are returned as is, while the blobs of the OCI cache are grouped by
+// image: an image registered in the index of the OCI layout is evicted with
+// its manifest, config and layers, and blobs not referenced by any image are
+// evicted individually. The blobs of the OCI cache are also returned, indexed
+// by hex encoded digest.
+func (h *Handle) evictionItems(items []cacheItem) ([]cacheItem, map[string]cacheItem, error) {
+	var evictable []cacheItem
+
+	blobs := make(map[string]cacheItem)
+	for _, item := range items {
+		if item.cacheType == OciBlobCacheType {
+			blobs[item.name] = item
+		} else {
+			evictable = append(evictable, item)
+		}
+	}
+
+	manifests, err := h.ociManifests()
+	if err != nil {
+		return nil, nil, fmt.Errorf("while reading OCI cache index: %v", err)
+	}
+	digests := make([]string, 0, len(manifests))
+	for digest := range manifests {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+
+	referenced := make(map[string]bool)
+	for _, digest := range digests {
+		image := cacheItem{
+			cacheType: OciBlobCacheType,
+			name:      digest,
+			path:      filepath.Join(h.getEntriesDir(OciBlobCacheType), digest),
+			image:     true,
+		}
+		refs, err := h.imageBlobs(digest, manifests[digest])
+		if err != nil {
+			// a broken image is evicted first, with the blobs found
+			sylog.Debugf("While reading cached image %s%s: %v", digestPrefix, digest, err)
+		} else {
+			// the access time of the manifest is updated on each use
+			image.lastAccess = blobs[digest].lastAccess
+		}
+		for _, b := range refs {
+			blob, ok := blobs[b]
+			if !ok || slices.Contains(image.blobs, b) {
+				continue
+			}
+			image.blobs = append(image.blobs, b)
+			image.size += blob.size
+			referenced[b] = true
+		}
+		evictable = append(evictable, image)
+	}
+
+	for _, item := range items {
+		if item.cacheType != OciBlobCacheType || referenced[item.name] {
+			continue
+		}
+		item.blobs = []string{item.name}
+		evictable = append(evictable, item)
+	}
+
+	return evictable, blobs, nil
+}
+
+// imageBlobs returns the hex encoded digests of the blobs of the OCI cache
+// referenced by the image manifest or index with the given digest, including
+// its own. Manifests of an index missing from the cache are ignored.
+func (h *Handle) imageBlobs(digest, mediaType string) ([]string, error) {
+	path := filepath.Join(h.getEntriesDir(OciBlobCacheType), digest)
+	blobs := []string{digest}
+
+	if !ggcrtypes.MediaType(mediaType).IsIndex() {
+		deps, err := manifestBlobs(path)
+		return append(blobs, deps...), err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return blobs, err
+	}
+	defer f.Close()
+
+	im, err := ggcrv1.ParseIndexManifest(f)
+	if err != nil {
+		return blobs, err
+	}
+	for _, m := range im.Manifests {
+		deps, err := h.imageBlobs(m.Digest.Hex, string(m.MediaType))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return blobs, err
+		}
+		blobs = append(blobs, deps...)
+	}
+	return blobs, nil
+}
+
+// removeOciImage removes the image with the given hex encoded digest from the
+// index of the OCI layout of the blob cache.
+func (h *Handle) removeOciImage(digest string) error {
+	lp, err := layout.FromPath(h.getCacheTypeDir(OciBlobCacheType))
+	if err != nil {
+		return err
+	}
+	hash, err := ggcrv1.NewHash(digestPrefix + digest)
+	if err != nil {
+		return err
+	}
+	return lp.RemoveDescriptors(match.Digests(hash))
+}
+
+// locksDirName is the name of the directory, within the cache root, holding
+// the lock files of cache entries.
+const locksDirName = ".locks"
+
+// lockFile acquires an exclusive lock on the lock file name of the given
+// cache type, creating it if required.
+func (h *Handle) lockFile(cacheType, name string) (int, error) {
+	dir := filepath.Join(h.rootDir, locksDirName, cacheType)
+	if err := initCacheDir(dir); err != nil {
+		return -1, err
+	}
+	path := filepath.Join(dir, name+".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return -1, fmt.Errorf("could not create lock file %s: %v", path, err)
+	}
+	f.Close()
+
+	fd, err := lock.Exclusive(path)
+	if err != nil {
+		return -1, fmt.Errorf("could not lock %s: %v", path, err)
+	}
+	return fd, nil
+}
+
+// LockOciCacheDir acquires an exclusive lock on the directory of an OCI cache
+// type, serializing modifications of the OCI layout between concurrent
+// processes. The returned function releases the lock.
+func (h *Handle) LockOciCacheDir(cacheType string) (unlock func(), err error) {
+	if !stringInSlice(cacheType, OciCacheTypes) {
+		return nil, errInvalidCacheType
+	}
+	if h.disabled {
+		return func() {}, nil
+	}
+	fd, err := h.lockFile(cacheType, cacheType)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := lock.Release(fd); err != nil {
+			sylog.Debugf("Could not release %s cache lock: %v", cacheType, err)
+		}
+	}, nil
+}
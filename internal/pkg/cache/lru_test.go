@@ -0,0 +1,368 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ggcrv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func TestParseMaxSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{name: "Empty", size: "", want: 0},
+		{name: "Bytes", size: "1024", want: 1024},
+		{name: "Megabytes", size: "500M", want: 500 << 20},
+		{name: "Gigabytes", size: "2g", want: 2 << 30},
+		{name: "Invalid", size: "lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMaxSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func addEntry(t *testing.T, h *Handle, cacheType, name string, size int, accessed time.Time) string {
+	t.Helper()
+
+	e, err := h.GetEntry(cacheType, name)
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if err := os.WriteFile(e.TmpPath, make([]byte, size), 0o600); err != nil {
+		t.Fatalf("while writing entry: %v", err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing entry: %v", err)
+	}
+	// set the recorded access time, with a modification time
+	// in the opposite order to ensure it's not used
+	err = h.updateMetadata(cacheType, name, func(md *entryMetadata) {
+		md.LastAccess = accessed
+	})
+	if err != nil {
+		t.Fatalf("while updating access: %v", err)
+	}
+	mtime := time.Now().Add(time.Since(accessed))
+	if err := os.Chtimes(e.Path, mtime, mtime); err != nil {
+		t.Fatalf("while setting times: %v", err)
+	}
+	return e.Path
+}
+
+func TestEnforceMaxSize(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+
+	now := time.Now()
+	oldest := addEntry(t, h, LibraryCacheType, "oldest", 400, now.Add(-3*time.Hour))
+	older := addEntry(t, h, OrasCacheType, "older", 400, now.Add(-2*time.Hour))
+	recent := addEntry(t, h, NetCacheType, "recent", 400, now.Add(-1*time.Hour))
+
+	// a temporary entry being created must not be evicted
+	tmp, err := h.GetEntry(LibraryCacheType, "pending")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	defer tmp.CleanTmp()
+	if err := os.WriteFile(tmp.TmpPath, make([]byte, 400), 0o600); err != nil {
+		t.Fatalf("while writing entry: %v", err)
+	}
+
+	// no maximum size, nothing is evicted
+	if err := h.EnforceMaxSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, p := range []string{oldest, older, recent, tmp.TmpPath} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("entry %s unexpectedly evicted", p)
+		}
+	}
+
+	h.maxSize = 900
+	if err := h.EnforceMaxSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Errorf("least recently used entry %s not evicted", oldest)
+	}
+	if _, err := os.Stat(h.getMetadataPath(LibraryCacheType, "oldest")); !os.IsNotExist(err) {
+		t.Errorf("metadata of entry %s not removed", oldest)
+	}
+	for _, p := range []string{older, recent, tmp.TmpPath} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("entry %s unexpectedly evicted", p)
+		}
+	}
+
+	// a cache hit refreshes the access time
+	if _, err := h.GetEntry(OrasCacheType, "older"); err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	h.maxSize = 500
+	if err := h.EnforceMaxSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(recent); !os.IsNotExist(err) {
+		t.Errorf("least recently used entry %s not evicted", recent)
+	}
+	if _, err := os.Stat(older); err != nil {
+		t.Errorf("recently accessed entry %s unexpectedly evicted", older)
+	}
+
+	// kept entries are never evicted
+	h.maxSize = 1
+	if err := h.EnforceMaxSize(older); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(older); err != nil {
+		t.Errorf("kept entry %s unexpectedly evicted", older)
+	}
+}
+
+func TestEnforceMaxSizeOciBlobs(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	h, err := New(Config{ParentDir: t.TempDir(), MaxSize: 100})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+
+	blobDir := h.getEntriesDir(OciBlobCacheType)
+	if err := os.MkdirAll(blobDir, 0o700); err != nil {
+		t.Fatalf("while creating blob directory: %v", err)
+	}
+	blobs := []string{"aaaa", "bbbb"}
+	for i, b := range blobs {
+		if err := os.WriteFile(filepath.Join(blobDir, b), make([]byte, 80), 0o600); err != nil {
+			t.Fatalf("while writing blob: %v", err)
+		}
+		// entries without metadata fall back to the modification time
+		mtime := time.Now().Add(time.Duration(i-len(blobs)) * time.Hour)
+		if err := os.Chtimes(filepath.Join(blobDir, b), mtime, mtime); err != nil {
+			t.Fatalf("while setting times: %v", err)
+		}
+	}
+
+	if err := h.EnforceMaxSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(blobDir, "aaaa")); !os.IsNotExist(err) {
+		t.Errorf("least recently used blob not evicted")
+	}
+	if _, err := os.Stat(filepath.Join(blobDir, "bbbb")); err != nil {
+		t.Errorf("most recently used blob unexpectedly evicted")
+	}
+}
+
+// imageBlobDigests returns the digests of the manifest, config and layers of img.
+func imageBlobDigests(t *testing.T, img ggcrv1.Image) []ggcrv1.Hash {
+	t.Helper()
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := img.ConfigName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests := []ggcrv1.Hash{digest, config}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, d)
+	}
+	return digests
+}
+
+func TestEnforceMaxSizeOciImages(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	lp, err := layout.Write(h.getCacheTypeDir(OciBlobCacheType), empty.Index)
+	if err != nil {
+		t.Fatalf("while creating OCI layout: %v", err)
+	}
+	blobDir := h.getEntriesDir(OciBlobCacheType)
+
+	// both images share their last layer
+	shared, err := random.Layer(256, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := make([]ggcrv1.Image, 2)
+	for i := range images {
+		img, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images[i], err = mutate.AppendLayers(img, shared)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	older, recent := images[0], images[1]
+
+	// pull writes the image to the OCI layout as the image fetch does
+	pull := func(img ggcrv1.Image, accessed time.Time) (size int64) {
+		t.Helper()
+		if err := lp.AppendImage(img); err != nil {
+			t.Fatalf("while writing image: %v", err)
+		}
+		for _, d := range imageBlobDigests(t, img) {
+			err := h.updateMetadata(OciBlobCacheType, d.Hex, func(md *entryMetadata) {
+				md.LastAccess = accessed
+			})
+			if err != nil {
+				t.Fatalf("while updating access: %v", err)
+			}
+			fi, err := os.Stat(filepath.Join(blobDir, d.Hex))
+			if err != nil {
+				t.Fatal(err)
+			}
+			size += fi.Size()
+		}
+		return size
+	}
+	indexed := func() map[ggcrv1.Hash]bool {
+		t.Helper()
+		idx, err := lp.ImageIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests := make(map[ggcrv1.Hash]bool)
+		for _, m := range im.Manifests {
+			digests[m.Digest] = true
+		}
+		return digests
+	}
+	validateImage := func(img ggcrv1.Image) {
+		t.Helper()
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached, err := lp.Image(digest)
+		if err != nil {
+			t.Fatalf("while reading cached image %s: %v", digest, err)
+		}
+		if err := validate.Image(cached); err != nil {
+			t.Errorf("cached image %s is invalid: %v", digest, err)
+		}
+	}
+
+	now := time.Now()
+	pull(older, now.Add(-2*time.Hour))
+	recentSize := pull(recent, now.Add(-1*time.Hour))
+
+	// evicting the least recently used image must leave the blobs of the
+	// other image in place, along with its index entry
+	h.maxSize = recentSize
+	if err := h.EnforceMaxSize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	olderDigests := imageBlobDigests(t, older)
+	if indexed()[olderDigests[0]] {
+		t.Errorf("evicted image %s still registered in the index", olderDigests[0])
+	}
+	sharedDigest, err := shared.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range olderDigests {
+		_, err := os.Stat(filepath.Join(blobDir, d.Hex))
+		if d == sharedDigest && err != nil {
+			t.Errorf("shared blob %s unexpectedly evicted", d)
+		} else if d != sharedDigest && !os.IsNotExist(err) {
+			t.Errorf("blob %s of evicted image not removed", d)
+		}
+	}
+	recentDigests := imageBlobDigests(t, recent)
+	if !indexed()[recentDigests[0]] {
+		t.Errorf("image %s unexpectedly removed from the index", recentDigests[0])
+	}
+	validateImage(recent)
+
+	// pulling the evicted image again restores it fully
+	h.maxSize = 0
+	pull(older, now)
+	if !indexed()[olderDigests[0]] {
+		t.Errorf("image %s not registered in the index", olderDigests[0])
+	}
+	validateImage(older)
+	validateImage(recent)
+
+	// images being used are never evicted
+	h.maxSize = 1
+	if err := h.EnforceMaxSize(filepath.Join(blobDir, recentDigests[0].Hex)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if indexed()[olderDigests[0]] {
+		t.Errorf("evicted image %s still registered in the index", olderDigests[0])
+	}
+	validateImage(recent)
+}
+
+func TestMaxSizeEnv(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "1M")
+
+	h, err := New(Config{ParentDir: t.TempDir(), MaxSize: 100})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	if h.MaxSize() != 1<<20 {
+		t.Errorf("got max size %d, want %d", h.MaxSize(), 1<<20)
+	}
+
+	t.Setenv(MaxSizeEnv, "invalid")
+	if _, err := New(Config{ParentDir: t.TempDir()}); err == nil {
+		t.Errorf("unexpected success with invalid %s", MaxSizeEnv)
+	}
+}
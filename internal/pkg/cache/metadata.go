@@ -0,0 +1,284 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// metadataDirName is the name of the directory, within the cache root,
+	// holding the metadata of cache entries.
+	metadataDirName = ".metadata"
+	// tmpEntryPrefix is the prefix of temporary files of cache entries
+	// being created, see GetEntry.
+	tmpEntryPrefix = "tmp_"
+	// digestPrefix is the algorithm prefix of digests recorded in the
+	// metadata of cache entries.
+	digestPrefix = "sha256:"
+)
+
+// entryMetadata holds the metadata recorded for a cache entry. The access time
+// is tracked here rather than relying on the filesystem atime, which is often
+// disabled (noatime) on shared filesystems.
+type entryMetadata struct {
+	LastAccess time.Time `json:"lastAccess"`
+	// Digest is the digest of the entry content, recorded when the entry
+	// is finalized, and verified when reading from a shared cache.
+	Digest string `json:"digest,omitempty"`
+	// Size and ModTime are the size and modification time of the entry
+	// when its digest was recorded. The digest of an unchanged entry isn't
+	// verified again.
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime,omitzero"`
+	// Source is the URI the entry was retrieved from, used to find the
+	// entry when the source can't be resolved (e.g. without network access).
+	Source string `json:"source,omitempty"`
+}
+
+// getMetadataPath returns the path of the metadata file of the entry name
+// of the given cache type.
+func (h *Handle) getMetadataPath(cacheType, name string) string {
+	return metadataPath(h.rootDir, cacheType, name)
+}
+
+func metadataPath(rootDir, cacheType, name string) string {
+	return filepath.Join(rootDir, metadataDirName, cacheType, name+".json")
+}
+
+// readMetadata returns the metadata stored at path.
+func readMetadata(path string) (*entryMetadata, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	md := new(entryMetadata)
+	if err := json.Unmarshal(b, md); err != nil {
+		return nil, fmt.Errorf("while decoding metadata %s: %v", path, err)
+	}
+	return md, nil
+}
+
+// updateMetadata applies fn to the metadata of the entry name of the given
+// cache type, and writes it back.
+func (h *Handle) updateMetadata(cacheType, name string, fn func(*entryMetadata)) error {
+	if h.disabled {
+		return nil
+	}
+	if !stringInSlice(cacheType, FileCacheTypes) && !stringInSlice(cacheType, OciCacheTypes) {
+		return errInvalidCacheType
+	}
+
+	path := h.getMetadataPath(cacheType, name)
+	if err := initCacheDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	md, err := readMetadata(path)
+	if err != nil {
+		md = new(entryMetadata)
+	}
+	fn(md)
+
+	b, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+
+	// write metadata atomically, as concurrent processes may update
+	// the metadata of the same entry
+	f, err := fs.MakeTmpFile(filepath.Dir(path), tmpEntryPrefix, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write metadata for cache entry %s: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// UpdateAccess records the current time as the last access time of the entry
+// name of the given cache type. For the OCI blob cache, name is the hex
+// encoded digest of the blob.
+func (h *Handle) UpdateAccess(cacheType, name string) error {
+	return h.updateMetadata(cacheType, name, func(md *entryMetadata) {
+		md.LastAccess = time.Now()
+	})
+}
+
+// recordDigest computes and records the digest of the content of the entry
+// name of the given cache type stored at path, along with its source if not
+// empty.
+func (h *Handle) recordDigest(cacheType, name, path, source string) error {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return h.updateMetadata(cacheType, name, func(md *entryMetadata) {
+		md.LastAccess = time.Now()
+		md.Digest = digest
+		md.Size = fi.Size()
+		md.ModTime = fi.ModTime()
+		if source != "" {
+			md.Source = source
+		}
+	})
+}
+
+// RecordSource records the URI the entry name of the given cache type was
+// retrieved from. For the OCI blob cache, the source is recorded on the image
+// manifest blob.
+func (h *Handle) RecordSource(cacheType, name, source string) error {
+	return h.updateMetadata(cacheType, name, func(md *entryMetadata) {
+		md.Source = source
+	})
+}
+
+// FindEntryBySource returns the most recently used entry of the given cache
+// type retrieved from source, or nil if there is none. It allows to use
+// cached entries when the source can't be resolved to a cache entry name,
+// e.g. on hosts without network access. For the OCI blob cache, the name of
+// the entry is the hex encoded digest of an image manifest.
+func (h *Handle) FindEntryBySource(cacheType, source string) (*Entry, error) {
+	if h.disabled || source == "" {
+		return nil, nil
+	}
+	if !stringInSlice(cacheType, FileCacheTypes) && !stringInSlice(cacheType, OciCacheTypes) {
+		return nil, errInvalidCacheType
+	}
+
+	dir := filepath.Join(h.rootDir, metadataDirName, cacheType)
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read cache metadata directory %s: %v", dir, err)
+	}
+
+	var (
+		e          *Entry
+		lastAccess time.Time
+	)
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || strings.HasPrefix(name, tmpEntryPrefix) {
+			continue
+		}
+		md, err := readMetadata(filepath.Join(dir, f.Name()))
+		if err != nil || md.Source != source {
+			continue
+		}
+		path := filepath.Join(h.getEntriesDir(cacheType), name)
+		if !fs.IsFile(path) {
+			continue
+		}
+		if e == nil || md.LastAccess.After(lastAccess) {
+			e = &Entry{
+				CacheType: cacheType,
+				Exists:    true,
+				Path:      path,
+				handle:    h,
+			}
+			lastAccess = md.LastAccess
+		}
+	}
+
+	if e != nil {
+		if err := h.UpdateAccess(cacheType, filepath.Base(e.Path)); err != nil {
+			sylog.Debugf("Could not update access time of cache entry '%s': %v", e.Path, err)
+		}
+	}
+	return e, nil
+}
+
+// lastAccess returns the last access time recorded for an entry, falling back
+// to its modification time for entries without metadata (e.g. entries created
+// by an older version of Apptainer).
+func (h *Handle) lastAccess(cacheType, name string, fi os.FileInfo) time.Time {
+	md, err := readMetadata(h.getMetadataPath(cacheType, name))
+	if err != nil || md.LastAccess.IsZero() {
+		return fi.ModTime()
+	}
+	return md.LastAccess
+}
+
+// removeMetadata removes the metadata of the entry name of the given cache
+// type.
+func (h *Handle) removeMetadata(cacheType, name string) {
+	err := os.Remove(h.getMetadataPath(cacheType, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		sylog.Debugf("Could not remove metadata of cache entry %s: %v", name, err)
+	}
+}
+
+// fileDigest returns the sha256 digest of the file at path.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("while computing digest of %s: %v", path, err)
+	}
+	return digestPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyDigest checks that the content of the file at path matches digest.
+func verifyDigest(path, digest string) error {
+	if !strings.HasPrefix(digest, digestPrefix) {
+		return fmt.Errorf("unsupported digest %q", digest)
+	}
+	got, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	if got != digest {
+		return fmt.Errorf("digest mismatch for %s: expected %s, got %s", path, digest, got)
+	}
+	return nil
+}
+
+// verifyEntry checks that the content of the cache entry at path matches the
+// digest recorded in its metadata. The digest is only computed if the size or
+// modification time of the entry differ from the recorded ones.
+func verifyEntry(path string, md *entryMetadata) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !md.ModTime.IsZero() && md.ModTime.Equal(fi.ModTime()) && md.Size == fi.Size() {
+		return nil
+	}
+	return verifyDigest(path, md.Digest)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// getSharedEntry returns the entry for the specified file cache type and hash
+// from the shared cache, or nil if the shared cache is not configured, or
+// doesn't hold a valid entry. The content of the entry is verified against
+// the digest recorded when the entry was added to the shared cache.
+func (h *Handle) getSharedEntry(cacheType, hash string) *Entry {
+	if h.sharedRootDir == "" {
+		return nil
+	}
+
+	path := filepath.Join(h.sharedRootDir, cacheType, hash)
+	if !fs.IsFile(path) {
+		return nil
+	}
+
+	md, err := readMetadata(metadataPath(h.sharedRootDir, cacheType, hash))
+	if err != nil || md.Digest == "" {
+		sylog.Debugf("Ignoring shared cache entry %s without recorded digest", path)
+		return nil
+	}
+	if err := verifyEntry(path, md); err != nil {
+		sylog.Warningf("Ignoring invalid shared cache entry: %v", err)
+		return nil
+	}
+
+	sylog.Debugf("Using shared cache entry %s", path)
+	return &Entry{
+		CacheType: cacheType,
+		Exists:    true,
+		Path:      path,
+		Shared:    true,
+	}
+}
+
+// GetSharedOciCacheDir returns the directory of an OCI cache type within the
+// shared cache, or an empty string if no shared cache is configured. The
+// directory is read-only and must not be used to store new images.
+func (h *Handle) GetSharedOciCacheDir(cacheType string) (string, error) {
+	if !stringInSlice(cacheType, OciCacheTypes) {
+		return "", errInvalidCacheType
+	}
+	if h.disabled || h.sharedRootDir == "" {
+		return "", nil
+	}
+	dir := filepath.Join(h.sharedRootDir, cacheType)
+	if !fs.IsDir(dir) {
+		return "", nil
+	}
+	return dir, nil
+}
+
+// VerifySharedBlob checks that the content of the blob with the given digest
+// (e.g. sha256:<hex>) in an OCI cache type of the shared cache matches its
+// digest.
+func (h *Handle) VerifySharedBlob(cacheType, digest string) error {
+	dir, err := h.GetSharedOciCacheDir(cacheType)
+	if err != nil {
+		return err
+	} else if dir == "" {
+		return fmt.Errorf("no shared %s cache", cacheType)
+	}
+	hex, ok := strings.CutPrefix(digest, digestPrefix)
+	if !ok || hex == "" || strings.ContainsRune(hex, os.PathSeparator) {
+		return fmt.Errorf("unsupported digest %q", digest)
+	}
+	return verifyDigest(filepath.Join(dir, "blobs", "sha256", hex), digest)
+}
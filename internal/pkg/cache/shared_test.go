@@ -0,0 +1,187 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharedEntry(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	// populate the shared cache as a regular cache
+	sharedDir := t.TempDir()
+	admin, err := New(Config{ParentDir: sharedDir, SharedDir: sharedDir})
+	if err != nil {
+		t.Fatalf("while creating shared cache: %v", err)
+	}
+	if admin.sharedRootDir != "" {
+		t.Errorf("shared cache consulted while populating it")
+	}
+	sharedPath := addEntry(t, admin, LibraryCacheType, "valid", 10, time.Now())
+	corruptPath := addEntry(t, admin, LibraryCacheType, "corrupt", 10, time.Now())
+	if err := os.WriteFile(corruptPath, []byte("corrupted!"), 0o600); err != nil {
+		t.Fatalf("while corrupting entry: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(admin.getCacheTypeDir(LibraryCacheType), "nodigest"), nil, 0o600); err != nil {
+		t.Fatalf("while writing entry: %v", err)
+	}
+
+	h, err := New(Config{ParentDir: t.TempDir(), SharedDir: sharedDir})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+
+	e, err := h.GetEntry(LibraryCacheType, "valid")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if !e.Exists || !e.Shared || e.Path != sharedPath {
+		t.Errorf("expected shared entry %s, got %+v", sharedPath, e)
+	}
+
+	for _, name := range []string{"corrupt", "nodigest", "missing"} {
+		e, err := h.GetEntry(LibraryCacheType, name)
+		if err != nil {
+			t.Fatalf("while getting entry: %v", err)
+		}
+		if e.Exists || e.Shared {
+			t.Errorf("unexpected shared entry for %s: %+v", name, e)
+		}
+		e.CleanTmp()
+	}
+}
+
+func TestVerifyEntry(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	path := addEntry(t, h, LibraryCacheType, "entry", 10, time.Now())
+	if err := h.recordDigest(LibraryCacheType, "entry", path, ""); err != nil {
+		t.Fatalf("while recording digest: %v", err)
+	}
+	md, err := readMetadata(h.getMetadataPath(LibraryCacheType, "entry"))
+	if err != nil {
+		t.Fatalf("while reading metadata: %v", err)
+	}
+	if md.Size != 10 || md.ModTime.IsZero() {
+		t.Fatalf("size and modification time not recorded: %+v", md)
+	}
+	if err := verifyEntry(path, md); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the digest isn't computed for an unchanged entry
+	if err := os.WriteFile(path, []byte("corrupted!"), 0o600); err != nil {
+		t.Fatalf("while corrupting entry: %v", err)
+	}
+	if err := os.Chtimes(path, md.ModTime, md.ModTime); err != nil {
+		t.Fatalf("while setting times: %v", err)
+	}
+	if err := verifyEntry(path, md); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	mtime := md.ModTime.Add(time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("while setting times: %v", err)
+	}
+	if err := verifyEntry(path, md); err == nil {
+		t.Errorf("unexpected success with modified entry")
+	}
+}
+
+func TestFinalizeError(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+
+	e, err := h.GetEntry(OrasCacheType, "entry")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if err := os.Remove(e.TmpPath); err != nil {
+		t.Fatalf("while removing temporary file: %v", err)
+	}
+	if err := e.Finalize(); err == nil {
+		t.Fatalf("unexpected success finalizing entry without temporary file")
+	}
+
+	// the entry lock must have been released
+	done := make(chan error, 1)
+	go func() {
+		e, err := h.GetEntry(OrasCacheType, "entry")
+		if err == nil {
+			e.CleanTmp()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("while getting entry: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("entry lock not released after finalize error")
+	}
+}
+
+func TestConcurrentEntry(t *testing.T) {
+	t.Setenv(MaxSizeEnv, "")
+
+	h, err := New(Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, err := h.GetEntry(OrasCacheType, "concurrent")
+			if err != nil {
+				t.Errorf("while getting entry: %v", err)
+				return
+			}
+			defer e.CleanTmp()
+			if e.Exists {
+				return
+			}
+			mu.Lock()
+			created++
+			mu.Unlock()
+			if err := os.WriteFile(e.TmpPath, []byte("content"), 0o600); err != nil {
+				t.Errorf("while writing entry: %v", err)
+				return
+			}
+			if err := e.Finalize(); err != nil {
+				t.Errorf("while finalizing entry: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("entry created %d times, expected once", created)
+	}
+}
@@ -228,6 +228,15 @@ func (m *Manager) Thaw() (err error) {
 	return m.cgroup.Freeze(lccgroups.Thawed)
 }
 
+// OOMKillCount returns the number of processes of the managed cgroup killed
+// by the out of memory killer.
+func (m *Manager) OOMKillCount() (uint64, error) {
+	if m.group == "" || m.cgroup == nil {
+		return 0, ErrUninitialized
+	}
+	return m.cgroup.OOMKillCount()
+}
+
 // Destroy deletes the managed cgroup.
 func (m *Manager) Destroy() (err error) {
 	if m.group == "" || m.cgroup == nil {
@@ -9,8 +9,11 @@
 package checkpoint
 
 import (
+	"context"
+	"errors"
 	"path/filepath"
 
+	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/pkg/syfs"
 )
 
@@ -18,6 +21,36 @@ const (
 	checkpointStatePath = "checkpoint"
 )
 
+// ErrNotSupported is returned by backends for operations they don't support.
+var ErrNotSupported = errors.New("operation not supported by checkpoint backend")
+
 func StatePath() string {
 	return filepath.Join(syfs.ConfigDir(), checkpointStatePath)
 }
+
+// Entry is a checkpoint holding the state saved by a backend.
+type Entry interface {
+	Name() string
+	Path() string
+}
+
+// Backend is a checkpoint backend, saving the state of instance processes
+// to checkpoints and restoring them.
+type Backend interface {
+	// Name returns the name of the backend, e.g. dmtcp.
+	Name() string
+	// QuickInstallationCheck emits a warning if the backend is not
+	// installed on the host.
+	QuickInstallationCheck()
+
+	Create(string) (Entry, error) // create checkpoint directory
+	Get(string) (Entry, error)    // ensure checkpoint directory exists
+	List() ([]Entry, error)       // list checkpoint directories
+	Delete(string) error          // delete checkpoint directory
+
+	// Checkpoint saves the state of the instance described by file, and
+	// returns the checkpoint holding it.
+	Checkpoint(ctx context.Context, file *instance.File) (Entry, error)
+	// Restore restores the instance saved in the checkpoint e.
+	Restore(ctx context.Context, e Entry) error
+}
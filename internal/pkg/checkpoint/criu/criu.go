@@ -0,0 +1,290 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package criu implements a checkpoint backend based on CRIU, which dumps and
+// restores the process tree of instances without requiring them to be
+// launched under a checkpointing tool.
+package criu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/checkpoint"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// BackendName is the name of the CRIU checkpoint backend.
+const BackendName = "criu"
+
+const (
+	criuPath     = "criu"
+	imagesDir    = "images"
+	instanceFile = "instance.json"
+	dumpLog      = "dump.log"
+	restoreLog   = "restore.log"
+	restorePid   = "restore.pid"
+)
+
+func criuDir() string {
+	return filepath.Join(checkpoint.StatePath(), criuPath)
+}
+
+type Entry struct {
+	path string
+}
+
+func (e *Entry) Path() string {
+	return e.path
+}
+
+func (e *Entry) Name() string {
+	return filepath.Base(e.path)
+}
+
+// imagesPath returns the directory holding the CRIU images of the checkpoint.
+func (e *Entry) imagesPath() string {
+	return filepath.Join(e.path, imagesDir)
+}
+
+// Options are the options of the CRIU checkpoint backend.
+type Options struct {
+	// LeaveRunning keeps the instance running after it's checkpointed.
+	LeaveRunning bool
+}
+
+type backend struct {
+	opts Options
+}
+
+// NewBackend returns the CRIU checkpoint backend. Instances are checkpointed
+// to a checkpoint with the same name, by dumping the process tree of the
+// instance, including its namespaces.
+func NewBackend(opts Options) checkpoint.Backend {
+	return &backend{opts: opts}
+}
+
+func (b *backend) Name() string {
+	return BackendName
+}
+
+// QuickInstallationCheck is a quick smoke test to see if criu is installed on
+// the host. If not found a warning is emitted.
+func (b *backend) QuickInstallationCheck() {
+	if _, err := bin.FindBin("criu"); err == nil {
+		return
+	}
+
+	sylog.Warningf("Unable to locate a criu installation, some functionality may not work as expected. Please ensure a criu installation exists or install it following instructions here: https://criu.org/Installation")
+}
+
+// checkName checks that name is a valid checkpoint name, which must also
+// be a valid instance name, so that it can't escape the checkpoint directory.
+func checkName(name string) error {
+	if name == "" {
+		return fmt.Errorf("checkpoint name must not be empty")
+	}
+	if name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return fmt.Errorf("invalid checkpoint name %q", name)
+	}
+	if err := instance.CheckName(name); err != nil {
+		return fmt.Errorf("invalid checkpoint name: %v", err)
+	}
+	return nil
+}
+
+func (b *backend) Create(name string) (checkpoint.Entry, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	err := os.MkdirAll(filepath.Join(criuDir(), name), 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{filepath.Join(criuDir(), name)}, nil
+}
+
+func (b *backend) Get(name string) (checkpoint.Entry, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	_, err := os.Stat(filepath.Join(criuDir(), name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{filepath.Join(criuDir(), name)}, nil
+}
+
+func (b *backend) List() ([]checkpoint.Entry, error) {
+	fis, err := os.ReadDir(criuDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := make([]checkpoint.Entry, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+
+		entries = append(entries, &Entry{filepath.Join(criuDir(), fi.Name())})
+	}
+
+	return entries, nil
+}
+
+func (b *backend) Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	_, err := os.Stat(filepath.Join(criuDir(), name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("checkpoint %q not found", name)
+		}
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(criuDir(), name))
+}
+
+// commonArgs returns the criu arguments shared by dump and restore, for an
+// instance described by file.
+func commonArgs(file *instance.File, e *Entry, logFile string) []string {
+	args := []string{
+		"--images-dir", e.imagesPath(),
+		"--log-file", filepath.Join(e.Path(), logFile),
+		"--tcp-established",
+		"--file-locks",
+		"--link-remap",
+		// mounts of the container image and bind paths are resolved
+		// against the host mount namespace
+		"--ext-mount-map", "auto",
+		"--enable-external-sharing",
+		"--enable-external-masters",
+	}
+	if file.Cgroup {
+		args = append(args, "--manage-cgroups")
+	}
+	if os.Geteuid() != 0 {
+		// requires CAP_CHECKPOINT_RESTORE
+		args = append(args, "--unprivileged")
+	}
+	return args
+}
+
+// run executes criu with args.
+func run(ctx context.Context, args []string) error {
+	criu, err := bin.FindBin("criu")
+	if err != nil {
+		return err
+	}
+	sylog.Debugf("Running %s %v", criu, args)
+	cmd := exec.CommandContext(ctx, criu, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Checkpoint dumps the process tree of the instance, rooted at the instance
+// master process, to the checkpoint named after the instance. Unless the
+// LeaveRunning option is set, the instance is stopped once dumped.
+func (b *backend) Checkpoint(ctx context.Context, file *instance.File) (checkpoint.Entry, error) {
+	if file.PPid <= 0 {
+		return nil, fmt.Errorf("instance %s is not running", file.Name)
+	}
+	if file.ShareNSMode {
+		return nil, fmt.Errorf("instances started with --sharens can't be checkpointed with %s", BackendName)
+	}
+
+	ce, err := b.Create(file.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint: %v", err)
+	}
+	e := ce.(*Entry)
+
+	// discard the state of a previous checkpoint
+	if err := os.RemoveAll(e.imagesPath()); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(e.imagesPath(), 0o700); err != nil {
+		return nil, err
+	}
+
+	// the instance file is required to restore the instance
+	data, err := json.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(e.Path(), instanceFile), data, 0o600); err != nil {
+		return nil, fmt.Errorf("while saving instance file: %v", err)
+	}
+
+	args := []string{"dump", "--tree", strconv.Itoa(file.PPid)}
+	args = append(args, commonArgs(file, e, dumpLog)...)
+	if b.opts.LeaveRunning {
+		args = append(args, "--leave-running")
+	}
+
+	if err := run(ctx, args); err != nil {
+		return nil, fmt.Errorf("criu dump failed, see %s for details: %v", filepath.Join(e.Path(), dumpLog), err)
+	}
+
+	return e, nil
+}
+
+// Restore restores the process tree of the instance dumped to the checkpoint
+// e, detached from the current process, and recreates its instance file.
+func (b *backend) Restore(ctx context.Context, ce checkpoint.Entry) error {
+	e, ok := ce.(*Entry)
+	if !ok {
+		return fmt.Errorf("not a %s checkpoint: %s", BackendName, ce.Name())
+	}
+
+	data, err := os.ReadFile(filepath.Join(e.Path(), instanceFile))
+	if err != nil {
+		return fmt.Errorf("checkpoint %s holds no instance state: %v", e.Name(), err)
+	}
+	saved := new(instance.File)
+	if err := json.Unmarshal(data, saved); err != nil {
+		return fmt.Errorf("while decoding instance file: %v", err)
+	}
+
+	file, err := instance.Add(saved.Name, instance.AppSubDir)
+	if err != nil {
+		return fmt.Errorf("could not restore instance: %v", err)
+	}
+
+	args := []string{"restore", "--restore-detached", "--pidfile", filepath.Join(e.Path(), restorePid)}
+	args = append(args, commonArgs(saved, e, restoreLog)...)
+
+	if err := run(ctx, args); err != nil {
+		return fmt.Errorf("criu restore failed, see %s for details: %v", filepath.Join(e.Path(), restoreLog), err)
+	}
+
+	// processes are restored with their original PIDs
+	path := file.Path
+	*file = *saved
+	file.Path = path
+	return file.Update()
+}
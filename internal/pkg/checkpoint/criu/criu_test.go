@@ -0,0 +1,92 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package criu
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+func TestCommonArgs(t *testing.T) {
+	e := &Entry{path: "/checkpoints/test"}
+
+	args := commonArgs(&instance.File{}, e, dumpLog)
+	if i := slices.Index(args, "--images-dir"); i < 0 || args[i+1] != filepath.Join(e.path, imagesDir) {
+		t.Errorf("unexpected images directory in %v", args)
+	}
+	if i := slices.Index(args, "--log-file"); i < 0 || args[i+1] != filepath.Join(e.path, dumpLog) {
+		t.Errorf("unexpected log file in %v", args)
+	}
+	if slices.Contains(args, "--manage-cgroups") {
+		t.Errorf("cgroups managed for instance without cgroup: %v", args)
+	}
+
+	args = commonArgs(&instance.File{Cgroup: true}, e, restoreLog)
+	if !slices.Contains(args, "--manage-cgroups") {
+		t.Errorf("cgroups not managed for instance with cgroup: %v", args)
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "checkpoint", wantErr: false},
+		{name: "my.checkpoint-1_a", wantErr: false},
+		{name: "", wantErr: true},
+		{name: ".", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "../other", wantErr: true},
+		{name: "a/b", wantErr: true},
+		{name: "/abs", wantErr: true},
+		{name: "with space", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := checkName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("checkName(%q): unexpected error %v", tt.name, err)
+		}
+	}
+
+	// names escaping the checkpoint directory are rejected before any
+	// filesystem access
+	b := NewBackend(Options{})
+	if _, err := b.Create("../escape"); err == nil {
+		t.Errorf("unexpected success creating checkpoint outside the checkpoint directory")
+	}
+	if _, err := b.Get(".."); err == nil {
+		t.Errorf("unexpected success getting checkpoint directory")
+	}
+	if err := b.Delete(".."); err == nil {
+		t.Errorf("unexpected success deleting checkpoint directory")
+	}
+}
+
+type otherEntry struct{}
+
+func (otherEntry) Name() string { return "other" }
+func (otherEntry) Path() string { return "/other" }
+
+func TestCheckpointErrors(t *testing.T) {
+	b := NewBackend(Options{})
+
+	if _, err := b.Checkpoint(context.Background(), &instance.File{Name: "test"}); err == nil {
+		t.Errorf("unexpected success checkpointing instance not running")
+	}
+	if _, err := b.Checkpoint(context.Background(), &instance.File{Name: "test", PPid: 1, ShareNSMode: true}); err == nil {
+		t.Errorf("unexpected success checkpointing --sharens instance")
+	}
+	if err := b.Restore(context.Background(), otherEntry{}); err == nil {
+		t.Errorf("unexpected success restoring checkpoint of another backend")
+	}
+}
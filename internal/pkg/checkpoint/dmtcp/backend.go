@@ -0,0 +1,104 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package dmtcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apptainer/apptainer/internal/pkg/checkpoint"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+)
+
+// BackendName is the name of the DMTCP checkpoint backend.
+const BackendName = "dmtcp"
+
+// ExecFunc executes args within the instance name.
+type ExecFunc func(ctx context.Context, name string, args []string) error
+
+type backend struct {
+	m    Manager
+	exec ExecFunc
+}
+
+// NewBackend returns the DMTCP checkpoint backend. DMTCP commands are run
+// within instances with exec. Instances must have been started with a
+// checkpoint to be checkpointed, and are restored when started with
+// --dmtcp-restart.
+func NewBackend(exec ExecFunc) checkpoint.Backend {
+	return &backend{
+		m:    NewManager(),
+		exec: exec,
+	}
+}
+
+func (b *backend) Name() string {
+	return BackendName
+}
+
+func (b *backend) QuickInstallationCheck() {
+	QuickInstallationCheck()
+}
+
+func (b *backend) Create(name string) (checkpoint.Entry, error) {
+	e, err := b.m.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (b *backend) Get(name string) (checkpoint.Entry, error) {
+	e, err := b.m.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (b *backend) List() ([]checkpoint.Entry, error) {
+	entries, err := b.m.List()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]checkpoint.Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+func (b *backend) Delete(name string) error {
+	return b.m.Delete(name)
+}
+
+func (b *backend) Checkpoint(ctx context.Context, file *instance.File) (checkpoint.Entry, error) {
+	if file.Checkpoint == "" {
+		return nil, fmt.Errorf("this instance was not started with checkpointing")
+	}
+
+	e, err := b.m.Get(file.Checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint entry: %v", err)
+	}
+
+	port, err := e.CoordinatorPort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse port file for coordinator port: %s", err)
+	}
+
+	if err := b.exec(ctx, file.Name, CheckpointArgs(port)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (b *backend) Restore(context.Context, checkpoint.Entry) error {
+	return fmt.Errorf("%w: start an instance with --dmtcp-restart instead", checkpoint.ErrNotSupported)
+}
@@ -49,6 +49,14 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 		if errors.Is(err, libClient.ErrNotFound) {
 			return "", fmt.Errorf("image does not exist in the library: %s (%s)", ref, arch)
 		}
+		// without access to the library, use the image previously
+		// pulled from the same reference
+		if directTo == "" && client.IsNetworkError(err) {
+			if e, cacheErr := imgCache.FindEntryBySource(cache.LibraryCacheType, imageRef.String()); cacheErr == nil && e != nil {
+				sylog.Warningf("Unable to get image %s from the library, using cached image: %v", ref, err)
+				return e.Path, nil
+			}
+		}
 		return "", err
 	}
 
@@ -82,6 +90,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 			return "", fmt.Errorf("cached file hash(%s) and expected hash(%s) does not match", cacheFileHash, libraryImage.Hash)
 		}
 
+		cacheEntry.Source = imageRef.String()
 		if err := cacheEntry.Finalize(); err != nil {
 			return "", err
 		}
@@ -0,0 +1,72 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	scslibclient "github.com/apptainer/container-library-client/client"
+)
+
+func TestPullCacheFallback(t *testing.T) {
+	t.Setenv(cache.MaxSizeEnv, "")
+
+	imgCache, err := cache.New(cache.Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	ref, err := scslibclient.Parse("library://user/collection/image:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an image previously pulled from ref
+	e, err := imgCache.GetEntry(cache.LibraryCacheType, "cached")
+	if err != nil {
+		t.Fatalf("while getting cache entry: %v", err)
+	}
+	e.Source = ref.String()
+	if err := os.WriteFile(e.TmpPath, []byte("image"), 0o600); err != nil {
+		t.Fatalf("while writing cache entry: %v", err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing cache entry: %v", err)
+	}
+
+	var status atomic.Value
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status.Load().(int))
+	}))
+	defer srv.Close()
+	opts := PullOptions{LibraryConfig: &scslibclient.Config{BaseURL: srv.URL}}
+
+	// errors returned by the library must not fall back to the cache
+	for _, s := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError} {
+		status.Store(s)
+		if _, err := pull(t.Context(), imgCache, "", ref, "amd64", opts); err == nil {
+			t.Errorf("unexpected success with HTTP status %d", s)
+		}
+	}
+
+	// an unreachable library falls back to the cache
+	srv.Close()
+	path, err := pull(t.Context(), imgCache, "", ref, "amd64", opts)
+	if err != nil {
+		t.Fatalf("unexpected error with unreachable library: %v", err)
+	}
+	if path != e.Path {
+		t.Errorf("got image %s, want cached image %s", path, e.Path)
+	}
+}
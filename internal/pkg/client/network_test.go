@@ -0,0 +1,66 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+func TestIsNetworkError(t *testing.T) {
+	// a closed listener provides an address refusing connections
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refusedAddr := ln.Addr().String()
+	ln.Close()
+	_, refusedErr := http.Get("http://" + refusedAddr)
+
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+	_, certErr := http.Get(tlsSrv.URL)
+
+	slowSrv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slowSrv.Close()
+	_, timeoutErr := (&http.Client{Timeout: 100 * time.Millisecond}).Get(slowSrv.URL)
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Nil", err: nil, want: false},
+		{name: "ConnectionRefused", err: refusedErr, want: true},
+		{name: "WrappedConnectionRefused", err: fmt.Errorf("while fetching: %w", refusedErr), want: true},
+		{name: "DNS", err: &net.DNSError{Err: "no such host", Name: "registry.invalid", IsNotFound: true}, want: true},
+		{name: "Timeout", err: timeoutErr, want: true},
+		{name: "Certificate", err: certErr, want: false},
+		{name: "Unauthorized", err: &transport.Error{StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "Forbidden", err: &transport.Error{StatusCode: http.StatusForbidden}, want: false},
+		{name: "NotFound", err: &transport.Error{StatusCode: http.StatusNotFound}, want: false},
+		{name: "Other", err: errors.New("invalid reference format"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNetworkError(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v for error %v", got, tt.want, tt.err)
+			}
+		})
+	}
+}
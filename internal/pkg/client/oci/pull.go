@@ -77,6 +77,15 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 	}
 	hash, err := oci.ImageDigest(ctx, pullFrom, to)
 	if err != nil {
+		// without access to the registry, use the image previously
+		// pulled from the same reference, e.g. imported from a cache
+		// archive on an air-gapped host
+		if directTo == "" && client.IsNetworkError(err) {
+			if e, cacheErr := imgCache.FindEntryBySource(cache.OciTempCacheType, pullFrom); cacheErr == nil && e != nil {
+				sylog.Warningf("Unable to get checksum for %s, using cached image: %s", pullFrom, err)
+				return e.Path, nil
+			}
+		}
 		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
 	}
 
@@ -100,6 +109,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 				return "", fmt.Errorf("while building SIF from layers: %v", err)
 			}
 
+			cacheEntry.Source = pullFrom
 			err = cacheEntry.Finalize()
 			if err != nil {
 				return "", err
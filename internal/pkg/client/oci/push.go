@@ -0,0 +1,273 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/squashfs"
+	"github.com/apptainer/apptainer/internal/pkg/ociimage"
+	"github.com/apptainer/apptainer/internal/pkg/util/ociauth"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/inspect"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	imageSpecs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// runscriptPath is the location of the container runscript within the
+	// root filesystem of a SIF image.
+	runscriptPath = "/.singularity.d/runscript"
+	// labelsPath is the location of the container labels within the root
+	// filesystem of a SIF image.
+	labelsPath = "/.singularity.d/labels.json"
+	// defaultPath is the PATH set in the image config when the SIF image
+	// doesn't carry an OCI configuration.
+	defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// PushOptions holds the options used to push a SIF image as an OCI image.
+type PushOptions struct {
+	TmpDir      string
+	OciAuth     *authn.AuthConfig
+	NoHTTPS     bool
+	ReqAuthFile string
+}
+
+// Push converts the SIF image at sourceFile into a native OCI image, with a
+// single layer holding the root filesystem, and pushes it to the registry
+// reference destRef.
+func Push(ctx context.Context, sourceFile, destRef string, opts PushOptions) error {
+	img, err := imageFromSIF(sourceFile)
+	if err != nil {
+		return err
+	}
+
+	tOpts := &ociimage.TransportOptions{
+		AuthConfig:   opts.OciAuth,
+		AuthFilePath: ociauth.ChooseAuthFile(opts.ReqAuthFile),
+		Insecure:     opts.NoHTTPS,
+		TmpDir:       opts.TmpDir,
+		UserAgent:    useragent.Value(),
+	}
+	if cf, err := img.ConfigFile(); err == nil && cf.Platform() != nil {
+		tOpts.Platform = *cf.Platform()
+	}
+	// computing the layer digest of a large root filesystem may take a
+	// while, don't start the upload if the operation was cancelled in the
+	// meantime
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sylog.Infof("Pushing OCI image to %s", destRef)
+	if err := ociimage.RegistrySourceSink.WriteImage(img, destRef, tOpts); err != nil {
+		return fmt.Errorf("while pushing image: %w", err)
+	}
+	return nil
+}
+
+// sifRootfs holds an open SIF image and its squashfs root filesystem.
+type sifRootfs struct {
+	img *image.Image
+	sfs *squashfs.FS
+}
+
+func openSIFRootfs(sourceFile string) (*sifRootfs, error) {
+	img, err := image.Init(sourceFile, false)
+	if err != nil {
+		return nil, fmt.Errorf("while loading image %s: %w", sourceFile, err)
+	}
+	if img.Type != image.SIF {
+		img.File.Close()
+		return nil, fmt.Errorf("%s is not a SIF image", sourceFile)
+	}
+	sfs, err := squashfs.OpenImage(img)
+	if err != nil {
+		img.File.Close()
+		return nil, fmt.Errorf("unsupported root filesystem for OCI conversion: %w", err)
+	}
+	return &sifRootfs{img: img, sfs: sfs}, nil
+}
+
+// tarLayer returns a reader of the root filesystem as a tar archive, which
+// closes the image once closed.
+func (r *sifRootfs) tarLayer() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		err := r.sfs.WriteTar(pw)
+		r.img.File.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// imageFromSIF returns a v1.Image wrapping the root filesystem of the SIF
+// image at sourceFile as a single layer, with an image config derived from
+// the SIF metadata. The layer is streamed from the squashfs root filesystem,
+// keeping the ownership and device files it records whatever the privileges
+// of the user.
+func imageFromSIF(sourceFile string) (v1.Image, error) {
+	r, err := openSIFRootfs(sourceFile)
+	if err != nil {
+		return nil, err
+	}
+	defer r.img.File.Close()
+
+	cf, err := sifConfigFile(r.img, r.sfs)
+	if err != nil {
+		return nil, err
+	}
+
+	// the layer is read once to compute its digest, and again to upload it
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		lr, err := openSIFRootfs(sourceFile)
+		if err != nil {
+			return nil, err
+		}
+		return lr.tarLayer(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while creating image layer: %w", err)
+	}
+
+	ociImg, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		return nil, fmt.Errorf("while appending image layer: %w", err)
+	}
+
+	// the layer diff ID is computed when the config file is requested
+	// from the mutated image, so retain it from there.
+	baseCf, err := ociImg.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cf.RootFS = baseCf.RootFS
+	cf.History = []v1.History{
+		{
+			Created:   cf.Created,
+			CreatedBy: "apptainer push",
+			Comment:   "converted from SIF image",
+		},
+	}
+
+	return mutate.ConfigFile(ociImg, cf)
+}
+
+// sifConfigFile builds an OCI image config for a SIF image. The OCI
+// configuration stored in the SIF (for images built from an OCI source) is
+// used when present, labels are taken from the SIF inspect metadata, and the
+// container runscript becomes the entrypoint when no other one is defined.
+func sifConfigFile(img *image.Image, rootfs fs.FS) (*v1.ConfigFile, error) {
+	fimg, err := sif.LoadContainer(img.File,
+		sif.OptLoadWithFlag(os.O_RDONLY),
+		sif.OptLoadWithCloseOnUnload(false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("while loading SIF: %w", err)
+	}
+	defer fimg.UnloadContainer()
+
+	arch := fimg.PrimaryArch()
+	if arch == "unknown" {
+		return nil, fmt.Errorf("unknown architecture in SIF file")
+	}
+
+	cf := &v1.ConfigFile{
+		Architecture: arch,
+		OS:           "linux",
+		Created:      v1.Time{Time: fimg.CreatedAt()},
+	}
+
+	reader, err := image.NewSectionReader(img, image.SIFDescOCIConfigJSON, -1)
+	if err != nil && !errors.Is(err, image.ErrNoSection) {
+		return nil, fmt.Errorf("failed to read %s section: %w", image.SIFDescOCIConfigJSON, err)
+	} else if err == nil {
+		var imgConfig imageSpecs.ImageConfig
+		if err := json.NewDecoder(reader).Decode(&imgConfig); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", image.SIFDescOCIConfigJSON, err)
+		}
+		cf.Config = v1.Config{
+			User:         imgConfig.User,
+			ExposedPorts: imgConfig.ExposedPorts,
+			Env:          imgConfig.Env,
+			Entrypoint:   imgConfig.Entrypoint,
+			Cmd:          imgConfig.Cmd,
+			Volumes:      imgConfig.Volumes,
+			WorkingDir:   imgConfig.WorkingDir,
+			Labels:       imgConfig.Labels,
+			StopSignal:   imgConfig.StopSignal,
+		}
+	}
+
+	labels, err := sifLabels(img, rootfs)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) > 0 && cf.Config.Labels == nil {
+		cf.Config.Labels = make(map[string]string)
+	}
+	for k, v := range labels {
+		cf.Config.Labels[k] = v
+	}
+
+	if len(cf.Config.Env) == 0 {
+		cf.Config.Env = []string{defaultPath}
+	}
+
+	if len(cf.Config.Entrypoint) == 0 && len(cf.Config.Cmd) == 0 {
+		if _, err := fs.Stat(rootfs, strings.TrimPrefix(runscriptPath, "/")); err == nil {
+			cf.Config.Entrypoint = []string{runscriptPath}
+		}
+	}
+
+	return cf, nil
+}
+
+// sifLabels returns the container labels from the SIF inspect metadata, or
+// from the labels file in the root filesystem for images without metadata.
+func sifLabels(img *image.Image, rootfs fs.FS) (map[string]string, error) {
+	reader, err := image.NewSectionReader(img, image.SIFDescInspectMetadataJSON, -1)
+	if err == nil {
+		md := inspect.NewMetadata()
+		if err := json.NewDecoder(reader).Decode(md); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", image.SIFDescInspectMetadataJSON, err)
+		}
+		return md.Attributes.Labels, nil
+	} else if !errors.Is(err, image.ErrNoSection) {
+		return nil, fmt.Errorf("failed to read %s section: %w", image.SIFDescInspectMetadataJSON, err)
+	}
+
+	b, err := fs.ReadFile(rootfs, strings.TrimPrefix(labelsPath, "/"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading labels: %w", err)
+	}
+
+	labels := make(map[string]string)
+	if err := json.Unmarshal(b, &labels); err != nil {
+		return nil, fmt.Errorf("while decoding labels: %w", err)
+	}
+	return labels, nil
+}
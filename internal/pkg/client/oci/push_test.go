@@ -0,0 +1,236 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/inspect"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	imageSpecs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testRootfs is a squashfs image holding file.txt owned by 1000:1000,
+// without runscript.
+const testRootfs = "../../image/squashfs/testdata/test.sqfs"
+
+// createSIF creates a SIF image with testRootfs as root filesystem and the
+// given JSON objects.
+func createSIF(t *testing.T, objects map[string]any) string {
+	t.Helper()
+
+	rootfs, err := os.Open(testRootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rootfs.Close()
+
+	part, err := sif.NewDescriptorInput(sif.DataPartition, rootfs,
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, "amd64"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dis := []sif.DescriptorInput{part}
+	for name, v := range objects {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		di, err := sif.NewDescriptorInput(sif.DataGenericJSON, bytes.NewReader(b), sif.OptObjectName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dis = append(dis, di)
+	}
+
+	path := filepath.Join(t.TempDir(), "image.sif")
+	f, err := sif.CreateContainerAtPath(path, sif.OptCreateWithDescriptors(dis...))
+	if err != nil {
+		t.Fatalf("while creating SIF: %v", err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSifConfigFile(t *testing.T) {
+	md := inspect.NewMetadata()
+	md.Attributes.Labels = map[string]string{"org.label-schema.version": "1.0"}
+
+	tests := []struct {
+		name       string
+		objects    map[string]any
+		rootfs     fstest.MapFS
+		entrypoint []string
+		cmd        []string
+		env        []string
+		labels     map[string]string
+	}{
+		{
+			name:    "Empty",
+			objects: nil,
+			rootfs:  fstest.MapFS{},
+			env:     []string{defaultPath},
+		},
+		{
+			name: "RootfsLabels",
+			rootfs: fstest.MapFS{
+				".singularity.d/runscript":   &fstest.MapFile{Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+				".singularity.d/labels.json": &fstest.MapFile{Data: []byte(`{"maintainer": "me"}`)},
+			},
+			entrypoint: []string{runscriptPath},
+			env:        []string{defaultPath},
+			labels:     map[string]string{"maintainer": "me"},
+		},
+		{
+			name: "Metadata",
+			objects: map[string]any{
+				image.SIFDescInspectMetadataJSON: md,
+			},
+			rootfs: fstest.MapFS{
+				".singularity.d/runscript":   &fstest.MapFile{Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+				".singularity.d/labels.json": &fstest.MapFile{Data: []byte(`{"maintainer": "me"}`)},
+			},
+			entrypoint: []string{runscriptPath},
+			env:        []string{defaultPath},
+			labels:     map[string]string{"org.label-schema.version": "1.0"},
+		},
+		{
+			name: "OCIConfig",
+			objects: map[string]any{
+				image.SIFDescOCIConfigJSON: imageSpecs.ImageConfig{
+					Env:    []string{"PATH=/bin", "A=1"},
+					Cmd:    []string{"/bin/sh"},
+					Labels: map[string]string{"maintainer": "oci"},
+				},
+				image.SIFDescInspectMetadataJSON: md,
+			},
+			rootfs: fstest.MapFS{
+				".singularity.d/runscript": &fstest.MapFile{Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+			},
+			cmd: []string{"/bin/sh"},
+			env: []string{"PATH=/bin", "A=1"},
+			labels: map[string]string{
+				"maintainer":               "oci",
+				"org.label-schema.version": "1.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := image.Init(createSIF(t, tt.objects), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer img.File.Close()
+
+			cf, err := sifConfigFile(img, tt.rootfs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cf.Architecture != "amd64" || cf.OS != "linux" {
+				t.Errorf("unexpected platform %s/%s", cf.OS, cf.Architecture)
+			}
+			if !reflect.DeepEqual(cf.Config.Entrypoint, tt.entrypoint) {
+				t.Errorf("got entrypoint %v, want %v", cf.Config.Entrypoint, tt.entrypoint)
+			}
+			if !reflect.DeepEqual(cf.Config.Cmd, tt.cmd) {
+				t.Errorf("got cmd %v, want %v", cf.Config.Cmd, tt.cmd)
+			}
+			if !reflect.DeepEqual(cf.Config.Env, tt.env) {
+				t.Errorf("got env %v, want %v", cf.Config.Env, tt.env)
+			}
+			if !reflect.DeepEqual(cf.Config.Labels, tt.labels) {
+				t.Errorf("got labels %v, want %v", cf.Config.Labels, tt.labels)
+			}
+		})
+	}
+
+	// invalid labels are reported
+	img, err := image.Init(createSIF(t, nil), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.File.Close()
+	rootfs := fstest.MapFS{".singularity.d/labels.json": &fstest.MapFile{Data: []byte("{")}}
+	if _, err := sifLabels(img, rootfs); err == nil {
+		t.Errorf("unexpected success with invalid labels")
+	}
+}
+
+func TestImageFromSIF(t *testing.T) {
+	img, err := imageFromSIF(createSIF(t, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("got %d layers, want 1", len(layers))
+	}
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	// the ownership recorded in the root filesystem is kept whatever the
+	// user running the conversion
+	found := false
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == "file.txt" {
+			found = true
+			if hdr.Uid != 1000 || hdr.Gid != 1000 {
+				t.Errorf("got file.txt owned by %d:%d, want 1000:1000", hdr.Uid, hdr.Gid)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("file.txt not found in layer")
+	}
+
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffID, err := layers[0].DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cf.RootFS.DiffIDs) != 1 || cf.RootFS.DiffIDs[0] != diffID {
+		t.Errorf("unexpected config diff IDs %v", cf.RootFS.DiffIDs)
+	}
+
+	if _, err := imageFromSIF(testRootfs); err == nil {
+		t.Errorf("unexpected success with squashfs image")
+	}
+}
@@ -31,6 +31,14 @@ const TmpDirKey contextKey = "tmpDir"
 func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, arch string, ociAuth *authn.AuthConfig, noHTTPS bool, reqAuthFile string) (imagePath string, err error) {
 	hash, err := RefHash(ctx, pullFrom, arch, ociAuth, noHTTPS, reqAuthFile)
 	if err != nil {
+		// without access to the registry, use the image previously
+		// pulled from the same reference
+		if directTo == "" && client.IsNetworkError(err) {
+			if e, cacheErr := imgCache.FindEntryBySource(cache.OrasCacheType, pullFrom); cacheErr == nil && e != nil {
+				sylog.Warningf("Unable to get checksum for %s, using cached image: %s", pullFrom, err)
+				return e.Path, nil
+			}
+		}
 		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
 	}
 	size, err := RefSize(ctx, pullFrom, arch, ociAuth, noHTTPS, reqAuthFile)
@@ -78,6 +86,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, arch
 				return "", fmt.Errorf("cached file hash(%s) and expected hash(%s) does not match", cacheFileHash, hash)
 			}
 
+			cacheEntry.Source = pullFrom
 			err = cacheEntry.Finalize()
 			if err != nil {
 				return "", err
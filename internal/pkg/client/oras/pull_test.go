@@ -0,0 +1,101 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oras
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestPullCacheFallback(t *testing.T) {
+	t.Setenv(cache.MaxSizeEnv, "")
+
+	// mode selects the response of the registry, the image is served
+	// when empty
+	var mode atomic.Value
+	mode.Store("")
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch mode.Load().(string) {
+		case "unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "notfound":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			reg.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	pullFrom := "oras://" + host + "/test/image:latest"
+
+	// an image which isn't a SIF image
+	ref, err := name.ParseReference(host+"/test/image:latest", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(64, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("while pushing image: %v", err)
+	}
+
+	imgCache, err := cache.New(cache.Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	// an image previously pulled from pullFrom
+	e, err := imgCache.GetEntry(cache.OrasCacheType, "cached")
+	if err != nil {
+		t.Fatalf("while getting cache entry: %v", err)
+	}
+	e.Source = pullFrom
+	if err := os.WriteFile(e.TmpPath, []byte("image"), 0o600); err != nil {
+		t.Fatalf("while writing cache entry: %v", err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing cache entry: %v", err)
+	}
+
+	// errors returned by the registry and invalid images must not fall
+	// back to the cache
+	for _, m := range []string{"unauthorized", "forbidden", "notfound", ""} {
+		mode.Store(m)
+		if _, err := pull(t.Context(), imgCache, "", pullFrom, "amd64", nil, true, ""); err == nil {
+			t.Errorf("unexpected success with %q registry response", m)
+		}
+	}
+
+	// an unreachable registry falls back to the cache
+	srv.Close()
+	path, err := pull(t.Context(), imgCache, "", pullFrom, "amd64", nil, true, "")
+	if err != nil {
+		t.Fatalf("unexpected error with unreachable registry: %v", err)
+	}
+	if path != e.Path {
+		t.Errorf("got image %s, want cached image %s", path, e.Path)
+	}
+}
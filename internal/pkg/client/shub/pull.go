@@ -164,6 +164,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 				return "", err
 			}
 
+			cacheEntry.Source = pullFrom
 			err = cacheEntry.Finalize()
 			if err != nil {
 				return "", err
@@ -57,6 +57,7 @@ type fuseappsFeature struct {
 type fuseappsDriver struct {
 	squashFeature  fuseappsFeature
 	ext3Feature    fuseappsFeature
+	erofsFeature   fuseappsFeature
 	overlayFeature fuseappsFeature
 	gocryptFeature fuseappsFeature
 	features       image.DriverFeature
@@ -102,6 +103,7 @@ func InitImageDrivers(register, unprivileged bool, fileconf *apptainerconf.File,
 
 	var squashFeature fuseappsFeature
 	var ext3Feature fuseappsFeature
+	var erofsFeature fuseappsFeature
 	var overlayFeature fuseappsFeature
 	var gocryptFeature fuseappsFeature
 	var features image.DriverFeature
@@ -122,6 +124,11 @@ func InitImageDrivers(register, unprivileged bool, fileconf *apptainerconf.File,
 			features |= image.Ext3Feature
 		}
 	}
+	if unprivileged || !fileconf.AllowSetuidMountErofs {
+		if erofsFeature.init("erofsfuse", "mount EROFS filesystems", desiredFeatures&image.ErofsFeature) {
+			features |= image.ErofsFeature
+		}
+	}
 	// Always initialize the OverlayFeature because the kernel overlay
 	// doesn't like using FUSE for lower or upper layers.
 	if overlayFeature.init("fuse-overlayfs", "use FUSE overlay", desiredFeatures&image.OverlayFeature) {
@@ -163,13 +170,14 @@ func InitImageDrivers(register, unprivileged bool, fileconf *apptainerconf.File,
 		_ = cmd.Wait()
 	}
 
-	if squashFeature.cmdPath != "" || ext3Feature.cmdPath != "" || overlayFeature.cmdPath != "" || gocryptFeature.cmdPath != "" {
+	if squashFeature.cmdPath != "" || ext3Feature.cmdPath != "" || erofsFeature.cmdPath != "" || overlayFeature.cmdPath != "" || gocryptFeature.cmdPath != "" {
 		sylog.Debugf("Setting ImageDriver to %v", DriverName)
 		fileconf.ImageDriver = DriverName
 		if register {
 			driver := &fuseappsDriver{
 				squashFeature:  squashFeature,
 				ext3Feature:    ext3Feature,
+				erofsFeature:   erofsFeature,
 				overlayFeature: overlayFeature,
 				gocryptFeature: gocryptFeature,
 				features:       features,
@@ -254,6 +262,14 @@ func (d *fuseappsDriver) Mount(params *image.MountParams, _ image.MountFunc) err
 		}
 		cmdArgs = append(cmdArgs, params.Source, params.Target)
 		cmd = exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	case "erofs":
+		f = &d.erofsFeature
+		cmdArgs = append(cmdArgs, f.cmdPath, "-f", "-o", optsStr)
+		if params.Offset > 0 {
+			cmdArgs = append(cmdArgs, "--offset="+strconv.FormatUint(params.Offset, 10))
+		}
+		cmdArgs = append(cmdArgs, params.Source, params.Target)
+		cmd = exec.Command(cmdArgs[0], cmdArgs[1:]...)
 	case "gocryptfs":
 		f = &d.gocryptFeature
 		cmdArgs = append(cmdArgs, f.cmdPath, "-fg", params.Source, params.Target)
@@ -581,7 +597,7 @@ func (f *fuseappsFeature) waitInstance(instance *fuseappsInstance) error {
 }
 
 func (d *fuseappsDriver) allFeatures() []fuseappsFeature {
-	return []fuseappsFeature{d.squashFeature, d.ext3Feature, d.overlayFeature, d.gocryptFeature}
+	return []fuseappsFeature{d.squashFeature, d.ext3Feature, d.erofsFeature, d.overlayFeature, d.gocryptFeature}
 }
 
 func (d *fuseappsDriver) Stop(target string) error {
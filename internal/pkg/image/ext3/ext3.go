@@ -0,0 +1,383 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package ext3 reads ext2 and ext3 filesystems in process, as created for
+// writable overlays, without mounting them.
+package ext3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	magic           = 0xef53
+	superblockStart = 1024
+	superblockSize  = 1024
+	// rootInode is the inode number of the root directory
+	rootInode = 2
+	// goodOldInodeSize is the inode size of revision 0 filesystems
+	goodOldInodeSize = 128
+	// maxSymlinks is the maximum number of symbolic links followed
+	// while resolving a path
+	maxSymlinks = 40
+)
+
+// Incompatible features, a filesystem using a feature not listed in
+// supportedIncompat can't be read.
+const (
+	incompatFiletype = 0x2
+	incompatRecover  = 0x4
+	incompatFlexBg   = 0x200
+
+	supportedIncompat = incompatFiletype | incompatRecover | incompatFlexBg
+)
+
+var errCorrupted = errors.New("corrupted ext3 filesystem")
+
+type superblock struct {
+	InodesCount     uint32
+	BlocksCount     uint32
+	RBlocksCount    uint32
+	FreeBlocksCount uint32
+	FreeInodesCount uint32
+	FirstDataBlock  uint32
+	LogBlockSize    uint32
+	LogClusterSize  uint32
+	BlocksPerGroup  uint32
+	ClustersPerGrp  uint32
+	InodesPerGroup  uint32
+	MTime           uint32
+	WTime           uint32
+	MntCount        uint16
+	MaxMntCount     uint16
+	Magic           uint16
+	State           uint16
+	Errors          uint16
+	MinorRevLevel   uint16
+	LastCheck       uint32
+	CheckInterval   uint32
+	CreatorOS       uint32
+	RevLevel        uint32
+	DefResUID       uint16
+	DefResGID       uint16
+	FirstIno        uint32
+	InodeSize       uint16
+	BlockGroupNr    uint16
+	FeatureCompat   uint32
+	FeatureIncompat uint32
+	FeatureRoCompat uint32
+}
+
+type groupDescriptor struct {
+	BlockBitmap     uint32
+	InodeBitmap     uint32
+	InodeTable      uint32
+	FreeBlocksCount uint16
+	FreeInodesCount uint16
+	UsedDirsCount   uint16
+	Flags           uint16
+	Unused          [12]byte
+}
+
+// FS is a read-only ext2 or ext3 filesystem, the journal is ignored. It
+// implements the fs.FS, fs.StatFS, fs.ReadDirFS, fs.ReadFileFS and
+// fs.ReadLinkFS interfaces, symbolic links being resolved inside the
+// filesystem.
+type FS struct {
+	r         io.ReaderAt
+	sb        superblock
+	blockSize uint32
+	inodeSize uint32
+	groups    []groupDescriptor
+	root      *inode
+}
+
+// Usage holds the space and inode usage of a filesystem.
+type Usage struct {
+	BlockSize  uint32
+	Blocks     uint64
+	FreeBlocks uint64
+	Inodes     uint64
+	FreeInodes uint64
+}
+
+// New returns the ext3 filesystem read from r, which starts at offset 0.
+func New(r io.ReaderAt) (*FS, error) {
+	f := &FS{r: r}
+
+	b := make([]byte, superblockSize)
+	if _, err := r.ReadAt(b, superblockStart); err != nil {
+		return nil, fmt.Errorf("while reading ext3 superblock: %w", err)
+	}
+	if _, err := binary.Decode(b, binary.LittleEndian, &f.sb); err != nil {
+		return nil, fmt.Errorf("while decoding ext3 superblock: %w", err)
+	}
+	if f.sb.Magic != magic {
+		return nil, fmt.Errorf("not an ext3 filesystem")
+	}
+	if f.sb.LogBlockSize > 6 {
+		return nil, fmt.Errorf("%w: invalid block size", errCorrupted)
+	}
+	f.blockSize = 1024 << f.sb.LogBlockSize
+
+	f.inodeSize = goodOldInodeSize
+	if f.sb.RevLevel > 0 {
+		if unsupported := f.sb.FeatureIncompat &^ supportedIncompat; unsupported != 0 {
+			return nil, fmt.Errorf("unsupported ext3 filesystem features 0x%x", unsupported)
+		}
+		f.inodeSize = uint32(f.sb.InodeSize)
+	}
+	if f.inodeSize < goodOldInodeSize || f.inodeSize > f.blockSize || f.inodeSize&(f.inodeSize-1) != 0 {
+		return nil, fmt.Errorf("%w: invalid inode size %d", errCorrupted, f.inodeSize)
+	}
+	if f.sb.BlocksPerGroup == 0 || f.sb.InodesPerGroup == 0 || f.sb.FirstDataBlock >= f.sb.BlocksCount {
+		return nil, fmt.Errorf("%w: invalid block groups", errCorrupted)
+	}
+
+	var err error
+	if f.groups, err = f.readGroupDescriptors(); err != nil {
+		return nil, fmt.Errorf("while reading ext3 group descriptors: %w", err)
+	}
+	if f.root, err = f.readInode(rootInode); err != nil {
+		return nil, fmt.Errorf("while reading ext3 root directory: %w", err)
+	}
+	if !f.root.isDir() {
+		return nil, fmt.Errorf("%w: root inode is not a directory", errCorrupted)
+	}
+	return f, nil
+}
+
+func (f *FS) readGroupDescriptors() ([]groupDescriptor, error) {
+	count := (f.sb.BlocksCount - f.sb.FirstDataBlock + f.sb.BlocksPerGroup - 1) / f.sb.BlocksPerGroup
+	if uint64(count)*uint64(f.sb.InodesPerGroup) < uint64(f.sb.InodesCount) {
+		return nil, fmt.Errorf("%w: invalid inode count %d", errCorrupted, f.sb.InodesCount)
+	}
+	b := make([]byte, int(count)*32)
+	if _, err := f.r.ReadAt(b, int64(f.sb.FirstDataBlock+1)*int64(f.blockSize)); err != nil {
+		return nil, err
+	}
+	groups := make([]groupDescriptor, count)
+	_, err := binary.Decode(b, binary.LittleEndian, groups)
+	return groups, err
+}
+
+// readBlock returns the content of the block number n.
+func (f *FS) readBlock(n uint32) ([]byte, error) {
+	if n >= f.sb.BlocksCount {
+		return nil, fmt.Errorf("%w: invalid block number %d", errCorrupted, n)
+	}
+	b := make([]byte, f.blockSize)
+	if _, err := f.r.ReadAt(b, int64(n)*int64(f.blockSize)); err != nil {
+		return nil, fmt.Errorf("while reading block %d: %w", n, err)
+	}
+	return b, nil
+}
+
+// Usage returns the space and inode usage of the filesystem, computed
+// from the block group descriptors.
+func (f *FS) Usage() Usage {
+	u := Usage{
+		BlockSize: f.blockSize,
+		Blocks:    uint64(f.sb.BlocksCount),
+		Inodes:    uint64(f.sb.InodesCount),
+	}
+	for _, g := range f.groups {
+		u.FreeBlocks += uint64(g.FreeBlocksCount)
+		u.FreeInodes += uint64(g.FreeInodesCount)
+	}
+	return u
+}
+
+// NeedsRecovery returns whether the journal holds changes not yet applied
+// to the filesystem, which happens when it wasn't cleanly unmounted. The
+// content read from such a filesystem may be outdated.
+func (f *FS) NeedsRecovery() bool {
+	return f.sb.FeatureIncompat&incompatRecover != 0
+}
+
+// lookup returns the inode of the file name, following symbolic links in
+// the path and, if follow is set, in its last element.
+func (f *FS) lookup(op, name string, follow bool) (*inode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	cur := f.root
+	var parents []*inode
+	parts := strings.Split(name, "/")
+	links := 0
+
+	for len(parts) > 0 {
+		elem := parts[0]
+		parts = parts[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(parents) > 0 {
+				cur, parents = parents[len(parents)-1], parents[:len(parents)-1]
+			}
+			continue
+		}
+
+		if !cur.isDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+		}
+		child, err := f.child(cur, elem)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		if child.typ() == fs.ModeSymlink && (len(parts) > 0 || follow) {
+			links++
+			if links > maxSymlinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			target, err := f.readLink(child)
+			if err != nil {
+				return nil, &fs.PathError{Op: op, Path: name, Err: err}
+			}
+			if path.IsAbs(target) {
+				cur, parents = f.root, nil
+			}
+			parts = append(strings.Split(target, "/"), parts...)
+			continue
+		}
+
+		parents = append(parents, cur)
+		cur = child
+	}
+	return cur, nil
+}
+
+// child returns the inode of the entry name of the directory dir.
+func (f *FS) child(dir *inode, name string) (*inode, error) {
+	entries, err := f.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.name == name {
+			return f.readInode(e.number)
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// Open opens the named file for reading.
+func (f *FS) Open(name string) (fs.File, error) {
+	ino, err := f.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info := &fileInfo{name: path.Base(name), ino: ino}
+	if ino.isDir() {
+		return &dirFile{f: f, info: info}, nil
+	}
+	return &file{f: f, info: info}, nil
+}
+
+// Stat returns the information of the named file, following symbolic links.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	ino, err := f.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), ino: ino}, nil
+}
+
+// Lstat returns the information of the named file, without following a
+// symbolic link in its last element.
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	ino, err := f.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), ino: ino}, nil
+}
+
+// ReadLink returns the target of the named symbolic link.
+func (f *FS) ReadLink(name string) (string, error) {
+	ino, err := f.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if ino.typ() != fs.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := f.readLink(ino)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ino, err := f.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !ino.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := f.readDir(ino)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, &dirEntry{f: f, entry: e})
+	}
+	// linear directories are in creation order
+	slices.SortFunc(list, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return list, nil
+}
+
+// ReadFile returns the content of the named file.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	ino, err := f.lookup("read", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if ino.isDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	// the file size isn't trusted for the allocation
+	buf := bytes.NewBuffer(make([]byte, 0, min(ino.size, 1<<20)))
+	fl := &file{f: f, info: &fileInfo{name: path.Base(name), ino: ino}}
+	if _, err := io.Copy(buf, fl); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return buf.Bytes(), nil
+}
+
+// Xattrs returns the extended attributes of the named file, without
+// following a symbolic link in its last element.
+func (f *FS) Xattrs(name string) (map[string][]byte, error) {
+	ino, err := f.lookup("xattrs", name, false)
+	if err != nil {
+		return nil, err
+	}
+	xattrs, err := f.readXattrs(ino)
+	if err != nil {
+		return nil, &fs.PathError{Op: "xattrs", Path: name, Err: err}
+	}
+	return xattrs, nil
+}
@@ -0,0 +1,225 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ext3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
+	"golang.org/x/sys/unix"
+)
+
+// largeContent returns content spanning the indirect blocks of a
+// filesystem with 1KiB blocks.
+func largeContent() []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < 2<<20; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.Bytes()
+}
+
+// createImage creates an ext3 image with the content of the src directory.
+func createImage(t *testing.T, src string) *FS {
+	t.Helper()
+	require.MkfsExt3(t)
+
+	img := filepath.Join(t.TempDir(), "ext3.img")
+	cmd := exec.Command("mkfs.ext3", "-q", "-F", "-b", "1024", "-d", src, img, "16M")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("while creating ext3 image: %s: %s", err, out)
+	}
+
+	f, err := os.Open(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	efs, err := New(f)
+	if err != nil {
+		t.Fatalf("while opening %s: %s", img, err)
+	}
+	return efs
+}
+
+func TestFS(t *testing.T) {
+	src := t.TempDir()
+	large := largeContent()
+	longTarget := strings.Repeat("./", 30) + "file"
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	files := map[string]string{
+		"file":         "content\n",
+		"dir/sub/file": "sub content\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(src, "large"), large, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "large"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir/sub/file", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(longTarget, filepath.Join(src, "longlink")); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mkfifo(filepath.Join(src, "fifo"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 300 {
+		p := filepath.Join(src, "many", fmt.Sprintf("entry-with-a-long-name-%03d", i))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the large value doesn't fit in the inode and is stored in an
+	// extended attribute block
+	bigValue := bytes.Repeat([]byte("v"), 300)
+	xattrs := unix.Setxattr(filepath.Join(src, "file"), "user.comment", []byte("hello"), 0) == nil &&
+		unix.Setxattr(filepath.Join(src, "dir/sub/file"), "user.big", bigValue, 0) == nil &&
+		unix.Setxattr(filepath.Join(src, "dir/sub"), "trusted.overlay.opaque", []byte("y"), 0) == nil
+
+	efs := createImage(t, src)
+
+	if err := fstest.TestFS(efs, "file", "dir/sub/file", "large", "link", "many/entry-with-a-long-name-299"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		b, err := efs.ReadFile(name)
+		if err != nil || string(b) != content {
+			t.Errorf("unexpected %s content %q: %v", name, b, err)
+		}
+	}
+	if b, err := efs.ReadFile("large"); err != nil || !bytes.Equal(b, large) {
+		t.Errorf("unexpected large file content: %v", err)
+	}
+	if b, err := efs.ReadFile("link"); err != nil || string(b) != files["dir/sub/file"] {
+		t.Errorf("unexpected link content %q: %v", b, err)
+	}
+
+	f, err := efs.Open("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 100)
+	off := int64(len(large) - 50)
+	if n, err := f.(io.ReaderAt).ReadAt(buf, off); n != 50 || err != io.EOF || !bytes.Equal(buf[:n], large[off:]) {
+		t.Errorf("unexpected read at the end of the large file: %d bytes, %v", n, err)
+	}
+
+	tests := []struct {
+		name   string
+		mode   fs.FileMode
+		target string
+	}{
+		{name: "file", mode: 0o640},
+		{name: "dir", mode: fs.ModeDir | 0o755},
+		{name: "link", mode: fs.ModeSymlink | 0o777, target: "dir/sub/file"},
+		{name: "longlink", mode: fs.ModeSymlink | 0o777, target: longTarget},
+		{name: "fifo", mode: fs.ModeNamedPipe | 0o600},
+	}
+	for _, tt := range tests {
+		fi, err := efs.Lstat(tt.name)
+		if err != nil {
+			t.Errorf("while getting %s information: %s", tt.name, err)
+			continue
+		}
+		if fi.Mode() != tt.mode {
+			t.Errorf("unexpected %s mode %s instead of %s", tt.name, fi.Mode(), tt.mode)
+		}
+		if tt.target == "" {
+			continue
+		}
+		if target, err := efs.ReadLink(tt.name); err != nil || target != tt.target {
+			t.Errorf("unexpected %s target %q: %v", tt.name, target, err)
+		}
+	}
+
+	fi, err := efs.Stat("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("unexpected modification time %s", fi.ModTime())
+	}
+	if st := fi.Sys().(*Stat); st.Uid != uint32(os.Getuid()) || st.Nlink != 1 {
+		t.Errorf("unexpected file information %+v", st)
+	}
+
+	entries, err := efs.ReadDir("many")
+	if err != nil || len(entries) != 300 {
+		t.Errorf("unexpected number of entries %d: %v", len(entries), err)
+	}
+
+	if xattrs {
+		x, err := efs.Xattrs("file")
+		if err != nil || string(x["user.comment"]) != "hello" {
+			t.Errorf("unexpected extended attributes %v: %v", x, err)
+		}
+		x, err = efs.Xattrs("dir/sub/file")
+		if err != nil || !bytes.Equal(x["user.big"], bigValue) {
+			t.Errorf("unexpected extended attributes %v: %v", x, err)
+		}
+		x, err = efs.Xattrs("dir/sub")
+		if err != nil || string(x["trusted.overlay.opaque"]) != "y" {
+			t.Errorf("unexpected extended attributes %v: %v", x, err)
+		}
+	}
+	if x, err := efs.Xattrs("dir"); err != nil || len(x) != 0 {
+		t.Errorf("unexpected extended attributes %v: %v", x, err)
+	}
+
+	if _, err := efs.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unexpected error for a missing file: %v", err)
+	}
+	if _, err := efs.Stat("file/sub"); err == nil {
+		t.Errorf("unexpected success for a path through a file")
+	}
+
+	u := efs.Usage()
+	if u.BlockSize != 1024 || u.Blocks != 16384 || u.FreeBlocks == 0 || u.FreeBlocks >= u.Blocks || u.FreeInodes >= u.Inodes {
+		t.Errorf("unexpected usage %+v", u)
+	}
+	if efs.NeedsRecovery() {
+		t.Errorf("unexpected journal recovery")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(bytes.NewReader(make([]byte, 4096))); err == nil {
+		t.Errorf("unexpected success with an empty image")
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ext3
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Stat holds the ownership and inode information of a file, it's returned
+// by the Sys method of the fs.FileInfo values of the filesystem.
+type Stat struct {
+	Uid   uint32 //nolint:revive
+	Gid   uint32 //nolint:revive
+	Nlink uint32
+	Ino   uint32
+	// Rdev is the device number of device files, as decoded by
+	// unix.Major and unix.Minor.
+	Rdev uint64
+}
+
+type fileInfo struct {
+	name string
+	ino  *inode
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	switch fi.ino.typ() {
+	case 0, fs.ModeDir, fs.ModeSymlink:
+		return int64(fi.ino.size)
+	}
+	return 0
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	return fileMode(fi.ino.mode)
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return time.Unix(fi.ino.mtime, fi.ino.mtimeNsec)
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.ino.isDir()
+}
+
+func (fi *fileInfo) Sys() any {
+	st := &Stat{
+		Uid:   fi.ino.uid,
+		Gid:   fi.ino.gid,
+		Nlink: fi.ino.nlink,
+		Ino:   fi.ino.number,
+	}
+	if fi.ino.typ()&fs.ModeDevice != 0 {
+		st.Rdev = fi.ino.rdev()
+	}
+	return st
+}
+
+type dirEntry struct {
+	f     *FS
+	entry direntry
+}
+
+func (d *dirEntry) Name() string {
+	return d.entry.name
+}
+
+func (d *dirEntry) IsDir() bool {
+	return d.entry.typ == fs.ModeDir
+}
+
+func (d *dirEntry) Type() fs.FileMode {
+	return d.entry.typ
+}
+
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	ino, err := d.f.readInode(d.entry.number)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: d.entry.name, ino: ino}, nil
+}
+
+func (d *dirEntry) String() string {
+	return fs.FormatDirEntry(d)
+}
+
+// file is an open regular or special file.
+type file struct {
+	f      *FS
+	info   *fileInfo
+	mapper *blockMapper
+	offset int64
+}
+
+func (fl *file) Stat() (fs.FileInfo, error) {
+	return fl.info, nil
+}
+
+func (fl *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	ino := fl.info.ino
+	if ino.typ() != 0 {
+		// special files have no content
+		return 0, io.EOF
+	}
+	size := int64(ino.size)
+	if off >= size {
+		return 0, io.EOF
+	}
+	if fl.mapper == nil {
+		fl.mapper = &blockMapper{f: fl.f, ino: ino}
+	}
+
+	bs := int64(fl.f.blockSize)
+	n := 0
+	for n < len(p) && off < size {
+		index := off / bs
+		start := off - index*bs
+		want := min(int64(len(p)-n), bs-start, size-off)
+
+		number, err := fl.mapper.mapBlock(uint64(index))
+		if err != nil {
+			return n, err
+		}
+		if number == 0 {
+			// sparse block
+			clear(p[n : n+int(want)])
+		} else {
+			if number >= fl.f.sb.BlocksCount {
+				return n, errCorrupted
+			}
+			if _, err := fl.f.r.ReadAt(p[n:n+int(want)], int64(number)*bs+start); err != nil {
+				return n, err
+			}
+		}
+		n += int(want)
+		off += want
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (fl *file) Read(p []byte) (int, error) {
+	n, err := fl.ReadAt(p, fl.offset)
+	fl.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (fl *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += fl.offset
+	case io.SeekEnd:
+		offset += int64(fl.info.ino.size)
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	fl.offset = offset
+	return offset, nil
+}
+
+func (fl *file) Close() error {
+	return nil
+}
+
+// dirFile is an open directory.
+type dirFile struct {
+	f       *FS
+	info    *fileInfo
+	entries []direntry
+	read    bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.f.readDir(d.info.ino)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.info.name, Err: err}
+		}
+		d.entries, d.read = entries, true
+	}
+
+	count := len(d.entries)
+	if n > 0 {
+		if count == 0 {
+			return nil, io.EOF
+		}
+		count = min(n, count)
+	}
+	list := make([]fs.DirEntry, 0, count)
+	for _, e := range d.entries[:count] {
+		list = append(list, &dirEntry{f: d.f, entry: e})
+	}
+	d.entries = d.entries[count:]
+	return list, nil
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
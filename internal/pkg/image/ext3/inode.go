@@ -0,0 +1,456 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ext3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// directBlocks is the number of block numbers stored in the inode,
+	// followed by the single, double and triple indirect block numbers
+	directBlocks = 12
+	// fastSymlinkSize is the size of the block map, which holds the
+	// target of short symbolic links
+	fastSymlinkSize = 60
+	// maxNameSize is the maximum length of a directory entry name
+	maxNameSize = 255
+	// xattrMagic starts the extended attributes stored in an inode or
+	// in a block
+	xattrMagic = 0xea020000
+	// xattrBlockHeaderSize is the size of the header of xattr blocks
+	xattrBlockHeaderSize = 32
+	// xattrEntrySize is the size of an xattr entry without its name
+	xattrEntrySize = 16
+)
+
+// Mode file types.
+const (
+	modeFifo     = 0x1000
+	modeCharDev  = 0x2000
+	modeDir      = 0x4000
+	modeBlockDev = 0x6000
+	modeFile     = 0x8000
+	modeSymlink  = 0xa000
+	modeSocket   = 0xc000
+	modeType     = 0xf000
+)
+
+// xattrPrefixes holds the name prefixes by xattr name index.
+var xattrPrefixes = map[uint8]string{
+	1: "user.",
+	2: "system.posix_acl_access",
+	3: "system.posix_acl_default",
+	4: "trusted.",
+	6: "security.",
+	7: "system.",
+}
+
+// rawInode is the part of an inode common to all revisions.
+type rawInode struct {
+	Mode       uint16
+	UID        uint16
+	SizeLo     uint32
+	ATime      uint32
+	CTime      uint32
+	MTime      uint32
+	DTime      uint32
+	GID        uint16
+	LinksCount uint16
+	BlocksLo   uint32
+	Flags      uint32
+	OSD1       uint32
+	Block      [15]uint32
+	Generation uint32
+	FileACL    uint32
+	SizeHigh   uint32
+	FAddr      uint32
+	BlocksHigh uint16
+	FileACLHi  uint16
+	UIDHigh    uint16
+	GIDHigh    uint16
+	Checksum   uint16
+	Reserved   uint16
+}
+
+// inode holds the decoded information of an ext3 inode.
+type inode struct {
+	number    uint32
+	mode      uint16
+	uid       uint32
+	gid       uint32
+	size      uint64
+	mtime     int64
+	mtimeNsec int64
+	nlink     uint32
+	blocks    uint32
+	block     [15]uint32
+	fileACL   uint32
+	// extra holds the content of the inode after the first 128 bytes,
+	// where extended attributes may be stored
+	extra []byte
+}
+
+func (i *inode) isDir() bool {
+	return i.mode&modeType == modeDir
+}
+
+func (i *inode) typ() fs.FileMode {
+	return fileMode(i.mode).Type()
+}
+
+// rdev returns the device number of a device inode.
+func (i *inode) rdev() uint64 {
+	if i.block[0] != 0 {
+		// old 16 bits encoding
+		return unix.Mkdev((i.block[0]>>8)&0xff, i.block[0]&0xff)
+	}
+	dev := i.block[1]
+	return unix.Mkdev((dev&0xfff00)>>8, (dev&0xff)|((dev>>12)&0xfff00))
+}
+
+// direntry holds a decoded ext3 directory entry.
+type direntry struct {
+	name   string
+	number uint32
+	typ    fs.FileMode
+}
+
+func (f *FS) readInode(number uint32) (*inode, error) {
+	if number == 0 || number > f.sb.InodesCount {
+		return nil, fmt.Errorf("%w: invalid inode number %d", errCorrupted, number)
+	}
+	group := (number - 1) / f.sb.InodesPerGroup
+	index := (number - 1) % f.sb.InodesPerGroup
+	table := f.groups[group].InodeTable
+	if table == 0 || table >= f.sb.BlocksCount {
+		return nil, fmt.Errorf("%w: invalid inode table %d", errCorrupted, table)
+	}
+
+	b := make([]byte, f.inodeSize)
+	pos := int64(table)*int64(f.blockSize) + int64(index)*int64(f.inodeSize)
+	if _, err := f.r.ReadAt(b, pos); err != nil {
+		return nil, fmt.Errorf("while reading inode %d: %w", number, err)
+	}
+	var raw rawInode
+	if _, err := binary.Decode(b, binary.LittleEndian, &raw); err != nil {
+		return nil, err
+	}
+
+	ino := &inode{
+		number:  number,
+		mode:    raw.Mode,
+		uid:     uint32(raw.UIDHigh)<<16 | uint32(raw.UID),
+		gid:     uint32(raw.GIDHigh)<<16 | uint32(raw.GID),
+		size:    uint64(raw.SizeLo),
+		mtime:   int64(int32(raw.MTime)),
+		nlink:   uint32(raw.LinksCount),
+		blocks:  raw.BlocksLo,
+		block:   raw.Block,
+		fileACL: raw.FileACL,
+		extra:   b[goodOldInodeSize:],
+	}
+	if ino.mode&modeType == modeFile {
+		// large_file stores the upper 32 bits of regular file sizes
+		ino.size |= uint64(raw.SizeHigh) << 32
+	}
+	if len(ino.extra) >= 12 {
+		if extraSize := binary.LittleEndian.Uint16(ino.extra); extraSize >= 12 && int(extraSize) <= len(ino.extra) {
+			// the low 2 bits extend the seconds, the others hold
+			// the nanoseconds
+			mtimeExtra := binary.LittleEndian.Uint32(ino.extra[8:])
+			ino.mtime += int64(mtimeExtra&3) << 32
+			ino.mtimeNsec = int64(mtimeExtra >> 2)
+		}
+	}
+	return ino, nil
+}
+
+// blockMapper maps the logical blocks of an inode to the filesystem
+// blocks, it keeps the last indirect block read at each level.
+type blockMapper struct {
+	f        *FS
+	ino      *inode
+	indirect [3]struct {
+		number  uint32
+		entries []uint32
+	}
+}
+
+// indirectEntry returns the entry index of the indirect block number at
+// the given level.
+func (m *blockMapper) indirectEntry(level int, number uint32, index uint64) (uint32, error) {
+	if number == 0 {
+		return 0, nil
+	}
+	cache := &m.indirect[level]
+	if cache.number != number || cache.entries == nil {
+		b, err := m.f.readBlock(number)
+		if err != nil {
+			return 0, err
+		}
+		cache.entries = make([]uint32, len(b)/4)
+		if _, err := binary.Decode(b, binary.LittleEndian, cache.entries); err != nil {
+			return 0, err
+		}
+		cache.number = number
+	}
+	return cache.entries[index], nil
+}
+
+// mapBlock returns the filesystem block holding the logical block n of
+// the inode, or 0 for a hole.
+func (m *blockMapper) mapBlock(n uint64) (uint32, error) {
+	if n < directBlocks {
+		return m.ino.block[n], nil
+	}
+	n -= directBlocks
+
+	perBlock := uint64(m.f.blockSize / 4)
+	// number of logical blocks addressed by an entry of each level
+	span := uint64(1)
+	for level := range 3 {
+		if n >= span*perBlock {
+			n -= span * perBlock
+			span *= perBlock
+			continue
+		}
+		number := m.ino.block[directBlocks+level]
+		for l := level; l >= 0; l-- {
+			var err error
+			number, err = m.indirectEntry(l, number, n/span)
+			if err != nil || number == 0 {
+				return 0, err
+			}
+			n %= span
+			span /= perBlock
+		}
+		return number, nil
+	}
+	return 0, fmt.Errorf("%w: block %d out of range", errCorrupted, n)
+}
+
+// readDir returns the entries of a directory inode sorted by name. Hashed
+// directory index blocks look like empty entries and are skipped.
+func (f *FS) readDir(dir *inode) ([]direntry, error) {
+	var entries []direntry
+
+	m := &blockMapper{f: f, ino: dir}
+	count := (dir.size + uint64(f.blockSize) - 1) / uint64(f.blockSize)
+	for n := range count {
+		number, err := m.mapBlock(n)
+		if err != nil {
+			return nil, err
+		} else if number == 0 {
+			continue
+		}
+		b, err := f.readBlock(number)
+		if err != nil {
+			return nil, err
+		}
+
+		for off := 0; off+8 <= len(b); {
+			ino := binary.LittleEndian.Uint32(b[off:])
+			recLen := int(binary.LittleEndian.Uint16(b[off+4:]))
+			nameLen := int(b[off+6])
+			fileType := b[off+7]
+			if f.sb.FeatureIncompat&incompatFiletype == 0 {
+				nameLen |= int(fileType) << 8
+				fileType = 0
+			}
+			if recLen < 8 || off+recLen > len(b) || nameLen > recLen-8 {
+				return nil, fmt.Errorf("%w: invalid directory entry", errCorrupted)
+			}
+			name := string(b[off+8 : off+8+nameLen])
+			off += recLen
+
+			if ino == 0 || name == "." || name == ".." {
+				continue
+			}
+			if nameLen > maxNameSize || !validName(name) {
+				return nil, fmt.Errorf("%w: invalid directory entry name %q", errCorrupted, name)
+			}
+
+			e := direntry{name: name, number: ino}
+			if fileType == 0 {
+				child, err := f.readInode(ino)
+				if err != nil {
+					return nil, err
+				}
+				e.typ = child.typ()
+			} else {
+				e.typ = direntryType(fileType)
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b direntry) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return entries, nil
+}
+
+// readLink returns the target of a symbolic link inode.
+func (f *FS) readLink(ino *inode) (string, error) {
+	if ino.size >= uint64(f.blockSize) {
+		return "", fmt.Errorf("%w: invalid symbolic link size %d", errCorrupted, ino.size)
+	}
+	// short targets are stored in the block map, unless the inode has
+	// data blocks besides its extended attribute block
+	blocks := int64(ino.blocks)
+	if ino.fileACL != 0 {
+		blocks -= int64(f.blockSize / 512)
+	}
+	if ino.size < fastSymlinkSize && blocks <= 0 {
+		b := make([]byte, fastSymlinkSize)
+		for i, n := range ino.block {
+			binary.LittleEndian.PutUint32(b[i*4:], n)
+		}
+		return string(b[:ino.size]), nil
+	}
+	if ino.block[0] == 0 {
+		return "", fmt.Errorf("%w: missing symbolic link block", errCorrupted)
+	}
+	b, err := f.readBlock(ino.block[0])
+	if err != nil {
+		return "", err
+	}
+	return string(b[:ino.size]), nil
+}
+
+// readXattrs returns the extended attributes of an inode, stored in the
+// inode and in an extended attribute block.
+func (f *FS) readXattrs(ino *inode) (map[string][]byte, error) {
+	xattrs := make(map[string][]byte)
+
+	if len(ino.extra) >= 2 {
+		extraSize := int(binary.LittleEndian.Uint16(ino.extra))
+		if extraSize+4 <= len(ino.extra) && binary.LittleEndian.Uint32(ino.extra[extraSize:]) == xattrMagic {
+			// values are relative to the first entry
+			region := ino.extra[extraSize+4:]
+			if err := parseXattrs(xattrs, region, region); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ino.fileACL != 0 {
+		b, err := f.readBlock(ino.fileACL)
+		if err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(b) != xattrMagic {
+			return nil, fmt.Errorf("%w: invalid extended attribute block", errCorrupted)
+		}
+		// values are relative to the block start
+		if err := parseXattrs(xattrs, b[xattrBlockHeaderSize:], b); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(xattrs) == 0 {
+		return nil, nil
+	}
+	return xattrs, nil
+}
+
+// parseXattrs adds the extended attributes of the entries to xattrs,
+// the value offsets being relative to values.
+func parseXattrs(xattrs map[string][]byte, entries, values []byte) error {
+	for len(entries) >= 4 && binary.LittleEndian.Uint32(entries) != 0 {
+		if len(entries) < xattrEntrySize {
+			return fmt.Errorf("%w: truncated extended attribute entry", errCorrupted)
+		}
+		nameLen := int(entries[0])
+		index := entries[1]
+		valueOffset := int(binary.LittleEndian.Uint16(entries[2:]))
+		valueInode := binary.LittleEndian.Uint32(entries[4:])
+		valueSize := int(binary.LittleEndian.Uint32(entries[8:]))
+
+		if xattrEntrySize+nameLen > len(entries) {
+			return fmt.Errorf("%w: truncated extended attribute name", errCorrupted)
+		}
+		name := string(entries[xattrEntrySize : xattrEntrySize+nameLen])
+		entries = entries[(xattrEntrySize+nameLen+3)&^3:]
+
+		if valueInode != 0 {
+			return fmt.Errorf("extended attribute values stored in inodes are not supported")
+		}
+		if valueOffset+valueSize > len(values) {
+			return fmt.Errorf("%w: invalid extended attribute value", errCorrupted)
+		}
+		prefix, ok := xattrPrefixes[index]
+		if !ok {
+			// unknown namespaces aren't exposed by the kernel either
+			continue
+		}
+		xattrs[prefix+name] = append([]byte(nil), values[valueOffset:valueOffset+valueSize]...)
+	}
+	return nil
+}
+
+// validName returns whether name is usable as a directory entry name.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00")
+}
+
+// direntryType returns the file type of a directory entry type.
+func direntryType(t uint8) fs.FileMode {
+	switch t {
+	case 2:
+		return fs.ModeDir
+	case 3:
+		return fs.ModeDevice | fs.ModeCharDevice
+	case 4:
+		return fs.ModeDevice
+	case 5:
+		return fs.ModeNamedPipe
+	case 6:
+		return fs.ModeSocket
+	case 7:
+		return fs.ModeSymlink
+	}
+	return 0
+}
+
+// fileMode returns the file mode corresponding to an inode mode.
+func fileMode(m uint16) fs.FileMode {
+	mode := fs.FileMode(m & 0o777)
+	if m&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	switch m & modeType {
+	case modeDir:
+		mode |= fs.ModeDir
+	case modeSymlink:
+		mode |= fs.ModeSymlink
+	case modeBlockDev:
+		mode |= fs.ModeDevice
+	case modeCharDev:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case modeFifo:
+		mode |= fs.ModeNamedPipe
+	case modeSocket:
+		mode |= fs.ModeSocket
+	}
+	return mode
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package packer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// Erofs represents an EROFS packer
+type Erofs struct {
+	MkfsErofsPath string
+	// SourceDateEpoch, when set, is passed to mkfs.erofs as
+	// SOURCE_DATE_EPOCH to clamp the image timestamps
+	SourceDateEpoch time.Time
+}
+
+// NewErofs initializes and returns an Erofs packer instance
+func NewErofs() *Erofs {
+	e := &Erofs{}
+	e.MkfsErofsPath, _ = bin.FindBin("mkfs.erofs")
+	return e
+}
+
+// HasMkfsErofs returns if mkfs.erofs binary has set or not
+func (e Erofs) HasMkfsErofs() bool {
+	return e.MkfsErofsPath != ""
+}
+
+// Create makes an EROFS filesystem from a source directory to a destination
+// file, the destination file is overwritten if it exists
+func (e Erofs) Create(src string, dest string, opts []string) error {
+	var stderr bytes.Buffer
+
+	if !e.HasMkfsErofs() {
+		return fmt.Errorf("could not create EROFS image, mkfs.erofs not found")
+	}
+
+	// mkfs.erofs takes args of the form: [options] destination source
+	args := append([]string{}, opts...)
+	args = append(args, dest, src)
+
+	sylog.Verbosef("Executing %s %s", e.MkfsErofsPath, strings.Join(args, " "))
+	cmd := exec.Command(e.MkfsErofsPath, args...)
+	cmd.Env = sourceDateEpochEnv(e.SourceDateEpoch)
+	if sylog.GetLevel() >= int(sylog.VerboseLevel) {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s command failed: %v: %s", e.MkfsErofsPath, err, stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package packer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func createErofs(t *testing.T, e *Erofs) (string, error) {
+	image := filepath.Join(t.TempDir(), "packer.erofs")
+	return image, e.Create(".", image, nil)
+}
+
+func TestErofs(t *testing.T) {
+	if e := NewErofs(); !e.HasMkfsErofs() {
+		t.Skip("mkfs.erofs not found, skipping")
+	}
+
+	t.Run("empty mkfs.erofs path", func(t *testing.T) {
+		e := NewErofs()
+		e.MkfsErofsPath = ""
+		if _, err := createErofs(t, e); err == nil {
+			t.Errorf("unexpected success with empty mkfs.erofs path")
+		}
+	})
+	t.Run("non-zero exit code", func(t *testing.T) {
+		e := NewErofs()
+		e.MkfsErofsPath, _ = exec.LookPath("false")
+		if _, err := createErofs(t, e); err == nil {
+			t.Errorf("unexpected success with non-zero exit code")
+		}
+	})
+	t.Run("happy path", func(t *testing.T) {
+		image, err := createErofs(t, NewErofs())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi, err := os.Stat(image); err != nil || fi.Size() == 0 {
+			t.Errorf("EROFS image not created: %v", err)
+		}
+	})
+}
@@ -90,13 +90,12 @@ func (g *Gocryptfs) init(tmpDir string) (cryptInfo *cryptInfo, err error) {
 		return nil, err
 	}
 
+	// the random password is encrypted with the key in the image
 	switch g.keyInfo.Format {
-	case cryptkey.PEM, cryptkey.ENV:
+	case cryptkey.PEM, cryptkey.ENV, cryptkey.Passphrase:
 		// #nosec G401
 		hash := md5.Sum(buf)
 		cryptInfo.pass = hex.EncodeToString(hash[:])
-	case cryptkey.Passphrase:
-		cryptInfo.pass = g.keyInfo.Material
 	default:
 		err = errors.New("cryptkey type is unknown")
 		return nil, err
@@ -15,6 +15,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/client"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
@@ -25,6 +26,9 @@ import (
 // Squashfs represents a squashfs packer
 type Squashfs struct {
 	MksquashfsPath string
+	// SourceDateEpoch, when set, is passed to mksquashfs as
+	// SOURCE_DATE_EPOCH to clamp the image timestamps
+	SourceDateEpoch time.Time
 }
 
 // NewSquashfs initializes and returns a Squashfs packer instance
@@ -34,6 +38,15 @@ func NewSquashfs() *Squashfs {
 	return s
 }
 
+// sourceDateEpochEnv returns the environment of a command clamping the
+// timestamps to t, or nil to inherit the current environment if t is zero.
+func sourceDateEpochEnv(t time.Time) []string {
+	if t.IsZero() {
+		return nil
+	}
+	return append(os.Environ(), fmt.Sprintf("SOURCE_DATE_EPOCH=%d", t.Unix()))
+}
+
 // HasMksquashfs returns if mksquashfs binary has set or not
 func (s Squashfs) HasMksquashfs() bool {
 	return s.MksquashfsPath != ""
@@ -75,6 +88,7 @@ func (s Squashfs) create(files []string, dest string, opts []string) error {
 	// (note: -reproducible is the default, there is also a -not-reproducible option)
 	sylog.Verbosef("Executing %s %s", s.MksquashfsPath, strings.Join(args, " "))
 	cmd := exec.Command(s.MksquashfsPath, args...)
+	cmd.Env = sourceDateEpochEnv(s.SourceDateEpoch)
 	if sylog.GetLevel() >= int(sylog.VerboseLevel) {
 		cmd.Stdout = os.Stdout
 	} else if hasPercentage {
@@ -13,7 +13,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func checkArchive(t *testing.T, path string, files []string) {
@@ -117,3 +119,41 @@ func TestSquashfs(t *testing.T) {
 	t.Run("non-zero exit code", testNonZeroExitCode)
 	t.Run("happy path", testHappyPath)
 }
+
+func TestSquashfsSourceDateEpoch(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	mksquashfs := filepath.Join(dir, "mksquashfs")
+	script := "#!/bin/sh\necho \"$SOURCE_DATE_EPOCH\" > " + envFile + "\n"
+	if err := os.WriteFile(mksquashfs, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+
+	tests := []struct {
+		name  string
+		epoch time.Time
+		want  string
+	}{
+		{name: "Unset", want: ""},
+		{name: "Set", epoch: time.Unix(1700000000, 0), want: "1700000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Squashfs{MksquashfsPath: mksquashfs, SourceDateEpoch: tt.epoch}
+			if _, err := createSquashfs(t, s); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			b, err := os.ReadFile(envFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(b)); got != tt.want {
+				t.Errorf("got SOURCE_DATE_EPOCH %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		t.Errorf("SOURCE_DATE_EPOCH set to %q in the process environment", v)
+	}
+}
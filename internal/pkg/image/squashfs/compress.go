@@ -0,0 +1,106 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression identifiers of the squashfs superblock.
+const (
+	compressionZlib = iota + 1
+	compressionLzma
+	compressionLzo
+	compressionXz
+	compressionLz4
+	compressionZstd
+)
+
+// decompressor returns the uncompressed data of a block, which can't be
+// larger than limit bytes.
+type decompressor func(src []byte, limit int) ([]byte, error)
+
+var (
+	zstdOnce    sync.Once
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func newDecompressor(id uint16) (decompressor, error) {
+	switch id {
+	case compressionZlib:
+		return func(src []byte, limit int) ([]byte, error) {
+			r, err := zlib.NewReader(bytes.NewReader(src))
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return readAll(r, limit)
+		}, nil
+	case compressionXz:
+		return func(src []byte, limit int) ([]byte, error) {
+			r, err := xz.NewReader(bytes.NewReader(src))
+			if err != nil {
+				return nil, err
+			}
+			return readAll(r, limit)
+		}, nil
+	case compressionLz4:
+		return func(src []byte, limit int) ([]byte, error) {
+			dst := make([]byte, limit)
+			n, err := lz4.UncompressBlock(src, dst)
+			if err != nil {
+				return nil, err
+			}
+			return dst[:n], nil
+		}, nil
+	case compressionZstd:
+		zstdOnce.Do(func() {
+			zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(1<<20))
+		})
+		if zstdErr != nil {
+			return nil, zstdErr
+		}
+		return func(src []byte, limit int) ([]byte, error) {
+			dst, err := zstdDecoder.DecodeAll(src, make([]byte, 0, limit))
+			if err != nil {
+				return nil, err
+			}
+			if len(dst) > limit {
+				return nil, fmt.Errorf("%w: block larger than %d bytes", errCorrupted, limit)
+			}
+			return dst, nil
+		}, nil
+	case compressionLzma:
+		return nil, fmt.Errorf("unsupported squashfs compression lzma")
+	case compressionLzo:
+		return nil, fmt.Errorf("unsupported squashfs compression lzo")
+	}
+	return nil, fmt.Errorf("unknown squashfs compression %d", id)
+}
+
+// readAll reads r until EOF and fails if more than limit bytes are read.
+func readAll(r io.Reader, limit int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("%w: block larger than %d bytes", errCorrupted, limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,292 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// ExtractOptions holds the options of an extraction.
+type ExtractOptions struct {
+	// Owner restores the file ownership, which requires privileges.
+	Owner bool
+	// Devices creates the block and character device files, which
+	// requires privileges, they are skipped otherwise.
+	Devices bool
+	// Exclude returns whether a file, identified by its path relative
+	// to the filesystem root, and its content are skipped.
+	Exclude func(name string) bool
+}
+
+type extractor struct {
+	f    *FS
+	opts ExtractOptions
+	// links holds the extracted path of inodes with several links
+	links map[uint32]string
+	// dirs holds the directories whose attributes are applied once
+	// their content is extracted
+	dirs []extractedDir
+	// parents holds the directory inodes being extracted
+	parents map[uint64]bool
+}
+
+type extractedDir struct {
+	path string
+	ino  *inode
+}
+
+// Extract extracts the named files and directories, with their content,
+// into the destination directory, or the whole filesystem if no name is
+// provided. Names are relative to the filesystem root, symbolic links are
+// never followed, neither in the filesystem nor in the destination.
+func (f *FS) Extract(dest string, names []string, opts ExtractOptions) error {
+	e := &extractor{
+		f:       f,
+		opts:    opts,
+		links:   make(map[uint32]string),
+		parents: make(map[uint64]bool),
+	}
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return fmt.Errorf("while creating %s: %w", dest, err)
+	}
+
+	if len(names) == 0 {
+		if err := e.extract(".", f.root, dest); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+		if !fs.ValidPath(name) {
+			return &fs.PathError{Op: "extract", Path: name, Err: fs.ErrInvalid}
+		}
+		if err := e.extractPath(name, dest); err != nil {
+			return err
+		}
+	}
+
+	// apply directory attributes from the deepest ones
+	for i := len(e.dirs) - 1; i >= 0; i-- {
+		if err := e.setAttributes(e.dirs[i].path, e.dirs[i].ino); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractPath extracts the file name and creates its parent directories.
+func (e *extractor) extractPath(name, dest string) error {
+	if name == "." {
+		return e.extract(name, e.f.root, dest)
+	}
+
+	cur := e.f.root
+	target := dest
+	elems := strings.Split(name, "/")
+
+	for i, elem := range elems {
+		child, err := e.f.child(cur, elem)
+		if err != nil {
+			return &fs.PathError{Op: "extract", Path: name, Err: err}
+		}
+		target = filepath.Join(target, elem)
+
+		if i == len(elems)-1 {
+			return e.extract(name, child, target)
+		}
+		if !child.isDir() {
+			return &fs.PathError{Op: "extract", Path: name, Err: errors.New("not a directory")}
+		}
+		if err := e.mkdir(target, child); err != nil {
+			return err
+		}
+		cur = child
+	}
+	return nil
+}
+
+// extract extracts the file rel, with the inode ino, to target.
+func (e *extractor) extract(rel string, ino *inode, target string) error {
+	if rel != "." && e.opts.Exclude != nil && e.opts.Exclude(rel) {
+		return nil
+	}
+
+	if ino.isDir() {
+		return e.extractDir(rel, ino, target)
+	}
+
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+
+	if ino.nlink > 1 {
+		if link, ok := e.links[ino.number]; ok {
+			if err := os.Link(link, target); err != nil {
+				return fmt.Errorf("while creating hard link %s: %w", target, err)
+			}
+			return nil
+		}
+	}
+
+	var err error
+	mode := fileMode(ino.typ, ino.perm)
+
+	switch ino.typ {
+	case typeFile:
+		err = e.extractFile(ino, target)
+	case typeSymlink:
+		err = os.Symlink(ino.target, target)
+	case typeBlockDev, typeCharDev:
+		if !e.opts.Devices {
+			sylog.Debugf("Skipping device file %s", rel)
+			return nil
+		}
+		devType := uint32(unix.S_IFBLK)
+		if ino.typ == typeCharDev {
+			devType = unix.S_IFCHR
+		}
+		err = unix.Mknod(target, devType|uint32(mode.Perm()), int(decodeDev(ino.rdev)))
+	case typeFifo:
+		err = unix.Mkfifo(target, uint32(mode.Perm()))
+	case typeSocket:
+		sylog.Debugf("Skipping socket file %s", rel)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("while extracting %s: %w", rel, err)
+	}
+
+	if ino.nlink > 1 {
+		e.links[ino.number] = target
+	}
+	return e.setAttributes(target, ino)
+}
+
+func (e *extractor) extractDir(rel string, ino *inode, target string) error {
+	if e.parents[ino.ref] {
+		return fmt.Errorf("%w: directory loop at %s", errCorrupted, rel)
+	}
+	e.parents[ino.ref] = true
+	defer delete(e.parents, ino.ref)
+
+	if err := e.mkdir(target, ino); err != nil {
+		return err
+	}
+
+	entries, err := e.f.readDir(ino)
+	if err != nil {
+		return fmt.Errorf("while reading directory %s: %w", rel, err)
+	}
+	for _, entry := range entries {
+		child, err := e.f.readInode(entry.ref)
+		if err != nil {
+			return fmt.Errorf("while reading %s: %w", path.Join(rel, entry.name), err)
+		}
+		if err := e.extract(path.Join(rel, entry.name), child, filepath.Join(target, entry.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) extractFile(ino *inode, target string) error {
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	in := &file{f: e.f, info: &fileInfo{name: filepath.Base(target), ino: ino}}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// mkdir creates the directory target, or reuses it if it already exists,
+// its attributes are applied once the extraction is complete.
+func (e *extractor) mkdir(target string, ino *inode) error {
+	fi, err := os.Lstat(target)
+	switch {
+	case err == nil && fi.IsDir():
+		// the content of the directory must be writable
+		err = os.Chmod(target, fi.Mode().Perm()|0o700)
+	case err == nil:
+		if err = os.Remove(target); err == nil {
+			err = os.Mkdir(target, 0o700)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		err = os.Mkdir(target, 0o700)
+	}
+	if err != nil {
+		return fmt.Errorf("while creating directory %s: %w", target, err)
+	}
+	e.dirs = append(e.dirs, extractedDir{path: target, ino: ino})
+	return nil
+}
+
+// setAttributes applies the ownership, permissions and modification time
+// of the inode to the extracted file target.
+func (e *extractor) setAttributes(target string, ino *inode) error {
+	if e.opts.Owner {
+		if err := os.Lchown(target, int(ino.uid), int(ino.gid)); err != nil {
+			return fmt.Errorf("while changing ownership of %s: %w", target, err)
+		}
+	}
+	if ino.typ != typeSymlink {
+		// set after the ownership which clears the setuid and setgid bits
+		mode := fileMode(ino.typ, ino.perm) & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		if err := os.Chmod(target, mode); err != nil {
+			return fmt.Errorf("while changing permissions of %s: %w", target, err)
+		}
+	}
+	ts := unix.NsecToTimespec(int64(ino.mtime) * 1e9)
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, target, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("while changing modification time of %s: %w", target, err)
+	}
+	return nil
+}
+
+// removeExisting removes the file target if it already exists.
+func removeExisting(target string) error {
+	fi, err := os.Lstat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = os.RemoveAll(target)
+	} else {
+		err = os.Remove(target)
+	}
+	if err != nil {
+		return fmt.Errorf("while removing %s: %w", target, err)
+	}
+	return nil
+}
+
+// decodeDev returns the device number of a squashfs device inode, stored
+// with the kernel new_encode_dev format.
+func decodeDev(rdev uint32) uint64 {
+	major := (rdev & 0xfff00) >> 8
+	minor := (rdev & 0xff) | ((rdev >> 12) & 0xfff00)
+	return unix.Mkdev(major, minor)
+}
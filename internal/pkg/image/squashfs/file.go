@@ -0,0 +1,311 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Stat holds the ownership and inode information of a file, it's returned
+// by the Sys method of the fs.FileInfo values of the filesystem.
+type Stat struct {
+	Uid   uint32 //nolint:revive
+	Gid   uint32 //nolint:revive
+	Nlink uint32
+	Ino   uint32
+	// Rdev is the device number of device files, as decoded by
+	// unix.Major and unix.Minor.
+	Rdev uint64
+}
+
+type fileInfo struct {
+	name string
+	ino  *inode
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	switch fi.ino.typ {
+	case typeFile:
+		return int64(fi.ino.size)
+	case typeSymlink:
+		return int64(len(fi.ino.target))
+	case typeDir:
+		return int64(fi.ino.dirSize)
+	}
+	return 0
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	return fileMode(fi.ino.typ, fi.ino.perm)
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return time.Unix(int64(fi.ino.mtime), 0)
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.ino.isDir()
+}
+
+func (fi *fileInfo) Sys() any {
+	return &Stat{
+		Uid:   fi.ino.uid,
+		Gid:   fi.ino.gid,
+		Nlink: fi.ino.nlink,
+		Ino:   fi.ino.number,
+		Rdev:  decodeDev(fi.ino.rdev),
+	}
+}
+
+type dirEntry struct {
+	f     *FS
+	entry direntry
+}
+
+func (d *dirEntry) Name() string {
+	return d.entry.name
+}
+
+func (d *dirEntry) IsDir() bool {
+	return d.entry.typ == typeDir
+}
+
+func (d *dirEntry) Type() fs.FileMode {
+	return fileMode(d.entry.typ, 0).Type()
+}
+
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	ino, err := d.f.readInode(d.entry.ref)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: d.entry.name, ino: ino}, nil
+}
+
+func (d *dirEntry) String() string {
+	return fs.FormatDirEntry(d)
+}
+
+// blockReader reads the content of a regular file, it keeps the last
+// uncompressed block to serve sequential reads.
+type blockReader struct {
+	f     *FS
+	ino   *inode
+	index int64
+	block []byte
+	// offsets holds the position of the data blocks
+	offsets []uint64
+}
+
+func (r *blockReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	size := int64(r.ino.size)
+	if off >= size {
+		return 0, io.EOF
+	}
+
+	bs := int64(r.f.sb.BlockSize)
+	n := 0
+	for n < len(p) && off < size {
+		index := off / bs
+		if index != r.index {
+			block, err := r.readBlock(index)
+			if err != nil {
+				return n, err
+			}
+			r.index, r.block = index, block
+		}
+		start := off - index*bs
+		c := copy(p[n:], r.block[start:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBlock returns the uncompressed data block index of the file.
+func (r *blockReader) readBlock(index int64) ([]byte, error) {
+	bs := int64(r.f.sb.BlockSize)
+	want := min(bs, int64(r.ino.size)-index*bs)
+
+	if index >= int64(len(r.ino.blockSizes)) {
+		return r.f.readFragment(r.ino, int(want))
+	}
+
+	if r.offsets == nil {
+		r.offsets = make([]uint64, len(r.ino.blockSizes))
+		pos := r.ino.blocks
+		for i, s := range r.ino.blockSizes {
+			r.offsets[i] = pos
+			pos += uint64(s &^ blockUncompressed)
+		}
+	}
+
+	s := r.ino.blockSizes[index]
+	if s == 0 {
+		// sparse block
+		return make([]byte, want), nil
+	}
+	data, err := r.f.readData(r.offsets[index], s)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != want {
+		return nil, fmt.Errorf("%w: data block of %d bytes instead of %d", errCorrupted, len(data), want)
+	}
+	return data, nil
+}
+
+// readFragment returns the tail end of the file stored in a fragment block.
+func (f *FS) readFragment(ino *inode, size int) ([]byte, error) {
+	if ino.fragIndex == noFragment {
+		return nil, fmt.Errorf("%w: missing fragment", errCorrupted)
+	}
+	frag := f.fragments[ino.fragIndex]
+	data, err := f.readData(frag.Start, frag.Size)
+	if err != nil {
+		return nil, err
+	}
+	end := int(ino.fragOffset) + size
+	if end > len(data) {
+		return nil, fmt.Errorf("%w: fragment too small", errCorrupted)
+	}
+	return data[ino.fragOffset:end], nil
+}
+
+// readData reads the data or fragment block at pos with the stored size,
+// and returns it uncompressed.
+func (f *FS) readData(pos uint64, size uint32) ([]byte, error) {
+	n := size &^ blockUncompressed
+	if n > f.sb.BlockSize {
+		return nil, fmt.Errorf("%w: invalid data block size %d", errCorrupted, n)
+	}
+	data := make([]byte, n)
+	if _, err := f.r.ReadAt(data, int64(pos)); err != nil {
+		return nil, fmt.Errorf("while reading data block: %w", err)
+	}
+	if size&blockUncompressed != 0 {
+		return data, nil
+	}
+	data, err := f.decompress(data, int(f.sb.BlockSize))
+	if err != nil {
+		return nil, fmt.Errorf("while decompressing data block: %w", err)
+	}
+	return data, nil
+}
+
+// file is an open regular or special file.
+type file struct {
+	f      *FS
+	info   *fileInfo
+	reader *blockReader
+	offset int64
+}
+
+func (fl *file) Stat() (fs.FileInfo, error) {
+	return fl.info, nil
+}
+
+func (fl *file) ReadAt(p []byte, off int64) (int, error) {
+	if fl.info.ino.typ != typeFile {
+		// special files have no content
+		return 0, io.EOF
+	}
+	if fl.reader == nil {
+		fl.reader = &blockReader{f: fl.f, ino: fl.info.ino, index: -1}
+	}
+	return fl.reader.ReadAt(p, off)
+}
+
+func (fl *file) Read(p []byte) (int, error) {
+	n, err := fl.ReadAt(p, fl.offset)
+	fl.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (fl *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += fl.offset
+	case io.SeekEnd:
+		offset += int64(fl.info.ino.size)
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	fl.offset = offset
+	return offset, nil
+}
+
+func (fl *file) Close() error {
+	return nil
+}
+
+// dirFile is an open directory.
+type dirFile struct {
+	f       *FS
+	info    *fileInfo
+	entries []direntry
+	read    bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.f.readDir(d.info.ino)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.info.name, Err: err}
+		}
+		d.entries, d.read = entries, true
+	}
+
+	count := len(d.entries)
+	if n > 0 {
+		if count == 0 {
+			return nil, io.EOF
+		}
+		count = min(n, count)
+	}
+	list := make([]fs.DirEntry, 0, count)
+	for _, e := range d.entries[:count] {
+		list = append(list, &dirEntry{f: d.f, entry: e})
+	}
+	d.entries = d.entries[count:]
+	return list, nil
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
@@ -0,0 +1,330 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// maxNameSize is the maximum length of a directory entry name
+const maxNameSize = 256
+
+type inodeHeader struct {
+	Type   uint16
+	Perm   uint16
+	UID    uint16
+	GID    uint16
+	MTime  uint32
+	Number uint32
+}
+
+// inode holds the decoded information of a squashfs inode, its type
+// is always reported as the basic type.
+type inode struct {
+	ref    uint64
+	typ    uint16
+	perm   uint16
+	uid    uint32
+	gid    uint32
+	mtime  uint32
+	number uint32
+	nlink  uint32
+
+	// directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+
+	// regular files
+	size       uint64
+	blocks     uint64
+	fragIndex  uint32
+	fragOffset uint32
+	blockSizes []uint32
+
+	// symbolic links
+	target string
+
+	// devices
+	rdev uint32
+
+	// xattr is the index in the xattr id table, or noXattr
+	xattr uint32
+}
+
+func (i *inode) isDir() bool {
+	return i.typ == typeDir
+}
+
+// direntry holds a decoded squashfs directory entry.
+type direntry struct {
+	name   string
+	ref    uint64
+	typ    uint16
+	number uint32
+}
+
+func (f *FS) readInode(ref uint64) (*inode, error) {
+	mr, err := f.newMetadataReader(f.sb.InodeTable, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var h inodeHeader
+	if err := binary.Read(mr, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("while reading inode header: %w", err)
+	}
+	if int(h.UID) >= len(f.ids) || int(h.GID) >= len(f.ids) {
+		return nil, fmt.Errorf("%w: invalid inode id index", errCorrupted)
+	}
+
+	ino := &inode{
+		ref:    ref,
+		typ:    h.Type,
+		perm:   h.Perm,
+		uid:    f.ids[h.UID],
+		gid:    f.ids[h.GID],
+		mtime:  h.MTime,
+		number: h.Number,
+		nlink:  1,
+		xattr:  noXattr,
+	}
+
+	extended := h.Type > typeSocket
+	if extended {
+		ino.typ -= typeSocket
+	}
+	if ino.typ < typeDir || ino.typ > typeSocket {
+		return nil, fmt.Errorf("%w: invalid inode type %d", errCorrupted, h.Type)
+	}
+
+	switch {
+	case ino.typ == typeDir && !extended:
+		var d struct {
+			Block  uint32
+			Nlink  uint32
+			Size   uint16
+			Offset uint16
+			Parent uint32
+		}
+		err = binary.Read(mr, binary.LittleEndian, &d)
+		ino.dirBlock, ino.nlink, ino.dirSize, ino.dirOffset = d.Block, d.Nlink, uint32(d.Size), d.Offset
+	case ino.typ == typeDir:
+		var d struct {
+			Nlink    uint32
+			Size     uint32
+			Block    uint32
+			Parent   uint32
+			IdxCount uint16
+			Offset   uint16
+			Xattr    uint32
+		}
+		err = binary.Read(mr, binary.LittleEndian, &d)
+		ino.dirBlock, ino.nlink, ino.dirSize, ino.dirOffset, ino.xattr = d.Block, d.Nlink, d.Size, d.Offset, d.Xattr
+	case ino.typ == typeFile && !extended:
+		var d struct {
+			Start      uint32
+			Frag       uint32
+			FragOffset uint32
+			Size       uint32
+		}
+		err = binary.Read(mr, binary.LittleEndian, &d)
+		ino.blocks, ino.fragIndex, ino.fragOffset, ino.size = uint64(d.Start), d.Frag, d.FragOffset, uint64(d.Size)
+	case ino.typ == typeFile:
+		var d struct {
+			Start      uint64
+			Size       uint64
+			Sparse     uint64
+			Nlink      uint32
+			Frag       uint32
+			FragOffset uint32
+			Xattr      uint32
+		}
+		err = binary.Read(mr, binary.LittleEndian, &d)
+		ino.blocks, ino.size, ino.nlink, ino.fragIndex, ino.fragOffset, ino.xattr = d.Start, d.Size, d.Nlink, d.Frag, d.FragOffset, d.Xattr
+	case ino.typ == typeSymlink:
+		var d struct {
+			Nlink uint32
+			Size  uint32
+		}
+		if err = binary.Read(mr, binary.LittleEndian, &d); err == nil {
+			if d.Size == 0 || d.Size > 4096 {
+				return nil, fmt.Errorf("%w: invalid symbolic link size %d", errCorrupted, d.Size)
+			}
+			target := make([]byte, d.Size)
+			if _, err = io.ReadFull(mr, target); err == nil {
+				ino.nlink, ino.target = d.Nlink, string(target)
+			}
+			if err == nil && extended {
+				err = binary.Read(mr, binary.LittleEndian, &ino.xattr)
+			}
+		}
+	case ino.typ == typeBlockDev || ino.typ == typeCharDev:
+		var d struct {
+			Nlink uint32
+			Rdev  uint32
+		}
+		err = binary.Read(mr, binary.LittleEndian, &d)
+		ino.nlink, ino.rdev = d.Nlink, d.Rdev
+		if err == nil && extended {
+			err = binary.Read(mr, binary.LittleEndian, &ino.xattr)
+		}
+	default:
+		err = binary.Read(mr, binary.LittleEndian, &ino.nlink)
+		if err == nil && extended {
+			err = binary.Read(mr, binary.LittleEndian, &ino.xattr)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while reading inode: %w", err)
+	}
+
+	if ino.typ == typeFile {
+		if err := f.readBlockSizes(ino, mr); err != nil {
+			return nil, fmt.Errorf("while reading file block list: %w", err)
+		}
+	}
+	return ino, nil
+}
+
+// readBlockSizes reads the list of data block sizes following a file inode.
+func (f *FS) readBlockSizes(ino *inode, r io.Reader) error {
+	bs := uint64(f.sb.BlockSize)
+	count := ino.size / bs
+	if ino.fragIndex == noFragment {
+		count = (ino.size + bs - 1) / bs
+	} else if int(ino.fragIndex) >= len(f.fragments) || uint64(ino.fragOffset)+ino.size%bs > bs {
+		return fmt.Errorf("%w: invalid fragment", errCorrupted)
+	}
+
+	// the list is read by chunk to not trust the file size
+	// for the allocation
+	const chunk = 1024
+	var b [chunk * 4]byte
+	for remaining := count; remaining > 0; {
+		n := min(remaining, chunk)
+		if _, err := io.ReadFull(r, b[:n*4]); err != nil {
+			return err
+		}
+		for i := range n {
+			ino.blockSizes = append(ino.blockSizes, binary.LittleEndian.Uint32(b[i*4:]))
+		}
+		remaining -= n
+	}
+	return nil
+}
+
+// readDir returns the entries of a directory inode sorted by name.
+func (f *FS) readDir(dir *inode) ([]direntry, error) {
+	// the directory size accounts for the "." and ".." entries
+	if dir.dirSize <= 3 {
+		return nil, nil
+	}
+	mr, err := f.newMetadataReader(f.sb.DirTable, uint64(dir.dirBlock)<<16|uint64(dir.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+	r := io.LimitReader(mr, int64(dir.dirSize-3))
+
+	var entries []direntry
+	for {
+		var h struct {
+			Count  uint32
+			Start  uint32
+			Number uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &h); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("while reading directory header: %w", err)
+		}
+		if h.Count >= 256 {
+			return nil, fmt.Errorf("%w: invalid directory header", errCorrupted)
+		}
+
+		for range h.Count + 1 {
+			var e struct {
+				Offset   uint16
+				Delta    int16
+				Type     uint16
+				NameSize uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+				return nil, fmt.Errorf("while reading directory entry: %w", err)
+			}
+			if e.NameSize >= maxNameSize {
+				return nil, fmt.Errorf("%w: invalid directory entry name size", errCorrupted)
+			}
+			name := make([]byte, e.NameSize+1)
+			if _, err := io.ReadFull(r, name); err != nil {
+				return nil, fmt.Errorf("while reading directory entry name: %w", err)
+			}
+			if !validName(string(name)) {
+				return nil, fmt.Errorf("%w: invalid directory entry name %q", errCorrupted, name)
+			}
+			typ := e.Type
+			if typ > typeSocket {
+				typ -= typeSocket
+			}
+			if typ < typeDir || typ > typeSocket {
+				return nil, fmt.Errorf("%w: invalid directory entry type %d", errCorrupted, e.Type)
+			}
+			entries = append(entries, direntry{
+				name:   string(name),
+				ref:    uint64(h.Start)<<16 | uint64(e.Offset),
+				typ:    typ,
+				number: uint32(int64(h.Number) + int64(e.Delta)),
+			})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b direntry) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return entries, nil
+}
+
+// validName returns whether name is usable as a directory entry name.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00")
+}
+
+// fileMode returns the file mode corresponding to a type and permissions.
+func fileMode(typ, perm uint16) fs.FileMode {
+	mode := fs.FileMode(perm & 0o777)
+	if perm&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if perm&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if perm&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	switch typ {
+	case typeDir:
+		mode |= fs.ModeDir
+	case typeSymlink:
+		mode |= fs.ModeSymlink
+	case typeBlockDev:
+		mode |= fs.ModeDevice
+	case typeCharDev:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case typeFifo:
+		mode |= fs.ModeNamedPipe
+	case typeSocket:
+		mode |= fs.ModeSocket
+	}
+	return mode
+}
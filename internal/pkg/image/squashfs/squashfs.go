@@ -0,0 +1,456 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package squashfs reads version 4 squashfs filesystems in process, without
+// relying on the unsquashfs or squashfuse programs.
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/apptainer/apptainer/pkg/image"
+)
+
+const (
+	magic          = 0x73717368
+	superblockSize = 96
+	// metadataSize is the maximum uncompressed size of a metadata block
+	metadataSize = 8192
+	// metadataUncompressed is set in the header of uncompressed metadata blocks
+	metadataUncompressed = 0x8000
+	// blockUncompressed is set in the size of uncompressed data blocks
+	blockUncompressed = 1 << 24
+	// noFragment is the fragment index of files without fragment
+	noFragment = 0xffffffff
+	// noXattr is the xattr index of inodes without extended attributes
+	noXattr = 0xffffffff
+	// noTable is the position of absent optional tables
+	noTable = 0xffffffffffffffff
+	// maxSymlinks is the maximum number of symbolic links followed
+	// while resolving a path
+	maxSymlinks = 40
+	// maxCachedBlocks is the maximum number of cached metadata blocks
+	maxCachedBlocks = 64
+)
+
+// Inode types, the extended types are the basic types plus 7.
+const (
+	typeDir = iota + 1
+	typeFile
+	typeSymlink
+	typeBlockDev
+	typeCharDev
+	typeFifo
+	typeSocket
+)
+
+var errCorrupted = errors.New("corrupted squashfs filesystem")
+
+type superblock struct {
+	Magic         uint32
+	InodeCount    uint32
+	ModTime       uint32
+	BlockSize     uint32
+	FragmentCount uint32
+	Compression   uint16
+	BlockLog      uint16
+	Flags         uint16
+	IDCount       uint16
+	Major         uint16
+	Minor         uint16
+	RootInode     uint64
+	BytesUsed     uint64
+	IDTable       uint64
+	XattrTable    uint64
+	InodeTable    uint64
+	DirTable      uint64
+	FragmentTable uint64
+	ExportTable   uint64
+}
+
+type fragment struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+// FS is a read-only squashfs filesystem. It implements the fs.FS,
+// fs.StatFS, fs.ReadDirFS, fs.ReadFileFS and fs.ReadLinkFS interfaces,
+// symbolic links being resolved inside the filesystem. It's safe for
+// concurrent use.
+type FS struct {
+	r          io.ReaderAt
+	sb         superblock
+	decompress decompressor
+	ids        []uint32
+	fragments  []fragment
+	root       *inode
+
+	xattrOnce  sync.Once
+	xattrIDs   []xattrID
+	xattrStart uint64
+	xattrErr   error
+
+	mu    sync.Mutex
+	cache map[uint64]metadataBlock
+}
+
+type metadataBlock struct {
+	data []byte
+	next uint64
+}
+
+// New returns the squashfs filesystem read from r, which starts at offset 0.
+func New(r io.ReaderAt) (*FS, error) {
+	f := &FS{
+		r:     r,
+		cache: make(map[uint64]metadataBlock),
+	}
+
+	b := make([]byte, superblockSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("while reading squashfs superblock: %w", err)
+	}
+	if _, err := binary.Decode(b, binary.LittleEndian, &f.sb); err != nil {
+		return nil, fmt.Errorf("while decoding squashfs superblock: %w", err)
+	}
+	if f.sb.Magic != magic {
+		return nil, fmt.Errorf("not a squashfs filesystem")
+	}
+	if f.sb.Major != 4 {
+		return nil, fmt.Errorf("unsupported squashfs version %d.%d", f.sb.Major, f.sb.Minor)
+	}
+	if f.sb.BlockLog < 12 || f.sb.BlockLog > 20 || f.sb.BlockSize != 1<<f.sb.BlockLog {
+		return nil, fmt.Errorf("%w: invalid block size %d", errCorrupted, f.sb.BlockSize)
+	}
+
+	var err error
+	if f.decompress, err = newDecompressor(f.sb.Compression); err != nil {
+		return nil, err
+	}
+	if f.ids, err = f.readIDTable(); err != nil {
+		return nil, fmt.Errorf("while reading squashfs id table: %w", err)
+	}
+	if f.fragments, err = f.readFragmentTable(); err != nil {
+		return nil, fmt.Errorf("while reading squashfs fragment table: %w", err)
+	}
+	if f.root, err = f.readInode(f.sb.RootInode); err != nil {
+		return nil, fmt.Errorf("while reading squashfs root directory: %w", err)
+	}
+	if !f.root.isDir() {
+		return nil, fmt.Errorf("%w: root inode is not a directory", errCorrupted)
+	}
+	return f, nil
+}
+
+// OpenImage returns the squashfs root filesystem of an image, read through
+// its root filesystem partition reader. The image file must stay open while
+// the returned filesystem is used.
+func OpenImage(img *image.Image) (*FS, error) {
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return nil, fmt.Errorf("while getting root filesystem in %s: %w", img.Path, err)
+	}
+	if part.Type != image.SQUASHFS {
+		return nil, fmt.Errorf("root filesystem of %s is not squashfs", img.Path)
+	}
+	r, err := image.NewPartitionReader(img, image.RootFs, -1)
+	if err != nil {
+		return nil, fmt.Errorf("while getting root filesystem reader in %s: %w", img.Path, err)
+	}
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil, fmt.Errorf("root filesystem reader of %s doesn't support random access", img.Path)
+	}
+	return New(ra)
+}
+
+// readMetadataBlock returns the uncompressed data of the metadata block at
+// pos, and the position of the following block.
+func (f *FS) readMetadataBlock(pos uint64) (metadataBlock, error) {
+	f.mu.Lock()
+	block, ok := f.cache[pos]
+	f.mu.Unlock()
+	if ok {
+		return block, nil
+	}
+
+	var h [2]byte
+	if _, err := f.r.ReadAt(h[:], int64(pos)); err != nil {
+		return block, fmt.Errorf("while reading metadata block header: %w", err)
+	}
+	header := binary.LittleEndian.Uint16(h[:])
+	size := header &^ metadataUncompressed
+	if size == 0 || size > metadataSize {
+		return block, fmt.Errorf("%w: invalid metadata block size %d", errCorrupted, size)
+	}
+
+	data := make([]byte, size)
+	if _, err := f.r.ReadAt(data, int64(pos)+2); err != nil {
+		return block, fmt.Errorf("while reading metadata block: %w", err)
+	}
+	if header&metadataUncompressed == 0 {
+		var err error
+		if data, err = f.decompress(data, metadataSize); err != nil {
+			return block, fmt.Errorf("while decompressing metadata block: %w", err)
+		}
+	}
+	block = metadataBlock{data: data, next: pos + 2 + uint64(size)}
+
+	f.mu.Lock()
+	if len(f.cache) >= maxCachedBlocks {
+		clear(f.cache)
+	}
+	f.cache[pos] = block
+	f.mu.Unlock()
+
+	return block, nil
+}
+
+// metadataReader reads the stream of data stored in consecutive metadata
+// blocks.
+type metadataReader struct {
+	f    *FS
+	next uint64
+	buf  []byte
+}
+
+// newMetadataReader returns a reader of the metadata of a table starting
+// at the position referenced by ref, which holds the offset of a block
+// relative to the table in its upper bits and the offset in the
+// uncompressed block in its lower 16 bits.
+func (f *FS) newMetadataReader(table, ref uint64) (*metadataReader, error) {
+	block, err := f.readMetadataBlock(table + ref>>16)
+	if err != nil {
+		return nil, err
+	}
+	offset := ref & 0xffff
+	if offset > uint64(len(block.data)) {
+		return nil, fmt.Errorf("%w: invalid metadata offset %d", errCorrupted, offset)
+	}
+	return &metadataReader{f: f, next: block.next, buf: block.data[offset:]}, nil
+}
+
+func (m *metadataReader) Read(p []byte) (int, error) {
+	if len(m.buf) == 0 {
+		block, err := m.f.readMetadataBlock(m.next)
+		if err != nil {
+			return 0, err
+		}
+		m.buf, m.next = block.data, block.next
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// readTable reads a table of count entries of size bytes, stored in
+// metadata blocks referenced by the list of block positions at start.
+func (f *FS) readTable(start uint64, count, size int) ([]byte, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	nblocks := (count*size + metadataSize - 1) / metadataSize
+	index := make([]byte, nblocks*8)
+	if _, err := f.r.ReadAt(index, int64(start)); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, count*size)
+	for i := range nblocks {
+		block, err := f.readMetadataBlock(binary.LittleEndian.Uint64(index[i*8:]))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, block.data...)
+	}
+	if len(data) < count*size {
+		return nil, fmt.Errorf("%w: truncated table", errCorrupted)
+	}
+	return data[:count*size], nil
+}
+
+func (f *FS) readIDTable() ([]uint32, error) {
+	data, err := f.readTable(f.sb.IDTable, int(f.sb.IDCount), 4)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint32, f.sb.IDCount)
+	_, err = binary.Decode(data, binary.LittleEndian, ids)
+	return ids, err
+}
+
+func (f *FS) readFragmentTable() ([]fragment, error) {
+	// a fragment entry can't be smaller than a byte of the image
+	if uint64(f.sb.FragmentCount) > f.sb.BytesUsed {
+		return nil, fmt.Errorf("%w: invalid fragment count %d", errCorrupted, f.sb.FragmentCount)
+	}
+	data, err := f.readTable(f.sb.FragmentTable, int(f.sb.FragmentCount), 16)
+	if err != nil {
+		return nil, err
+	}
+	fragments := make([]fragment, f.sb.FragmentCount)
+	_, err = binary.Decode(data, binary.LittleEndian, fragments)
+	return fragments, err
+}
+
+// lookup returns the inode of the file name, following symbolic links in
+// the path and, if follow is set, in its last element.
+func (f *FS) lookup(op, name string, follow bool) (*inode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	cur := f.root
+	var parents []*inode
+	parts := strings.Split(name, "/")
+	links := 0
+
+	for len(parts) > 0 {
+		elem := parts[0]
+		parts = parts[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(parents) > 0 {
+				cur, parents = parents[len(parents)-1], parents[:len(parents)-1]
+			}
+			continue
+		}
+
+		if !cur.isDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+		}
+		child, err := f.child(cur, elem)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		if child.typ == typeSymlink && (len(parts) > 0 || follow) {
+			links++
+			if links > maxSymlinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			if path.IsAbs(child.target) {
+				cur, parents = f.root, nil
+			}
+			parts = append(strings.Split(child.target, "/"), parts...)
+			continue
+		}
+
+		parents = append(parents, cur)
+		cur = child
+	}
+	return cur, nil
+}
+
+// child returns the inode of the entry name of the directory dir.
+func (f *FS) child(dir *inode, name string) (*inode, error) {
+	entries, err := f.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.name == name {
+			return f.readInode(e.ref)
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// Open opens the named file for reading.
+func (f *FS) Open(name string) (fs.File, error) {
+	ino, err := f.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info := &fileInfo{name: path.Base(name), ino: ino}
+	if ino.isDir() {
+		return &dirFile{f: f, info: info}, nil
+	}
+	return &file{f: f, info: info}, nil
+}
+
+// Stat returns the information of the named file, following symbolic links.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	ino, err := f.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), ino: ino}, nil
+}
+
+// Lstat returns the information of the named file, without following a
+// symbolic link in its last element.
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	ino, err := f.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), ino: ino}, nil
+}
+
+// ReadLink returns the target of the named symbolic link.
+func (f *FS) ReadLink(name string) (string, error) {
+	ino, err := f.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if ino.typ != typeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return ino.target, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ino, err := f.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !ino.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := f.readDir(ino)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, &dirEntry{f: f, entry: e})
+	}
+	return list, nil
+}
+
+// ReadFile returns the content of the named file.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	ino, err := f.lookup("read", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if ino.isDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	// the file size isn't trusted for the allocation
+	buf := bytes.NewBuffer(make([]byte, 0, min(ino.size, 1<<20)))
+	fl := &file{f: f, info: &fileInfo{name: path.Base(name), ino: ino}}
+	if _, err := io.Copy(buf, fl); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,464 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// testdata/test.sqfs is a zlib compressed image with a block size of
+// 4096 bytes and the following content:
+//
+//	abslink -> /dir/nested.txt
+//	big.bin (compressed, uncompressed and sparse blocks followed by a fragment)
+//	dir/nested.txt
+//	fifo
+//	file.txt (owned by 1000:1000, hard linked to hardlink.txt)
+//	link -> file.txt
+//	setuid (empty file with mode 04755)
+const testImage = "testdata/test.sqfs"
+
+var testMtime = time.Unix(1700000000, 0)
+
+func bigContent() []byte {
+	var b bytes.Buffer
+	b.Write(bytes.Repeat([]byte("A"), 4096))
+	// the second block is stored uncompressed, only its size is checked
+	b.Write(make([]byte, 4096))
+	b.Write(make([]byte, 4096))
+	b.Write(bytes.Repeat([]byte("tail"), 25))
+	return b.Bytes()
+}
+
+func openTest(t *testing.T, path string) *FS {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	sfs, err := New(f)
+	if err != nil {
+		t.Fatalf("while opening %s: %s", path, err)
+	}
+	return sfs
+}
+
+func TestNew(t *testing.T) {
+	image, err := os.ReadFile(testImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badMagic := bytes.Clone(image)
+	copy(badMagic, "xxxx")
+	badVersion := bytes.Clone(image)
+	badVersion[28] = 3
+	badCompression := bytes.Clone(image)
+	badCompression[20] = 2
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "Valid", data: image},
+		{name: "Empty", data: nil, wantErr: true},
+		{name: "Truncated", data: image[:superblockSize+10], wantErr: true},
+		{name: "BadMagic", data: badMagic, wantErr: true},
+		{name: "BadVersion", data: badVersion, wantErr: true},
+		{name: "Lzma", data: badCompression, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(bytes.NewReader(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v (want error %v)", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMksquashfsImage(t *testing.T) {
+	sfs := openTest(t, "../../../../pkg/image/testdata/squashfs.v4")
+
+	b, err := sfs.ReadFile("examplefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Example File Contents\n" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if err := fstest.TestFS(sfs, "examplefile"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenImage(t *testing.T) {
+	img, err := image.Init(testImage, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.File.Close()
+
+	sfs, err := OpenImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := sfs.ReadFile("file.txt"); err != nil || string(b) != "Hello squashfs\n" {
+		t.Errorf("unexpected file.txt content %q: %v", b, err)
+	}
+}
+
+func TestFS(t *testing.T) {
+	sfs := openTest(t, testImage)
+
+	if err := fstest.TestFS(sfs, "big.bin", "dir/nested.txt", "file.txt", "hardlink.txt", "setuid"); err != nil {
+		t.Error(err)
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{name: "file.txt", content: "Hello squashfs\n"},
+		{name: "hardlink.txt", content: "Hello squashfs\n"},
+		{name: "link", content: "Hello squashfs\n"},
+		{name: "abslink", content: "nested\n"},
+		{name: "dir/nested.txt", content: "nested\n"},
+		{name: "setuid", content: ""},
+	}
+	for _, f := range files {
+		b, err := sfs.ReadFile(f.name)
+		if err != nil {
+			t.Errorf("while reading %s: %s", f.name, err)
+		} else if string(b) != f.content {
+			t.Errorf("unexpected content %q for %s", b, f.name)
+		}
+	}
+
+	b, err := sfs.ReadFile("big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bigContent()
+	if len(b) != len(want) || !bytes.Equal(b[:4096], want[:4096]) || !bytes.Equal(b[8192:], want[8192:]) {
+		t.Errorf("unexpected content for big.bin")
+	}
+
+	fi, err := sfs.Stat("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fi.Sys().(*Stat)
+	if st.Uid != 1000 || st.Gid != 1000 || st.Nlink != 2 {
+		t.Errorf("unexpected ownership or links for file.txt: %+v", st)
+	}
+	if !fi.ModTime().Equal(testMtime) {
+		t.Errorf("unexpected modification time %s", fi.ModTime())
+	}
+
+	if fi, err := sfs.Stat("setuid"); err != nil || fi.Mode() != fs.ModeSetuid|0o755 {
+		t.Errorf("unexpected mode for setuid: %v", err)
+	}
+	if fi, err := sfs.Lstat("fifo"); err != nil || fi.Mode().Type() != fs.ModeNamedPipe {
+		t.Errorf("unexpected mode for fifo: %v", err)
+	}
+	if fi, err := sfs.Lstat("link"); err != nil || fi.Mode().Type() != fs.ModeSymlink {
+		t.Errorf("unexpected mode for link: %v", err)
+	}
+	if target, err := sfs.ReadLink("abslink"); err != nil || target != "/dir/nested.txt" {
+		t.Errorf("unexpected target %q for abslink: %v", target, err)
+	}
+	if _, err := sfs.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unexpected error for a missing file: %v", err)
+	}
+	if _, err := sfs.Stat("file.txt/foo"); err == nil {
+		t.Errorf("unexpected success with a file as directory")
+	}
+	if _, err := sfs.ReadFile("dir"); err == nil {
+		t.Errorf("unexpected success while reading a directory")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	sfs := openTest(t, testImage)
+
+	t.Run("all", func(t *testing.T) {
+		dest := t.TempDir()
+		// existing files are replaced
+		if err := os.Symlink("/etc/passwd", filepath.Join(dest, "file.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if err := sfs.Extract(dest, nil, ExtractOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if b, err := os.ReadFile(filepath.Join(dest, "big.bin")); err != nil || len(b) != len(bigContent()) {
+			t.Errorf("unexpected big.bin: %v", err)
+		}
+		if b, err := os.ReadFile(filepath.Join(dest, "dir/nested.txt")); err != nil || string(b) != "nested\n" {
+			t.Errorf("unexpected dir/nested.txt: %v", err)
+		}
+		if target, err := os.Readlink(filepath.Join(dest, "abslink")); err != nil || target != "/dir/nested.txt" {
+			t.Errorf("unexpected abslink target %q: %v", target, err)
+		}
+
+		fi1, err := os.Lstat(filepath.Join(dest, "file.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi2, err := os.Lstat(filepath.Join(dest, "hardlink.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(fi1, fi2) {
+			t.Errorf("file.txt and hardlink.txt aren't the same file")
+		}
+		if !fi1.Mode().IsRegular() || !fi1.ModTime().Equal(testMtime) {
+			t.Errorf("unexpected file.txt mode %s or modification time %s", fi1.Mode(), fi1.ModTime())
+		}
+
+		if fi, err := os.Lstat(filepath.Join(dest, "setuid")); err != nil || fi.Mode() != fs.ModeSetuid|0o755 {
+			t.Errorf("unexpected setuid mode: %v", err)
+		}
+		if fi, err := os.Lstat(filepath.Join(dest, "fifo")); err != nil || fi.Mode().Type() != fs.ModeNamedPipe {
+			t.Errorf("unexpected fifo mode: %v", err)
+		}
+		if fi, err := os.Lstat(filepath.Join(dest, "dir")); err != nil || fi.Mode() != fs.ModeDir|0o750 || !fi.ModTime().Equal(testMtime) {
+			t.Errorf("unexpected dir attributes: %v", err)
+		}
+	})
+
+	t.Run("names", func(t *testing.T) {
+		dest := t.TempDir()
+		exclude := func(name string) bool {
+			return strings.HasPrefix(name, "big")
+		}
+		if err := sfs.Extract(dest, []string{"/dir/nested.txt", "big.bin", "link"}, ExtractOptions{Exclude: exclude}); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := os.ReadDir(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if strings.Join(names, ",") != "dir,link" {
+			t.Errorf("unexpected extracted files %v", names)
+		}
+		if b, err := os.ReadFile(filepath.Join(dest, "dir/nested.txt")); err != nil || string(b) != "nested\n" {
+			t.Errorf("unexpected dir/nested.txt: %v", err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if err := sfs.Extract(t.TempDir(), []string{"missing"}, ExtractOptions{}); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("unexpected error for a missing file: %v", err)
+		}
+		if err := sfs.Extract(t.TempDir(), []string{"link/foo"}, ExtractOptions{}); err == nil {
+			t.Errorf("unexpected success through a symbolic link")
+		}
+	})
+}
+
+func TestWriteTar(t *testing.T) {
+	sfs := openTest(t, testImage)
+
+	var buf bytes.Buffer
+	if err := sfs.WriteTar(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	hdrs := make(map[string]*tar.Header)
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdrs[hdr.Name] = hdr
+		contents[hdr.Name] = b
+	}
+
+	tests := []struct {
+		name     string
+		typeflag byte
+		mode     int64
+		uid      int
+		linkname string
+		content  string
+	}{
+		{name: "abslink", typeflag: tar.TypeSymlink, mode: 0o777, linkname: "/dir/nested.txt"},
+		{name: "dir/", typeflag: tar.TypeDir, mode: 0o750},
+		{name: "dir/nested.txt", typeflag: tar.TypeReg, mode: 0o600, content: "nested\n"},
+		{name: "fifo", typeflag: tar.TypeFifo, mode: 0o644},
+		{name: "file.txt", typeflag: tar.TypeReg, mode: 0o644, uid: 1000, content: "Hello squashfs\n"},
+		{name: "hardlink.txt", typeflag: tar.TypeLink, mode: 0o644, uid: 1000, linkname: "file.txt"},
+		{name: "link", typeflag: tar.TypeSymlink, mode: 0o777, linkname: "file.txt"},
+		{name: "setuid", typeflag: tar.TypeReg, mode: 0o4755},
+	}
+	for _, tt := range tests {
+		hdr, ok := hdrs[tt.name]
+		if !ok {
+			t.Errorf("%s not found in archive", tt.name)
+			continue
+		}
+		if hdr.Typeflag != tt.typeflag || hdr.Mode != tt.mode || hdr.Uid != tt.uid || hdr.Gid != tt.uid || hdr.Linkname != tt.linkname {
+			t.Errorf("unexpected %s header: %+v", tt.name, hdr)
+		}
+		if !hdr.ModTime.Equal(testMtime) {
+			t.Errorf("unexpected %s modification time %s", tt.name, hdr.ModTime)
+		}
+		if string(contents[tt.name]) != tt.content {
+			t.Errorf("unexpected %s content %q", tt.name, contents[tt.name])
+		}
+	}
+	// the second block of big.bin is stored uncompressed, only its size is
+	// checked
+	if len(contents["big.bin"]) != len(bigContent()) {
+		t.Errorf("unexpected big.bin size %d", len(contents["big.bin"]))
+	}
+	if len(hdrs) != len(tests)+1 {
+		t.Errorf("got %d files in archive, expected %d", len(hdrs), len(tests)+1)
+	}
+}
+
+func TestDecompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("squashfs block "), 500)
+
+	var zlibData, xzData bytes.Buffer
+	zw := zlib.NewWriter(&zlibData)
+	zw.Write(data)
+	zw.Close()
+	xw, err := xz.NewWriter(&xzData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xw.Write(data)
+	xw.Close()
+	lz4Data := make([]byte, lz4.CompressBlockBound(len(data)))
+	n, err := lz4.CompressBlock(data, lz4Data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstdData := enc.EncodeAll(data, nil)
+	enc.Close()
+
+	tests := []struct {
+		name        string
+		compression uint16
+		src         []byte
+	}{
+		{name: "zlib", compression: compressionZlib, src: zlibData.Bytes()},
+		{name: "xz", compression: compressionXz, src: xzData.Bytes()},
+		{name: "lz4", compression: compressionLz4, src: lz4Data[:n]},
+		{name: "zstd", compression: compressionZstd, src: zstdData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decompress, err := newDecompressor(tt.compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := decompress(tt.src, 8192)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, data) {
+				t.Errorf("unexpected decompressed data")
+			}
+			// blocks can't be larger than the block size
+			if _, err := decompress(tt.src, 4096); err == nil {
+				t.Errorf("unexpected success with a too large block")
+			}
+		})
+	}
+}
+
+func TestXattrs(t *testing.T) {
+	// testdata/xattr.sqfs has an opaque directory with the
+	// trusted.overlay.opaque xattr, a whiteout character device and
+	// a symbolic link and a file with an inline and an out of line
+	// xattr value
+	sfs := openTest(t, "testdata/xattr.sqfs")
+
+	tests := []struct {
+		name string
+		want map[string]string
+	}{
+		{name: "opaque", want: map[string]string{"trusted.overlay.opaque": "y"}},
+		{name: "opaque/file", want: map[string]string{"user.comment": "hello", "user.dup": "y"}},
+		{name: "link", want: map[string]string{"user.comment": "hello", "user.dup": "y"}},
+		{name: "wh", want: map[string]string{}},
+		{name: ".", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		xattrs, err := sfs.Xattrs(tt.name)
+		if err != nil {
+			t.Errorf("while reading %s xattrs: %s", tt.name, err)
+			continue
+		}
+		got := make(map[string]string)
+		for k, v := range xattrs {
+			got[k] = string(v)
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("unexpected %s xattrs %v", tt.name, got)
+		}
+	}
+
+	if b, err := sfs.ReadFile("link"); err != nil || string(b) != "x\n" {
+		t.Errorf("unexpected link content %q: %v", b, err)
+	}
+	fi, err := sfs.Lstat("wh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Type() != fs.ModeDevice|fs.ModeCharDevice || fi.Sys().(*Stat).Rdev != 0 {
+		t.Errorf("unexpected whiteout %s", fi.Mode())
+	}
+	if _, err := sfs.Xattrs("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unexpected error for a missing file: %v", err)
+	}
+}
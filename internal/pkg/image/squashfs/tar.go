@@ -0,0 +1,141 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+type tarWriter struct {
+	f  *FS
+	tw *tar.Writer
+	// links holds the archived name of inodes with several links
+	links map[uint32]string
+	// parents holds the directory inodes being archived
+	parents map[uint64]bool
+}
+
+// WriteTar writes the whole filesystem to w as a tar archive. Unlike an
+// extraction, the archive holds the ownership, device files and extended
+// attributes recorded in the filesystem without requiring privileges. Names
+// are relative to the filesystem root, which isn't archived.
+func (f *FS) WriteTar(w io.Writer) error {
+	t := &tarWriter{
+		f:       f,
+		tw:      tar.NewWriter(w),
+		links:   make(map[uint32]string),
+		parents: make(map[uint64]bool),
+	}
+	if err := t.writeDir(".", f.root); err != nil {
+		return err
+	}
+	return t.tw.Close()
+}
+
+// write archives the file name, with the inode ino.
+func (t *tarWriter) write(name string, ino *inode) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(ino.perm & 0o7777),
+		Uid:     int(ino.uid),
+		Gid:     int(ino.gid),
+		ModTime: time.Unix(int64(ino.mtime), 0),
+	}
+
+	xattrs, err := t.f.readXattrs(ino)
+	if err != nil {
+		return fmt.Errorf("while reading extended attributes of %s: %w", name, err)
+	}
+	for k, v := range xattrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords["SCHILY.xattr."+k] = string(v)
+	}
+
+	if ino.nlink > 1 && !ino.isDir() {
+		if link, ok := t.links[ino.number]; ok {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = link
+			hdr.PAXRecords = nil
+			return t.tw.WriteHeader(hdr)
+		}
+		t.links[ino.number] = name
+	}
+
+	switch ino.typ {
+	case typeDir:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case typeFile:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(ino.size)
+	case typeSymlink:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = ino.target
+	case typeBlockDev, typeCharDev:
+		hdr.Typeflag = tar.TypeBlock
+		if ino.typ == typeCharDev {
+			hdr.Typeflag = tar.TypeChar
+		}
+		dev := decodeDev(ino.rdev)
+		hdr.Devmajor = int64(unix.Major(dev))
+		hdr.Devminor = int64(unix.Minor(dev))
+	case typeFifo:
+		hdr.Typeflag = tar.TypeFifo
+	case typeSocket:
+		sylog.Debugf("Skipping socket file %s", name)
+		return nil
+	}
+
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("while writing %s: %w", name, err)
+	}
+	switch ino.typ {
+	case typeDir:
+		return t.writeDir(name, ino)
+	case typeFile:
+		in := &file{f: t.f, info: &fileInfo{name: path.Base(name), ino: ino}}
+		if _, err := io.Copy(t.tw, in); err != nil {
+			return fmt.Errorf("while writing %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// writeDir archives the content of the directory name.
+func (t *tarWriter) writeDir(name string, ino *inode) error {
+	if t.parents[ino.ref] {
+		return fmt.Errorf("%w: directory loop at %s", errCorrupted, name)
+	}
+	t.parents[ino.ref] = true
+	defer delete(t.parents, ino.ref)
+
+	entries, err := t.f.readDir(ino)
+	if err != nil {
+		return fmt.Errorf("while reading directory %s: %w", name, err)
+	}
+	for _, entry := range entries {
+		child, err := t.f.readInode(entry.ref)
+		if err != nil {
+			return fmt.Errorf("while reading %s: %w", path.Join(name, entry.name), err)
+		}
+		if err := t.write(path.Join(name, entry.name), child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+const (
+	// xattrValueOutOfLine is set in the type of xattr entries whose value
+	// is a reference to a value stored elsewhere in the xattr table
+	xattrValueOutOfLine = 0x100
+	// maxXattrSize is the maximum size of an xattr name or value
+	maxXattrSize = 65536
+)
+
+// xattrPrefixes holds the name prefixes by xattr entry type.
+var xattrPrefixes = []string{"user.", "trusted.", "security."}
+
+// xattrID is an entry of the xattr id table, it references the list of
+// extended attributes of inodes.
+type xattrID struct {
+	Ref   uint64
+	Count uint32
+	Size  uint32
+}
+
+// readXattrIDTable reads the xattr id table once, the position of the
+// xattr table being stored in the table header.
+func (f *FS) readXattrIDTable() ([]xattrID, uint64, error) {
+	f.xattrOnce.Do(func() {
+		if f.sb.XattrTable == noTable {
+			return
+		}
+		var h struct {
+			Start  uint64
+			Count  uint32
+			Unused uint32
+		}
+		b := make([]byte, 16)
+		if _, err := f.r.ReadAt(b, int64(f.sb.XattrTable)); err != nil {
+			f.xattrErr = fmt.Errorf("while reading xattr id table header: %w", err)
+			return
+		}
+		if _, err := binary.Decode(b, binary.LittleEndian, &h); err != nil {
+			f.xattrErr = err
+			return
+		}
+		if uint64(h.Count) > f.sb.BytesUsed {
+			f.xattrErr = fmt.Errorf("%w: invalid xattr id count %d", errCorrupted, h.Count)
+			return
+		}
+		data, err := f.readTable(f.sb.XattrTable+16, int(h.Count), 16)
+		if err != nil {
+			f.xattrErr = fmt.Errorf("while reading xattr id table: %w", err)
+			return
+		}
+		ids := make([]xattrID, h.Count)
+		if _, err := binary.Decode(data, binary.LittleEndian, ids); err != nil {
+			f.xattrErr = err
+			return
+		}
+		f.xattrIDs, f.xattrStart = ids, h.Start
+	})
+	return f.xattrIDs, f.xattrStart, f.xattrErr
+}
+
+// readXattrs returns the extended attributes of an inode.
+func (f *FS) readXattrs(ino *inode) (map[string][]byte, error) {
+	if ino.xattr == noXattr {
+		return nil, nil
+	}
+	ids, start, err := f.readXattrIDTable()
+	if err != nil {
+		return nil, err
+	}
+	if int(ino.xattr) >= len(ids) {
+		return nil, fmt.Errorf("%w: invalid xattr index %d", errCorrupted, ino.xattr)
+	}
+	id := ids[ino.xattr]
+
+	mr, err := f.newMetadataReader(start, id.Ref)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for range id.Count {
+		var h struct {
+			Type uint16
+			Size uint16
+		}
+		if err := binary.Read(mr, binary.LittleEndian, &h); err != nil {
+			return nil, fmt.Errorf("while reading xattr entry: %w", err)
+		}
+		prefix := int(h.Type &^ xattrValueOutOfLine)
+		if prefix >= len(xattrPrefixes) {
+			return nil, fmt.Errorf("%w: invalid xattr type %d", errCorrupted, h.Type)
+		}
+		name := make([]byte, h.Size)
+		if _, err := io.ReadFull(mr, name); err != nil {
+			return nil, fmt.Errorf("while reading xattr name: %w", err)
+		}
+
+		r := io.Reader(mr)
+		if h.Type&xattrValueOutOfLine != 0 {
+			var ref struct {
+				Size uint32
+				Ref  uint64
+			}
+			if err := binary.Read(mr, binary.LittleEndian, &ref); err != nil {
+				return nil, fmt.Errorf("while reading xattr value reference: %w", err)
+			}
+			if r, err = f.newMetadataReader(start, ref.Ref); err != nil {
+				return nil, err
+			}
+		}
+		value, err := readXattrValue(r)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[xattrPrefixes[prefix]+string(name)] = value
+	}
+	return xattrs, nil
+}
+
+func readXattrValue(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("while reading xattr value: %w", err)
+	}
+	if size > maxXattrSize {
+		return nil, fmt.Errorf("%w: invalid xattr value size %d", errCorrupted, size)
+	}
+	value := make([]byte, size)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, fmt.Errorf("while reading xattr value: %w", err)
+	}
+	return value, nil
+}
+
+// Xattrs returns the extended attributes of the named file, without
+// following a symbolic link in its last element.
+func (f *FS) Xattrs(name string) (map[string][]byte, error) {
+	ino, err := f.lookup("xattrs", name, false)
+	if err != nil {
+		return nil, err
+	}
+	xattrs, err := f.readXattrs(ino)
+	if err != nil {
+		return nil, &fs.PathError{Op: "xattrs", Path: name, Err: err}
+	}
+	return xattrs, nil
+}
@@ -17,6 +17,7 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"github.com/apptainer/apptainer/internal/pkg/image/squashfs"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
@@ -69,14 +70,16 @@ func NewSquashfs() *Squashfs {
 	return s
 }
 
-// HasUnsquashfs returns if unsquashfs binary has been found or not
+// HasUnsquashfs returns if unsquashfs binary has been found or not, the
+// squashfs data is extracted in process without it
 func (s *Squashfs) HasUnsquashfs() bool {
 	return s.UnsquashfsPath != ""
 }
 
 func (s *Squashfs) extract(files []string, reader io.Reader, dest string) (err error) {
 	if !s.HasUnsquashfs() {
-		return fmt.Errorf("%w: could not extract squashfs data, unsquashfs not found", os.ErrNotExist)
+		sylog.Debugf("unsquashfs not found, extracting squashfs data in process")
+		return extractInProcess(files, reader, dest)
 	}
 
 	// pipe over stdin by default
@@ -181,6 +184,65 @@ func (s *Squashfs) extract(files []string, reader io.Reader, dest string) (err e
 	return nil
 }
 
+// extractInProcess extracts squashfs data with the in-process squashfs
+// reader, with the same restrictions as unsquashfs for non root users.
+func extractInProcess(files []string, reader io.Reader, dest string) error {
+	hostuid, err := namespaces.HostUID()
+	if err != nil {
+		return fmt.Errorf("could not get host UID: %s", err)
+	}
+	rootless := hostuid != 0
+
+	ra, ok := reader.(io.ReaderAt)
+	if !ok {
+		// use the destination parent directory to store the
+		// temporary archive
+		tmp, err := os.CreateTemp(filepath.Dir(dest), "archive-")
+		if err != nil {
+			return fmt.Errorf("failed to create staging file: %s", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(tmp, reader); err != nil {
+			return fmt.Errorf("failed to copy content in staging file: %s", err)
+		}
+		ra = tmp
+	}
+
+	sfs, err := squashfs.New(ra)
+	if err != nil {
+		return fmt.Errorf("could not read squashfs data: %w", err)
+	}
+
+	opts := squashfs.ExtractOptions{
+		Owner:   !rootless,
+		Devices: !rootless,
+	}
+	// non real root users could not create pseudo devices, exclude
+	// the dev directory from a root filesystem extraction (#5690)
+	excludeDev := rootless && len(files) == 0
+	if excludeDev {
+		sylog.Debugf("Excluding /dev directory during root filesystem extraction (non root user)")
+		opts.Exclude = func(name string) bool {
+			return name == "dev"
+		}
+	}
+
+	if err := sfs.Extract(dest, files, opts); err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+
+	if excludeDev {
+		// create $rootfs/dev as it has been excluded
+		rootfsDev := filepath.Join(dest, "dev")
+		if err := os.Mkdir(rootfsDev, 0o755); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("could not create %s: %s", rootfsDev, err)
+		}
+	}
+	return nil
+}
+
 // ExtractAll extracts a squashfs filesystem read from reader to a
 // destination directory.
 func (s *Squashfs) ExtractAll(reader io.Reader, dest string) error {
@@ -71,10 +71,10 @@ func testSquashfs(t *testing.T, tmpParent string) {
 
 	savedPath := s.UnsquashfsPath
 
-	// test with an empty unsquashfs path
+	// test with an empty unsquashfs path, data are extracted in process
 	s.UnsquashfsPath = ""
-	if err := s.ExtractAll(archive, dir); err == nil {
-		t.Errorf("unexpected success with empty unsquashfs path")
+	if err := s.ExtractAll(archive, t.TempDir()); err != nil {
+		t.Errorf("unexpected error with empty unsquashfs path: %s", err)
 	}
 	// test with a bad unsquashfs path
 	s.UnsquashfsPath = "/unsquashfs-no-exists"
@@ -124,6 +124,38 @@ func testSquashfs(t *testing.T, tmpParent string) {
 	}
 }
 
+func TestSquashfsInProcess(t *testing.T) {
+	s := &Squashfs{}
+
+	archive, err := os.Open("../../../../pkg/image/testdata/squashfs.v4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	dir := t.TempDir()
+	if err := s.ExtractAll(archive, dir); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "examplefile")
+	if b, err := os.ReadFile(path); err != nil || string(b) != "Example File Contents\n" {
+		t.Errorf("extraction failed, unexpected %s: %v", path, err)
+	}
+
+	// reader without random access
+	dir = t.TempDir()
+	if err := s.ExtractFiles([]string{"examplefile"}, bufio.NewReader(archive), dir); err != nil {
+		t.Fatal(err)
+	}
+	if !isExist(filepath.Join(dir, "examplefile")) {
+		t.Errorf("file extraction failed, %s is missing", path)
+	}
+
+	if err := s.ExtractFiles([]string{"missing"}, archive, t.TempDir()); err == nil {
+		t.Errorf("unexpected success with a missing file")
+	}
+}
+
 func TestMain(m *testing.M) {
 	cmdFunc = unsquashfsCmd
 	os.Exit(m.Run())
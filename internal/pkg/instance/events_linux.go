@@ -0,0 +1,198 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Actions of lifecycle events.
+const (
+	// EventStart is emitted once the container process started.
+	EventStart = "start"
+	// EventExit is emitted once the container exited.
+	EventExit = "exit"
+	// EventOOM is emitted when processes of the container were killed
+	// by the out of memory killer of its cgroup.
+	EventOOM = "oom"
+	// EventRestart is emitted when an instance process is restarted
+	// according to its restart policy.
+	EventRestart = "restart"
+	// EventHealthStatus is emitted when the health of an instance changes.
+	EventHealthStatus = "health_status"
+	// EventCheckpoint is emitted once an instance is checkpointed.
+	EventCheckpoint = "checkpoint"
+)
+
+const (
+	eventLogName = "events.log"
+	// maxEventLogSize is the size from which the event log is rotated,
+	// only the last rotated file is kept
+	maxEventLogSize = 8 << 20
+)
+
+// Event is a lifecycle event of a container.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Engine is the name of the engine which ran the container.
+	Engine string `json:"engine"`
+	// ID is the name of an instance or the ID of an OCI container, it's
+	// empty for containers not run as instance.
+	ID         string            `json:"id,omitempty"`
+	Pid        int               `json:"pid,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ExitAttributes returns the attributes of an exit event for a container
+// process which exited with status.
+func ExitAttributes(status syscall.WaitStatus) map[string]string {
+	if status.Signaled() {
+		return map[string]string{
+			"exitCode": strconv.Itoa(128 + int(status.Signal())),
+			"signal":   unix.SignalName(status.Signal()),
+		}
+	}
+	return map[string]string{
+		"exitCode": strconv.Itoa(status.ExitStatus()),
+	}
+}
+
+// GetEventLogPaths returns the path of the event log of the current user
+// and of its rotated file, in chronological order.
+func GetEventLogPaths() ([]string, error) {
+	path, err := getPath("", EventSubDir)
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.Join(path, eventLogName)
+	return []string{path + ".1", path}, nil
+}
+
+// WriteEvent appends an event to the event log of the current user, its
+// time is set to the current time if not set.
+func WriteEvent(e Event) error {
+	paths, err := GetEventLogPaths()
+	if err != nil {
+		return err
+	}
+	return writeEvent(paths[1], paths[0], maxEventLogSize, e)
+}
+
+// writeEvent appends an event to the event log at path, which is first
+// rotated to rotatedPath if it would grow beyond maxSize.
+func writeEvent(path, rotatedPath string, maxSize int64, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("while creating event log directory: %w", err)
+	}
+	f, err := openEventLog(path)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fi.Size()+int64(len(data)) > maxSize {
+		err := os.Rename(path, rotatedPath)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("while rotating event log: %w", err)
+		}
+		if f, err = openEventLog(path); err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	return err
+}
+
+// openEventLog opens the event log for writing, locked to serialize the
+// writers rotating it. The log is opened again if it was rotated while
+// waiting for the lock.
+func openEventLog(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("while opening event log: %w", err)
+		}
+		if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("while locking event log: %w", err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if pi, err := os.Stat(path); err == nil && os.SameFile(fi, pi) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// EventReader reads the events of the event log, it can be called
+// repeatedly to read events appended to the log.
+type EventReader struct {
+	readers []*lineReader
+}
+
+// NewEventReader returns a reader of the event log files at paths, read in
+// order. Only the last file is read again by the following calls, the
+// others being rotated files.
+func NewEventReader(paths []string) *EventReader {
+	r := &EventReader{}
+	for _, path := range paths {
+		r.readers = append(r.readers, &lineReader{path: path})
+	}
+	return r
+}
+
+// Read returns the events written since the previous call. Lines which
+// aren't events are skipped.
+func (r *EventReader) Read() ([]Event, error) {
+	var events []Event
+	for _, lr := range r.readers {
+		lines, err := lr.read()
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			var e Event
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				continue
+			}
+			events = append(events, e)
+		}
+	}
+	r.readers = r.readers[len(r.readers)-1:]
+	return events, nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestExitAttributes(t *testing.T) {
+	tests := []struct {
+		name   string
+		status syscall.WaitStatus
+		want   map[string]string
+	}{
+		{
+			name:   "Exited",
+			status: syscall.WaitStatus(3 << 8),
+			want:   map[string]string{"exitCode": "3"},
+		},
+		{
+			name:   "Signaled",
+			status: syscall.WaitStatus(syscall.SIGKILL),
+			want:   map[string]string{"exitCode": "137", "signal": "SIGKILL"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExitAttributes(tt.status)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("got %s=%q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, eventLogName)
+	rotatedPath := path + ".1"
+
+	write := func(id string) {
+		t.Helper()
+		e := Event{Action: EventStart, Engine: "apptainer", ID: id}
+		if err := writeEvent(path, rotatedPath, 256, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(r *EventReader, want ...string) {
+		t.Helper()
+		events, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range events {
+			if e.Time.IsZero() {
+				t.Errorf("event %s has no time", e.ID)
+			}
+			got = append(got, e.ID)
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	r := NewEventReader([]string{rotatedPath, path})
+	read(r)
+
+	write("one")
+	write("two")
+	read(r, "one", "two")
+
+	// one event per line, without empty lines
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("unexpected event log content %q", data)
+	}
+	for _, l := range lines[:2] {
+		if !strings.HasPrefix(l, "{") {
+			t.Errorf("unexpected event log line %q", l)
+		}
+	}
+
+	// the third event rotates the log
+	write("three")
+	if _, err := os.Stat(rotatedPath); err != nil {
+		t.Fatalf("event log not rotated: %s", err)
+	}
+	read(r, "three")
+
+	// rotated events are read first
+	read(NewEventReader([]string{rotatedPath, path}), "one", "two", "three")
+}
@@ -30,6 +30,8 @@ const (
 	AppSubDir = "app"
 	// LogSubDir represents directory where Apptainer instance log files are stored
 	LogSubDir = "logs"
+	// EventSubDir represents directory where the event log is stored
+	EventSubDir = "events"
 )
 
 const (
@@ -42,20 +44,25 @@ const (
 
 // File represents an instance file storing instance information
 type File struct {
-	Path        string `json:"-"`
-	Pid         int    `json:"pid"`
-	PPid        int    `json:"ppid"`
-	Name        string `json:"name"`
-	User        string `json:"user"`
-	Image       string `json:"image"`
-	Config      []byte `json:"config"`
-	UserNs      bool   `json:"userns"`
-	Cgroup      bool   `json:"cgroup"`
-	IP          string `json:"ip"`
-	LogErrPath  string `json:"logErrPath"`
-	LogOutPath  string `json:"logOutPath"`
-	Checkpoint  string `json:"checkpoint"`
-	ShareNSMode bool   `json:"sharensMode"`
+	Path          string  `json:"-"`
+	Pid           int     `json:"pid"`
+	PPid          int     `json:"ppid"`
+	Name          string  `json:"name"`
+	User          string  `json:"user"`
+	Image         string  `json:"image"`
+	Config        []byte  `json:"config"`
+	UserNs        bool    `json:"userns"`
+	Cgroup        bool    `json:"cgroup"`
+	IP            string  `json:"ip"`
+	LogErrPath    string  `json:"logErrPath"`
+	LogOutPath    string  `json:"logOutPath"`
+	Checkpoint    string  `json:"checkpoint"`
+	ShareNSMode   bool    `json:"sharensMode"`
+	RestartPolicy string  `json:"restartPolicy,omitempty"`
+	RestartCount  int     `json:"restartCount,omitempty"`
+	Health        *Health `json:"health,omitempty"`
+	AttachSocket  string  `json:"attachSocket,omitempty"`
+	ControlSocket string  `json:"controlSocket,omitempty"`
 }
 
 // ProcName returns process name based on instance name
@@ -19,6 +19,8 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
 )
 
 const (
@@ -57,10 +59,17 @@ var LogFormats = map[string]LogFormatter{
 	JSONLogFormat:       jsonLogFormatter,
 }
 
+// maxRawLine is the length from which a line written to a raw writer is
+// logged in several chunks, so it doesn't exceed the scanner buffer.
+const maxRawLine = 16 * 1024
+
 // Logger defines a file logger.
 type Logger struct {
 	fm        sync.Mutex // protect file
 	file      *os.File
+	size      int64 // size of the log file
+	maxSize   int64 // size from which the log file is rotated
+	maxFiles  int   // number of rotated log files kept
 	formatter LogFormatter
 	cm        sync.Mutex // protect closers array
 	closers   []closer
@@ -84,12 +93,76 @@ func NewLogger(logPath string, formatter LogFormatter) (*Logger, error) {
 	return logger, nil
 }
 
-func (l *Logger) openFile(path string) (err error) {
+func (l *Logger) openFile(path string) error {
 	oldmask := syscall.Umask(0)
 	defer syscall.Umask(oldmask)
 
-	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o640)
-	return err
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o640)
+	if err != nil {
+		l.file = nil
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		l.file = nil
+		return err
+	}
+	l.file = f
+	l.size = fi.Size()
+	return nil
+}
+
+// SetRotation enables the rotation of the log file, once writing to it
+// would make it exceed maxSize bytes. Up to maxFiles rotated files are
+// kept, named after the log file with a .1 to .N suffix, .1 being the most
+// recent. Rotation is disabled if maxSize is zero.
+func (l *Logger) SetRotation(maxSize int64, maxFiles int) {
+	l.fm.Lock()
+	defer l.fm.Unlock()
+
+	l.maxSize = maxSize
+	l.maxFiles = maxFiles
+}
+
+// write writes data to the log file, rotating it first if required. It
+// must be called with the file lock held.
+func (l *Logger) write(data string) {
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			sylog.Warningf("Could not rotate log file: %s", err)
+			if l.file == nil {
+				return
+			}
+		}
+	}
+	n, _ := io.WriteString(l.file, data)
+	l.size += int64(n)
+}
+
+// rotate renames the log file with a .1 suffix, after shifting the suffix
+// of previously rotated files, and opens a new log file. The log file is
+// kept open on rename failure.
+func (l *Logger) rotate() error {
+	path := l.file.Name()
+
+	if l.maxFiles > 0 {
+		for i := l.maxFiles - 1; i > 0; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	l.file.Sync()
+	l.file.Close()
+	return l.openFile(path)
 }
 
 func (l *Logger) scanOutput(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -108,8 +181,46 @@ func (l *Logger) scanOutput(data []byte, atEOF bool) (advance int, token []byte,
 	return 0, nil, nil
 }
 
+// scanRaw splits data in lines, keeping their newline, or in chunks of
+// maxRawLine bytes for longer lines.
+func scanRaw(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[0 : i+1], nil
+	}
+
+	if atEOF || len(data) >= maxRawLine {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
 // NewWriter create a new pipe pair for corresponding stream.
 func (l *Logger) NewWriter(stream string, dropCRNL bool) (*io.PipeWriter, error) {
+	if dropCRNL {
+		return l.newWriter(bufio.ScanLines, func(data string) string {
+			return l.formatter(stream, data)
+		})
+	}
+	r := strings.NewReplacer("\r", "\\r", "\n", "\\n")
+	return l.newWriter(l.scanOutput, func(data string) string {
+		return l.formatter(stream, r.Replace(data))
+	})
+}
+
+// NewRawWriter create a new pipe pair whose content is written to the
+// log file as is, without formatter.
+func (l *Logger) NewRawWriter() (*io.PipeWriter, error) {
+	return l.newWriter(scanRaw, func(data string) string {
+		return data
+	})
+}
+
+func (l *Logger) newWriter(split bufio.SplitFunc, format func(string) string) (*io.PipeWriter, error) {
 	l.cm.Lock()
 	defer l.cm.Unlock()
 
@@ -118,17 +229,14 @@ func (l *Logger) NewWriter(stream string, dropCRNL bool) (*io.PipeWriter, error)
 		return nil, fmt.Errorf("logger has been closed")
 	}
 	reader, writer := io.Pipe()
-	closer := l.scan(stream, reader, writer, dropCRNL)
+	closer := l.scan(reader, writer, split, format)
 	l.closers = append(l.closers, closer)
 	return writer, nil
 }
 
-func (l *Logger) scan(stream string, pr *io.PipeReader, pw *io.PipeWriter, dropCRNL bool) closer {
-	r := strings.NewReplacer("\r", "\\r", "\n", "\\n")
+func (l *Logger) scan(pr *io.PipeReader, pw *io.PipeWriter, split bufio.SplitFunc, format func(string) string) closer {
 	scanner := bufio.NewScanner(pr)
-	if !dropCRNL {
-		scanner.Split(l.scanOutput)
-	}
+	scanner.Split(split)
 
 	wg := new(sync.WaitGroup)
 
@@ -144,11 +252,7 @@ func (l *Logger) scan(stream string, pr *io.PipeReader, pw *io.PipeWriter, dropC
 				l.fm.Unlock()
 				break
 			}
-			if !dropCRNL {
-				fmt.Fprint(l.file, l.formatter(stream, r.Replace(scanner.Text())))
-			} else {
-				fmt.Fprint(l.file, l.formatter(stream, scanner.Text()))
-			}
+			l.write(format(scanner.Text()))
 			l.fm.Unlock()
 		}
 		pr.Close()
@@ -118,3 +118,38 @@ func TestLogger(t *testing.T) {
 		}
 	}
 }
+
+func TestLoggerRotation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "log")
+
+	logger, err := NewLogger(filename, nil)
+	if err != nil {
+		t.Fatalf("failed to create new logger: %s", err)
+	}
+	logger.SetRotation(10, 2)
+
+	writer, err := logger.NewRawWriter()
+	if err != nil {
+		t.Fatalf("failed to add new writer: %s", err)
+	}
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4"} {
+		writer.Write([]byte(line))
+	}
+	logger.Close()
+
+	for name, want := range map[string]string{
+		filename:        "line 4",
+		filename + ".1": "line 3\n",
+		filename + ".2": "line 2\n",
+	} {
+		d, err := os.ReadFile(name)
+		if err != nil {
+			t.Errorf("failed to read log data: %s", err)
+		} else if string(d) != want {
+			t.Errorf("unexpected content of %s: got %q, want %q", name, d, want)
+		}
+	}
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Errorf("unexpected rotated file %s.3", filename)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogEntry is a log line parsed back from a log file.
+type LogEntry struct {
+	// Time is the time the line was logged at, it's zero for
+	// lines written without a formatter.
+	Time time.Time
+	// Stream is the stream the line was written to, if known.
+	Stream string
+	// Log is the logged line, without trailing newline.
+	Log string
+}
+
+var logUnescaper = strings.NewReplacer("\\r", "\r", "\\n", "\n")
+
+// ParseLogEntry parses a line written with one of LogFormats, or without
+// formatter, into a log entry. The stream of lines which don't carry it is
+// set to defaultStream.
+func ParseLogEntry(line string, defaultStream string) LogEntry {
+	if e, ok := parseJSONLogEntry(line); ok {
+		return e
+	}
+
+	fields := strings.SplitN(line, " ", 4)
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil || len(fields) < 2 {
+		return LogEntry{Stream: defaultStream, Log: line}
+	}
+
+	e := LogEntry{Time: t, Stream: defaultStream}
+	switch {
+	case len(fields) == 4 && (fields[2] == "F" || fields[2] == "P"):
+		// kubernetes format
+		e.Stream = fields[1]
+		e.Log = fields[3]
+	case len(fields) >= 3 && (fields[1] == "stdout" || fields[1] == "stderr"):
+		// basic format with stream
+		e.Stream = fields[1]
+		e.Log = strings.Join(fields[2:], " ")
+	default:
+		// basic format without stream
+		e.Log = strings.Join(fields[1:], " ")
+	}
+	e.Log = strings.TrimSuffix(logUnescaper.Replace(e.Log), "\n")
+	return e
+}
+
+// parseJSONLogEntry parses a line written with the JSON log format. As the
+// formatter doesn't escape logged data, lines which aren't valid JSON are
+// parsed based on the fields position.
+func parseJSONLogEntry(line string) (LogEntry, bool) {
+	var raw struct {
+		Time   time.Time `json:"time"`
+		Stream string    `json:"stream"`
+		Log    string    `json:"log"`
+	}
+	if err := json.Unmarshal([]byte(line), &raw); err == nil {
+		return LogEntry{Time: raw.Time, Stream: raw.Stream, Log: strings.TrimSuffix(raw.Log, "\n")}, true
+	}
+
+	const (
+		timePrefix   = `{"time":"`
+		streamPrefix = `","stream":"`
+		logPrefix    = `","log":"`
+		logSuffix    = `"}`
+	)
+	if !strings.HasPrefix(line, timePrefix) || !strings.HasSuffix(line, logSuffix) {
+		return LogEntry{}, false
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(line, timePrefix), logSuffix)
+	ts, rest, ok := strings.Cut(rest, streamPrefix)
+	if !ok {
+		return LogEntry{}, false
+	}
+	stream, data, ok := strings.Cut(rest, logPrefix)
+	if !ok {
+		return LogEntry{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return LogEntry{}, false
+	}
+	return LogEntry{Time: t, Stream: stream, Log: strings.TrimSuffix(logUnescaper.Replace(data), "\n")}, true
+}
+
+// lineReader reads the lines of a file, it can be called repeatedly to
+// read lines appended to the file.
+type lineReader struct {
+	path    string
+	offset  int64
+	partial []byte
+}
+
+// read returns the complete lines written since the previous call. A
+// missing file has no lines, and a file truncated since the previous call,
+// e.g. by log rotation, is read from the start.
+func (r *lineReader) read() ([]string, error) {
+	f, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < r.offset {
+		r.offset = 0
+		r.partial = nil
+	}
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	r.offset += int64(len(data))
+
+	data = append(r.partial, data...)
+	i := bytes.LastIndexByte(data, '\n')
+	if i < 0 {
+		r.partial = data
+		return nil, nil
+	}
+	r.partial = append([]byte(nil), data[i+1:]...)
+
+	return strings.Split(string(data[:i]), "\n"), nil
+}
+
+// flush returns the last line of the file if it's not terminated by a
+// newline.
+func (r *lineReader) flush() (string, bool) {
+	if len(r.partial) == 0 {
+		return "", false
+	}
+	line := string(r.partial)
+	r.partial = nil
+	return line, true
+}
+
+// LogFileReader reads the log entries of a log file, it can be called
+// repeatedly to read entries appended to the file.
+type LogFileReader struct {
+	lineReader
+	stream string
+}
+
+// NewLogFileReader returns a reader of the log file at path, whose lines
+// are assigned to stream when they don't carry it.
+func NewLogFileReader(path, stream string) *LogFileReader {
+	return &LogFileReader{lineReader: lineReader{path: path}, stream: stream}
+}
+
+// Read returns the complete log lines written since the previous call. A
+// missing file has no entries, and a file truncated since the previous call,
+// e.g. by log rotation, is read from the start.
+func (r *LogFileReader) Read() ([]LogEntry, error) {
+	lines, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LogEntry, 0, len(lines))
+	for _, line := range lines {
+		entries = append(entries, ParseLogEntry(line, r.stream))
+	}
+	return entries, nil
+}
+
+// Flush returns the last log line of the file if it's not terminated by a
+// newline.
+func (r *LogFileReader) Flush() []LogEntry {
+	line, ok := r.flush()
+	if !ok {
+		return nil
+	}
+	return []LogEntry{ParseLogEntry(line, r.stream)}
+}
+
+// MergeLogEntries merges log entries of different files, each in order, into
+// a single list ordered by time. Entries without time are kept after the
+// entry preceding them in their file.
+func MergeLogEntries(lists ...[]LogEntry) []LogEntry {
+	var merged []LogEntry
+	for _, l := range lists {
+		merged = mergeLogEntries(merged, l)
+	}
+	return merged
+}
+
+func mergeLogEntries(a, b []LogEntry) []LogEntry {
+	merged := make([]LogEntry, 0, len(a)+len(b))
+	// time of the last entry with a time taken from each list
+	var ta, tb time.Time
+	for len(a) > 0 && len(b) > 0 {
+		if !a[0].Time.IsZero() {
+			ta = a[0].Time
+		}
+		if !b[0].Time.IsZero() {
+			tb = b[0].Time
+		}
+		if tb.Before(ta) {
+			merged = append(merged, b[0])
+			b = b[1:]
+		} else {
+			merged = append(merged, a[0])
+			a = a[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
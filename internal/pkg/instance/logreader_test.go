@@ -0,0 +1,193 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		wantStream string
+		wantLog    string
+		wantTime   bool
+	}{
+		{
+			name:       "Basic",
+			line:       strings.TrimSuffix(basicLogFormatter("stderr", "hello world"), "\n"),
+			wantStream: "stderr",
+			wantLog:    "hello world",
+			wantTime:   true,
+		},
+		{
+			name:       "BasicNoStream",
+			line:       strings.TrimSuffix(basicLogFormatter("", "hello world"), "\n"),
+			wantStream: "stdout",
+			wantLog:    "hello world",
+			wantTime:   true,
+		},
+		{
+			name:       "BasicEscaped",
+			line:       strings.TrimSuffix(basicLogFormatter("stdout", `test\r\n`), "\n"),
+			wantStream: "stdout",
+			wantLog:    "test\r",
+			wantTime:   true,
+		},
+		{
+			name:       "Kubernetes",
+			line:       strings.TrimSuffix(kubernetesLogFormatter("stderr", "hello world"), "\n"),
+			wantStream: "stderr",
+			wantLog:    "hello world",
+			wantTime:   true,
+		},
+		{
+			name:       "JSON",
+			line:       strings.TrimSuffix(jsonLogFormatter("stderr", `hello world\n`), "\n"),
+			wantStream: "stderr",
+			wantLog:    "hello world",
+			wantTime:   true,
+		},
+		{
+			name:       "JSONUnescaped",
+			line:       strings.TrimSuffix(jsonLogFormatter("stderr", `say "hello"`), "\n"),
+			wantStream: "stderr",
+			wantLog:    `say "hello"`,
+			wantTime:   true,
+		},
+		{
+			name:       "Raw",
+			line:       "hello world",
+			wantStream: "stdout",
+			wantLog:    "hello world",
+		},
+		{
+			name:       "Empty",
+			line:       "",
+			wantStream: "stdout",
+			wantLog:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := ParseLogEntry(tt.line, "stdout")
+			if e.Stream != tt.wantStream {
+				t.Errorf("got stream %q, want %q", e.Stream, tt.wantStream)
+			}
+			if e.Log != tt.wantLog {
+				t.Errorf("got log %q, want %q", e.Log, tt.wantLog)
+			}
+			if e.Time.IsZero() == tt.wantTime {
+				t.Errorf("got time %v, want time %v", e.Time, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestLogFileReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.out")
+	r := NewLogFileReader(path, "stdout")
+
+	entries, err := r.Read()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("unexpected result for missing file: %v, %v", entries, err)
+	}
+
+	write := func(flag int, data string) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(want ...string) {
+		t.Helper()
+		entries, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Log)
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	write(os.O_APPEND, "one\ntwo\nthr")
+	read("one", "two")
+	write(os.O_APPEND, "ee\n")
+	read("three")
+	read()
+
+	// truncated file is read from the start
+	write(os.O_TRUNC, "four\nfive")
+	read("four")
+	if entries := r.Flush(); len(entries) != 1 || entries[0].Log != "five" {
+		t.Errorf("unexpected flushed entries: %v", entries)
+	}
+}
+
+func TestMergeLogEntries(t *testing.T) {
+	at := func(s int) time.Time {
+		return time.Date(2024, 1, 2, 3, 4, s, 0, time.UTC)
+	}
+	stdout := []LogEntry{
+		{Time: at(1), Log: "out1"},
+		{Time: at(3), Log: "out3"},
+		{Log: "out-raw"},
+		{Time: at(5), Log: "out5"},
+	}
+	stderr := []LogEntry{
+		{Time: at(2), Log: "err2"},
+		{Time: at(4), Log: "err4"},
+	}
+	raw := []LogEntry{
+		{Log: "raw1"},
+		{Log: "raw2"},
+	}
+
+	tests := []struct {
+		name  string
+		lists [][]LogEntry
+		want  []string
+	}{
+		{
+			name:  "Timestamped",
+			lists: [][]LogEntry{stdout, stderr},
+			want:  []string{"out1", "err2", "out3", "out-raw", "err4", "out5"},
+		},
+		{
+			name:  "Raw",
+			lists: [][]LogEntry{raw, stderr},
+			want:  []string{"raw1", "raw2", "err2", "err4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range MergeLogEntries(tt.lists...) {
+				got = append(got, e.Log)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Restart policies of instance processes.
+const (
+	// RestartNo never restarts the instance process.
+	RestartNo = "no"
+	// RestartOnFailure restarts the instance process when it exits
+	// with a non-zero status or is killed by a signal.
+	RestartOnFailure = "on-failure"
+	// RestartAlways restarts the instance process whenever it exits.
+	RestartAlways = "always"
+)
+
+// Health statuses of instances running a health check.
+const (
+	// HealthStarting is the status until the first check completes.
+	HealthStarting = "starting"
+	// HealthHealthy is the status after a successful check.
+	HealthHealthy = "healthy"
+	// HealthUnhealthy is the status after too many failed checks.
+	HealthUnhealthy = "unhealthy"
+)
+
+// Health is the result of the health checks of an instance.
+type Health struct {
+	Status        string    `json:"status"`
+	FailingStreak int       `json:"failingStreak"`
+	LastCheck     time.Time `json:"lastCheck,omitempty"`
+	LastExitCode  int       `json:"lastExitCode"`
+}
+
+// SupervisorState is the state of an instance process supervised by
+// a restart policy or a health check, as reported by the instance
+// init process.
+type SupervisorState struct {
+	RestartCount int     `json:"restartCount"`
+	Health       *Health `json:"health,omitempty"`
+}
+
+// ParseRestartPolicy parses a restart policy of the form no, always or
+// on-failure[:N], and returns the policy and the maximum number of
+// restarts, where 0 means unlimited.
+func ParseRestartPolicy(s string) (string, int, error) {
+	policy, maxRestarts, hasMax := strings.Cut(s, ":")
+	switch policy {
+	case RestartNo, RestartAlways:
+		if hasMax {
+			return "", 0, fmt.Errorf("restart policy %q doesn't accept a maximum number of restarts", policy)
+		}
+		return policy, 0, nil
+	case RestartOnFailure:
+		if !hasMax {
+			return policy, 0, nil
+		}
+		n, err := strconv.Atoi(maxRestarts)
+		if err != nil || n < 0 {
+			return "", 0, fmt.Errorf("invalid maximum number of restarts %q", maxRestarts)
+		}
+		return policy, n, nil
+	}
+	return "", 0, fmt.Errorf("invalid restart policy %q, must be %s, %s[:N] or %s", s, RestartNo, RestartOnFailure, RestartAlways)
+}
+
+// ShouldRestart returns whether an instance process exiting with exitCode,
+// 128+N for a process killed by signal N, has to be restarted according to
+// policy after it was already restarted restartCount times.
+func ShouldRestart(policy string, maxRestarts, restartCount, exitCode int) bool {
+	switch policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exitCode != 0 && (maxRestarts == 0 || restartCount < maxRestarts)
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package instance
+
+import (
+	"testing"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		wantPolicy  string
+		wantMax     int
+		expectError bool
+	}{
+		{policy: "no", wantPolicy: RestartNo},
+		{policy: "always", wantPolicy: RestartAlways},
+		{policy: "on-failure", wantPolicy: RestartOnFailure},
+		{policy: "on-failure:3", wantPolicy: RestartOnFailure, wantMax: 3},
+		{policy: "on-failure:-1", expectError: true},
+		{policy: "on-failure:x", expectError: true},
+		{policy: "always:3", expectError: true},
+		{policy: "unless-stopped", expectError: true},
+		{policy: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy, maxRestarts, err := ParseRestartPolicy(tt.policy)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if policy != tt.wantPolicy || maxRestarts != tt.wantMax {
+				t.Errorf("got %s:%d, want %s:%d", policy, maxRestarts, tt.wantPolicy, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		maxRestarts  int
+		restartCount int
+		exitCode     int
+		want         bool
+	}{
+		{name: "NoPolicy", policy: "", exitCode: 1, want: false},
+		{name: "No", policy: RestartNo, exitCode: 1, want: false},
+		{name: "AlwaysSuccess", policy: RestartAlways, exitCode: 0, want: true},
+		{name: "AlwaysFailure", policy: RestartAlways, exitCode: 1, want: true},
+		{name: "OnFailureSuccess", policy: RestartOnFailure, exitCode: 0, want: false},
+		{name: "OnFailureFailure", policy: RestartOnFailure, restartCount: 10, exitCode: 1, want: true},
+		{name: "OnFailureSignaled", policy: RestartOnFailure, exitCode: 137, want: true},
+		{name: "OnFailureBelowMax", policy: RestartOnFailure, maxRestarts: 2, restartCount: 1, exitCode: 1, want: true},
+		{name: "OnFailureMax", policy: RestartOnFailure, maxRestarts: 2, restartCount: 2, exitCode: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShouldRestart(tt.policy, tt.maxRestarts, tt.restartCount, tt.exitCode); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
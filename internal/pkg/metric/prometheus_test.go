@@ -0,0 +1,56 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package metric
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	families := []Family{
+		{
+			Name: "test_bytes",
+			Help: "Test\nhelp",
+			Type: GaugeType,
+			Samples: []Sample{
+				{Labels: map[string]string{"name": "a", "image": `/tmp/"a".sif`}, Value: 1024},
+				{Labels: map[string]string{"name": "b"}, Value: 0.5},
+			},
+		},
+		{
+			Name: "test_empty",
+			Help: "No samples",
+			Type: CounterType,
+		},
+		{
+			Name:    "test_total",
+			Help:    "Total",
+			Type:    CounterType,
+			Samples: []Sample{{Value: 3}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, families); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `# HELP test_bytes Test\nhelp
+# TYPE test_bytes gauge
+test_bytes{image="/tmp/\"a\".sif",name="a"} 1024
+test_bytes{name="b"} 0.5
+# HELP test_total Total
+# TYPE test_total counter
+test_total 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -31,7 +31,8 @@ import (
 
 // cachedImage will ensure that the provided v1.Image is present in the Apptainer
 // OCI cache layout dir, and return a new v1.Image pointing to the cached copy.
-func cachedImage(ctx context.Context, imgCache *cache.Handle, srcImg ggcrv1.Image) (ggcrv1.Image, error) {
+// The source URI of the image is recorded, see offlineCachedImage.
+func cachedImage(ctx context.Context, imgCache *cache.Handle, srcImg ggcrv1.Image, source string) (ggcrv1.Image, error) {
 	if imgCache == nil || imgCache.IsDisabled() {
 		return nil, fmt.Errorf("undefined image cache")
 	}
@@ -41,20 +42,141 @@ func cachedImage(ctx context.Context, imgCache *cache.Handle, srcImg ggcrv1.Imag
 		return nil, err
 	}
 
+	if img, err := sharedCachedImage(ctx, imgCache, digest); err != nil {
+		sylog.Debugf("Image %s not available from shared cache: %v", digest, err)
+	} else if img != nil {
+		return img, nil
+	}
+
 	layoutDir, err := imgCache.GetOciCacheDir(cache.OciBlobCacheType)
 	if err != nil {
 		return nil, err
 	}
 
+	unlock, err := imgCache.LockOciCacheDir(cache.OciBlobCacheType)
+	if err != nil {
+		return nil, err
+	}
 	cachedRef := layoutDir + "@" + digest.String()
 	sylog.Debugf("Caching image to %s", cachedRef)
-	if err := OCISourceSink.WriteImage(srcImg, layoutDir, nil); err != nil {
+	err = OCISourceSink.WriteImage(srcImg, layoutDir, nil)
+	unlock()
+	if err != nil {
 		return nil, err
 	}
 
+	if err := imgCache.RecordSource(cache.OciBlobCacheType, digest.Hex, source); err != nil {
+		sylog.Debugf("Could not record source of image %s: %v", digest, err)
+	}
+	if err := updateBlobsAccess(imgCache, layoutDir, srcImg); err != nil {
+		sylog.Warningf("Could not enforce maximum cache size: %v", err)
+	}
+
 	return OCISourceSink.Image(ctx, cachedRef, nil, nil)
 }
 
+// offlineCachedImage returns the image most recently cached from the source
+// URI, or nil if there is none. It's used when the source can't be reached,
+// e.g. on hosts without network access where the cache was imported from a
+// cache archive.
+func offlineCachedImage(ctx context.Context, imgCache *cache.Handle, source string) (ggcrv1.Image, error) {
+	e, err := imgCache.FindEntryBySource(cache.OciBlobCacheType, source)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	layoutDir, err := imgCache.GetOciCacheDir(cache.OciBlobCacheType)
+	if err != nil {
+		return nil, err
+	}
+	img, err := OCISourceSink.Image(ctx, layoutDir+"@sha256:"+filepath.Base(e.Path), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateBlobsAccess(imgCache, layoutDir, img); err != nil {
+		sylog.Warningf("Could not enforce maximum cache size: %v", err)
+	}
+	return img, nil
+}
+
+// sharedCachedImage returns the image with the given digest from the shared
+// OCI cache, if configured. The manifest, config and layer blobs are verified
+// against their digest. A nil image is returned if there is no shared cache.
+func sharedCachedImage(ctx context.Context, imgCache *cache.Handle, digest ggcrv1.Hash) (ggcrv1.Image, error) {
+	sharedDir, err := imgCache.GetSharedOciCacheDir(cache.OciBlobCacheType)
+	if err != nil || sharedDir == "" {
+		return nil, err
+	}
+
+	img, err := OCISourceSink.Image(ctx, sharedDir+"@"+digest.String(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := img.ConfigName()
+	if err != nil {
+		return nil, err
+	}
+	blobs := []ggcrv1.Hash{digest, config}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, d)
+	}
+
+	for _, b := range blobs {
+		if err := imgCache.VerifySharedBlob(cache.OciBlobCacheType, b.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	sylog.Debugf("Using image %s from shared cache %s", digest, sharedDir)
+	return img, nil
+}
+
+// updateBlobsAccess records the access to the manifest, config and layer
+// blobs of img in the OCI cache, then evicts least recently used entries if
+// the cache exceeds its maximum size, while keeping the blobs of img.
+func updateBlobsAccess(imgCache *cache.Handle, layoutDir string, img ggcrv1.Image) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	config, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	blobs := []ggcrv1.Hash{digest, config}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	for _, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, d)
+	}
+
+	keep := make([]string, 0, len(blobs))
+	for _, b := range blobs {
+		if err := imgCache.UpdateAccess(cache.OciBlobCacheType, b.Hex); err != nil {
+			sylog.Debugf("Could not update access time of blob %s: %v", b, err)
+		}
+		keep = append(keep, filepath.Join(layoutDir, "blobs", b.Algorithm, b.Hex))
+	}
+
+	return imgCache.EnforceMaxSize(keep...)
+}
+
 // FetchToLayout will fetch the OCI image specified by imageRef to an OCI layout
 // and return a v1.Image referencing it. If imgCache is non-nil, and enabled,
 // the image will be fetched into Apptainer's cache - which is a multi-image
@@ -130,12 +252,22 @@ func FetchToLayout(ctx context.Context, tOpts *TransportOptions, imgCache *cache
 	srcImg, err := srcType.Image(ctx, srcRef, tOpts, rt)
 	if err != nil {
 		rt.ProgressShutdown()
+		// only a registry that can't be reached falls back to the cache,
+		// errors returned by the registry are reported
+		if srcType == RegistrySourceSink && imgCache != nil && !imgCache.IsDisabled() && progressClient.IsNetworkError(err) {
+			if img, cacheErr := offlineCachedImage(ctx, imgCache, imageURI); cacheErr != nil {
+				sylog.Debugf("Could not find cached image for %s: %v", imageURI, cacheErr)
+			} else if img != nil {
+				sylog.Warningf("Unable to fetch %s, using cached image: %v", imageURI, err)
+				return img, nil
+			}
+		}
 		return nil, err
 	}
 
 	if imgCache != nil && !imgCache.IsDisabled() {
 		// Ensure the image is cached, and return reference to the cached image.
-		cachedImg, err := cachedImage(ctx, imgCache, srcImg)
+		cachedImg, err := cachedImage(ctx, imgCache, srcImg, imageURI)
 		if err != nil {
 			rt.ProgressShutdown()
 			return nil, err
@@ -0,0 +1,117 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ociimage
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestFetchToLayoutCacheFallback(t *testing.T) {
+	t.Setenv(cache.MaxSizeEnv, "")
+
+	// mode selects the response of the registry, the image is served
+	// when empty
+	var mode atomic.Value
+	mode.Store("")
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch mode.Load().(string) {
+		case "unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "manifest":
+			if strings.Contains(r.URL.Path, "/manifests/") {
+				w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+				w.Write([]byte("{invalid"))
+				return
+			}
+			reg.ServeHTTP(w, r)
+		default:
+			reg.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	ref, err := name.ParseReference(host+"/test/image:latest", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("while pushing image: %v", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imgCache, err := cache.New(cache.Config{ParentDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	tOpts := &TransportOptions{Insecure: true, TmpDir: t.TempDir()}
+	imageURI := "docker://" + ref.String()
+
+	// populate the cache
+	if _, err := FetchToLayout(t.Context(), tOpts, imgCache, imageURI, t.TempDir()); err != nil {
+		t.Fatalf("while fetching image: %v", err)
+	}
+
+	// errors returned by the registry must not fall back to the cache
+	for _, m := range []string{"unauthorized", "forbidden", "manifest"} {
+		t.Run(m, func(t *testing.T) {
+			mode.Store(m)
+			if _, err := FetchToLayout(t.Context(), tOpts, imgCache, imageURI, t.TempDir()); err == nil {
+				t.Errorf("unexpected success with %s error", m)
+			}
+		})
+	}
+	mode.Store("")
+	t.Run("NotFound", func(t *testing.T) {
+		if err := remote.Delete(ref); err != nil {
+			t.Fatalf("while deleting image: %v", err)
+		}
+		if _, err := FetchToLayout(t.Context(), tOpts, imgCache, imageURI, t.TempDir()); err == nil {
+			t.Errorf("unexpected success with deleted image")
+		}
+	})
+
+	// an unreachable registry falls back to the cache
+	t.Run("Unreachable", func(t *testing.T) {
+		srv.Close()
+		cached, err := FetchToLayout(t.Context(), tOpts, imgCache, imageURI, t.TempDir())
+		if err != nil {
+			t.Fatalf("unexpected error with unreachable registry: %v", err)
+		}
+		got, err := cached.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != digest {
+			t.Errorf("got cached image %s, want %s", got, digest)
+		}
+	})
+}
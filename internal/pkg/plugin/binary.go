@@ -57,8 +57,9 @@ func Install(sifPath string) error {
 	}
 
 	m := &Meta{
-		Name:    manifest.Name,
-		Enabled: true,
+		Name:       manifest.Name,
+		Enabled:    true,
+		Executable: manifest.Executable,
 	}
 
 	err = m.install(img)
@@ -0,0 +1,243 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// executable is a plugin implemented by an executable speaking the JSON
+// protocol defined in pkg/plugin over stdio.
+type executable struct {
+	name string
+	path string
+	// flags holds pointers to the values of the flags injected by
+	// the plugin, by flag name
+	flags map[string]interface{}
+}
+
+// call runs the plugin executable with the given request and decodes its
+// result into result, if not nil.
+func (e *executable) call(method string, params interface{}, result interface{}) error {
+	req := pluginapi.Request{
+		Version: pluginapi.ProtocolVersion,
+		Method:  method,
+	}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("while encoding %s request: %s", method, err)
+		}
+		req.Params = raw
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("while encoding %s request: %s", method, err)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(e.path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	sylog.Debugf("Calling %s method of plugin %s", method, e.path)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("while running %s method: %s", method, err)
+	}
+
+	var resp pluginapi.Response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return fmt.Errorf("while decoding %s response: %s", method, err)
+	}
+	if resp.Version != pluginapi.ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d, expected %d", resp.Version, pluginapi.ProtocolVersion)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s method failed: %s", method, resp.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("while decoding %s result: %s", method, err)
+	}
+	return nil
+}
+
+// initExecutable calls the init method of the plugin executable at path
+// and checks it only implements supported callbacks.
+func initExecutable(path string) (*pluginapi.InitResult, error) {
+	e := &executable{path: path}
+
+	var res pluginapi.InitResult
+	if err := e.call(pluginapi.MethodInit, nil, &res); err != nil {
+		return nil, err
+	}
+	for _, name := range res.Callbacks {
+		if _, ok := executableCallbacks[name]; !ok {
+			return nil, fmt.Errorf("callback %q is not supported by executable plugins", name)
+		}
+	}
+	return &res, nil
+}
+
+// ExecutableManifest returns the manifest of the executable plugin at path,
+// as reported by its init method.
+func ExecutableManifest(path string) (pluginapi.Manifest, error) {
+	res, err := initExecutable(path)
+	if err != nil {
+		return pluginapi.Manifest{}, err
+	}
+	res.Manifest.Executable = true
+	return res.Manifest, nil
+}
+
+// executableCallbacks maps the callback methods of the protocol to the
+// functions returning the corresponding callback.
+var executableCallbacks = map[string]func(*executable) pluginapi.Callback{
+	pluginapi.MethodCommand:               (*executable).command,
+	pluginapi.MethodApptainerEngineConfig: (*executable).engineConfig,
+	pluginapi.MethodPostStartProcess:      (*executable).postStartProcess,
+}
+
+// callbacks returns the callbacks of the plugin matching names.
+func (e *executable) callbacks(names []string) ([]pluginapi.Callback, error) {
+	var cbs []pluginapi.Callback
+	for _, name := range names {
+		fn, ok := executableCallbacks[name]
+		if !ok {
+			return nil, fmt.Errorf("callback %q is not supported by executable plugins", name)
+		}
+		cbs = append(cbs, fn(e))
+	}
+	return cbs, nil
+}
+
+func (e *executable) command() pluginapi.Callback {
+	return (clicallback.Command)(func(manager *cmdline.CommandManager) {
+		var res pluginapi.CommandResult
+		if err := e.call(pluginapi.MethodCommand, nil, &res); err != nil {
+			sylog.Warningf("Plugin %s: %s", e.name, err)
+			return
+		}
+		for _, spec := range res.Flags {
+			if err := e.registerFlag(manager, spec); err != nil {
+				sylog.Warningf("Plugin %s: could not register flag %q: %s", e.name, spec.Name, err)
+			}
+		}
+	})
+}
+
+// registerFlag registers the flag described by spec for its commands.
+func (e *executable) registerFlag(manager *cmdline.CommandManager, spec pluginapi.FlagSpec) error {
+	var cmds []*cobra.Command
+	for _, name := range spec.Commands {
+		group := manager.GetCmdGroup(name)
+		if group == nil {
+			return fmt.Errorf("command %q not found", name)
+		}
+		cmds = append(cmds, group...)
+	}
+	if len(cmds) == 0 {
+		return errors.New("no command specified")
+	}
+
+	flag := &cmdline.Flag{
+		ID:        fmt.Sprintf("plugin_%s_%s", e.name, spec.Name),
+		Name:      spec.Name,
+		ShortHand: spec.ShortHand,
+		Usage:     spec.Usage,
+		EnvKeys:   spec.EnvKeys,
+	}
+	switch spec.Type {
+	case pluginapi.FlagTypeString, "":
+		flag.Value = new(string)
+		flag.DefaultValue = spec.Default
+	case pluginapi.FlagTypeBool:
+		def := false
+		if spec.Default != "" {
+			b, err := strconv.ParseBool(spec.Default)
+			if err != nil {
+				return fmt.Errorf("invalid default value: %s", err)
+			}
+			def = b
+		}
+		flag.Value = new(bool)
+		flag.DefaultValue = def
+	case pluginapi.FlagTypeStringSlice:
+		def := []string{}
+		if spec.Default != "" {
+			def = strings.Split(spec.Default, ",")
+		}
+		flag.Value = new([]string)
+		flag.DefaultValue = def
+	default:
+		return fmt.Errorf("unsupported type %q", spec.Type)
+	}
+
+	manager.RegisterFlagForCmd(flag, cmds...)
+	e.flags[spec.Name] = flag.Value
+	return nil
+}
+
+func (e *executable) engineConfig() pluginapi.Callback {
+	return (clicallback.ApptainerEngineConfig)(func(cfg *config.Common) {
+		raw, err := json.Marshal(cfg)
+		if err != nil {
+			sylog.Fatalf("Plugin %s: while encoding engine configuration: %s", e.name, err)
+		}
+		params := pluginapi.EngineConfigParams{
+			Flags:  e.flags,
+			Config: raw,
+		}
+		var res pluginapi.EngineConfigResult
+		if err := e.call(pluginapi.MethodApptainerEngineConfig, params, &res); err != nil {
+			sylog.Fatalf("Plugin %s: %s", e.name, err)
+		}
+		if len(res.Config) == 0 {
+			return
+		}
+		if err := json.Unmarshal(res.Config, cfg); err != nil {
+			sylog.Fatalf("Plugin %s: while decoding engine configuration: %s", e.name, err)
+		}
+	})
+}
+
+func (e *executable) postStartProcess() pluginapi.Callback {
+	return (apptainercallback.PostStartProcess)(func(cfg *config.Common, pid int) error {
+		raw, err := json.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("while encoding engine configuration: %s", err)
+		}
+		params := pluginapi.PostStartProcessParams{
+			Config: raw,
+			Pid:    pid,
+		}
+		if err := e.call(pluginapi.MethodPostStartProcess, params, nil); err != nil {
+			return fmt.Errorf("plugin %s: %s", e.name, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/plugin/callback"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/spf13/cobra"
+)
+
+// testPlugin answers requests according to the method found in them.
+const testPlugin = `#!/bin/sh
+req=$(cat)
+case "$req" in
+*'"method":"init"'*)
+	echo '{"version":1,"result":{"manifest":{"name":"example.com/test"},"callbacks":["cli.Command","cli.ApptainerEngineConfig","apptainer.PostStartProcess"]}}' ;;
+*'"method":"cli.Command"'*)
+	echo '{"version":1,"result":{"flags":[{"name":"test-flag","usage":"test","type":"bool","commands":["exec"]}]}}' ;;
+*'"method":"cli.ApptainerEngineConfig"'*'"test-flag":true'*)
+	echo '{"version":1,"result":{"config":{"containerID":"modified"}}}' ;;
+*'"method":"apptainer.PostStartProcess"'*'"pid":1'*)
+	echo '{"version":1,"error":"pid 1"}' ;;
+*'"method":"apptainer.PostStartProcess"'*)
+	echo '{"version":1}' ;;
+*)
+	echo '{"version":2}' ;;
+esac
+`
+
+func writeTestPlugin(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "plugin")
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecutableManifest(t *testing.T) {
+	path := writeTestPlugin(t, testPlugin)
+
+	manifest, err := ExecutableManifest(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if manifest.Name != "example.com/test" || !manifest.Executable {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+
+	unsupported := writeTestPlugin(t, `#!/bin/sh
+echo '{"version":1,"result":{"manifest":{"name":"example.com/test"},"callbacks":["apptainer.MonitorContainer"]}}'
+`)
+	if _, err := ExecutableManifest(unsupported); err == nil {
+		t.Errorf("unexpected success with unsupported callback")
+	}
+
+	badVersion := writeTestPlugin(t, `#!/bin/sh
+echo '{"version":2}'
+`)
+	if _, err := ExecutableManifest(badVersion); err == nil {
+		t.Errorf("unexpected success with unsupported protocol version")
+	}
+}
+
+func TestExecutableCallbacks(t *testing.T) {
+	e := &executable{
+		name:  "example.com/test",
+		path:  writeTestPlugin(t, testPlugin),
+		flags: make(map[string]interface{}),
+	}
+
+	names := []string{
+		callback.Name((clicallback.Command)(nil)),
+		callback.Name((clicallback.ApptainerEngineConfig)(nil)),
+		callback.Name((apptainercallback.PostStartProcess)(nil)),
+	}
+	// protocol methods must match the callback names stored in metadata
+	for i, method := range []string{pluginapi.MethodCommand, pluginapi.MethodApptainerEngineConfig, pluginapi.MethodPostStartProcess} {
+		if names[i] != method {
+			t.Fatalf("method %q doesn't match callback name %q", method, names[i])
+		}
+	}
+
+	cbs, err := e.callbacks(names)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	execCmd := &cobra.Command{Use: "exec"}
+	manager := cmdline.NewCommandManager(&cobra.Command{Use: "apptainer"})
+	manager.RegisterCmd(execCmd)
+	cbs[0].(clicallback.Command)(manager)
+	if errs := manager.GetError(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if err := execCmd.ParseFlags([]string{"--test-flag"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cfg := &config.Common{ContainerID: "original"}
+	cbs[1].(clicallback.ApptainerEngineConfig)(cfg)
+	if cfg.ContainerID != "modified" {
+		t.Errorf("engine configuration not modified: %+v", cfg)
+	}
+
+	postStart := cbs[2].(apptainercallback.PostStartProcess)
+	if err := postStart(cfg, 2); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := postStart(cfg, 1); err == nil {
+		t.Errorf("unexpected success")
+	}
+}
@@ -45,7 +45,11 @@ func LoadCallbacks(cb pluginapi.Callback) ([]pluginapi.Callback, error) {
 
 		for _, name := range meta.Callbacks {
 			if name == callbackName {
-				if err := loadCallbacks(meta.binaryName()); err != nil {
+				load := loadCallbacks
+				if meta.Executable {
+					load = loadExecutableCallbacks(meta)
+				}
+				if err := load(meta.binaryName()); err != nil {
 					// This might be destroying information by
 					// grabbing only the textual description of the
 					// error
@@ -132,6 +136,37 @@ func loadCallbacks(path string) error {
 	return nil
 }
 
+// loadExecutableCallbacks returns a function loading the callbacks of the
+// executable plugin described by meta.
+func loadExecutableCallbacks(meta *Meta) func(string) error {
+	return func(path string) error {
+		lp.Lock()
+		defer lp.Unlock()
+
+		if _, ok := lp.plugins[path]; ok {
+			return nil
+		}
+
+		e := &executable{
+			name:  meta.Name,
+			path:  path,
+			flags: make(map[string]interface{}),
+		}
+		callbacks, err := e.callbacks(meta.Callbacks)
+		if err != nil {
+			return err
+		}
+
+		lp.plugins[path] = struct{}{}
+
+		for _, c := range callbacks {
+			callback.Load(c)
+		}
+
+		return nil
+	}
+}
+
 // LoadObject loads a plugin object in memory and returns
 // the Plugin object set within the plugin.
 func LoadObject(path string) (*pluginapi.Plugin, error) {
@@ -32,6 +32,8 @@ var (
 	nameManifest = "object.manifest"
 	// nameBinary is the name of the plugin object
 	nameBinary = "object.so"
+	// nameExecutable is the name of the plugin executable
+	nameExecutable = "object.exe"
 )
 
 // Meta is an internal representation of a plugin binary
@@ -45,6 +47,9 @@ type Meta struct {
 	Enabled bool
 	// Callbacks contains callbacks name registered by the plugin.
 	Callbacks []string
+	// Executable reports whether the plugin is an executable speaking
+	// the JSON protocol over stdio rather than a Go shared object.
+	Executable bool `json:",omitempty"`
 }
 
 // loadFromJSON loads a Meta type from an io.Reader containing
@@ -113,13 +118,17 @@ func (m *Meta) install(img *image.Image) error {
 }
 
 func (m *Meta) installBinary(img *image.Image) error {
-	fh, err := os.Create(m.binaryName())
+	perm := os.FileMode(0o644)
+	if m.Executable {
+		perm = 0o755
+	}
+	fh, err := os.OpenFile(m.binaryName(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
 
-	r, err := getBinaryReader(img)
+	r, err := getBinaryReader(img, m.Executable)
 	if err != nil {
 		return err
 	}
@@ -147,6 +156,18 @@ func (m *Meta) installManifest(img *image.Image) error {
 func (m *Meta) runInstall() error {
 	binary := m.binaryName()
 
+	if m.Executable {
+		res, err := initExecutable(binary)
+		if err != nil {
+			return fmt.Errorf("while initializing plugin %s: %s", binary, err)
+		}
+		if res.Manifest.Name != m.Name {
+			return fmt.Errorf("plugin executable reports name %q instead of %q", res.Manifest.Name, m.Name)
+		}
+		m.Callbacks = res.Callbacks
+		return nil
+	}
+
 	pl, err := LoadObject(binary)
 	if err != nil {
 		return fmt.Errorf("while loading plugin %s: %s", binary, err)
@@ -275,6 +296,9 @@ func (m *Meta) manifestName() string {
 }
 
 func (m *Meta) binaryName() string {
+	if m.Executable {
+		return filepath.Join(m.path(), nameExecutable)
+	}
 	return filepath.Join(m.path(), nameBinary)
 }
 
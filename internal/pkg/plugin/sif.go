@@ -23,6 +23,9 @@ const (
 	// pluginBinaryName is the name of the plugin binary within the
 	// SIF file
 	pluginBinaryName = "plugin.so"
+	// pluginExecutableName is the name of the executable of executable
+	// plugins within the SIF file
+	pluginExecutableName = "plugin.exe"
 	// pluginManifestName is the name of the plugin manifest within
 	// the SIF file
 	pluginManifestName = "plugin.manifest"
@@ -32,7 +35,7 @@ const (
 // make up a valid plugin. A plugin sif file should have the following
 // format:
 //
-//	DESCR[0]: Sifplugin
+//	DESCR[0]: Sifplugin (plugin.so or plugin.exe for executable plugins)
 //	  - DataType: sif.DataPartition
 //	  - FSType:   sif.FsRaw
 //	  - PartType: sif.PartData
@@ -49,7 +52,7 @@ func isPluginFile(img *image.Image) bool {
 	}
 
 	// check binary object
-	if part[0].Name != pluginBinaryName {
+	if part[0].Name != pluginBinaryName && part[0].Name != pluginExecutableName {
 		return false
 	} else if part[0].AllowedUsage&image.DataUsage == 0 {
 		return false
@@ -85,7 +88,10 @@ func getManifest(img *image.Image) (pluginapi.Manifest, error) {
 	return manifest, nil
 }
 
-func getBinaryReader(img *image.Image) (io.Reader, error) {
+func getBinaryReader(img *image.Image, executable bool) (io.Reader, error) {
+	if executable {
+		return image.NewPartitionReader(img, pluginExecutableName, -1)
+	}
 	return image.NewPartitionReader(img, pluginBinaryName, -1)
 }
 
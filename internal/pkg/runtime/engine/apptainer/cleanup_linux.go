@@ -22,6 +22,7 @@ import (
 	fakerootConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/fakeroot/config"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/crypt"
+	"github.com/apptainer/apptainer/internal/pkg/util/exec"
 	"github.com/apptainer/apptainer/internal/pkg/util/priv"
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/pkg/build/types"
@@ -29,6 +30,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/capabilities"
 	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 )
 
@@ -43,7 +45,7 @@ import (
 // For better understanding of runtime flow in general refer to
 // https://github.com/opencontainers/runtime-spec/blob/master/runtime.md#lifecycle.
 // CleanupContainer is performing step 8/9 here.
-func (e *EngineOperations) CleanupContainer(ctx context.Context, _ error, _ syscall.WaitStatus) error {
+func (e *EngineOperations) CleanupContainer(ctx context.Context, _ error, status syscall.WaitStatus) error {
 	sylog.Debugf("Cleanup container")
 	if fd := e.EngineConfig.GetShareNSFd(); fd != -1 && e.EngineConfig.GetShareNSMode() {
 		br := lock.NewByteRange(fd, 0, 0)
@@ -126,6 +128,9 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, _ error, _ sysc
 		}
 	}
 
+	// the out of memory kill count is read before the cgroup is destroyed
+	e.emitExitEvent(status)
+
 	if cgroupsManager != nil {
 		if err := cgroupsManager.Destroy(); err != nil {
 			sylog.Warningf("failed to remove cgroup configuration: %v", err)
@@ -138,7 +143,16 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, _ error, _ sysc
 		}
 	}
 
+	// poststop hooks are run once the container is torn down, a failure
+	// is only reported
+	if err := runHooks(ctx, exec.HookStagePoststop, specs.StateStopped); err != nil {
+		sylog.Warningf("%s", err)
+	}
+
 	if e.EngineConfig.GetInstance() {
+		stopInstanceStateWatch()
+		stopInstanceLoggers()
+		closeInstanceConsole()
 		file, err := instance.Get(e.CommonConfig.ContainerID, instance.AppSubDir)
 		if err != nil {
 			return err
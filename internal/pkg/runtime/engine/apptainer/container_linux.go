@@ -974,6 +974,10 @@ func (c *container) mountImage(mnt *mount.Point, system *mount.System) error {
 			if features&image.Ext3Feature != 0 {
 				return c.mountImageDriver(params, system, c.rpcOps.Mount)
 			}
+		case "erofs":
+			if features&image.ErofsFeature != 0 {
+				return c.mountImageDriver(params, system, c.rpcOps.Mount)
+			}
 		}
 	}
 
@@ -1075,6 +1079,8 @@ func (c *container) addRootfsMount(system *mount.System) error {
 		mountType = "squashfs"
 	case image.EXT3:
 		mountType = "ext3"
+	case image.EROFS:
+		mountType = "erofs"
 	case image.ENCRYPTSQUASHFS:
 		mountType = "encryptfs"
 		key = c.engine.EngineConfig.GetEncryptionKey()
@@ -1225,9 +1231,13 @@ func (c *container) addOverlayMount(system *mount.System) error {
 				if err != nil {
 					return fmt.Errorf("while adding ext3 image: %s", err)
 				}
-			case image.SQUASHFS:
+			case image.SQUASHFS, image.EROFS:
+				fstype := "squashfs"
+				if overlay.Type == image.EROFS {
+					fstype = "erofs"
+				}
 				flags := uintptr(c.suidFlag | syscall.MS_NODEV | syscall.MS_RDONLY)
-				err = system.Points.AddImage(mount.PreLayerTag, src, dst, "squashfs", flags, offset, size, nil)
+				err = system.Points.AddImage(mount.PreLayerTag, src, dst, fstype, flags, offset, size, nil)
 				if err != nil {
 					return err
 				}
@@ -1393,6 +1403,9 @@ func (c *container) addImageBindMount(system *mount.System) error {
 			case image.SQUASHFS:
 				flags |= syscall.MS_RDONLY
 				fstype = "squashfs"
+			case image.EROFS:
+				flags |= syscall.MS_RDONLY
+				fstype = "erofs"
 			default:
 				return fmt.Errorf("could not use %s for image binding: not supported image format", img.Path)
 			}
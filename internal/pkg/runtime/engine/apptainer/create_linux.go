@@ -18,10 +18,12 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc/client"
 	"github.com/apptainer/apptainer/internal/pkg/util/crypt"
+	"github.com/apptainer/apptainer/internal/pkg/util/exec"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/ccoveille/go-safecast"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 )
 
@@ -74,6 +76,17 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		return fmt.Errorf("failed to initialize RPC client")
 	}
 
+	if err := e.startInstanceLoggers(); err != nil {
+		return fmt.Errorf("while starting instance loggers: %v", err)
+	}
+	if err := e.startInstanceConsole(); err != nil {
+		return fmt.Errorf("while starting instance terminal: %v", err)
+	}
+
+	if err := e.loadHooks(pid); err != nil {
+		return fmt.Errorf("while loading OCI hooks: %v", err)
+	}
+
 	if err := create(ctx, e, rpcOps, pid); err != nil {
 		if strings.Contains(err.Error(), crypt.ErrInvalidPassphrase.Error()) {
 			sylog.Debugf("%s", err)
@@ -87,5 +100,13 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		return err
 	}
 
+	// prestart and createRuntime hooks are run once the container
+	// environment is set up and before the container process starts
+	for _, stage := range []string{exec.HookStagePrestart, exec.HookStageCreateRuntime} {
+		if err := runHooks(ctx, stage, specs.StateCreating); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,69 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// containerPid is the pid of the container process reported in the
+// lifecycle events.
+var containerPid int
+
+// emitEvent writes a lifecycle event of the container to the event log of
+// the user, a failure is only reported in debug output. It's called from
+// the master process.
+func (e *EngineOperations) emitEvent(action string, attributes map[string]string) {
+	// the event log is stored in the configuration directory of the user
+	os.Setenv("APPTAINER_CONFIGDIR", e.EngineConfig.GetConfigDir())
+
+	ev := instance.Event{
+		Action:     action,
+		Engine:     e.CommonConfig.EngineName,
+		ID:         e.CommonConfig.ContainerID,
+		Pid:        containerPid,
+		Attributes: attributes,
+	}
+	if err := instance.WriteEvent(ev); err != nil {
+		sylog.Debugf("Could not write %s event: %s", action, err)
+	}
+}
+
+// emitStartEvent writes the start event of the container process.
+func (e *EngineOperations) emitStartEvent(pid int) {
+	containerPid = pid
+	e.emitEvent(instance.EventStart, map[string]string{
+		"image": e.EngineConfig.GetImage(),
+	})
+}
+
+// emitExitEvent writes the exit event of the container, preceded by an
+// out of memory event if processes of its cgroup were killed by the out
+// of memory killer. It must be called before the cgroup is destroyed.
+func (e *EngineOperations) emitExitEvent(status syscall.WaitStatus) {
+	if containerPid == 0 {
+		// the container process never started
+		return
+	}
+	if cgroupsManager != nil {
+		if count, err := cgroupsManager.OOMKillCount(); err != nil {
+			sylog.Debugf("Could not get out of memory kill count: %s", err)
+		} else if count > 0 {
+			e.emitEvent(instance.EventOOM, map[string]string{
+				"oomKillCount": strconv.FormatUint(count, 10),
+			})
+		}
+	}
+	e.emitEvent(instance.EventExit, instance.ExitAttributes(status))
+}
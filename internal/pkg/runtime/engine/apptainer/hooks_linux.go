@@ -0,0 +1,97 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/exec"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// containerHooks holds the OCI hooks matching the container, per stage,
+// and the state passed to them. It's set by loadHooks in the master process
+// and remains nil when no hooks directory is configured.
+var containerHooks *hooks
+
+type hooks struct {
+	stages map[string][]specs.Hook
+	state  specs.State
+}
+
+// loadHooks loads the hooks from the directory set by the "oci hooks path"
+// directive and keeps those matching the container with the given pid.
+func (e *EngineOperations) loadHooks(pid int) error {
+	dir := e.EngineConfig.File.OciHooksPath
+	if dir == "" {
+		return nil
+	}
+	configs, err := exec.LoadHooksDir(dir)
+	if err != nil {
+		return err
+	}
+
+	m := exec.HookMatch{
+		Annotations:   e.EngineConfig.OciConfig.Annotations,
+		Command:       hookCommand(e.EngineConfig.OciConfig.Process.Args),
+		HasBindMounts: len(e.EngineConfig.GetBindPath()) > 0,
+	}
+	h := &hooks{stages: make(map[string][]specs.Hook)}
+	for _, stage := range []string{exec.HookStagePrestart, exec.HookStageCreateRuntime, exec.HookStagePoststart, exec.HookStagePoststop} {
+		h.stages[stage] = exec.MatchingHooks(configs, stage, m)
+		sylog.Debugf("Found %d %s hook(s) for container", len(h.stages[stage]), stage)
+	}
+
+	// containers other than instances have no name, use their pid instead
+	id := e.CommonConfig.ContainerID
+	if id == "" {
+		id = strconv.Itoa(pid)
+	}
+	h.state = specs.State{
+		Version:     specs.Version,
+		ID:          id,
+		Pid:         pid,
+		Bundle:      e.EngineConfig.GetImage(),
+		Annotations: e.EngineConfig.OciConfig.Annotations,
+	}
+	containerHooks = h
+	return nil
+}
+
+// hookCommand returns the command matched against the commands of hooks,
+// the one executed by the exec action script or the action itself.
+func hookCommand(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if args[0] == "/.singularity.d/actions/exec" && len(args) > 1 {
+		return args[1]
+	}
+	return args[0]
+}
+
+// runHooks runs the hooks of the given stage in order, stopping at the
+// first failure.
+func runHooks(ctx context.Context, stage string, status specs.ContainerState) error {
+	if containerHooks == nil {
+		return nil
+	}
+	state := containerHooks.state
+	state.Status = status
+	for _, h := range containerHooks.stages[stage] {
+		sylog.Debugf("Running %s hook %s", stage, h.Path)
+		if err := exec.Hook(ctx, &h, &state); err != nil {
+			return fmt.Errorf("%s hook %s: %v", stage, h.Path, err)
+		}
+	}
+	return nil
+}
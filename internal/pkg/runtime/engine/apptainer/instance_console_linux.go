@@ -0,0 +1,258 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/ociruntime"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/copy"
+	"github.com/apptainer/apptainer/pkg/util/unix"
+	"github.com/ccoveille/go-safecast"
+	"github.com/creack/pty"
+)
+
+// instanceConsole holds the master side of the instance pseudo-terminal
+// and the clients attached to it from the master process.
+var instanceConsole struct {
+	sync.Mutex
+	master    *os.File
+	output    *copy.MultiWriter
+	tbuf      *copy.TerminalBuffer
+	listeners []net.Listener
+	clients   map[net.Conn]struct{}
+	closed    bool
+}
+
+// consoleClient is an attached client receiving the instance output, a
+// client failing to receive it is disconnected without blocking the
+// instance output.
+type consoleClient struct {
+	conn net.Conn
+}
+
+func (c *consoleClient) Write(p []byte) (int, error) {
+	if _, err := c.conn.Write(p); err != nil {
+		c.conn.Close()
+	}
+	return len(p), nil
+}
+
+// startInstanceConsole starts writing the instance output read from the
+// pseudo-terminal to the log file and to the attached clients. It's called
+// from the master process.
+func (e *EngineOperations) startInstanceConsole() error {
+	pts := e.EngineConfig.GetInstancePts()
+	if pts[0] == -1 {
+		return nil
+	}
+	syscall.Close(pts[1])
+	master := os.NewFile(uintptr(pts[0]), "instance-master-pts")
+
+	_, outPath, err := instance.GetLogFilePaths(e.CommonConfig.ContainerID, instance.LogSubDir)
+	if err != nil {
+		master.Close()
+		return fmt.Errorf("could not find log paths: %s", err)
+	}
+	logger, err := instance.NewLogger(outPath, nil)
+	if err != nil {
+		master.Close()
+		return fmt.Errorf("while opening log file %s: %s", outPath, err)
+	}
+	rotation := e.EngineConfig.GetLogRotation()
+	logger.SetRotation(rotation.MaxSize, rotation.MaxFiles)
+	w, err := logger.NewRawWriter()
+	if err != nil {
+		master.Close()
+		return err
+	}
+
+	instanceConsole.master = master
+	instanceConsole.tbuf = copy.NewTerminalBuffer()
+	instanceConsole.output = &copy.MultiWriter{}
+	instanceConsole.output.Add(w)
+	instanceConsole.output.Add(instanceConsole.tbuf)
+	instanceConsole.clients = make(map[net.Conn]struct{})
+
+	// the logger is closed along with the loggers used with log rotation
+	instanceLoggers.loggers = append(instanceLoggers.loggers, logger)
+	instanceLoggers.wg.Add(1)
+	go func() {
+		defer instanceLoggers.wg.Done()
+
+		// reading from the master side returns EIO once the instance
+		// processes closed the slave side
+		if _, err := io.Copy(instanceConsole.output, master); err != nil {
+			sylog.Debugf("Instance terminal output stopped: %s", err)
+		}
+		closeInstanceConsole()
+		master.Close()
+	}()
+	return nil
+}
+
+// listenInstanceConsole creates the attach and control sockets of the
+// instance pseudo-terminal next to the instance file and records them
+// in it. It's called from the master process.
+func (e *EngineOperations) listenInstanceConsole(file *instance.File) error {
+	if instanceConsole.master == nil {
+		return nil
+	}
+
+	attachPath := filepath.Join(filepath.Dir(file.Path), "attach.sock")
+	attach, err := unix.CreateSocket(attachPath)
+	if err != nil {
+		return fmt.Errorf("while creating attach socket: %s", err)
+	}
+	controlPath := filepath.Join(filepath.Dir(file.Path), "control.sock")
+	control, err := unix.CreateSocket(controlPath)
+	if err != nil {
+		attach.Close()
+		return fmt.Errorf("while creating control socket: %s", err)
+	}
+
+	instanceConsole.Lock()
+	defer instanceConsole.Unlock()
+
+	// the instance may already be exited
+	if instanceConsole.closed {
+		attach.Close()
+		control.Close()
+		return nil
+	}
+	instanceConsole.listeners = append(instanceConsole.listeners, attach, control)
+
+	file.AttachSocket = attachPath
+	file.ControlSocket = controlPath
+
+	go handleConsoleAttach(attach)
+	go handleConsoleControl(control)
+	return nil
+}
+
+// handleConsoleAttach accepts the clients attaching to the instance, which
+// receive the instance output starting with the current terminal line, and
+// whose input is sent to the instance.
+func handleConsoleAttach(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		client := &consoleClient{conn: c}
+		instanceConsole.Lock()
+		if instanceConsole.closed {
+			instanceConsole.Unlock()
+			c.Close()
+			return
+		}
+		instanceConsole.clients[c] = struct{}{}
+		instanceConsole.Unlock()
+
+		go func() {
+			instanceConsole.output.Add(client)
+			client.Write(instanceConsole.tbuf.Line())
+
+			io.Copy(instanceConsole.master, c)
+
+			instanceConsole.output.Del(client)
+			instanceConsole.Lock()
+			delete(instanceConsole.clients, c)
+			instanceConsole.Unlock()
+			c.Close()
+		}()
+	}
+}
+
+// handleConsoleControl accepts the control requests of the attached clients
+// to resize the instance terminal.
+func handleConsoleControl(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		ctrl := &ociruntime.Control{}
+		if err := json.NewDecoder(c).Decode(ctrl); err != nil {
+			sylog.Debugf("Could not decode instance control request: %s", err)
+		} else if ctrl.ConsoleSize != nil {
+			if err := resizeInstanceConsole(ctrl.ConsoleSize.Width, ctrl.ConsoleSize.Height); err != nil {
+				sylog.Debugf("Could not resize instance terminal: %s", err)
+			}
+		}
+		c.Close()
+	}
+}
+
+func resizeInstanceConsole(width, height uint) error {
+	cols, err := safecast.Convert[uint16](width)
+	if err != nil {
+		return fmt.Errorf("failed to convert console width to uint16: %s", err)
+	}
+	rows, err := safecast.Convert[uint16](height)
+	if err != nil {
+		return fmt.Errorf("failed to convert console height to uint16: %s", err)
+	}
+	return pty.Setsize(instanceConsole.master, &pty.Winsize{Cols: cols, Rows: rows})
+}
+
+// closeInstanceConsole stops accepting clients and disconnects the
+// attached ones.
+func closeInstanceConsole() {
+	instanceConsole.Lock()
+	defer instanceConsole.Unlock()
+
+	if instanceConsole.closed {
+		return
+	}
+	instanceConsole.closed = true
+
+	for _, l := range instanceConsole.listeners {
+		l.Close()
+	}
+	for c := range instanceConsole.clients {
+		c.Close()
+	}
+}
+
+// redirectInstanceTerminal redirects the standard streams of the instance
+// to the slave side of the pseudo-terminal. It's called from the container
+// process.
+func (e *EngineOperations) redirectInstanceTerminal() error {
+	pts := e.EngineConfig.GetInstancePts()
+	if pts[0] == -1 {
+		return nil
+	}
+
+	for _, fd := range []int{syscall.Stdin, syscall.Stdout, syscall.Stderr} {
+		if err := syscall.Dup3(pts[1], fd, 0); err != nil {
+			return fmt.Errorf("while redirecting instance to terminal: %s", err)
+		}
+	}
+	syscall.Close(pts[0])
+	syscall.Close(pts[1])
+	return nil
+}
+
+// hasInstanceTerminal returns if the instance process runs with a
+// pseudo-terminal.
+func (e *EngineOperations) hasInstanceTerminal() bool {
+	return e.EngineConfig.GetInstancePts()[0] != -1
+}
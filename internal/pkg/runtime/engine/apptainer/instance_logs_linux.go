@@ -0,0 +1,118 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// instanceLogsTimeout is the maximum time to wait for the instance output
+// to be written to the log files once the container exited, processes left
+// in background may keep the log pipes open.
+const instanceLogsTimeout = time.Second
+
+// instanceLoggers holds the loggers writing the instance output to the
+// rotated log files from the master process.
+var instanceLoggers struct {
+	loggers []*instance.Logger
+	wg      sync.WaitGroup
+}
+
+// startInstanceLoggers starts writing the instance output received through
+// the log pipes to the log files, rotated according to the configuration.
+// It's called from the master process.
+func (e *EngineOperations) startInstanceLoggers() error {
+	pipes := e.EngineConfig.GetInstanceLogPipes()
+	if pipes[0][0] == -1 {
+		return nil
+	}
+
+	errPath, outPath, err := instance.GetLogFilePaths(e.CommonConfig.ContainerID, instance.LogSubDir)
+	if err != nil {
+		return fmt.Errorf("could not find log paths: %s", err)
+	}
+	rotation := e.EngineConfig.GetLogRotation()
+
+	for i, path := range []string{outPath, errPath} {
+		unix.Close(pipes[i][1])
+		r := os.NewFile(uintptr(pipes[i][0]), "instance-log")
+
+		logger, err := instance.NewLogger(path, nil)
+		if err != nil {
+			r.Close()
+			return fmt.Errorf("while opening log file %s: %s", path, err)
+		}
+		logger.SetRotation(rotation.MaxSize, rotation.MaxFiles)
+		w, err := logger.NewRawWriter()
+		if err != nil {
+			r.Close()
+			return err
+		}
+		instanceLoggers.loggers = append(instanceLoggers.loggers, logger)
+
+		instanceLoggers.wg.Add(1)
+		go func() {
+			defer instanceLoggers.wg.Done()
+			defer r.Close()
+
+			if _, err := io.Copy(w, r); err != nil {
+				// the output is discarded to not block the instance
+				sylog.Debugf("Instance output can't be written to %s anymore: %s", path, err)
+				io.Copy(io.Discard, r)
+			}
+		}()
+	}
+	return nil
+}
+
+// stopInstanceLoggers waits for the instance output to be written to the
+// log files and closes them.
+func stopInstanceLoggers() {
+	done := make(chan struct{})
+	go func() {
+		instanceLoggers.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(instanceLogsTimeout):
+		sylog.Debugf("Timeout while waiting for instance output")
+	}
+
+	for _, logger := range instanceLoggers.loggers {
+		logger.Close()
+	}
+	instanceLoggers.loggers = nil
+}
+
+// redirectInstanceOutput redirects the standard output and error streams
+// of the instance to the log pipes. It's called from the container process.
+func (e *EngineOperations) redirectInstanceOutput() error {
+	pipes := e.EngineConfig.GetInstanceLogPipes()
+	if pipes[0][0] == -1 {
+		return nil
+	}
+
+	for i, fd := range []int{unix.Stdout, unix.Stderr} {
+		if err := unix.Dup3(pipes[i][1], fd, 0); err != nil {
+			return fmt.Errorf("while redirecting instance output: %s", err)
+		}
+		unix.Close(pipes[i][0])
+		unix.Close(pipes[i][1])
+	}
+	return nil
+}
@@ -51,6 +51,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
 	"github.com/apptainer/apptainer/pkg/util/slice"
 	"github.com/ccoveille/go-safecast"
+	"github.com/creack/pty"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 )
@@ -239,6 +240,54 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		e.EngineConfig.SetUnixSocketPair([2]int{-1, -1})
 	}
 
+	// the instance init process reports the state of the restart policy
+	// and health check to the master process which stores it in the
+	// instance file
+	if e.EngineConfig.GetInstance() && !e.EngineConfig.GetShareNSMode() && e.EngineConfig.GetSupervision().Enabled() {
+		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to create socketpair for instance state: %s", err)
+		}
+		e.EngineConfig.SetInstanceStatePair(fds)
+		starterConfig.KeepFileDescriptor(fds[0])
+		starterConfig.KeepFileDescriptor(fds[1])
+	} else {
+		e.EngineConfig.SetInstanceStatePair([2]int{-1, -1})
+	}
+
+	// with a terminal, the instance output is read from the master side
+	// of the pseudo-terminal by the master process which writes it to the
+	// log file and to the attached clients
+	terminal := e.EngineConfig.GetInstance() && !e.EngineConfig.GetShareNSMode() && e.EngineConfig.GetInstanceTerminal()
+	if terminal {
+		master, slave, err := pty.Open()
+		if err != nil {
+			return fmt.Errorf("failed to allocate pseudo-terminal for instance: %s", err)
+		}
+		pts := [2]int{int(master.Fd()), int(slave.Fd())}
+		e.EngineConfig.SetInstancePts(pts)
+		starterConfig.KeepFileDescriptor(pts[0])
+		starterConfig.KeepFileDescriptor(pts[1])
+	} else {
+		e.EngineConfig.SetInstancePts([2]int{-1, -1})
+	}
+
+	// with log rotation, the instance output is sent to the master process
+	// which writes it to the log files
+	if e.EngineConfig.GetInstance() && !e.EngineConfig.GetShareNSMode() && !terminal && e.EngineConfig.GetLogRotation().MaxSize > 0 {
+		var pipes [2][2]int
+		for i := range pipes {
+			if err := unix.Pipe2(pipes[i][:], unix.O_CLOEXEC); err != nil {
+				return fmt.Errorf("failed to create pipe for instance logs: %s", err)
+			}
+			starterConfig.KeepFileDescriptor(pipes[i][0])
+			starterConfig.KeepFileDescriptor(pipes[i][1])
+		}
+		e.EngineConfig.SetInstanceLogPipes(pipes)
+	} else {
+		e.EngineConfig.SetInstanceLogPipes([2][2]int{{-1, -1}, {-1, -1}})
+	}
+
 	// nvidia-container-cli requires additional caps in the starter bounding set.
 	// These are within the capability set for the starter process itself, *not* the capabilities
 	// that will be set on the running container process, which are defined with SetCapabilities above.
@@ -1572,6 +1621,14 @@ func (e *EngineOperations) loadImage(path string, writable bool, userNS bool, el
 		if elevated && !squashfs.SetuidMountAllowed(e.EngineConfig.File) && !hasFeature(image.SquashFeature) {
 			return nil, fmt.Errorf("configuration disallows users from mounting squashFS in setuid mode, try --userns")
 		}
+	// Bare EROFS
+	case image.EROFS:
+		if !e.EngineConfig.File.AllowContainerErofs {
+			return nil, fmt.Errorf("configuration disallows users from running EROFS containers")
+		}
+		if elevated && !e.EngineConfig.File.AllowSetuidMountErofs && !hasFeature(image.ErofsFeature) {
+			return nil, fmt.Errorf("configuration disallows users from mounting EROFS in setuid mode, try --userns")
+		}
 	// Bare EXT3
 	case image.EXT3:
 		if !e.EngineConfig.File.AllowContainerExtfs {
@@ -1587,7 +1644,11 @@ func (e *EngineOperations) loadImage(path string, writable bool, userNS bool, el
 		}
 	// SIF
 	case image.SIF:
-		if elevated && !squashfs.SetuidMountAllowed(e.EngineConfig.File) && !hasFeature(image.SquashFeature) {
+		if rootFs, err := imgObject.GetRootFsPartition(); err == nil && rootFs.Type == image.EROFS {
+			if elevated && !e.EngineConfig.File.AllowSetuidMountErofs && !hasFeature(image.ErofsFeature) {
+				return nil, fmt.Errorf("configuration disallows users from mounting SIF EROFS partition in setuid mode, try --userns")
+			}
+		} else if elevated && !squashfs.SetuidMountAllowed(e.EngineConfig.File) && !hasFeature(image.SquashFeature) {
 			return nil, fmt.Errorf("configuration disallows users from mounting SIF squashFS partition in setuid mode, try --userns")
 		}
 		// Check if SIF contains an encrypted rootfs partition.
@@ -36,6 +36,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/security"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	hookexec "github.com/apptainer/apptainer/internal/pkg/util/exec"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
 	"github.com/apptainer/apptainer/internal/pkg/util/machine"
 	"github.com/apptainer/apptainer/internal/pkg/util/shell"
@@ -74,6 +75,13 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		_ = unix.Close(fd)
 	}
 
+	if err := e.redirectInstanceOutput(); err != nil {
+		return err
+	}
+	if err := e.redirectInstanceTerminal(); err != nil {
+		return err
+	}
+
 	// Manage all signals.
 	// Queue them until they're ready to be handled below.
 	// Use a channel size of two here, since we may receive SIGURG, which is
@@ -99,7 +107,8 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		}
 	}
 
-	if e.EngineConfig.File.MountDev == "minimal" || e.EngineConfig.GetContain() {
+	// the instance terminal is kept in place of /dev/console
+	if (e.EngineConfig.File.MountDev == "minimal" || e.EngineConfig.GetContain()) && !e.hasInstanceTerminal() {
 		// If on a terminal, reopen /dev/console so /proc/self/fd/[0-2
 		//   will point to /dev/console.  This is needed so that tty and
 		//   ttyname() on el6 will return the correct answer.  Newer
@@ -209,9 +218,11 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 	args, env, err := runActionScript(e.EngineConfig)
 	if err != nil {
 		return err
-	} else if len(args) > 0 {
+	}
+
+	// Spawn and wait container process, signal handler
+	startCmd := func() error {
 	cmdexec:
-		// Spawn and wait container process, signal handler
 		cmd := exec.Command(args[0], args[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -220,6 +231,15 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		cmd.SysProcAttr = &syscall.SysProcAttr{
 			Setpgid: isInstance,
 		}
+		if isInstance && e.hasInstanceTerminal() {
+			// the instance process leads its own session with the
+			// instance terminal as controlling terminal
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				Setsid:  true,
+				Setctty: true,
+				Ctty:    syscall.Stdin,
+			}
+		}
 		if err := cmd.Start(); err != nil {
 			if e, ok := err.(*os.PathError); ok {
 				if e.Err.(syscall.Errno) == syscall.ENOEXEC && args[0] != defaultShell {
@@ -234,6 +254,21 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		go func() {
 			errChan <- cmd.Wait()
 		}()
+		return nil
+	}
+
+	// instance process restarted according to the restart
+	// policy and checked by the health check, if any
+	var sup *supervisor
+	if isInstance {
+		sup = newSupervisor(e.EngineConfig, env)
+	}
+
+	if len(args) > 0 {
+		if err := startCmd(); err != nil {
+			return err
+		}
+		sup.started(cmdPid)
 	}
 
 	// Modify argv argument and program name shown in /proc/self/comm
@@ -274,8 +309,14 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 						break
 					}
 
+					if sup.reaped(wpid, status) {
+						continue
+					}
 					if wpid == cmdPid {
-						e.stopFuseDrivers()
+						// FUSE drivers are still used by a restarted process
+						if sup == nil {
+							e.stopFuseDrivers()
+						}
 						statusChan <- status
 					}
 				}
@@ -291,6 +332,7 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 				// permissions to send signals to its childs and EINVAL would
 				// mean to update the Go runtime or the kernel to something more
 				// stable :)
+				sup.signaled(signal)
 				if (isInstance || e.EngineConfig.GetShareNSMode()) && cmdPid > 0 {
 					if err := syscall.Kill(-cmdPid, signal); err == syscall.ESRCH {
 						sylog.Debugf("No child process, exiting ...")
@@ -328,7 +370,22 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 					os.Exit(0)
 				}
 				sylog.Fatalf("command exited with unknown error: %s", err)
+			} else if sup != nil {
+				var status syscall.WaitStatus
+				if len(statusChan) > 0 {
+					status = <-statusChan
+				}
+				sup.exited(status)
 			}
+		case <-sup.restartC():
+			if err := startCmd(); err != nil {
+				sylog.Errorf("Could not restart instance process: %s", err)
+				sup.restart = nil
+			} else {
+				sup.restarted(cmdPid)
+			}
+		case <-sup.healthC():
+			sup.runHealthCheck()
 		}
 	}
 }
@@ -343,7 +400,7 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 // and thus no additional privileges can be gained.
 //
 // Here, however, apptainer engine does not escalate privileges.
-func (e *EngineOperations) PostStartProcess(_ context.Context, pid int) error {
+func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error {
 	sylog.Debugf("Post start process")
 
 	callbackType := (apptainercallback.PostStartProcess)(nil)
@@ -357,6 +414,13 @@ func (e *EngineOperations) PostStartProcess(_ context.Context, pid int) error {
 		}
 	}
 
+	// a failing poststart hook doesn't stop the container
+	if err := runHooks(ctx, hookexec.HookStagePoststart, specs.StateRunning); err != nil {
+		sylog.Warningf("%s", err)
+	}
+
+	e.emitStartEvent(pid)
+
 	if e.EngineConfig.GetInstance() {
 		os.Setenv("APPTAINER_CONFIGDIR", e.EngineConfig.GetConfigDir())
 
@@ -433,16 +497,28 @@ func (e *EngineOperations) PostStartProcess(_ context.Context, pid int) error {
 			file.Cgroup = true
 		}
 
+		if sup := e.EngineConfig.GetSupervision(); sup.Enabled() {
+			file.RestartPolicy = sup.RestartPolicy
+			if sup.HealthCmd != "" {
+				file.Health = &instance.Health{Status: instance.HealthStarting}
+			}
+		}
+
 		// grab configuration to store in instance file
 		file.Config, err = json.Marshal(e.CommonConfig)
 		if err != nil {
 			return err
 		}
 
+		if err := e.listenInstanceConsole(file); err != nil {
+			return err
+		}
+
 		err = file.Update()
 		if err != nil {
 			return err
 		}
+		e.watchInstanceState(file)
 
 		if !e.EngineConfig.GetShareNSMode() {
 			// send SIGUSR1 to the parent process in order to tell it
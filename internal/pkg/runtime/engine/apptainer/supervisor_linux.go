@@ -0,0 +1,304 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+const (
+	// minRestartDelay is the delay before the first restart of an
+	// instance process, it doubles with each restart
+	minRestartDelay = 100 * time.Millisecond
+	// maxRestartDelay is the maximum delay between two restarts
+	maxRestartDelay = time.Minute
+)
+
+// supervisor applies the restart policy and health check of an instance
+// from the instance init process, and reports their state to the master
+// process.
+type supervisor struct {
+	config apptainerConfig.SupervisionConfig
+	state  instance.SupervisorState
+	report *json.Encoder
+	env    []string
+
+	// pid of the instance process, 0 when not running
+	pid int
+	// pid of the instance process already sent SIGTERM after
+	// being reported unhealthy
+	termPid  int
+	stopping bool
+
+	restart *time.Timer
+	ticker  *time.Ticker
+	check   *exec.Cmd
+}
+
+// newSupervisor returns the supervisor of the instance process, or nil
+// if the instance has no restart policy nor health check.
+func newSupervisor(engineConfig *apptainerConfig.EngineConfig, env []string) *supervisor {
+	fds := engineConfig.GetInstanceStatePair()
+	if fds[1] == -1 || !engineConfig.GetSupervision().Enabled() {
+		return nil
+	}
+	syscall.Close(fds[0])
+
+	s := &supervisor{
+		config: engineConfig.GetSupervision(),
+		report: json.NewEncoder(os.NewFile(uintptr(fds[1]), "instance-state")),
+		env:    env,
+	}
+	if s.config.HealthCmd != "" {
+		s.state.Health = &instance.Health{Status: instance.HealthStarting}
+		s.ticker = time.NewTicker(s.config.HealthInterval)
+	}
+	return s
+}
+
+// restartC returns the channel receiving the time to restart the
+// instance process.
+func (s *supervisor) restartC() <-chan time.Time {
+	if s == nil || s.restart == nil {
+		return nil
+	}
+	return s.restart.C
+}
+
+// healthC returns the channel receiving the time to run a health check.
+func (s *supervisor) healthC() <-chan time.Time {
+	if s == nil || s.ticker == nil {
+		return nil
+	}
+	return s.ticker.C
+}
+
+// started records the pid of the started instance process.
+func (s *supervisor) started(pid int) {
+	if s != nil {
+		s.pid = pid
+	}
+}
+
+// signaled records a signal forwarded to the instance process, the
+// process isn't restarted once asked to terminate.
+func (s *supervisor) signaled(sig syscall.Signal) {
+	if s == nil {
+		return
+	}
+	switch sig {
+	case syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT:
+		s.stopping = true
+		if s.ticker != nil {
+			s.ticker.Stop()
+		}
+	}
+}
+
+// exited schedules the restart of the instance process according to
+// the restart policy.
+func (s *supervisor) exited(status syscall.WaitStatus) {
+	if s == nil {
+		return
+	}
+	s.pid = 0
+
+	code := status.ExitStatus()
+	if status.Signaled() {
+		code = 128 + int(status.Signal())
+	}
+	if s.stopping || !instance.ShouldRestart(s.config.RestartPolicy, s.config.MaxRestarts, s.state.RestartCount, code) {
+		return
+	}
+
+	delay := restartDelay(s.state.RestartCount)
+	sylog.Infof("Instance process exited with status %d, restarting in %s", code, delay)
+	s.restart = time.NewTimer(delay)
+}
+
+// restarted records the restart of the instance process.
+func (s *supervisor) restarted(pid int) {
+	s.restart = nil
+	s.pid = pid
+	s.state.RestartCount++
+	if s.state.Health != nil {
+		s.state.Health = &instance.Health{Status: instance.HealthStarting}
+	}
+	s.sendState()
+}
+
+// restartDelay returns the delay before restarting an instance process
+// already restarted count times.
+func restartDelay(count int) time.Duration {
+	if count > 16 {
+		return maxRestartDelay
+	}
+	return min(minRestartDelay<<count, maxRestartDelay)
+}
+
+// runHealthCheck starts the health check command inside the instance,
+// a command still running since the previous check is killed and
+// counted as failed.
+func (s *supervisor) runHealthCheck() {
+	if s.check != nil {
+		sylog.Debugf("Health check timed out, killing it")
+		syscall.Kill(-s.check.Process.Pid, syscall.SIGKILL)
+		return
+	}
+	if s.pid == 0 {
+		return
+	}
+
+	cmd := exec.Command(defaultShell, "-c", s.config.HealthCmd)
+	cmd.Env = s.env
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+	if err := cmd.Start(); err != nil {
+		sylog.Warningf("Could not run health check: %s", err)
+		s.healthChecked(-1)
+		return
+	}
+	s.check = cmd
+}
+
+// reaped handles the exit of a process reaped by the init process, it
+// returns true if it was the health check command.
+func (s *supervisor) reaped(pid int, status syscall.WaitStatus) bool {
+	if s == nil || s.check == nil || s.check.Process.Pid != pid {
+		return false
+	}
+	s.check.Process.Release()
+	s.check = nil
+
+	code := status.ExitStatus()
+	if status.Signaled() {
+		code = 128 + int(status.Signal())
+	}
+	s.healthChecked(code)
+	return true
+}
+
+// healthChecked updates the health of the instance with the exit code
+// of a health check. An unhealthy instance process is terminated to be
+// restarted, unless it has no restart policy.
+func (s *supervisor) healthChecked(code int) {
+	h := s.state.Health
+	h.LastCheck = time.Now()
+	h.LastExitCode = code
+	if code == 0 {
+		h.Status = instance.HealthHealthy
+		h.FailingStreak = 0
+	} else {
+		h.FailingStreak++
+		if h.FailingStreak >= s.config.HealthRetries {
+			h.Status = instance.HealthUnhealthy
+		}
+	}
+	s.sendState()
+
+	if h.Status != instance.HealthUnhealthy || s.pid == 0 || s.stopping {
+		return
+	}
+	if s.config.RestartPolicy == "" || s.config.RestartPolicy == instance.RestartNo {
+		return
+	}
+	sig := syscall.SIGTERM
+	if s.termPid == s.pid {
+		sig = syscall.SIGKILL
+	}
+	sylog.Warningf("Instance process is unhealthy, sending %s", sig)
+	syscall.Kill(-s.pid, sig)
+	s.termPid = s.pid
+}
+
+func (s *supervisor) sendState() {
+	if err := s.report.Encode(s.state); err != nil {
+		sylog.Debugf("Could not report instance state: %s", err)
+	}
+}
+
+// instanceStateWatch protects the instance file updated with the state
+// reported by the instance init process from being written once deleted.
+var instanceStateWatch struct {
+	sync.Mutex
+	stopped bool
+}
+
+// watchInstanceState updates the instance file with the state reported by
+// the instance init process, until it exits. It's called from the master
+// process.
+func (e *EngineOperations) watchInstanceState(file *instance.File) {
+	fds := e.EngineConfig.GetInstanceStatePair()
+	if fds[0] == -1 {
+		return
+	}
+	syscall.Close(fds[1])
+
+	go func() {
+		f := os.NewFile(uintptr(fds[0]), "instance-state")
+		defer f.Close()
+
+		dec := json.NewDecoder(f)
+		for {
+			var state instance.SupervisorState
+			if err := dec.Decode(&state); err != nil {
+				if err != io.EOF {
+					sylog.Debugf("Could not read instance state: %s", err)
+				}
+				return
+			}
+			e.emitStateEvents(file, state)
+
+			instanceStateWatch.Lock()
+			if !instanceStateWatch.stopped {
+				file.RestartCount = state.RestartCount
+				file.Health = state.Health
+				if err := file.Update(); err != nil {
+					sylog.Warningf("Could not update instance file: %s", err)
+				}
+			}
+			instanceStateWatch.Unlock()
+		}
+	}()
+}
+
+// emitStateEvents writes the restart and health status events of the state
+// reported by the instance init process, compared to the instance file.
+func (e *EngineOperations) emitStateEvents(file *instance.File, state instance.SupervisorState) {
+	if state.RestartCount > file.RestartCount {
+		e.emitEvent(instance.EventRestart, map[string]string{
+			"restartCount": strconv.Itoa(state.RestartCount),
+		})
+	}
+	if state.Health != nil && (file.Health == nil || file.Health.Status != state.Health.Status) {
+		e.emitEvent(instance.EventHealthStatus, map[string]string{
+			"status": state.Health.Status,
+		})
+	}
+}
+
+// stopInstanceStateWatch stops updating the instance file before its
+// deletion.
+func stopInstanceStateWatch() {
+	instanceStateWatch.Lock()
+	instanceStateWatch.stopped = true
+	instanceStateWatch.Unlock()
+}
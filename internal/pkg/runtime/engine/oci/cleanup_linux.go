@@ -13,6 +13,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"syscall"
 
 	"github.com/apptainer/apptainer/internal/pkg/instance"
@@ -39,6 +40,8 @@ func (e *EngineOperations) CleanupContainer(_ context.Context, fatal error, stat
 		}
 	}
 
+	oomKillCount := e.oomKillCount()
+
 	if e.EngineConfig.Cgroups != nil {
 		if err := e.EngineConfig.Cgroups.Destroy(); err != nil {
 			sylog.Warningf("failed to remove cgroup configuration: %v", err)
@@ -82,6 +85,15 @@ func (e *EngineOperations) CleanupContainer(_ context.Context, fatal error, stat
 	e.EngineConfig.State.ExitCode = &exitCode
 	e.EngineConfig.State.ExitDesc = desc
 
+	attributes := instance.ExitAttributes(status)
+	if fatal != nil {
+		attributes = map[string]string{
+			"exitCode": strconv.Itoa(exitCode),
+			"error":    desc,
+		}
+	}
+	e.emitExitEvent(oomKillCount, attributes)
+
 	if err := e.updateState(ociruntime.Stopped); err != nil {
 		return err
 	}
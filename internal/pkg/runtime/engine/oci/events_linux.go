@@ -0,0 +1,58 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"strconv"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// emitEvent writes a lifecycle event of the container to the event log of
+// the user, a failure is only reported in debug output. It's called from
+// the master process.
+func (e *EngineOperations) emitEvent(action string, attributes map[string]string) {
+	ev := instance.Event{
+		Action:     action,
+		Engine:     e.CommonConfig.EngineName,
+		ID:         e.CommonConfig.ContainerID,
+		Pid:        e.EngineConfig.State.Pid,
+		Attributes: attributes,
+	}
+	if err := instance.WriteEvent(ev); err != nil {
+		sylog.Debugf("Could not write %s event: %s", action, err)
+	}
+}
+
+// oomKillCount returns the number of processes of the container cgroup
+// killed by the out of memory killer. It must be called before the cgroup
+// is destroyed.
+func (e *EngineOperations) oomKillCount() uint64 {
+	if e.EngineConfig.Cgroups == nil {
+		return 0
+	}
+	count, err := e.EngineConfig.Cgroups.OOMKillCount()
+	if err != nil {
+		sylog.Debugf("Could not get out of memory kill count: %s", err)
+	}
+	return count
+}
+
+// emitExitEvent writes the exit event of the container, preceded by an
+// out of memory event if processes of its cgroup were killed by the out
+// of memory killer.
+func (e *EngineOperations) emitExitEvent(oomKillCount uint64, attributes map[string]string) {
+	if oomKillCount > 0 {
+		e.emitEvent(instance.EventOOM, map[string]string{
+			"oomKillCount": strconv.FormatUint(oomKillCount, 10),
+		})
+	}
+	e.emitEvent(instance.EventExit, attributes)
+}
@@ -268,6 +268,9 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, _ int) error {
 	if err := e.updateState(ociruntime.Running); err != nil {
 		return err
 	}
+	e.emitEvent(instance.EventStart, map[string]string{
+		"bundle": e.EngineConfig.GetBundlePath(),
+	})
 	hooks := e.EngineConfig.OciConfig.Hooks
 	if hooks != nil {
 		for _, h := range hooks.Poststart {
@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -54,6 +55,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
 	"github.com/apptainer/apptainer/pkg/util/rlimit"
 	"github.com/ccoveille/go-safecast"
+	"github.com/docker/go-units"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
 )
@@ -282,6 +284,14 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		l.engineConfig.SetHostname(l.cfg.Hostname)
 	}
 
+	// Annotations are matched against and passed to OCI hooks.
+	if len(l.cfg.Annotations) > 0 {
+		if l.generator.Config.Annotations == nil {
+			l.generator.Config.Annotations = make(map[string]string)
+		}
+		maps.Copy(l.generator.Config.Annotations, l.cfg.Annotations)
+	}
+
 	// Set requested capabilities (effective for root, or if sysadmin has permitted to another user).
 	l.engineConfig.SetAddCaps(l.cfg.AddCaps)
 	l.engineConfig.SetDropCaps(l.cfg.DropCaps)
@@ -386,6 +396,14 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		// Set sharens mode
 		l.engineConfig.SetShareNSMode(l.cfg.ShareNSMode)
 		l.engineConfig.SetShareNSFd(l.cfg.ShareNSFd)
+
+		if err := l.setSupervision(); err != nil {
+			return err
+		}
+		if err := l.setLogRotation(); err != nil {
+			return err
+		}
+		l.engineConfig.SetInstanceTerminal(l.cfg.Terminal)
 	}
 
 	// Set runscript timeout
@@ -526,6 +544,71 @@ func (l *Launcher) setTargetIDs(useSuid bool) (err error) {
 	return nil
 }
 
+// setSupervision sets the restart policy and health check of an instance.
+func (l *Launcher) setSupervision() error {
+	if l.cfg.RestartPolicy == "" && l.cfg.HealthCmd == "" {
+		return nil
+	}
+	if l.cfg.Boot {
+		return fmt.Errorf("restart policy and health check are not supported with --boot")
+	}
+
+	config := apptainerConfig.SupervisionConfig{
+		HealthCmd:      l.cfg.HealthCmd,
+		HealthInterval: l.cfg.HealthInterval,
+		HealthRetries:  l.cfg.HealthRetries,
+	}
+	if l.cfg.RestartPolicy != "" {
+		policy, maxRestarts, err := instance.ParseRestartPolicy(l.cfg.RestartPolicy)
+		if err != nil {
+			return err
+		}
+		config.RestartPolicy = policy
+		config.MaxRestarts = maxRestarts
+	}
+	if config.HealthCmd != "" {
+		if config.HealthInterval <= 0 {
+			return fmt.Errorf("health check interval must be greater than zero")
+		}
+		if config.HealthRetries < 1 {
+			return fmt.Errorf("health check retries must be at least 1")
+		}
+	}
+
+	l.engineConfig.SetSupervision(config)
+	return nil
+}
+
+// setLogRotation sets the rotation settings of the instance log files, from
+// the options or the apptainer.conf defaults.
+func (l *Launcher) setLogRotation() error {
+	size := l.cfg.LogMaxSize
+	if size == "" {
+		size = l.engineConfig.File.InstanceLogMaxSize
+	}
+	if size == "" {
+		return nil
+	}
+	maxSize, err := units.RAMInBytes(size)
+	if err != nil {
+		return fmt.Errorf("invalid log max size %q: %s", size, err)
+	}
+	if maxSize < 0 {
+		return fmt.Errorf("negative log max size %s", size)
+	}
+
+	maxFiles := l.cfg.LogMaxFiles
+	if maxFiles < 0 {
+		maxFiles = int(l.engineConfig.File.InstanceLogMaxFiles)
+	}
+
+	l.engineConfig.SetLogRotation(apptainerConfig.LogRotationConfig{
+		MaxSize:  maxSize,
+		MaxFiles: maxFiles,
+	})
+	return nil
+}
+
 // setImageOrInstance sets the image to start, or instance and it's image to be joined.
 func (l *Launcher) setImageOrInstance(image string, name string) error {
 	if strings.HasPrefix(image, "instance://") {
@@ -1186,35 +1269,29 @@ func (l *Launcher) prepareImage(_ context.Context, insideUserNs bool, image stri
 		convert := false
 		if l.cfg.Unsquash {
 			convert = true
-		} else if l.cfg.Namespaces.User || insideUserNs ||
-			!squashfs.SetuidMountAllowed(fileconf) {
-			convert = true
-			if fileconf.ImageDriver != "" {
-				// load image driver plugins
-				callbackType := (apptainercallback.RegisterImageDriver)(nil)
-				callbacks, err := plugin.LoadCallbacks(callbackType)
-				if err != nil {
-					sylog.Debugf("Loading plugins callbacks '%T' failed: %s", callbackType, err)
-				} else {
-					for _, callback := range callbacks {
-						if err := callback.(apptainercallback.RegisterImageDriver)(true); err != nil {
-							sylog.Debugf("While registering image driver: %s", err)
-						}
-					}
-				}
-				driver := imgutil.GetDriver(fileconf.ImageDriver)
-				if driver != nil && driver.Features()&imgutil.SquashFeature != 0 {
-					// the image driver indicates support for squashfs so let's
-					// proceed with the image driver without conversion
-					convert = false
+		} else if isErofsImage(image) {
+			// EROFS can't be extracted, it must be mounted either
+			// by the kernel or by the image driver
+			userNs := l.cfg.Namespaces.User || insideUserNs
+			kernelMount := !userNs && (l.uid == 0 || fileconf.AllowSetuidMountErofs)
+			if !kernelMount && !l.imageDriverHas(imgutil.ErofsFeature) {
+				if userNs {
+					return fmt.Errorf("image %s has an EROFS root filesystem which can't be mounted in a user namespace without erofsfuse", image)
 				}
+				return fmt.Errorf("image %s has an EROFS root filesystem which can't be mounted: 'allow setuid-mount erofs' is disabled and erofsfuse is not available", image)
 			}
+			sylog.Debugf("Image %s has an EROFS root filesystem, not converting it", image)
+		} else if l.cfg.Namespaces.User || insideUserNs ||
+			!squashfs.SetuidMountAllowed(fileconf) {
+			// convert unless the image driver indicates support for
+			// squashfs, then proceed with the image driver
+			convert = !l.imageDriverHas(imgutil.SquashFeature)
 		}
 
 		if convert {
 			unsquashfsPath, err := bin.FindBin("unsquashfs")
 			if err != nil {
-				sylog.Fatalf("while extracting %s: %s", image, err)
+				sylog.Debugf("unsquashfs not found, %s will be extracted in process: %s", image, err)
 			}
 			sylog.Infof("Converting SIF file to temporary sandbox...")
 			rootfsDir, imageDir, err := convertImage(image, unsquashfsPath, l.cfg.TmpDir)
@@ -1237,6 +1314,43 @@ func (l *Launcher) prepareImage(_ context.Context, insideUserNs bool, image stri
 	return nil
 }
 
+// imageDriverHas returns whether the image driver configured in
+// apptainer.conf, after loading the image driver plugins, supports
+// the desired feature.
+func (l *Launcher) imageDriverHas(feature imgutil.DriverFeature) bool {
+	name := l.engineConfig.File.ImageDriver
+	if name == "" {
+		return false
+	}
+	// load image driver plugins
+	callbackType := (apptainercallback.RegisterImageDriver)(nil)
+	callbacks, err := plugin.LoadCallbacks(callbackType)
+	if err != nil {
+		sylog.Debugf("Loading plugins callbacks '%T' failed: %s", callbackType, err)
+	} else {
+		for _, callback := range callbacks {
+			if err := callback.(apptainercallback.RegisterImageDriver)(true); err != nil {
+				sylog.Debugf("While registering image driver: %s", err)
+			}
+		}
+	}
+	driver := imgutil.GetDriver(name)
+	return driver != nil && driver.Features()&feature != 0
+}
+
+// isErofsImage returns whether the root filesystem of the image file is
+// EROFS.
+func isErofsImage(filename string) bool {
+	img, err := imgutil.Init(filename, false)
+	if err != nil {
+		return false
+	}
+	defer img.File.Close()
+
+	part, err := img.GetRootFsPartition()
+	return err == nil && part.Type == imgutil.EROFS
+}
+
 // starterInteractive executes the starter binary to run an image interactively, given the supplied engineConfig
 func (l *Launcher) starterInteractive(loadOverlay bool, useSuid bool, cfg *config.Common, imageFilename string) error {
 	err := starter.Exec(
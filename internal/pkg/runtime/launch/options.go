@@ -20,6 +20,8 @@
 package launch
 
 import (
+	"time"
+
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
 	"github.com/apptainer/apptainer/pkg/util/cryptkey"
@@ -97,6 +99,8 @@ type launchOptions struct {
 	Hostname string
 	// DNS is the comma separated list of DNS servers to be set in the container's resolv.conf.
 	DNS string
+	// Annotations are set on the container, they're passed to OCI hooks.
+	Annotations map[string]string
 
 	// AddCaps is the list of capabilities to Add to the container process.
 	AddCaps string
@@ -161,6 +165,27 @@ type launchOptions struct {
 	ShareNSFd         int    // fd opened in sharens mode
 	RunscriptTimeout  string // runscript timeout
 
+	// RestartPolicy is the restart policy of an instance process, either
+	// no, on-failure[:N] or always.
+	RestartPolicy string
+	// HealthCmd is a shell command run periodically inside an instance
+	// to check its health.
+	HealthCmd string
+	// HealthInterval is the time between two health checks.
+	HealthInterval time.Duration
+	// HealthRetries is the number of consecutive failed health checks
+	// after which an instance is unhealthy.
+	HealthRetries int
+	// LogMaxSize is the size from which instance log files are rotated,
+	// the apptainer.conf default is used if empty.
+	LogMaxSize string
+	// LogMaxFiles is the number of rotated instance log files kept, the
+	// apptainer.conf default is used if negative.
+	LogMaxFiles int
+	// Terminal allocates a pseudo-terminal for an instance process, which
+	// can be attached to.
+	Terminal bool
+
 	// Devices lists fully-qualified CDI device names to make available in the container.
 	Devices []string
 	// CdiDirs lists directories in which CDI should look for device definition JSON files.
@@ -382,6 +407,14 @@ func OptDNS(d string) Option {
 	}
 }
 
+// OptAnnotations sets annotations on the container.
+func OptAnnotations(a map[string]string) Option {
+	return func(lo *launchOptions) error {
+		lo.Annotations = a
+		return nil
+	}
+}
+
 // OptCaps sets capabilities to add and drop.
 func OptCaps(add, drop string) Option {
 	return func(lo *launchOptions) error {
@@ -623,6 +656,43 @@ func OptRunscriptTimeout(timeout string) Option {
 	}
 }
 
+// OptRestartPolicy sets the restart policy of an instance process.
+func OptRestartPolicy(policy string) Option {
+	return func(lo *launchOptions) error {
+		lo.RestartPolicy = policy
+		return nil
+	}
+}
+
+// OptHealthCheck sets the health check command of an instance, run every
+// interval, and the number of failures after which it's unhealthy.
+func OptHealthCheck(cmd string, interval time.Duration, retries int) Option {
+	return func(lo *launchOptions) error {
+		lo.HealthCmd = cmd
+		lo.HealthInterval = interval
+		lo.HealthRetries = retries
+		return nil
+	}
+}
+
+// OptLogRotation sets the size from which instance log files are rotated
+// and the number of rotated files kept.
+func OptLogRotation(maxSize string, maxFiles int) Option {
+	return func(lo *launchOptions) error {
+		lo.LogMaxSize = maxSize
+		lo.LogMaxFiles = maxFiles
+		return nil
+	}
+}
+
+// OptTerminal allocates a pseudo-terminal for an instance process.
+func OptTerminal(b bool) Option {
+	return func(lo *launchOptions) error {
+		lo.Terminal = b
+		return nil
+	}
+}
+
 // OptDevice sets the list of fully-qualified CDI device names.
 func OptDevice(devices []string) Option {
 	return func(lo *launchOptions) error {
@@ -48,19 +48,24 @@ func FindBin(name string) (path string, err error) {
 		return findOnPath("ldconfig", false)
 	// All other executables
 	// We will always search the user's PATH first for these
-	case "curl",
+	case "criu",
+		"curl",
 		"debootstrap",
 		"dnf",
+		"e2fsck",
+		"erofsfuse",
 		"fakeroot",
 		"fakeroot-sysv",
 		"fuse-overlayfs",
 		"fuse2fs",
 		"go",
+		"mkfs.erofs",
 		"mksquashfs",
 		"newgidmap",
 		"newuidmap",
 		"nvidia-container-cli",
 		"pacstrap",
+		"resize2fs",
 		"rpm",
 		"rpmkeys",
 		"squashfuse",
@@ -0,0 +1,218 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// HookConfigVersion is the version of the oci-hooks.d configuration format
+// supported by LoadHooksDir.
+const HookConfigVersion = "1.0.0"
+
+// Hook stages supported in hook configuration files.
+const (
+	HookStagePrestart      = "prestart"
+	HookStageCreateRuntime = "createRuntime"
+	HookStagePoststart     = "poststart"
+	HookStagePoststop      = "poststop"
+)
+
+var hookStages = []string{
+	HookStagePrestart,
+	HookStageCreateRuntime,
+	HookStagePoststart,
+	HookStagePoststop,
+}
+
+// HookWhen holds the conditions under which a hook is injected, the hook
+// is injected if all the conditions set are true, or any of them when Or is
+// set.
+type HookWhen struct {
+	// Always injects the hook unconditionally when true.
+	Always *bool `json:"always,omitempty"`
+	// Annotations maps regular expressions matched against the container
+	// annotation keys to regular expressions matched against their values.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Commands holds regular expressions matched against the container
+	// command.
+	Commands []string `json:"commands,omitempty"`
+	// HasBindMounts injects the hook when true and the container has user
+	// bind mounts.
+	HasBindMounts *bool `json:"hasBindMounts,omitempty"`
+	// Or injects the hook if any of the conditions is true.
+	Or bool `json:"or,omitempty"`
+
+	annotations map[*regexp.Regexp]*regexp.Regexp
+	commands    []*regexp.Regexp
+}
+
+// HookConfig is a hook configuration file in the oci-hooks.d format.
+type HookConfig struct {
+	Version string     `json:"version"`
+	Hook    specs.Hook `json:"hook"`
+	When    HookWhen   `json:"when"`
+	Stages  []string   `json:"stages"`
+}
+
+// HookMatch describes the container a hook configuration is matched
+// against.
+type HookMatch struct {
+	Annotations   map[string]string
+	Command       string
+	HasBindMounts bool
+}
+
+// validate checks the hook configuration and compiles its regular
+// expressions.
+func (c *HookConfig) validate() error {
+	if c.Version != HookConfigVersion {
+		return fmt.Errorf("unsupported version %q, must be %s", c.Version, HookConfigVersion)
+	}
+	if c.Hook.Path == "" {
+		return fmt.Errorf("missing hook path")
+	}
+	if !filepath.IsAbs(c.Hook.Path) {
+		return fmt.Errorf("hook path %s is not absolute", c.Hook.Path)
+	}
+	if len(c.Stages) == 0 {
+		return fmt.Errorf("missing hook stages")
+	}
+	for _, s := range c.Stages {
+		if !slices.Contains(hookStages, s) {
+			return fmt.Errorf("unsupported stage %q, must be one of %s", s, strings.Join(hookStages, ", "))
+		}
+	}
+
+	w := &c.When
+	if w.Always == nil && w.HasBindMounts == nil && len(w.Annotations) == 0 && len(w.Commands) == 0 {
+		return fmt.Errorf("at least one when condition is required")
+	}
+	w.annotations = make(map[*regexp.Regexp]*regexp.Regexp, len(w.Annotations))
+	for k, v := range w.Annotations {
+		kre, err := regexp.Compile(k)
+		if err != nil {
+			return fmt.Errorf("invalid annotation key expression: %v", err)
+		}
+		vre, err := regexp.Compile(v)
+		if err != nil {
+			return fmt.Errorf("invalid annotation value expression: %v", err)
+		}
+		w.annotations[kre] = vre
+	}
+	w.commands = make([]*regexp.Regexp, 0, len(w.Commands))
+	for _, cmd := range w.Commands {
+		re, err := regexp.Compile(cmd)
+		if err != nil {
+			return fmt.Errorf("invalid command expression: %v", err)
+		}
+		w.commands = append(w.commands, re)
+	}
+	return nil
+}
+
+// Match returns true if the hook must be injected into the container
+// described by m. All the annotation expressions must match an annotation of
+// the container, while any of the command expressions must match its command.
+func (c *HookConfig) Match(m HookMatch) bool {
+	w := &c.When
+	match := false
+
+	// check records the result of a condition, and returns whether it
+	// decides the match: a false condition without Or, or a true
+	// condition with Or
+	check := func(matched bool) bool {
+		match = matched
+		return matched == w.Or
+	}
+
+	if w.Always != nil && check(*w.Always) {
+		return match
+	}
+	if w.HasBindMounts != nil && check(*w.HasBindMounts && m.HasBindMounts) {
+		return match
+	}
+	for kre, vre := range w.annotations {
+		matched := false
+		for k, v := range m.Annotations {
+			if kre.MatchString(k) && vre.MatchString(v) {
+				matched = true
+				break
+			}
+		}
+		if check(matched) {
+			return match
+		}
+	}
+	if len(w.commands) > 0 {
+		matched := false
+		for _, re := range w.commands {
+			if re.MatchString(m.Command) {
+				matched = true
+				break
+			}
+		}
+		if check(matched) {
+			return match
+		}
+	}
+	return match
+}
+
+// LoadHooksDir loads the hook configuration files with a .json extension
+// from dir, in lexical order. A missing directory holds no hooks.
+func LoadHooksDir(dir string) ([]HookConfig, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading hooks directory: %v", err)
+	}
+
+	var hooks []HookConfig
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("while reading hook %s: %v", path, err)
+		}
+		var c HookConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("while decoding hook %s: %v", path, err)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("invalid hook %s: %v", path, err)
+		}
+		hooks = append(hooks, c)
+	}
+	return hooks, nil
+}
+
+// MatchingHooks returns the hooks of the given stage to inject into the
+// container described by m, in order.
+func MatchingHooks(hooks []HookConfig, stage string, m HookMatch) []specs.Hook {
+	var matching []specs.Hook
+	for i := range hooks {
+		if slices.Contains(hooks[i].Stages, stage) && hooks[i].Match(m) {
+			matching = append(matching, hooks[i].Hook)
+		}
+	}
+	return matching
+}
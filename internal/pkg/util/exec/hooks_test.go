@@ -0,0 +1,198 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHooks(t *testing.T, hooks map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range hooks {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadHooksDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    string
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			hook: `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"always": true}, "stages": ["prestart"]}`,
+		},
+		{
+			name:    "BadVersion",
+			hook:    `{"version": "2.0.0", "hook": {"path": "/bin/true"}, "when": {"always": true}, "stages": ["prestart"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "RelativePath",
+			hook:    `{"version": "1.0.0", "hook": {"path": "true"}, "when": {"always": true}, "stages": ["prestart"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "NoStages",
+			hook:    `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"always": true}}`,
+			wantErr: true,
+		},
+		{
+			name:    "UnsupportedStage",
+			hook:    `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"always": true}, "stages": ["startContainer"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "NoCondition",
+			hook:    `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {}, "stages": ["prestart"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadExpression",
+			hook:    `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"commands": ["("]}, "stages": ["prestart"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadJSON",
+			hook:    `{"version": "1.0.0",`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeHooks(t, map[string]string{"hook.json": tt.hook})
+			hooks, err := LoadHooksDir(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v (want error %v)", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(hooks) != 1 {
+				t.Errorf("got %d hooks, want 1", len(hooks))
+			}
+		})
+	}
+
+	hooks, err := LoadHooksDir(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || hooks != nil {
+		t.Errorf("unexpected result for missing directory: %v, %v", hooks, err)
+	}
+}
+
+func TestMatchingHooks(t *testing.T) {
+	dir := writeHooks(t, map[string]string{
+		"00-always.json":      `{"version": "1.0.0", "hook": {"path": "/always"}, "when": {"always": true}, "stages": ["prestart", "poststop"]}`,
+		"10-annotation.json":  `{"version": "1.0.0", "hook": {"path": "/annotation"}, "when": {"annotations": {"^org\\.site\\.bb$": "^(yes|true)$"}}, "stages": ["prestart"]}`,
+		"20-command.json":     `{"version": "1.0.0", "hook": {"path": "/command"}, "when": {"commands": ["/licensed$"]}, "stages": ["prestart"]}`,
+		"30-binds.json":       `{"version": "1.0.0", "hook": {"path": "/binds"}, "when": {"hasBindMounts": true}, "stages": ["createRuntime"]}`,
+		"40-never.json":       `{"version": "1.0.0", "hook": {"path": "/never"}, "when": {"always": false}, "stages": ["prestart"]}`,
+		"50-and.json":         `{"version": "1.0.0", "hook": {"path": "/and"}, "when": {"annotations": {"^org\\.site\\.gpu$": "^yes$"}, "commands": ["/train$"]}, "stages": ["poststart"]}`,
+		"60-or.json":          `{"version": "1.0.0", "hook": {"path": "/or"}, "when": {"annotations": {"^org\\.site\\.gpu$": "^yes$"}, "commands": ["/train$"], "or": true}, "stages": ["poststart"]}`,
+		"70-annotations.json": `{"version": "1.0.0", "hook": {"path": "/annotations"}, "when": {"annotations": {"^org\\.site\\.gpu$": "^yes$", "^org\\.site\\.mpi$": ".*"}}, "stages": ["poststart"]}`,
+		"README":              "not a hook",
+		"50-poststart.json.d": "not a hook",
+	})
+	hooks, err := LoadHooksDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		stage string
+		match HookMatch
+		want  []string
+	}{
+		{
+			name:  "Always",
+			stage: HookStagePrestart,
+			want:  []string{"/always"},
+		},
+		{
+			name:  "Annotation",
+			stage: HookStagePrestart,
+			match: HookMatch{Annotations: map[string]string{"org.site.bb": "yes"}},
+			want:  []string{"/always", "/annotation"},
+		},
+		{
+			name:  "AnnotationValueMismatch",
+			stage: HookStagePrestart,
+			match: HookMatch{Annotations: map[string]string{"org.site.bb": "no"}},
+			want:  []string{"/always"},
+		},
+		{
+			name:  "Command",
+			stage: HookStagePrestart,
+			match: HookMatch{Command: "/opt/bin/licensed"},
+			want:  []string{"/always", "/command"},
+		},
+		{
+			name:  "BindMounts",
+			stage: HookStageCreateRuntime,
+			match: HookMatch{HasBindMounts: true},
+			want:  []string{"/binds"},
+		},
+		{
+			name:  "NoBindMounts",
+			stage: HookStageCreateRuntime,
+			want:  nil,
+		},
+		{
+			name:  "AllConditions",
+			stage: HookStagePoststart,
+			match: HookMatch{Annotations: map[string]string{"org.site.gpu": "yes", "org.site.mpi": "1"}, Command: "/opt/train"},
+			want:  []string{"/and", "/or", "/annotations"},
+		},
+		{
+			name:  "AnnotationOnly",
+			stage: HookStagePoststart,
+			match: HookMatch{Annotations: map[string]string{"org.site.gpu": "yes"}},
+			want:  []string{"/or"},
+		},
+		{
+			name:  "CommandOnly",
+			stage: HookStagePoststart,
+			match: HookMatch{Command: "/opt/train"},
+			want:  []string{"/or"},
+		},
+		{
+			name:  "NoCondition",
+			stage: HookStagePoststart,
+			match: HookMatch{Command: "/opt/test"},
+			want:  nil,
+		},
+		{
+			name:  "Poststop",
+			stage: HookStagePoststop,
+			want:  []string{"/always"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, h := range MatchingHooks(hooks, tt.stage, tt.match) {
+				got = append(got, h.Path)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got hooks %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got hooks %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -154,6 +154,7 @@ var authorizedTags = map[AuthorizedTag]struct {
 var authorizedImage = map[string]fsContext{
 	"encryptfs": {true},
 	"ext3":      {true},
+	"erofs":     {true},
 	"squashfs":  {true},
 	"gocryptfs": {true},
 }
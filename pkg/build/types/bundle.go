@@ -88,6 +88,9 @@ type Options struct {
 	// encryption if applicable.
 	// A nil value indicates encryption should not occur.
 	EncryptionKeyInfo *cryptkey.KeyInfo
+	// EncryptionRecipients specifies the additional PEM public keys
+	// the filesystem key is encrypted for.
+	EncryptionRecipients []cryptkey.KeyInfo
 	// ImgCache stores a pointer to the image cache to use.
 	ImgCache *cache.Handle
 	// NoTest indicates if build should skip running the test script.
@@ -126,6 +129,9 @@ type Options struct {
 	ReqAuthFile string
 	// Extra arguments for mksquashfs
 	MksquashfsArgs string
+	// Filesystem type of the root filesystem partition of SIF images,
+	// squashfs if empty or erofs
+	FsType string
 	// Which Platform to use when retrieving images for the build
 	Platform ggcrv1.Platform
 	// Reproducible build
@@ -137,6 +137,34 @@ func NewDefinitionFromJSON(r io.Reader) (d Definition, err error) {
 	return d, nil
 }
 
+// NewDefinitionsFromJSON creates the build stages of a definition using the
+// supplied JSON, either an array of definitions or a single definition. The
+// raw data of the definitions is regenerated from their content.
+func NewDefinitionsFromJSON(r io.Reader) ([]Definition, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []Definition
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &defs)
+	} else {
+		var d Definition
+		err = json.Unmarshal(raw, &d)
+		defs = append(defs, d)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("no definition found in JSON data")
+	}
+
+	UpdateDefinitionRaw(&defs)
+	return defs, nil
+}
+
 func UpdateDefinitionRaw(defs *[]Definition) {
 	var buf []byte
 	for i, def := range *defs {
@@ -0,0 +1,980 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/build/types"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+var (
+	dockerfileStart     = regexp.MustCompile(`(?i)^(from|arg)\s+\S`)
+	dockerfileDirective = regexp.MustCompile(`(?i)^#\s*([a-z]+)\s*=\s*(.*?)\s*$`)
+	dockerfileHeredoc   = regexp.MustCompile(`(^|[^<])<<(-?)(["']?)([A-Za-z_]\w*)["']?`)
+	dockerfileFlag      = regexp.MustCompile(`^--([a-z-]+)(?:=(\S*))?\s+`)
+	dockerfileStageName = regexp.MustCompile(`^[a-z][a-z0-9._-]*$`)
+	shellSafe           = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+)
+
+// dockerfileArchive matches the sources extracted by the ADD instruction.
+var dockerfileArchive = regexp.MustCompile(`\.(tar|tgz|tbz2?|txz|tar\.(gz|bz2|xz|zst))$`)
+
+// dockerfileCopyDir is the directory where %files stages the sources of COPY
+// and ADD instructions following RUN commands, until %post moves them in
+// place.
+const dockerfileCopyDir = "/.dockerfile-copy"
+
+// dockerfilePlatformArgs are the build arguments set automatically by
+// BuildKit, the build platform being the target platform here.
+var dockerfilePlatformArgs = map[string]string{
+	"TARGETPLATFORM": runtime.GOOS + "/" + runtime.GOARCH,
+	"TARGETOS":       runtime.GOOS,
+	"TARGETARCH":     runtime.GOARCH,
+	"BUILDPLATFORM":  runtime.GOOS + "/" + runtime.GOARCH,
+	"BUILDOS":        runtime.GOOS,
+	"BUILDARCH":      runtime.GOARCH,
+}
+
+// DockerfileOptions are the options of ParseDockerfile.
+type DockerfileOptions struct {
+	// Context is the build context directory, relative COPY and ADD sources
+	// are resolved against it. Defaults to the current working directory.
+	Context string
+}
+
+// dockerInstruction is a Dockerfile instruction with its continuation lines.
+type dockerInstruction struct {
+	line int
+	cmd  string
+	// args are the arguments of the instruction on a single line
+	args string
+	// script are the arguments of a RUN instruction, keeping continuation
+	// lines and here-documents
+	script string
+}
+
+// dockerStage holds the definition of a build stage while a Dockerfile is
+// translated.
+type dockerStage struct {
+	name        string
+	header      map[string]string
+	arguments   []string
+	argNames    map[string]bool
+	env         map[string]string
+	environment []string
+	post        []string
+	files       []types.Files
+	labels      map[string]string
+	workdir     string
+	shell       []string
+	entrypoint  []string
+	cmd         []string
+	cmdSet      bool
+	// stageCopies is set once a %post step modifying files was added, the
+	// sources of later copies being staged to keep the Dockerfile order
+	stageCopies bool
+	// copies is the number of staged copies
+	copies int
+}
+
+// IsDockerfile returns whether or not the given file is a Dockerfile rather
+// than a definition file, i.e. whether its first instruction is FROM or ARG.
+func IsDockerfile(source string) (bool, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if s, err := f.Stat(); err != nil {
+		return false, fmt.Errorf("unable to stat file: %v", err)
+	} else if s.IsDir() {
+		return false, nil
+	}
+
+	return isDockerfile(f), nil
+}
+
+func isDockerfile(r io.Reader) bool {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return dockerfileStart.MatchString(line)
+	}
+	return false
+}
+
+// splitDockerfile returns the instructions of a Dockerfile.
+func splitDockerfile(r io.Reader) ([]dockerInstruction, byte, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("while reading Dockerfile: %v", err)
+	}
+	lines := strings.Split(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+
+	escape := byte('\\')
+	directives := true
+
+	var insts []dockerInstruction
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if directives {
+			if m := dockerfileDirective.FindStringSubmatch(line); m != nil {
+				if strings.ToLower(m[1]) == "escape" {
+					if m[2] != "\\" && m[2] != "`" {
+						return nil, 0, fmt.Errorf("line %d: invalid escape character %q", i+1, m[2])
+					}
+					escape = m[2][0]
+				}
+				continue
+			}
+			directives = false
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		inst := dockerInstruction{line: i + 1}
+		var args, script []string
+		for {
+			cont := line[len(line)-1] == escape
+			if cont {
+				line = strings.TrimSpace(line[:len(line)-1])
+			}
+			args = append(args, line)
+			script = append(script, strings.TrimSpace(lines[i]))
+			if !cont {
+				break
+			}
+			// skip comments and empty lines in continuation lines
+			for i++; i < len(lines); i++ {
+				line = strings.TrimSpace(lines[i])
+				if line != "" && line[0] != '#' {
+					break
+				}
+			}
+			if i == len(lines) {
+				break
+			}
+		}
+
+		first := strings.Join(args, " ")
+		cmd, rest, _ := strings.Cut(first, " ")
+		inst.cmd = strings.ToLower(cmd)
+		inst.args = strings.TrimSpace(rest)
+		inst.script = inst.args
+		if escape == '\\' {
+			// the shell handles continuation lines the same way
+			inst.script = strings.TrimSpace(strings.Join(script, "\n")[len(cmd):])
+			for strings.HasPrefix(inst.script, "\\\n") {
+				inst.script = strings.TrimSpace(inst.script[2:])
+			}
+		}
+
+		if m := dockerfileHeredoc.FindStringSubmatchIndex(inst.args); m != nil {
+			start := m[3]
+			if inst.cmd != "run" {
+				if start == 0 {
+					return nil, 0, fmt.Errorf("line %d: here-documents are only supported with RUN", inst.line)
+				}
+			} else {
+				strip := m[5] > m[4]
+				delim := inst.args[m[8]:m[9]]
+				var body []string
+				for i++; i < len(lines); i++ {
+					l := lines[i]
+					if strip {
+						l = strings.TrimLeft(l, "\t")
+					}
+					if l == delim {
+						break
+					}
+					body = append(body, lines[i])
+				}
+				if i == len(lines) {
+					return nil, 0, fmt.Errorf("line %d: unterminated here-document %s", inst.line, delim)
+				}
+				if strings.TrimSpace(inst.args[m[1]:]) == "" && strings.TrimSpace(inst.args[:start]) == "" {
+					// the here-document is the script
+					inst.script = strings.Join(body, "\n")
+				} else {
+					inst.script += "\n" + strings.Join(body, "\n") + "\n" + delim
+				}
+			}
+		}
+		insts = append(insts, inst)
+	}
+	return insts, escape, nil
+}
+
+// dockerLexer splits the arguments of Dockerfile instructions into words,
+// handling quotes, escapes and variable references like Docker does.
+type dockerLexer struct {
+	escape byte
+	lookup func(name string) (string, bool)
+	// keepUnset keeps references to unknown variables, e.g. set by the base
+	// image, as markers replaced by shellUnset
+	keepUnset bool
+}
+
+// unsetMarker marks the references to unknown variables kept by dockerLexer.
+const unsetMarker = "\x00"
+
+var unsetRef = regexp.MustCompile(unsetMarker + `(\w+)` + unsetMarker)
+
+// shellUnset replaces the references to unknown variables in s by shell
+// variable references.
+func shellUnset(s string) string {
+	return unsetRef.ReplaceAllString(s, "$${$1}")
+}
+
+// words returns the words of s with quotes removed and variables expanded.
+func (l *dockerLexer) words(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == l.escape:
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				switch {
+				case s[i] == l.escape && i+1 < len(s) && strings.IndexByte("\"$`\\", s[i+1]) >= 0:
+					i++
+					word.WriteByte(s[i])
+				case s[i] == '$':
+					v, n, err := l.variable(s[i:])
+					if err != nil {
+						return nil, err
+					}
+					word.WriteString(v)
+					i += n - 1
+				default:
+					word.WriteByte(s[i])
+				}
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated double quote in %q", s)
+			}
+		case c == '$':
+			v, n, err := l.variable(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			word.WriteString(v)
+			i += n - 1
+		default:
+			word.WriteByte(c)
+		}
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if !l.keepUnset {
+		for i, w := range words {
+			words[i] = unsetRef.ReplaceAllString(w, "")
+		}
+	}
+	return words, nil
+}
+
+// variable returns the expansion of the variable reference at the start of s
+// and its length. Unset variables expand to an empty string.
+func (l *dockerLexer) variable(s string) (string, int, error) {
+	if len(s) > 1 && s[1] == '{' {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return "", 0, fmt.Errorf("missing '}' in %q", s)
+		}
+		expr := s[2:end]
+		name, word := expr, ""
+		op := ""
+		if i := strings.IndexAny(expr, ":-+"); i > 0 {
+			name = expr[:i]
+			if expr[i] == ':' {
+				if i+1 >= len(expr) || (expr[i+1] != '-' && expr[i+1] != '+') {
+					return "", 0, fmt.Errorf("unsupported modifier in %q", s[:end+1])
+				}
+				op, word = expr[i:i+2], expr[i+2:]
+			} else {
+				op, word = expr[i:i+1], expr[i+1:]
+			}
+		}
+		if op != "" {
+			ws, err := l.words(word)
+			if err != nil {
+				return "", 0, err
+			}
+			word = strings.Join(ws, " ")
+		}
+		v, ok := l.value(name)
+		switch op {
+		case ":-":
+			if !ok || v == "" {
+				v = word
+			}
+		case "-":
+			if !ok {
+				v = word
+			}
+		case ":+":
+			if ok && v != "" {
+				v = word
+			}
+		case "+":
+			if ok {
+				v = word
+			}
+		}
+		return v, end + 1, nil
+	}
+
+	n := 1
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 1 && s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	if n == 1 {
+		return "$", 1, nil
+	}
+	v, _ := l.value(s[1:n])
+	return v, n, nil
+}
+
+func (l *dockerLexer) value(name string) (string, bool) {
+	v, ok := l.lookup(name)
+	if !ok && l.keepUnset {
+		v = unsetMarker + name + unsetMarker
+	}
+	return v, ok
+}
+
+// execForm returns the arguments of an instruction in exec form, or nil if
+// they are in shell form.
+func execForm(args string) []string {
+	if !strings.HasPrefix(args, "[") {
+		return nil
+	}
+	var a []string
+	if err := json.Unmarshal([]byte(args), &a); err != nil {
+		return nil
+	}
+	return a
+}
+
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// doubleQuote quotes s for the shell, build arguments in s being kept as is.
+func doubleQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(s) + `"`
+}
+
+func buildArg(name string) string {
+	return "{{ " + name + " }}"
+}
+
+// dockerKeyValue is a key/value pair of an ENV, LABEL or ARG instruction.
+type dockerKeyValue struct {
+	key   string
+	value string
+	// set is false for ARG instructions without default value
+	set bool
+}
+
+// keyValues returns the key/value pairs of ENV, LABEL and ARG instructions,
+// supporting the legacy 'key value' form if legacy is set.
+func keyValues(lex *dockerLexer, args string, legacy bool) ([]dockerKeyValue, error) {
+	words, err := lex.words(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("missing arguments")
+	}
+	if legacy && !strings.Contains(words[0], "=") {
+		return []dockerKeyValue{{words[0], strings.Join(words[1:], " "), true}}, nil
+	}
+	kv := make([]dockerKeyValue, 0, len(words))
+	for _, w := range words {
+		k, v, ok := strings.Cut(w, "=")
+		if !ok && legacy {
+			return nil, fmt.Errorf("%q is not a key=value pair", w)
+		}
+		if k == "" {
+			return nil, fmt.Errorf("missing key in %q", w)
+		}
+		kv = append(kv, dockerKeyValue{k, v, ok})
+	}
+	return kv, nil
+}
+
+// instructionFlags removes the leading --name=value options from the
+// arguments of an instruction and returns them.
+func instructionFlags(args string) (map[string]string, string) {
+	f := make(map[string]string)
+	for {
+		m := dockerfileFlag.FindStringSubmatch(args)
+		if m == nil {
+			return f, args
+		}
+		f[m[1]] = m[2]
+		args = args[len(m[0]):]
+	}
+}
+
+func (s *dockerStage) lookup(name string) (string, bool) {
+	if v, ok := s.env[name]; ok {
+		return v, true
+	}
+	if s.argNames[name] {
+		return buildArg(name), true
+	}
+	return "", false
+}
+
+// from returns a new build stage starting from s.
+func (s *dockerStage) from(name string) *dockerStage {
+	n := &dockerStage{
+		name:        name,
+		header:      make(map[string]string),
+		arguments:   append([]string(nil), s.arguments...),
+		argNames:    make(map[string]bool),
+		env:         make(map[string]string),
+		environment: append([]string(nil), s.environment...),
+		post:        append([]string(nil), s.post...),
+		labels:      make(map[string]string),
+		workdir:     "/",
+		shell:       s.shell,
+		entrypoint:  s.entrypoint,
+		cmd:         s.cmd,
+		stageCopies: s.stageCopies,
+		copies:      s.copies,
+	}
+	if s.workdir != "" {
+		n.workdir = s.workdir
+	}
+	for k, v := range s.header {
+		n.header[k] = v
+	}
+	for k, v := range s.env {
+		n.env[k] = v
+	}
+	for k, v := range s.labels {
+		n.labels[k] = v
+	}
+	for _, f := range s.files {
+		n.files = append(n.files, types.Files{Args: f.Args, Files: append([]types.FileTransport(nil), f.Files...)})
+	}
+	return n
+}
+
+func (s *dockerStage) addFile(args string, ft types.FileTransport) {
+	for i := range s.files {
+		if s.files[i].Args == args {
+			s.files[i].Files = append(s.files[i].Files, ft)
+			return
+		}
+	}
+	s.files = append(s.files, types.Files{Args: args, Files: []types.FileTransport{ft}})
+}
+
+// copy translates a COPY or ADD instruction to %files entries. As %files are
+// copied before %post scripts run, the files copied after a RUN command are
+// staged in dockerfileCopyDir by %files and moved to their destination by
+// %post, keeping the order of the Dockerfile.
+func (s *dockerStage) copy(p *dockerfileParser, inst dockerInstruction) error {
+	lex := p.lexer(s)
+	opts, args := instructionFlags(inst.args)
+	for k, v := range opts {
+		ws, err := lex.words(v)
+		if err != nil {
+			return err
+		}
+		opts[k] = strings.Join(ws, " ")
+	}
+	words := execForm(args)
+	if words == nil {
+		var err error
+		if words, err = lex.words(args); err != nil {
+			return err
+		}
+	}
+	if len(words) < 2 {
+		return fmt.Errorf("%s requires at least a source and a destination", strings.ToUpper(inst.cmd))
+	}
+	srcs, dst := words[:len(words)-1], words[len(words)-1]
+	if len(srcs) > 1 && !strings.HasSuffix(dst, "/") {
+		return fmt.Errorf("destination %s must end with / when copying several sources", dst)
+	}
+	if !path.IsAbs(dst) {
+		keep := strings.HasSuffix(dst, "/") || dst == "." || strings.HasSuffix(dst, "/.")
+		dst = path.Join(s.workdir, dst)
+		if keep && dst != "/" {
+			dst += "/"
+		}
+	}
+
+	args = ""
+	if from, ok := opts["from"]; ok {
+		stage, err := p.stageName(from)
+		if err != nil {
+			return err
+		}
+		args = "from " + stage
+	}
+
+	staged := ""
+	if s.stageCopies {
+		staged = path.Join(dockerfileCopyDir, strconv.Itoa(s.copies))
+		s.copies++
+	}
+
+	var owned []string
+	file := ""
+	for _, src := range srcs {
+		if inst.cmd == "add" {
+			if strings.Contains(src, "://") || strings.HasPrefix(src, "git@") {
+				return fmt.Errorf("ADD from a URL is not supported, use RUN with curl or wget instead")
+			}
+			if dockerfileArchive.MatchString(src) {
+				return fmt.Errorf("ADD of archive %s is not supported, use COPY and RUN tar instead", src)
+			}
+		}
+
+		glob := strings.ContainsAny(src, "*?[")
+		dir := false
+		if args == "" {
+			src = filepath.Join(p.context, src)
+			if fi, err := os.Stat(src); err == nil && fi.IsDir() {
+				dir = true
+			}
+		} else {
+			src = path.Join("/", src)
+		}
+
+		target := dst
+		if dir {
+			// the content of directories is copied, not the directories
+			src += "/."
+		} else if !glob && strings.HasSuffix(dst, "/") {
+			target = path.Join(dst, path.Base(src))
+		} else if !glob {
+			file = path.Base(src)
+		} else if staged != "" && !strings.HasSuffix(dst, "/") {
+			return fmt.Errorf("destination %s must end with / when copying %s after RUN", dst, src)
+		}
+		if staged != "" {
+			s.addFile(args, types.FileTransport{Src: src, Dst: staged + "/"})
+		} else {
+			s.addFile(args, types.FileTransport{Src: src, Dst: dst})
+		}
+		owned = append(owned, target)
+	}
+
+	switch {
+	case staged == "":
+	case file != "":
+		s.post = append(s.post, "mkdir -p "+shellQuote(path.Dir(dst))+" && cp -a "+shellQuote(path.Join(staged, file))+" "+shellQuote(dst))
+	default:
+		s.post = append(s.post, "mkdir -p "+shellQuote(dst)+" && cp -a "+shellQuote(staged+"/.")+" "+shellQuote(dst))
+	}
+
+	if chown := opts["chown"]; chown != "" {
+		s.post = append(s.post, "chown -R "+shellQuote(chown)+" "+shellJoin(owned))
+		s.stageCopies = true
+	}
+	if chmod := opts["chmod"]; chmod != "" {
+		s.post = append(s.post, "chmod -R "+shellQuote(chmod)+" "+shellJoin(owned))
+		s.stageCopies = true
+	}
+	return nil
+}
+
+func (s *dockerStage) run(inst dockerInstruction) error {
+	script := inst.script
+	if a := execForm(inst.args); a != nil {
+		script = shellJoin(a)
+	}
+	// only the last of repeated --mount options is checked, which is
+	// enough to reject bind and secret mounts in most cases
+	opts, script := instructionFlags(script)
+	if m, ok := opts["mount"]; ok && !strings.Contains(m, "type=cache") && !strings.Contains(m, "type=tmpfs") {
+		return fmt.Errorf("RUN --mount=%s is not supported, only cache and tmpfs mounts are ignored", m)
+	}
+	if script == "" {
+		return fmt.Errorf("RUN requires a command")
+	}
+	s.post = append(s.post, script)
+	s.stageCopies = true
+	return nil
+}
+
+// runscript returns the %runscript running the entrypoint with the command
+// as default arguments.
+func (s *dockerStage) runscript() string {
+	if s.entrypoint == nil && s.cmd == nil {
+		return ""
+	}
+	var b strings.Builder
+	if len(s.cmd) > 0 {
+		b.WriteString("if [ $# -eq 0 ]; then\n")
+		b.WriteString("    set -- " + shellJoin(s.cmd) + "\n")
+		b.WriteString("fi\n")
+	}
+	if len(s.entrypoint) > 0 {
+		b.WriteString("exec " + shellJoin(s.entrypoint) + " \"$@\"\n")
+	} else {
+		b.WriteString("exec \"$@\"\n")
+	}
+	return b.String()
+}
+
+func (s *dockerStage) definition(multiStage bool) types.Definition {
+	post := s.post
+	if s.copies > 0 {
+		post = append(post[:len(post):len(post)], "rm -rf "+dockerfileCopyDir)
+	}
+	d := types.Definition{
+		Header: s.header,
+		ImageData: types.ImageData{
+			Labels: s.labels,
+			ImageScripts: types.ImageScripts{
+				Environment: types.Script{Script: strings.Join(s.environment, "\n")},
+				Runscript:   types.Script{Script: s.runscript()},
+			},
+		},
+		BuildData: types.Data{
+			Files: s.files,
+			Scripts: types.Scripts{
+				Arguments: types.Script{Script: strings.Join(s.arguments, "\n")},
+				Post:      types.Script{Script: strings.Join(post, "\n")},
+			},
+		},
+		CustomData: map[string]string{},
+	}
+	if multiStage {
+		d.Header["stage"] = s.name
+	}
+	if len(s.shell) > 0 {
+		shell := s.shell
+		if shell[len(shell)-1] == "-c" {
+			shell = shell[:len(shell)-1]
+		}
+		// stop on the first failing command like the default shell
+		d.BuildData.Post.Args = "-c " + strings.Join(shell, " ") + " -e"
+	}
+	return d
+}
+
+type dockerfileParser struct {
+	context    string
+	escape     byte
+	globalArgs map[string]bool
+	arguments  []string
+	stages     []*dockerStage
+}
+
+func (p *dockerfileParser) lexer(s *dockerStage) *dockerLexer {
+	lookup := func(name string) (string, bool) {
+		if p.globalArgs[name] {
+			return buildArg(name), true
+		}
+		return "", false
+	}
+	if s != nil {
+		lookup = s.lookup
+	}
+	return &dockerLexer{escape: p.escape, lookup: lookup}
+}
+
+// stageName returns the name of the stage referenced by a stage name or
+// index, as in FROM and COPY --from.
+func (p *dockerfileParser) stageName(ref string) (string, error) {
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i < 0 || i >= len(p.stages)-1 {
+			return "", fmt.Errorf("invalid stage index %d", i)
+		}
+		return p.stages[i].name, nil
+	}
+	if s := p.stage(ref); s != nil {
+		return s.name, nil
+	}
+	return "", fmt.Errorf("copying from image %s is not supported, copy from a build stage instead", ref)
+}
+
+func (p *dockerfileParser) stage(name string) *dockerStage {
+	for _, s := range p.stages {
+		if s.name == strings.ToLower(name) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (p *dockerfileParser) from(inst dockerInstruction) error {
+	_, args := instructionFlags(inst.args)
+	words, err := p.lexer(nil).words(args)
+	if err != nil {
+		return err
+	}
+	name := strconv.Itoa(len(p.stages))
+	switch {
+	case len(words) == 3 && strings.EqualFold(words[1], "as"):
+		name = strings.ToLower(words[2])
+		if !dockerfileStageName.MatchString(name) {
+			return fmt.Errorf("invalid stage name %q", words[2])
+		}
+	case len(words) != 1:
+		return fmt.Errorf("FROM requires an image and an optional stage name")
+	}
+
+	var s *dockerStage
+	if parent := p.stage(words[0]); parent != nil {
+		s = parent.from(name)
+	} else {
+		s = (&dockerStage{}).from(name)
+		if words[0] == "scratch" {
+			s.header["bootstrap"] = "scratch"
+		} else {
+			s.header["bootstrap"] = "docker"
+			s.header["from"] = words[0]
+		}
+	}
+	// global arguments may be used in FROM and declared again in stages
+	for _, a := range p.arguments {
+		if !slices.Contains(s.arguments, a) {
+			s.arguments = append(s.arguments, a)
+		}
+	}
+	p.stages = append(p.stages, s)
+	return nil
+}
+
+func (p *dockerfileParser) arg(s *dockerStage, inst dockerInstruction) error {
+	kv, err := keyValues(p.lexer(s), inst.args, false)
+	if err != nil {
+		return err
+	}
+	for _, a := range kv {
+		name, def := a.key, a.value
+		if !a.set {
+			if v, ok := dockerfilePlatformArgs[name]; ok {
+				def = v
+			} else if s != nil && p.globalArgs[name] {
+				// inherits the default value of the global argument
+				s.argNames[name] = true
+				s.post = append(s.post, "export "+name+"="+doubleQuote(buildArg(name)))
+				continue
+			}
+		}
+		line := name + "=" + def
+		if s == nil {
+			p.globalArgs[name] = true
+			p.arguments = append(p.arguments, line)
+			continue
+		}
+		s.argNames[name] = true
+		s.arguments = append(s.arguments, line)
+		s.post = append(s.post, "export "+name+"="+doubleQuote(buildArg(name)))
+	}
+	return nil
+}
+
+func (p *dockerfileParser) instruction(inst dockerInstruction) error {
+	if inst.cmd == "from" {
+		return p.from(inst)
+	}
+	if inst.cmd == "arg" && len(p.stages) == 0 {
+		return p.arg(nil, inst)
+	}
+	if len(p.stages) == 0 {
+		return fmt.Errorf("%s instruction before FROM", strings.ToUpper(inst.cmd))
+	}
+	s := p.stages[len(p.stages)-1]
+	lex := p.lexer(s)
+
+	switch inst.cmd {
+	case "arg":
+		return p.arg(s, inst)
+	case "run":
+		return s.run(inst)
+	case "copy", "add":
+		return s.copy(p, inst)
+	case "env":
+		lex.keepUnset = true
+		kv, err := keyValues(lex, inst.args, true)
+		if err != nil {
+			return err
+		}
+		for _, e := range kv {
+			s.env[e.key] = e.value
+			export := "export " + e.key + "=" + shellUnset(doubleQuote(e.value))
+			s.environment = append(s.environment, export)
+			s.post = append(s.post, export)
+		}
+	case "label":
+		kv, err := keyValues(lex, inst.args, false)
+		if err != nil {
+			return err
+		}
+		for _, l := range kv {
+			s.labels[l.key] = l.value
+		}
+	case "maintainer":
+		s.labels["maintainer"] = inst.args
+	case "workdir":
+		words, err := lex.words(inst.args)
+		if err != nil {
+			return err
+		}
+		if len(words) != 1 {
+			return fmt.Errorf("WORKDIR requires a single directory")
+		}
+		if path.IsAbs(words[0]) {
+			s.workdir = path.Clean(words[0])
+		} else {
+			s.workdir = path.Join(s.workdir, words[0])
+		}
+		dir := shellQuote(s.workdir)
+		s.post = append(s.post, "mkdir -p "+dir+" && cd "+dir)
+	case "entrypoint", "cmd", "shell":
+		a := execForm(inst.args)
+		if a == nil {
+			if inst.cmd == "shell" {
+				return fmt.Errorf("SHELL requires a JSON array")
+			}
+			a = []string{"/bin/sh", "-c", inst.args}
+		}
+		switch inst.cmd {
+		case "entrypoint":
+			s.entrypoint = a
+			if !s.cmdSet {
+				// the command of the base image is reset
+				s.cmd = []string{}
+			}
+		case "cmd":
+			s.cmd, s.cmdSet = a, true
+		case "shell":
+			s.shell = a
+		}
+	case "user":
+		sylog.Warningf("Dockerfile line %d: USER %s is ignored, RUN commands run as root and the container as the user running it",
+			inst.line, inst.args)
+	case "expose", "volume", "stopsignal", "healthcheck", "onbuild":
+		// runtime settings without equivalent in SIF images
+	default:
+		return fmt.Errorf("unknown instruction %s", strings.ToUpper(inst.cmd))
+	}
+	return nil
+}
+
+// ParseDockerfile translates the Dockerfile read from r to the build stages
+// of a definition file, the last stage being the image built. FROM, RUN,
+// COPY, ADD, ENV, ARG, WORKDIR, ENTRYPOINT, CMD, LABEL, MAINTAINER and SHELL
+// are supported, runtime settings like USER, EXPOSE or VOLUME are ignored.
+// ARG values are build arguments, set with %arguments. COPY and ADD sources
+// are copied with %files, those following RUN commands being moved in place
+// by %post so that instructions apply in the Dockerfile order.
+func ParseDockerfile(r io.Reader, opts DockerfileOptions) ([]types.Definition, error) {
+	insts, escape, err := splitDockerfile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &dockerfileParser{
+		context:    opts.Context,
+		escape:     escape,
+		globalArgs: make(map[string]bool),
+	}
+	if p.context == "" {
+		p.context = "."
+	}
+	for _, inst := range insts {
+		if err := p.instruction(inst); err != nil {
+			return nil, fmt.Errorf("line %d: %v", inst.line, err)
+		}
+	}
+	if len(p.stages) == 0 {
+		return nil, fmt.Errorf("no FROM instruction found in Dockerfile")
+	}
+
+	defs := make([]types.Definition, 0, len(p.stages))
+	for _, s := range p.stages {
+		defs = append(defs, s.definition(len(p.stages) > 1))
+	}
+	types.UpdateDefinitionRaw(&defs)
+	return defs, nil
+}
+
+// FormatDockerfile translates the Dockerfile read from r with
+// ParseDockerfile and writes the resulting definition file to w.
+func FormatDockerfile(w io.Writer, r io.Reader, opts DockerfileOptions) error {
+	defs, err := ParseDockerfile(r, opts)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := Format(&buf, defs); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,253 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const dockerfile = `# syntax=docker/dockerfile:1
+ARG GO_VERSION=1.22
+
+FROM golang:${GO_VERSION} AS build
+ARG GO_VERSION
+WORKDIR /src
+COPY go.mod main.go ./
+COPY src .
+# build the binary
+RUN go mod download && \
+    # comment in continuation lines
+    go build -o /out/app .
+
+FROM alpine:3.20
+ARG VERSION=dev
+ENV APP_HOME=/opt/app \
+    PATH="/opt/app/bin:$PATH"
+LABEL org.opencontainers.image.version=$VERSION maintainer="Jane Doe"
+COPY --from=build --chmod=755 /out/app $APP_HOME/bin/
+RUN <<EOF
+apk add --no-cache ca-certificates
+adduser -D app
+EOF
+RUN ["echo", "it's done"]
+USER app
+ENTRYPOINT ["app"]
+CMD ["--help"]
+`
+
+const dockerfileDef = `Bootstrap: docker
+From: golang:{{ GO_VERSION }}
+Stage: build
+
+%arguments
+GO_VERSION=1.22
+
+%files
+    CONTEXT/go.mod /src/
+    CONTEXT/main.go /src/
+    CONTEXT/src/. /src/
+
+%post
+export GO_VERSION="{{ GO_VERSION }}"
+mkdir -p /src && cd /src
+go mod download && \
+go build -o /out/app .
+
+Bootstrap: docker
+From: alpine:3.20
+Stage: 1
+
+%arguments
+GO_VERSION=1.22
+VERSION=dev
+
+%files from build
+    /out/app /opt/app/bin/
+
+%environment
+export APP_HOME="/opt/app"
+export PATH="/opt/app/bin:${PATH}"
+
+%post
+export VERSION="{{ VERSION }}"
+export APP_HOME="/opt/app"
+export PATH="/opt/app/bin:${PATH}"
+chmod -R 755 /opt/app/bin/app
+apk add --no-cache ca-certificates
+adduser -D app
+echo 'it'\''s done'
+
+%runscript
+if [ $# -eq 0 ]; then
+    set -- --help
+fi
+exec app "$@"
+%labels
+    maintainer Jane Doe
+    org.opencontainers.image.version {{ VERSION }}
+`
+
+func TestParseDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := FormatDockerfile(&buf, strings.NewReader(dockerfile), DockerfileOptions{Context: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := strings.ReplaceAll(dockerfileDef, "CONTEXT", dir)
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected definition:\n%s\nexpected:\n%s", got, want)
+	}
+
+	// the translation is a valid definition file
+	if _, err := All(&buf); err != nil {
+		t.Errorf("while parsing translated definition: %v", err)
+	}
+}
+
+const dockerfileOrder = `FROM alpine
+COPY config /etc/app/
+RUN rm -rf /etc/app && mkdir -p /opt
+COPY config /etc/app/
+COPY --chown=app config/app.conf /opt/app.conf
+WORKDIR /srv
+COPY data .
+RUN ls /srv
+`
+
+const dockerfileOrderDef = `Bootstrap: docker
+From: alpine
+
+%files
+    CONTEXT/config/. /etc/app/
+    CONTEXT/config/. /.dockerfile-copy/0/
+    CONTEXT/config/app.conf /.dockerfile-copy/1/
+    CONTEXT/data/. /.dockerfile-copy/2/
+
+%post
+rm -rf /etc/app && mkdir -p /opt
+mkdir -p /etc/app/ && cp -a /.dockerfile-copy/0/. /etc/app/
+mkdir -p /opt && cp -a /.dockerfile-copy/1/app.conf /opt/app.conf
+chown -R app /opt/app.conf
+mkdir -p /srv && cd /srv
+mkdir -p /srv/ && cp -a /.dockerfile-copy/2/. /srv/
+ls /srv
+rm -rf /.dockerfile-copy
+`
+
+func TestParseDockerfileOrder(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"config", "data"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// files copied after RUN commands are moved in place by %post
+	var buf bytes.Buffer
+	if err := FormatDockerfile(&buf, strings.NewReader(dockerfileOrder), DockerfileOptions{Context: dir}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := strings.ReplaceAll(dockerfileOrderDef, "CONTEXT", dir)
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected definition:\n%s\nexpected:\n%s", got, want)
+	}
+
+	// the staged copies are inherited by stages built from the stage
+	defs, err := ParseDockerfile(strings.NewReader(dockerfileOrder+"FROM 0\nRUN true\n"), DockerfileOptions{Context: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(defs) != 2 {
+		t.Fatalf("got %d stages, expected 2", len(defs))
+	}
+	post := defs[1].BuildData.Post.Script
+	if !strings.HasSuffix(post, "ls /srv\ntrue\nrm -rf /.dockerfile-copy") {
+		t.Errorf("unexpected %%post of inherited stage:\n%s", post)
+	}
+
+	// the destination of a glob can't be guessed
+	_, err = ParseDockerfile(strings.NewReader("FROM alpine\nRUN true\nCOPY *.conf /etc/app.conf\n"), DockerfileOptions{Context: dir})
+	if err == nil || !strings.Contains(err.Error(), "must end with /") {
+		t.Errorf("unexpected error for glob copied after RUN: %v", err)
+	}
+}
+
+func TestParseDockerfileErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		err        string
+	}{
+		{
+			name:       "NoFrom",
+			dockerfile: "RUN true\n",
+			err:        "line 1: RUN instruction before FROM",
+		},
+		{
+			name:       "UnknownInstruction",
+			dockerfile: "FROM alpine\nCOPYY a b\n",
+			err:        "line 2: unknown instruction COPYY",
+		},
+		{
+			name:       "CopyFromImage",
+			dockerfile: "FROM alpine\nCOPY --from=nginx /etc/nginx /etc/nginx\n",
+			err:        "line 2: copying from image nginx is not supported",
+		},
+		{
+			name:       "AddURL",
+			dockerfile: "FROM alpine\nADD https://example.com/a.txt /opt/\n",
+			err:        "line 2: ADD from a URL is not supported",
+		},
+		{
+			name:       "BindMount",
+			dockerfile: "FROM alpine\nRUN --mount=type=bind,target=/src make\n",
+			err:        "line 2: RUN --mount=type=bind,target=/src is not supported",
+		},
+		{
+			name:       "Heredoc",
+			dockerfile: "FROM alpine\nRUN <<EOF\ntrue\n",
+			err:        "line 2: unterminated here-document EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDockerfile(strings.NewReader(tt.dockerfile), DockerfileOptions{})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("got error %v, expected %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestIsDockerfile(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"# syntax=docker/dockerfile:1\n\nFROM alpine\n", true},
+		{"ARG VERSION=1\nFROM alpine:$VERSION\n", true},
+		{"Bootstrap: docker\nFrom: alpine\n", false},
+		{"from: alpine\nbootstrap: docker\n", false},
+	}
+
+	for _, tt := range tests {
+		if got := isDockerfile(strings.NewReader(tt.content)); got != tt.want {
+			t.Errorf("isDockerfile(%q) = %v, expected %v", tt.content, got, tt.want)
+		}
+	}
+}
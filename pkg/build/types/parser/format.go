@@ -0,0 +1,262 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/build/types"
+)
+
+// formatIndent is the indentation of section content written by Format.
+const formatIndent = "    "
+
+// headerNames are the spellings of header keywords written by Format, other
+// keywords are written in lower case.
+var headerNames = map[string]string{
+	"bootstrap":    "Bootstrap",
+	"from":         "From",
+	"stage":        "Stage",
+	"includecmd":   "IncludeCmd",
+	"mirrorurl":    "MirrorURL",
+	"updateurl":    "UpdateURL",
+	"osversion":    "OSVersion",
+	"include":      "Include",
+	"library":      "Library",
+	"registry":     "Registry",
+	"namespace":    "Namespace",
+	"product":      "Product",
+	"user":         "User",
+	"regcode":      "Regcode",
+	"productpgp":   "ProductPGP",
+	"registerurl":  "RegisterURL",
+	"modules":      "Modules",
+	"fingerprints": "Fingerprints",
+	"confurl":      "ConfURL",
+	"setopt":       "Setopt",
+	"target":       "Target",
+	"frontend":     "Frontend",
+	"filename":     "Filename",
+	"buildargs":    "BuildArgs",
+}
+
+// headerOrder are the header keywords written first by Format, other keywords
+// follow in alphabetical order.
+var headerOrder = []string{"bootstrap", "from", "stage"}
+
+// formatSections is the order of the sections written by Format.
+var formatSections = []string{
+	"arguments",
+	"pre",
+	"setup",
+	"files",
+	"environment",
+	"post",
+	"runscript",
+	"startscript",
+	"test",
+	"labels",
+	"help",
+}
+
+// formatAppSections is the order of the sections of each SCIF app written by
+// Format.
+var formatAppSections = []string{
+	"appfiles",
+	"appinstall",
+	"appenv",
+	"apprun",
+	"appstart",
+	"apptest",
+	"applabels",
+	"apphelp",
+}
+
+// sectionScript returns the script of the standard section name.
+func sectionScript(d *types.Definition, name string) types.Script {
+	switch name {
+	case "help":
+		return d.Help
+	case "environment":
+		return d.Environment
+	case "runscript":
+		return d.Runscript
+	case "test":
+		return d.Test
+	case "startscript":
+		return d.Startscript
+	case "arguments":
+		return d.BuildData.Arguments
+	case "pre":
+		return d.BuildData.Pre
+	case "setup":
+		return d.BuildData.Setup
+	case "post":
+		return d.BuildData.Post
+	}
+	return types.Script{}
+}
+
+// quoteFile quotes a %files path containing spaces.
+func quoteFile(path string) string {
+	if strings.ContainsAny(path, " \t") {
+		return `"` + path + `"`
+	}
+	return path
+}
+
+// formatter writes definitions in canonical form.
+type formatter struct {
+	buf bytes.Buffer
+	// sep is set when an empty line must be written before the next section
+	sep bool
+}
+
+func (f *formatter) writeSectionName(name, args string) {
+	if f.sep {
+		f.buf.WriteString("\n")
+	}
+	f.sep = false
+	f.buf.WriteString("%" + name)
+	if args = strings.TrimSpace(args); args != "" {
+		f.buf.WriteString(" " + args)
+	}
+	f.buf.WriteString("\n")
+}
+
+// writeSection writes a section whose entries lines are generated from the
+// definition.
+func (f *formatter) writeSection(name, args string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	f.writeSectionName(name, args)
+	for _, l := range lines {
+		f.buf.WriteString(l + "\n")
+	}
+	f.sep = true
+}
+
+// writeScript writes a script section with its content as is, indentation
+// being significant in scripts, e.g. Python scripts and here-documents. As
+// the content of a parsed section includes the empty lines before the next
+// section, no separator is added unless the script doesn't end with a new
+// line.
+func (f *formatter) writeScript(name, args, script string) {
+	if script == "" {
+		return
+	}
+	f.writeSectionName(name, args)
+	f.buf.WriteString(script)
+	f.sep = !strings.HasSuffix(script, "\n")
+	if f.sep {
+		f.buf.WriteString("\n")
+	}
+}
+
+func (f *formatter) writeHeader(header map[string]string) {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	rank := func(k string) int {
+		for i, h := range headerOrder {
+			if k == h {
+				return i
+			}
+		}
+		return len(headerOrder)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	if len(keys) > 0 && f.sep {
+		f.buf.WriteString("\n")
+		f.sep = false
+	}
+	for _, k := range keys {
+		name, ok := headerNames[k]
+		if !ok {
+			name = k
+		}
+		// multi-line values are written with continuation lines
+		val := strings.ReplaceAll(strings.TrimSpace(header[k]), "\n", "\\n\\\n")
+		f.buf.WriteString(name + ": " + val + "\n")
+	}
+	if len(keys) > 0 {
+		f.sep = true
+	}
+}
+
+func (f *formatter) writeDefinition(d *types.Definition) {
+	f.writeHeader(d.Header)
+
+	for _, name := range formatSections {
+		switch name {
+		case "files":
+			for _, fs := range d.BuildData.Files {
+				lines := make([]string, 0, len(fs.Files))
+				for _, ft := range fs.Files {
+					l := formatIndent + quoteFile(ft.Src)
+					if ft.Dst != "" {
+						l += " " + quoteFile(ft.Dst)
+					}
+					lines = append(lines, l)
+				}
+				f.writeSection(name, fs.Args, lines)
+			}
+		case "labels":
+			keys := make([]string, 0, len(d.Labels))
+			for k := range d.Labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			lines := make([]string, 0, len(keys))
+			for _, k := range keys {
+				lines = append(lines, strings.TrimRight(formatIndent+k+" "+d.Labels[k], " "))
+			}
+			f.writeSection(name, "", lines)
+		default:
+			s := sectionScript(d, name)
+			f.writeScript(name, s.Args, s.Script)
+		}
+	}
+
+	for _, app := range d.AppOrder {
+		for _, name := range formatAppSections {
+			if script, ok := d.CustomData[name+" "+app]; ok {
+				f.writeScript(name+" "+app, "", script)
+			}
+		}
+	}
+}
+
+// Format writes the build stages defs to w as a definition file in canonical
+// form: header keywords first, then sections in a fixed order, %files and
+// %labels entries being indented by four spaces. Scripts are written as is,
+// parsing the output of Format gives the same scripts. Comments outside of
+// scripts, e.g. in the header, %files and %labels sections, are not kept, as
+// they are not part of a Definition. Formatting a definition file parsed
+// from the output of Format gives the same output.
+func Format(w io.Writer, defs []types.Definition) error {
+	var f formatter
+	for i := range defs {
+		f.writeDefinition(&defs[i])
+	}
+	_, err := w.Write(f.buf.Bytes())
+	return err
+}
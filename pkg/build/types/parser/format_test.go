@@ -0,0 +1,241 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/build/types"
+)
+
+func formatString(t *testing.T, def string) string {
+	t.Helper()
+
+	defs, err := All(strings.NewReader(def))
+	if err != nil {
+		t.Fatalf("while parsing definition: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Format(&buf, defs); err != nil {
+		t.Fatalf("while formatting definition: %v", err)
+	}
+	return buf.String()
+}
+
+func TestFormat(t *testing.T) {
+	def := `Bootstrap: docker
+# comment
+stage: build
+from: alpine
+
+%post
+	apt-get update
+	  apt-get install -y curl
+
+%labels
+Version 1.0
+Author me
+%files
+"my file" /opt
+%environment
+export A=1
+%appinstall foo
+  make
+%runscript -c /bin/bash
+exec "$@"
+`
+	want := `Bootstrap: docker
+From: alpine
+Stage: build
+
+%files
+    "my file" /opt
+
+%environment
+export A=1
+%post
+	apt-get update
+	  apt-get install -y curl
+
+%runscript -c /bin/bash
+exec "$@"
+%labels
+    Author me
+    Version 1.0
+
+%appinstall foo
+  make
+`
+	if got := formatString(t, def); got != want {
+		t.Errorf("unexpected formatted definition:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestFormatScripts(t *testing.T) {
+	def := `Bootstrap: docker
+From: python:3
+
+%runscript
+#!/usr/bin/env python
+print("hi")
+if True:
+    print("x")
+
+%post
+	cat > /etc/motd <<EOF
+  Welcome
+EOF
+	sed -i 's/a/b/' \\
+		/etc/motd
+%labels
+Version 1.0
+`
+	want := `Bootstrap: docker
+From: python:3
+
+%post
+	cat > /etc/motd <<EOF
+  Welcome
+EOF
+	sed -i 's/a/b/' \\
+		/etc/motd
+%runscript
+#!/usr/bin/env python
+print("hi")
+if True:
+    print("x")
+
+%labels
+    Version 1.0
+`
+
+	defs, err := All(strings.NewReader(def))
+	if err != nil {
+		t.Fatalf("while parsing definition: %v", err)
+	}
+	got := formatString(t, def)
+	if got != want {
+		t.Errorf("unexpected formatted definition:\n%s\nexpected:\n%s", got, want)
+	}
+	fdefs, err := All(strings.NewReader(got))
+	if err != nil {
+		t.Fatalf("while parsing formatted definition: %v", err)
+	}
+	if len(fdefs) != 1 {
+		t.Fatalf("got %d stages, expected 1", len(fdefs))
+	}
+	checkFormattedDefinition(t, defs[0], fdefs[0])
+	if want := "#!/usr/bin/env python\n"; !strings.HasPrefix(fdefs[0].ImageData.Runscript.Script, want) {
+		t.Errorf("runscript %q doesn't start with %q", fdefs[0].ImageData.Runscript.Script, want)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("testdata_good/*/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		// skip parsed definitions and build results
+		if filepath.Ext(path) == ".json" || filepath.Base(path) == "result" {
+			continue
+		}
+		t.Run(path, func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("while reading definition: %v", err)
+			}
+			defs, err := All(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("while parsing definition: %v", err)
+			}
+
+			formatted := formatString(t, string(raw))
+			if again := formatString(t, formatted); again != formatted {
+				t.Errorf("formatting is not stable:\n%s\nthen:\n%s", formatted, again)
+			}
+
+			fdefs, err := All(strings.NewReader(formatted))
+			if err != nil {
+				t.Fatalf("while parsing formatted definition: %v", err)
+			}
+			if len(fdefs) != len(defs) {
+				t.Fatalf("got %d stages, expected %d", len(fdefs), len(defs))
+			}
+			for i := range defs {
+				checkFormattedDefinition(t, defs[i], fdefs[i])
+			}
+
+			// converting to JSON and back gives the same definition file
+			b, err := json.Marshal(defs)
+			if err != nil {
+				t.Fatalf("while converting definition to JSON: %v", err)
+			}
+			jdefs, err := types.NewDefinitionsFromJSON(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("while parsing JSON definition: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := Format(&buf, jdefs); err != nil {
+				t.Fatalf("while formatting JSON definition: %v", err)
+			}
+			if buf.String() != formatted {
+				t.Errorf("unexpected definition from JSON:\n%s\nexpected:\n%s", buf.String(), formatted)
+			}
+		})
+	}
+}
+
+// checkFormattedDefinition checks that the formatted definition f holds the
+// same data as d.
+func checkFormattedDefinition(t *testing.T, d, f types.Definition) {
+	t.Helper()
+
+	// the first section of a definition without header is parsed without
+	// its trailing empty lines, which scripts are then compared without
+	sameScript := func(a, b string) bool {
+		if len(d.Header) == 0 {
+			return strings.TrimRight(a, "\n") == strings.TrimRight(b, "\n")
+		}
+		return a == b
+	}
+
+	if !reflect.DeepEqual(d.Header, f.Header) {
+		t.Errorf("header %v, expected %v", f.Header, d.Header)
+	}
+	if !reflect.DeepEqual(d.Labels, f.Labels) {
+		t.Errorf("labels %v, expected %v", f.Labels, d.Labels)
+	}
+	if !reflect.DeepEqual(d.BuildData.Files, f.BuildData.Files) {
+		t.Errorf("files %v, expected %v", f.BuildData.Files, d.BuildData.Files)
+	}
+	if !reflect.DeepEqual(d.AppOrder, f.AppOrder) {
+		t.Errorf("app order %v, expected %v", f.AppOrder, d.AppOrder)
+	}
+	for _, name := range formatSections {
+		ds, fs := sectionScript(&d, name), sectionScript(&f, name)
+		if !sameScript(ds.Script, fs.Script) {
+			t.Errorf("%%%s script %q, expected %q", name, fs.Script, ds.Script)
+		} else if ds.Script != "" && strings.TrimSpace(ds.Args) != fs.Args {
+			t.Errorf("%%%s args %q, expected %q", name, fs.Args, ds.Args)
+		}
+	}
+	for k, v := range d.CustomData {
+		if !sameScript(v, f.CustomData[k]) {
+			t.Errorf("%%%s script %q, expected %q", k, f.CustomData[k], v)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/util/slice"
+)
+
+// Rules reported by Lint.
+const (
+	// LintHeader reports header keywords that are invalid or not used by
+	// the bootstrap agent of the build stage.
+	LintHeader = "header"
+	// LintSection reports sections that are not valid.
+	LintSection = "section"
+	// LintDuplicateSection reports sections defined more than once in a build
+	// stage, which are silently merged.
+	LintDuplicateSection = "duplicate-section"
+	// LintFiles reports %files sources that don't exist on the host.
+	LintFiles = "files"
+	// LintBuildArgs reports build arguments of %arguments that are not used.
+	LintBuildArgs = "build-args"
+	// LintErrexit reports build scripts run by a custom shell without
+	// exiting on errors.
+	LintErrexit = "errexit"
+)
+
+var (
+	stageRegexp    = regexp.MustCompile(`(?i)^bootstrap:`)
+	buildArgRegexp = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+	errexitRegexp  = regexp.MustCompile(`^set\s+(.*\s)?(-[a-zA-Z]*e[a-zA-Z]*|-o\s+errexit)(\s|$)`)
+	otherURLRegexp = regexp.MustCompile(`\d+$`)
+)
+
+// agentHeaders lists the header keywords used by each bootstrap agent, in
+// addition to bootstrap and stage.
+var agentHeaders = map[string][]string{
+	"library":        {"from", "library", "fingerprints"},
+	"oras":           {"from", "fingerprints"},
+	"shub":           {"from", "fingerprints"},
+	"docker":         {"from", "registry", "namespace"},
+	"docker-archive": {"from"},
+	"docker-daemon":  {"from"},
+	"oci":            {"from"},
+	"oci-archive":    {"from"},
+	"busybox":        {"mirrorurl"},
+	"debootstrap":    {"osversion", "mirrorurl", "include"},
+	"arch":           {"confurl", "include"},
+	"localimage":     {"from", "fingerprints"},
+	"yum":            {"osversion", "mirrorurl", "updateurl", "include", "setopt"},
+	"dnf":            {"osversion", "mirrorurl", "updateurl", "include", "setopt"},
+	"zypper":         {"osversion", "mirrorurl", "updateurl", "include", "product", "user", "regcode", "productpgp", "registerurl", "modules", "otherurl&n"},
+	"scratch":        {},
+	"buildkit":       {"from", "frontend", "target", "filename", "buildargs"},
+	"dockerfile":     {"from", "frontend", "target", "filename", "buildargs"},
+}
+
+// errexitSections are the build sections run by /bin/sh -e, unless a custom
+// shell is specified with the -c section argument.
+var errexitSections = map[string]bool{
+	"pre":   true,
+	"setup": true,
+	"post":  true,
+}
+
+// Diagnostic is a problem found in a definition file by Lint.
+type Diagnostic struct {
+	// Line is the line of the definition file, starting at 1.
+	Line int
+	// Rule is the rule that reported the problem.
+	Rule string
+	// Message describes the problem.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s (%s)", d.Line, d.Message, d.Rule)
+}
+
+// LintOptions are the options of Lint.
+type LintOptions struct {
+	// Dir is the directory relative %files sources are resolved against,
+	// defaulting to the current working directory.
+	Dir string
+}
+
+type lintLine struct {
+	num  int
+	text string
+}
+
+type lintSection struct {
+	line lintLine
+	name string
+	app  string
+	args string
+	body []lintLine
+}
+
+// key returns the name identifying the section within a build stage.
+func (s *lintSection) key() string {
+	if s.app != "" {
+		return s.name + " " + s.app
+	}
+	return s.name
+}
+
+type lintStage struct {
+	header   []lintLine
+	sections []*lintSection
+}
+
+// scanLintStages splits the definition file raw into build stages, as done by
+// All, and stages into sections, keeping line numbers.
+func scanLintStages(raw []byte) []*lintStage {
+	st := &lintStage{}
+	stages := []*lintStage{st}
+	var sec *lintSection
+
+	for i, text := range strings.Split(string(raw), "\n") {
+		l := lintLine{num: i + 1, text: strings.TrimRight(text, "\r")}
+
+		if stageRegexp.MatchString(l.text) {
+			st = &lintStage{}
+			stages = append(stages, st)
+			sec = nil
+		}
+
+		fields := strings.Fields(l.text)
+		if len(fields) > 0 && fields[0][0] == '%' {
+			sec = &lintSection{
+				line: l,
+				name: strings.ToLower(strings.TrimLeft(fields[0], "%")),
+			}
+			rest := fields[1:]
+			if appSections[sec.name] && len(rest) > 0 {
+				sec.app = rest[0]
+				rest = rest[1:]
+			}
+			sec.args = strings.TrimSpace(strings.Split(strings.Join(rest, " "), "#")[0])
+			st.sections = append(st.sections, sec)
+			continue
+		}
+
+		if sec != nil {
+			sec.body = append(sec.body, l)
+		} else {
+			st.header = append(st.header, l)
+		}
+	}
+
+	return stages
+}
+
+func isCommentLine(text string) bool {
+	text = strings.TrimSpace(text)
+	return strings.HasPrefix(text, "#") && !strings.HasPrefix(text, "#!")
+}
+
+// lintHeader checks that header keywords are valid and used by the bootstrap
+// agent of the stage.
+func (st *lintStage) lintHeader() []Diagnostic {
+	var diags []Diagnostic
+	keys := make(map[string]int)
+	var order []string
+	agent, agentLine := "", 0
+
+	continuation := false
+	for _, l := range st.header {
+		line := strings.TrimSpace(strings.Split(l.text, "#")[0])
+		if line == "" {
+			continuation = false
+			continue
+		}
+		if continuation {
+			continuation = strings.HasSuffix(line, "\\")
+			continue
+		}
+		continuation = strings.HasSuffix(line, "\\")
+
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			diags = append(diags, Diagnostic{l.num, LintHeader, fmt.Sprintf("header line %q has no keyword", line)})
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "bootstrap" {
+			agent, agentLine = strings.ToLower(strings.TrimSpace(val)), l.num
+		}
+		if _, ok := keys[key]; !ok {
+			order = append(order, key)
+		}
+		keys[key] = l.num
+	}
+
+	if agentLine == 0 {
+		if len(keys) > 0 {
+			diags = append(diags, Diagnostic{keys[order[0]], LintHeader, "header has no bootstrap keyword"})
+		}
+		return diags
+	}
+	used, known := agentHeaders[agent]
+	if !known {
+		diags = append(diags, Diagnostic{agentLine, LintHeader, fmt.Sprintf("unknown bootstrap agent %q", agent)})
+	}
+
+	for _, key := range order {
+		name := key
+		if !validHeaders[name] {
+			name = otherURLRegexp.ReplaceAllString(key, "&n")
+		}
+		switch {
+		case !validHeaders[name]:
+			diags = append(diags, Diagnostic{keys[key], LintHeader, fmt.Sprintf("invalid header keyword %q", key)})
+		case name == "bootstrap" || name == "stage" || !known:
+		case !slice.ContainsString(used, name):
+			diags = append(diags, Diagnostic{keys[key], LintHeader, fmt.Sprintf("header keyword %q is not used by the %s bootstrap agent", key, agent)})
+		}
+	}
+
+	return diags
+}
+
+// lintSections checks for invalid and duplicate sections, and for build
+// scripts run by a custom shell without exiting on errors.
+func (st *lintStage) lintSections() []Diagnostic {
+	var diags []Diagnostic
+	seen := make(map[string]int)
+
+	for _, s := range st.sections {
+		if !validSections[s.name] && !appSections[s.name] {
+			diags = append(diags, Diagnostic{s.line.num, LintSection, fmt.Sprintf("invalid section %%%s", s.name)})
+			continue
+		}
+
+		if s.name != "files" {
+			if first, ok := seen[s.key()]; ok {
+				diags = append(diags, Diagnostic{s.line.num, LintDuplicateSection, fmt.Sprintf("section %%%s is merged with the same section at line %d", s.key(), first)})
+			} else {
+				seen[s.key()] = s.line.num
+			}
+		}
+
+		if errexitSections[s.name] && !s.exitsOnError() {
+			diags = append(diags, Diagnostic{s.line.num, LintErrexit, fmt.Sprintf("section %%%s is run by a custom shell without \"set -e\", failing commands won't fail the build", s.name)})
+		}
+	}
+
+	return diags
+}
+
+// exitsOnError returns whether the script of the section exits on the first
+// failing command. Scripts are run by /bin/sh -e, unless a custom shell is
+// specified with the -c section argument.
+func (s *lintSection) exitsOnError() bool {
+	args := strings.Fields(s.args)
+	i := 0
+	for i < len(args) && args[i] != "-c" {
+		i++
+	}
+	if i == len(args) {
+		return true
+	}
+	for _, arg := range args[i+1:] {
+		arg = strings.Trim(arg, `"'`)
+		if arg == "errexit" || (len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.Contains(arg, "e")) {
+			return true
+		}
+	}
+	for _, l := range s.body {
+		if errexitRegexp.MatchString(strings.TrimSpace(l.text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintFiles checks that the sources of %files and %appfiles sections copied
+// from the host exist.
+func (st *lintStage) lintFiles(dir string) []Diagnostic {
+	var diags []Diagnostic
+
+	for _, s := range st.sections {
+		if s.name != "appfiles" && (s.name != "files" || s.args != "") {
+			continue
+		}
+		for _, l := range s.body {
+			line := strings.TrimSpace(l.text)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			src := strings.Trim(fileSplitter.FindString(line), `"`)
+			// sources are expanded by the shell
+			if src == "" || strings.ContainsAny(src, "$`~") || buildArgRegexp.MatchString(src) {
+				continue
+			}
+			path := src
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			if strings.ContainsAny(path, "*?[") {
+				if m, err := filepath.Glob(path); err == nil && len(m) > 0 {
+					continue
+				}
+			} else if _, err := os.Stat(path); err == nil {
+				continue
+			}
+			diags = append(diags, Diagnostic{l.num, LintFiles, fmt.Sprintf("source %s of %%%s doesn't exist", src, s.key())})
+		}
+	}
+
+	return diags
+}
+
+// lintBuildArgs checks that the build arguments of the %arguments sections
+// are used in the stage.
+func (st *lintStage) lintBuildArgs() []Diagnostic {
+	var diags []Diagnostic
+	used := make(map[string]bool)
+	type definition struct {
+		name string
+		line int
+	}
+	var defined []definition
+
+	lines := append([]lintLine{}, st.header...)
+	for _, s := range st.sections {
+		lines = append(lines, s.line)
+		for _, l := range s.body {
+			if s.name == "arguments" {
+				text := strings.TrimSpace(l.text)
+				if name, _, ok := strings.Cut(text, "="); ok && !strings.HasPrefix(text, "#") {
+					defined = append(defined, definition{strings.TrimSpace(name), l.num})
+				}
+			}
+			lines = append(lines, l)
+		}
+	}
+
+	for _, l := range lines {
+		if isCommentLine(l.text) {
+			continue
+		}
+		for _, m := range buildArgRegexp.FindAllStringSubmatch(l.text, -1) {
+			used[m[1]] = true
+		}
+	}
+
+	for _, d := range defined {
+		if !used[d.name] {
+			diags = append(diags, Diagnostic{d.line, LintBuildArgs, fmt.Sprintf("build argument %s is not used as {{ %s }}", d.name, d.name)})
+		}
+	}
+
+	return diags
+}
+
+// Lint reads a definition file from r and returns the problems found in it,
+// sorted by line. Problems are common mistakes which don't prevent parsing the
+// definition file, but lead to unexpected or failing builds, and invalid
+// header keywords and sections, which are reported all at once rather than
+// failing on the first one.
+func Lint(r io.Reader, opts LintOptions) ([]Diagnostic, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("while attempting to read definition file: %v", err)
+	}
+
+	var diags []Diagnostic
+	for _, st := range scanLintStages(raw) {
+		diags = append(diags, st.lintHeader()...)
+		diags = append(diags, st.lintSections()...)
+		diags = append(diags, st.lintFiles(opts.Dir)...)
+		diags = append(diags, st.lintBuildArgs()...)
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Line < diags[j].Line
+	})
+	return diags, nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const lintDef = `Bootstrap: docker
+From: alpine
+MirrorURL: http://example.com
+Invalid: value
+
+%arguments
+    USED=1
+    UNUSED=2
+    # COMMENTED=3
+
+%files
+    exists.txt /opt
+    missing.txt /opt
+    {{ USED }}.txt
+    *.txt /opt
+
+%post -c /bin/bash
+    echo {{ USED }}
+
+%post
+    echo again
+
+%appinstall foo
+    make
+%appinstall foo
+    make install
+%unknown
+    value
+
+Bootstrap: yum
+OSVersion: 9
+MirrorURL: http://example.com
+
+%files from stage
+    missing.txt
+
+%post -c /bin/bash
+    set -euo pipefail
+    false
+
+%setup -c /bin/bash -e
+    false
+`
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "exists.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	diags, err := Lint(strings.NewReader(lintDef), LintOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type result struct {
+		line int
+		rule string
+	}
+	want := []result{
+		{3, LintHeader},
+		{4, LintHeader},
+		{8, LintBuildArgs},
+		{13, LintFiles},
+		{17, LintErrexit},
+		{20, LintDuplicateSection},
+		{25, LintDuplicateSection},
+		{27, LintSection},
+	}
+	var got []result
+	for _, d := range diags {
+		got = append(got, result{d.Line, d.Rule})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected diagnostics:\n%v\nexpected:\n%v", diags, want)
+	}
+}
+
+func TestLintUnknownAgent(t *testing.T) {
+	diags, err := Lint(strings.NewReader("Bootstrap: dockr\nFrom: alpine\n"), LintOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diags) != 1 || diags[0].Line != 1 || diags[0].Rule != LintHeader {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+}
@@ -29,10 +29,12 @@ const (
 	OverlayFeature
 	// FuseFeature means the driver uses FUSE as its base.
 	FuseFeature
+	// ErofsFeature means the driver handles EROFS image mounts.
+	ErofsFeature
 )
 
 // ImageFeature means the driver handles any of the image mount types
-const ImageFeature = SquashFeature | Ext3Feature | GocryptFeature
+const ImageFeature = SquashFeature | Ext3Feature | GocryptFeature | ErofsFeature
 
 // MountFunc defines mount function prototype
 type MountFunc func(source string, target string, filesystem string, flags uintptr, data string) error
@@ -0,0 +1,122 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/ccoveille/go-safecast"
+)
+
+const (
+	erofsSuperOffset = 1024
+	erofsMagic       = 0xE0F5E1E2
+	// block sizes supported by the kernel range from 512 bytes
+	// to the page size
+	erofsMinBlkSzBits = 9
+	erofsMaxBlkSzBits = 16
+)
+
+// this represents the beginning of the superblock of an EROFS image
+type erofsInfo struct {
+	Magic           uint32
+	Checksum        uint32
+	FeatureCompat   uint32
+	BlkSzBits       uint8
+	SbExtSlots      uint8
+	RootNid         uint16
+	Inos            uint64
+	BuildTime       uint64
+	BuildTimeNsec   uint32
+	Blocks          uint32
+	MetaBlkAddr     uint32
+	XattrBlkAddr    uint32
+	UUID            [16]byte
+	VolumeName      [16]byte
+	FeatureIncompat uint32
+}
+
+type erofsFormat struct{}
+
+// CheckErofsHeader checks if byte content contains a valid EROFS header.
+func CheckErofsHeader(b []byte) error {
+	einfo := &erofsInfo{}
+
+	if erofsSuperOffset+unsafe.Sizeof(*einfo) >= uintptr(len(b)) {
+		return debugError("can't find EROFS information header")
+	}
+	buffer := bytes.NewReader(b[erofsSuperOffset:])
+
+	if err := binary.Read(buffer, binary.LittleEndian, einfo); err != nil {
+		return debugError("can't read the top of the image")
+	}
+	if einfo.Magic != erofsMagic {
+		return debugError("not a valid EROFS image")
+	}
+	if einfo.BlkSzBits < erofsMinBlkSzBits || einfo.BlkSzBits > erofsMaxBlkSzBits {
+		return fmt.Errorf("corrupted image: unsupported EROFS block size 2^%d", einfo.BlkSzBits)
+	}
+	sylog.Debugf("EROFS image block size %d, incompatible features 0x%x", 1<<einfo.BlkSzBits, einfo.FeatureIncompat)
+
+	return nil
+}
+
+func (f *erofsFormat) initializer(img *Image, fileinfo os.FileInfo) error {
+	if fileinfo.IsDir() {
+		return debugError("not an EROFS image")
+	}
+	b := make([]byte, bufferSize)
+	if n, err := img.File.Read(b); err != nil || n != bufferSize {
+		return debugErrorf("can't read first %d bytes: %v", bufferSize, err)
+	}
+	if err := CheckErofsHeader(b); err != nil {
+		return err
+	}
+	fSize, err := safecast.Convert[uint64](fileinfo.Size())
+	if err != nil {
+		return err
+	}
+	img.Type = EROFS
+	img.Partitions = []Section{
+		{
+			Offset:       0,
+			Size:         fSize,
+			ID:           1,
+			Type:         EROFS,
+			Name:         RootFs,
+			AllowedUsage: RootFsUsage | OverlayUsage | DataUsage,
+		},
+	}
+
+	if img.Writable {
+		// we set Writable to appropriate value to match the
+		// image open mode as some code may want to ignore this
+		// error by using IsReadOnlyFilesytem check
+		img.Writable = false
+
+		return &readOnlyFilesystemError{
+			"could not set " + img.Path + " image writable: EROFS is a read-only filesystem",
+		}
+	}
+
+	return nil
+}
+
+func (f *erofsFormat) openMode(_ bool) int {
+	return os.O_RDONLY
+}
+
+func (f *erofsFormat) lock(_ *Image) error {
+	return nil
+}
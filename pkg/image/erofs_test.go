@@ -0,0 +1,164 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// erofsHeader returns the first bytes of an EROFS image with the given
+// magic and block size bits.
+func erofsHeader(magic uint32, blkSzBits uint8) []byte {
+	b := make([]byte, bufferSize)
+	binary.LittleEndian.PutUint32(b[erofsSuperOffset:], magic)
+	b[erofsSuperOffset+12] = blkSzBits
+	return b
+}
+
+func TestCheckErofsHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		wantErr bool
+	}{
+		{name: "Valid", header: erofsHeader(erofsMagic, 12)},
+		{name: "BadMagic", header: erofsHeader(0xdeadbeef, 12), wantErr: true},
+		{name: "BadBlockSize", header: erofsHeader(erofsMagic, 30), wantErr: true},
+		{name: "Short", header: erofsHeader(erofsMagic, 12)[:erofsSuperOffset+8], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckErofsHeader(tt.header); (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v (want error %v)", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestErofsInitializer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.erofs")
+	data := append(erofsHeader(erofsMagic, 12), make([]byte, 4096)...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var erofsfmt erofsFormat
+
+	for _, writable := range []bool{false, true} {
+		img := &Image{Path: path, Name: "test", Writable: writable}
+		f, err := os.OpenFile(path, erofsfmt.openMode(writable), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img.File = f
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			t.Fatal(err)
+		}
+
+		err = erofsfmt.initializer(img, fi)
+		f.Close()
+		if writable {
+			if !IsReadOnlyFilesytem(err) {
+				t.Errorf("unexpected error for writable image: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if img.Type != EROFS {
+			t.Errorf("got image type %d, want %d", img.Type, EROFS)
+		}
+		if len(img.Partitions) != 1 {
+			t.Fatalf("got %d partitions, want 1", len(img.Partitions))
+		}
+		if part := img.Partitions[0]; part.Type != EROFS || part.Size != uint64(len(data)) {
+			t.Errorf("unexpected root filesystem partition %+v", part)
+		}
+	}
+
+	// EROFS images are recognized by Init
+	img, err := Init(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.File.Close()
+	if img.Type != EROFS {
+		t.Errorf("got image type %d from Init, want %d", img.Type, EROFS)
+	}
+
+	// directories aren't EROFS images
+	img = &Image{Path: t.TempDir()}
+	fi, err := os.Stat(img.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := erofsfmt.initializer(img, fi); err == nil {
+		t.Errorf("unexpected success with a directory")
+	}
+}
+
+func TestSIFErofsPartition(t *testing.T) {
+	rawPart := func(data []byte) func() (sif.DescriptorInput, error) {
+		return func() (sif.DescriptorInput, error) {
+			return sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader(data),
+				sif.OptPartitionMetadata(sif.FsRaw, sif.PartPrimSys, runtime.GOARCH),
+			)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType uint32
+		wantErr  bool
+	}{
+		{name: "Erofs", data: erofsHeader(erofsMagic, 12), wantType: EROFS},
+		{name: "Raw", data: make([]byte, bufferSize), wantType: RAW},
+		{name: "CorruptedErofs", data: erofsHeader(erofsMagic, 30), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createSIF(t, false, rawPart(tt.data))
+			defer os.Remove(path)
+
+			img, err := Init(path, false)
+			if tt.wantErr {
+				if err == nil {
+					img.File.Close()
+					t.Fatalf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer img.File.Close()
+
+			part, err := img.GetRootFsPartition()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if part.Type != tt.wantType {
+				t.Errorf("got partition type %d, want %d", part.Type, tt.wantType)
+			}
+		})
+	}
+}
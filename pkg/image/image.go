@@ -39,6 +39,8 @@ const (
 	RAW
 	// GOCRYPTFS constant for encrypted gocryptfs format
 	GOCRYPTFSSQUASHFS
+	// EROFS constant for EROFS format
+	EROFS
 )
 
 type Usage uint8
@@ -107,6 +109,7 @@ var registeredFormats = []struct {
 	{"sandbox", &sandboxFormat{}},
 	{"sif", &sifFormat{}},
 	{"squashfs", &squashfsFormat{}},
+	{"erofs", &erofsFormat{}},
 	{"ext3", &ext3Format{}},
 }
 
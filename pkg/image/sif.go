@@ -11,12 +11,15 @@ package image
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
 	"os"
 	"runtime"
+	"slices"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/machine"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
 	"github.com/apptainer/sif/v2/pkg/sif"
 	"github.com/ccoveille/go-safecast"
 )
@@ -51,6 +54,13 @@ func checkPartitionType(img *Image, fstype sif.FSType, offset int64) (uint32, er
 	case sif.FsEncryptedSquashfs:
 		return ENCRYPTSQUASHFS, nil
 	case sif.FsRaw:
+		// SIF doesn't define a filesystem type for EROFS, EROFS
+		// partitions are raw partitions identified by their superblock
+		if err := CheckErofsHeader(header[:]); err == nil {
+			return EROFS, nil
+		} else if _, ok := err.(debugError); !ok {
+			return 0, fmt.Errorf("error while checking EROFS header: %s", err)
+		}
 		return RAW, nil
 	case sif.FsGocryptfsSquashfs:
 		return GOCRYPTFSSQUASHFS, nil
@@ -131,6 +141,7 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 		}
 	}
 
+	start := len(img.Partitions)
 	fimg.WithDescriptors(func(desc sif.Descriptor) bool {
 		offset, err := safecast.Convert[uint64](desc.Offset())
 		if err != nil {
@@ -194,6 +205,13 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 		return false
 	})
 
+	// descriptors of deleted objects are reused while data objects are
+	// always appended, overlay partitions are stacked in the order they
+	// were added to the image
+	slices.SortStableFunc(img.Partitions[start:], func(a, b Section) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+
 	img.Type = SIF
 
 	return nil
@@ -208,12 +226,39 @@ func (f *sifFormat) openMode(writable bool) int {
 
 func (f *sifFormat) lock(img *Image) error {
 	for _, part := range img.Partitions {
-		if part.Type != EXT3 {
-			continue
-		}
-		if err := lockSection(img, part); err != nil {
-			return fmt.Errorf("while locking ext3 partition from %s: %s", img.Path, err)
+		if part.Type == EXT3 {
+			if err := lockSection(img, part); err != nil {
+				return fmt.Errorf("while locking ext3 partition from %s: %s", img.Path, err)
+			}
+		} else if part.AllowedUsage&OverlayUsage != 0 {
+			// read-only overlay layers are always locked for reading,
+			// they are replaced by the overlay seal and merge commands
+			if err := lockLayer(img, part); err != nil {
+				return fmt.Errorf("while locking overlay layer from %s: %s", img.Path, err)
+			}
 		}
 	}
 	return nil
 }
+
+// lockLayer puts a read lock on a read-only overlay layer, preventing its
+// replacement while in use.
+func lockLayer(img *Image, section Section) error {
+	start, err := safecast.Convert[int64](section.Offset)
+	if err != nil {
+		return err
+	}
+	size, err := safecast.Convert[int64](section.Size)
+	if err != nil {
+		return err
+	}
+
+	switch err := lock.NewByteRange(int(img.Fd), start, size).RLock(); err {
+	case lock.ErrByteRangeAcquired:
+		return fmt.Errorf("can't open %s for reading, currently modified by another process", img.Path)
+	case lock.ErrLockNotSupported:
+		return nil
+	default:
+		return err
+	}
+}
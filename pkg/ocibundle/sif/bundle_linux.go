@@ -112,7 +112,13 @@ func (s *sifBundle) Create(ociConfig *specs.Spec) error {
 		return fmt.Errorf("while getting root filesystem in SIF %s: %s", s.image, err)
 	}
 
-	if part.Type != image.SQUASHFS {
+	var fstype string
+	switch part.Type {
+	case image.SQUASHFS:
+		fstype = "squashfs"
+	case image.EROFS:
+		fstype = "erofs"
+	default:
 		return fmt.Errorf("unsupported image fs type: %v", part.Type)
 	}
 	offset := part.Offset
@@ -133,7 +139,7 @@ func (s *sifBundle) Create(ociConfig *specs.Spec) error {
 	defer loopCloser.Close()
 
 	rootFs := tools.RootFs(s.bundlePath).Path()
-	if err := syscall.Mount(loop, rootFs, "squashfs", syscall.MS_RDONLY, ""); err != nil {
+	if err := syscall.Mount(loop, rootFs, fstype, syscall.MS_RDONLY, ""); err != nil {
 		tools.DeleteBundle(s.bundlePath)
 		return fmt.Errorf("failed to mount SIF partition: %s", err)
 	}
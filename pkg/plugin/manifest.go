@@ -27,4 +27,8 @@ type Manifest struct {
 	Version string `json:"version"`
 	// Description describes the plugin.
 	Description string `json:"description"`
+	// Executable is set for plugins implemented by an executable speaking
+	// the JSON protocol described in protocol.go over stdio, rather than
+	// by a Go shared object.
+	Executable bool `json:"executable,omitempty"`
 }
@@ -0,0 +1,111 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import "encoding/json"
+
+// ProtocolVersion is the version of the JSON protocol spoken by executable
+// plugins. It's incremented on incompatible changes only, an executable
+// plugin must answer with the version of the requests it receives.
+const ProtocolVersion = 1
+
+// Methods of the executable plugin protocol. The callback methods are named
+// after the Go callback types defined in pkg/plugin/callback they implement.
+const (
+	// MethodInit returns the plugin manifest and the callback methods
+	// it implements, as an InitResult.
+	MethodInit = "init"
+	// MethodCommand implements the cli.Command callback, it returns the
+	// flags to inject into apptainer commands as a CommandResult.
+	MethodCommand = "cli.Command"
+	// MethodApptainerEngineConfig implements the cli.ApptainerEngineConfig
+	// callback, it receives EngineConfigParams and returns an
+	// EngineConfigResult.
+	MethodApptainerEngineConfig = "cli.ApptainerEngineConfig"
+	// MethodPostStartProcess implements the apptainer.PostStartProcess
+	// callback, it receives PostStartProcessParams and returns no result.
+	MethodPostStartProcess = "apptainer.PostStartProcess"
+)
+
+// Request is a request sent to an executable plugin. The plugin executable
+// is run for each request, which is written as a single JSON object to its
+// standard input. The response must be written as a single JSON object to
+// its standard output, its standard error is passed through to the user.
+type Request struct {
+	Version int             `json:"version"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the response of an executable plugin to a request. A non
+// empty Error reports the failure of the request.
+type Response struct {
+	Version int             `json:"version"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// InitResult is the result of the init method.
+type InitResult struct {
+	Manifest  Manifest `json:"manifest"`
+	Callbacks []string `json:"callbacks"`
+}
+
+// Flag types supported by FlagSpec.
+const (
+	FlagTypeString      = "string"
+	FlagTypeBool        = "bool"
+	FlagTypeStringSlice = "stringSlice"
+)
+
+// FlagSpec describes a flag injected by an executable plugin into
+// apptainer commands.
+type FlagSpec struct {
+	Name      string `json:"name"`
+	ShortHand string `json:"shorthand,omitempty"`
+	Usage     string `json:"usage"`
+	// Type is one of FlagTypeString (default), FlagTypeBool or
+	// FlagTypeStringSlice.
+	Type string `json:"type,omitempty"`
+	// Default is the default value of the flag, in its command line form.
+	Default string   `json:"default,omitempty"`
+	EnvKeys []string `json:"envKeys,omitempty"`
+	// Commands are the names of the commands or command groups the flag
+	// is added to, e.g. "exec" or "actions_instance".
+	Commands []string `json:"commands"`
+}
+
+// CommandResult is the result of the cli.Command method.
+type CommandResult struct {
+	Flags []FlagSpec `json:"flags"`
+}
+
+// EngineConfigParams are the parameters of the cli.ApptainerEngineConfig
+// method.
+type EngineConfigParams struct {
+	// Flags holds the values of the flags injected by the plugin, by name.
+	Flags map[string]interface{} `json:"flags"`
+	// Config is the JSON representation of the engine configuration.
+	Config json.RawMessage `json:"config"`
+}
+
+// EngineConfigResult is the result of the cli.ApptainerEngineConfig method.
+type EngineConfigResult struct {
+	// Config is the modified engine configuration, it's decoded over the
+	// current one. Plugins can store their own data for later callbacks
+	// in its "plugin" object, under the plugin name.
+	Config json.RawMessage `json:"config"`
+}
+
+// PostStartProcessParams are the parameters of the
+// apptainer.PostStartProcess method.
+type PostStartProcessParams struct {
+	Config json.RawMessage `json:"config"`
+	Pid    int             `json:"pid"`
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci"
 	"github.com/apptainer/apptainer/pkg/image"
@@ -70,6 +71,27 @@ type DMTCPConfig struct {
 	Args       []string `json:"args,omitempty"`
 }
 
+// SupervisionConfig stores the restart policy and the health check
+// applied by the init process of an instance to the instance process.
+type SupervisionConfig struct {
+	RestartPolicy  string        `json:"restartPolicy,omitempty"`
+	MaxRestarts    int           `json:"maxRestarts,omitempty"`
+	HealthCmd      string        `json:"healthCmd,omitempty"`
+	HealthInterval time.Duration `json:"healthInterval,omitempty"`
+	HealthRetries  int           `json:"healthRetries,omitempty"`
+}
+
+// Enabled returns whether a restart policy or a health check is set.
+func (s SupervisionConfig) Enabled() bool {
+	return (s.RestartPolicy != "" && s.RestartPolicy != "no") || s.HealthCmd != ""
+}
+
+// LogRotationConfig stores the rotation settings of the instance log files.
+type LogRotationConfig struct {
+	MaxSize  int64 `json:"maxSize,omitempty"`
+	MaxFiles int   `json:"maxFiles,omitempty"`
+}
+
 type UserInfo struct {
 	Username string         `json:"username,omitempty"`
 	Home     string         `json:"home,omitempty"`
@@ -94,6 +116,9 @@ type JSONConfig struct {
 	ApptainerEnv          map[string]string `json:"apptainerEnv,omitempty"`
 	UnixSocketPair        [2]int            `json:"unixSocketPair,omitempty"`
 	OpenFd                []int             `json:"openFd,omitempty"`
+	InstanceStatePair     [2]int            `json:"instanceStatePair,omitempty"`
+	InstanceLogPipes      [2][2]int         `json:"instanceLogPipes,omitempty"`
+	InstancePts           [2]int            `json:"instancePts,omitempty"`
 	TargetGID             []int             `json:"targetGID,omitempty"`
 	Image                 string            `json:"image"`
 	ImageArg              string            `json:"imageArg"`
@@ -148,6 +173,9 @@ type JSONConfig struct {
 	DeleteTempDir         string            `json:"deleteTempDir,omitempty"`
 	Umask                 int               `json:"umask,omitempty"`
 	DMTCPConfig           DMTCPConfig       `json:"dmtcpConfig,omitempty"`
+	Supervision           SupervisionConfig `json:"supervision,omitempty"`
+	LogRotation           LogRotationConfig `json:"logRotation,omitempty"`
+	InstanceTerminal      bool              `json:"instanceTerminal,omitempty"`
 	XdgRuntimeDir         string            `json:"xdgRuntimeDir,omitempty"`
 	DbusSessionBusAddress string            `json:"dbusSessionBusAddress,omitempty"`
 	NoEval                bool              `json:"noEval,omitempty"`
@@ -900,6 +928,75 @@ func (e *EngineConfig) GetDMTCPConfig() DMTCPConfig {
 	return e.JSON.DMTCPConfig
 }
 
+// SetSupervision sets the restart policy and health check of an instance.
+func (e *EngineConfig) SetSupervision(config SupervisionConfig) {
+	e.JSON.Supervision = config
+}
+
+// GetSupervision returns the restart policy and health check of an instance.
+func (e *EngineConfig) GetSupervision() SupervisionConfig {
+	return e.JSON.Supervision
+}
+
+// SetInstanceStatePair sets a unix socketpair used by the instance
+// init process to report the supervision state to the master process.
+func (e *EngineConfig) SetInstanceStatePair(fds [2]int) {
+	e.JSON.InstanceStatePair = fds
+}
+
+// GetInstanceStatePair returns the unix socketpair previously set
+// in stage one by the engine.
+func (e *EngineConfig) GetInstanceStatePair() [2]int {
+	return e.JSON.InstanceStatePair
+}
+
+// SetLogRotation sets the rotation settings of the instance log files.
+func (e *EngineConfig) SetLogRotation(config LogRotationConfig) {
+	e.JSON.LogRotation = config
+}
+
+// GetLogRotation returns the rotation settings of the instance log files.
+func (e *EngineConfig) GetLogRotation() LogRotationConfig {
+	return e.JSON.LogRotation
+}
+
+// SetInstanceLogPipes sets the pipes, for the standard output and error
+// streams, through which the instance output is sent to the master process
+// writing it to the log files.
+func (e *EngineConfig) SetInstanceLogPipes(pipes [2][2]int) {
+	e.JSON.InstanceLogPipes = pipes
+}
+
+// GetInstanceLogPipes returns the pipes previously set in stage one by
+// the engine.
+func (e *EngineConfig) GetInstanceLogPipes() [2][2]int {
+	return e.JSON.InstanceLogPipes
+}
+
+// SetInstanceTerminal sets if the instance process runs with a
+// pseudo-terminal which can be attached to.
+func (e *EngineConfig) SetInstanceTerminal(terminal bool) {
+	e.JSON.InstanceTerminal = terminal
+}
+
+// GetInstanceTerminal returns if the instance process runs with a
+// pseudo-terminal which can be attached to.
+func (e *EngineConfig) GetInstanceTerminal() bool {
+	return e.JSON.InstanceTerminal
+}
+
+// SetInstancePts sets the master and slave side of the pseudo-terminal
+// allocated for the instance process.
+func (e *EngineConfig) SetInstancePts(pts [2]int) {
+	e.JSON.InstancePts = pts
+}
+
+// GetInstancePts returns the master and slave side of the pseudo-terminal
+// previously set in stage one by the engine.
+func (e *EngineConfig) GetInstancePts() [2]int {
+	return e.JSON.InstancePts
+}
+
 // SetXdgRuntimeDir sets a XDG_RUNTIME_DIR value for rootless operations
 func (e *EngineConfig) SetXdgRuntimeDir(path string) {
 	e.JSON.XdgRuntimeDir = path
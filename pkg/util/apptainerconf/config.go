@@ -98,10 +98,12 @@ type File struct {
 	AllowContainerEncrypted   bool     `default:"yes" authorized:"yes,no" directive:"allow container encrypted"`
 	AllowContainerSquashfs    bool     `default:"yes" authorized:"yes,no" directive:"allow container squashfs"`
 	AllowContainerExtfs       bool     `default:"yes" authorized:"yes,no" directive:"allow container extfs"`
+	AllowContainerErofs       bool     `default:"yes" authorized:"yes,no" directive:"allow container erofs"`
 	AllowContainerDir         bool     `default:"yes" authorized:"yes,no" directive:"allow container dir"`
 	AllowSetuidMountEncrypted bool     `default:"yes" authorized:"yes,no" directive:"allow setuid-mount encrypted"`
 	AllowSetuidMountSquashfs  string   `default:"iflimited" authorized:"yes,no,iflimited" directive:"allow setuid-mount squashfs"`
 	AllowSetuidMountExtfs     bool     `default:"no" authorized:"yes,no" directive:"allow setuid-mount extfs"`
+	AllowSetuidMountErofs     bool     `default:"no" authorized:"yes,no" directive:"allow setuid-mount erofs"`
 	AlwaysUseNv               bool     `default:"no" authorized:"yes,no" directive:"always use nv"`
 	UseNvCCLI                 bool     `default:"no" authorized:"yes,no" directive:"use nvidia-container-cli"`
 	AlwaysUseRocm             bool     `default:"no" authorized:"yes,no" directive:"always use rocm"`
@@ -122,6 +124,7 @@ type File struct {
 	MemoryFSType              string   `default:"tmpfs" authorized:"tmpfs,ramfs" directive:"memory fs type"`
 	CniConfPath               string   `directive:"cni configuration path"`
 	CniPluginPath             string   `directive:"cni plugin path"`
+	OciHooksPath              string   `directive:"oci hooks path"`
 	BinaryPath                string   `default:"$PATH:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin" directive:"binary path"`
 	// SuidBinaryPath is hidden; it is not referenced below, and overwritten
 	SuidBinaryPath      string `directive:"suidbinary path"`
@@ -131,6 +134,10 @@ type File struct {
 	DownloadConcurrency uint   `default:"3" directive:"download concurrency"`
 	DownloadPartSize    uint   `default:"5242880" directive:"download part size"`
 	DownloadBufferSize  uint   `default:"32768" directive:"download buffer size"`
+	CacheMaxSize        string `directive:"cache max size"`
+	SharedCacheDir      string `directive:"shared cache dir"`
+	InstanceLogMaxSize  string `directive:"instance log max size"`
+	InstanceLogMaxFiles uint   `default:"5" directive:"instance log max files"`
 	SystemdCgroups      bool   `default:"yes" authorized:"yes,no" directive:"systemd cgroups"`
 	// apptheus unix socket
 	ApptheusSocketPath string `default:"/run/apptheus/gateway.sock" directive:"apptheus communication socket path"`
@@ -406,6 +413,7 @@ allow container encrypted = {{ if eq .AllowContainerEncrypted true }}yes{{ else
 # Allow use of non-SIF image formats
 allow container squashfs = {{ if eq .AllowContainerSquashfs true }}yes{{ else }}no{{ end }}
 allow container extfs = {{ if eq .AllowContainerExtfs true }}yes{{ else }}no{{ end }}
+allow container erofs = {{ if eq .AllowContainerErofs true }}yes{{ else }}no{{ end }}
 allow container dir = {{ if eq .AllowContainerDir true }}yes{{ else }}no{{ end }}
 
 # ALLOW SETUID-MOUNT ${TYPE}: [see specific types below]
@@ -453,6 +461,16 @@ allow container dir = {{ if eq .AllowContainerDir true }}yes{{ else }}no{{ end }
 # this option is enabled in setuid mode. That is why this option defaults to
 # "no".  Change it at your own risk.
 {{ if eq .AllowSetuidMountExtfs false}}# {{ end }}allow setuid-mount extfs = {{ if eq .AllowSetuidMountExtfs true}}yes{{ else }}no{{ end }}
+#
+# ALLOW SETUID-MOUNT EROFS: [BOOL]
+# DEFAULT: no
+# Allow mounting of EROFS filesystem types by the kernel in setuid mode, both
+# inside and outside of SIF files.  If set to "no", the erofsfuse FUSE-based
+# alternative will be used, the same one used in unprivileged user namespace
+# mode.
+# WARNING: as for extfs, a "yes" here while still allowing users write access
+# to the underlying filesystem data enables potential attacks on the kernel.
+{{ if eq .AllowSetuidMountErofs false}}# {{ end }}allow setuid-mount erofs = {{ if eq .AllowSetuidMountErofs true}}yes{{ else }}no{{ end }}
 
 # ALLOW NET USERS: [STRING]
 # DEFAULT: NULL
@@ -552,6 +570,15 @@ memory fs type = {{ .MemoryFSType }}
 #cni plugin path =
 {{ if ne .CniPluginPath "" }}cni plugin path = {{ .CniPluginPath }}{{ end }}
 
+# OCI HOOKS PATH: [STRING]
+# DEFAULT: Undefined
+# Defines the directory holding OCI hook configuration files (in the
+# oci-hooks.d JSON format) applied to containers run by the native runtime.
+# The prestart, createRuntime, poststart and poststop stages are supported,
+# hooks are executed with the privileges of the user running the container.
+#oci hooks path =
+{{ if ne .OciHooksPath "" }}oci hooks path = {{ .OciHooksPath }}{{ end }}
+
 # BINARY PATH: [STRING]
 # DEFAULT: $PATH:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
 # Colon-separated list of directories to search for many binaries.  May include
@@ -616,6 +643,42 @@ download part size = {{ .DownloadPartSize }}
 # are enabled.
 download buffer size = {{ .DownloadBufferSize }}
 
+# CACHE MAX SIZE: [STRING]
+# DEFAULT: Unlimited
+# This option specifies the maximum size of the user image cache, e.g. 20G
+# for 20gb or 500M for 500mb. When the cache grows beyond it, the least
+# recently used entries are automatically evicted after each download.
+# It can be overridden by users with the APPTAINER_CACHE_MAX_SIZE
+# environment variable.
+# cache max size = 20G
+{{ if ne .CacheMaxSize "" }}cache max size = {{ .CacheMaxSize }}{{ end }}
+
+# SHARED CACHE DIR: [STRING]
+# DEFAULT: Undefined
+# This option specifies the location of a read-only image cache shared
+# between all users, which is consulted before the user cache. It can be
+# populated by an administrator by running pulls or builds with the
+# APPTAINER_CACHEDIR environment variable set to this location. Entries are
+# verified against their digest before being used.
+# shared cache dir = /var/lib/apptainer
+{{ if ne .SharedCacheDir "" }}shared cache dir = {{ .SharedCacheDir }}{{ end }}
+
+# INSTANCE LOG MAX SIZE: [STRING]
+# DEFAULT: Unlimited
+# This option specifies the default maximum size of the standard output and
+# error log files of instances, e.g. 10M for 10mb. When a log file would grow
+# beyond it, it's rotated while the instance keeps running. It can be
+# overridden with the instance start --log-max-size option.
+# instance log max size = 10M
+{{ if ne .InstanceLogMaxSize "" }}instance log max size = {{ .InstanceLogMaxSize }}{{ end }}
+
+# INSTANCE LOG MAX FILES: [UINT]
+# DEFAULT: 5
+# This option specifies the default number of rotated log files kept for
+# each instance log file, the oldest ones are removed. It can be overridden
+# with the instance start --log-max-files option.
+instance log max files = {{ .InstanceLogMaxFiles }}
+
 # SYSTEMD CGROUPS: [BOOL]
 # DEFAULT: yes
 # Whether to use systemd to manage container cgroups. Required for rootless cgroups
@@ -16,6 +16,7 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -50,6 +51,18 @@ const (
 	Hash = 32
 )
 
+const (
+	// recipientHeader is the PEM header of RSA messages holding the
+	// fingerprint of the public key used to encrypt the data key.
+	recipientHeader = "Recipient"
+	// dataKeyHeader is the PEM header of RSA messages set to
+	// passphraseDataKey when the data key is the passphrase the image
+	// was built with, by versions not generating a data key for
+	// passphrase images.
+	dataKeyHeader     = "Data-Key"
+	passphraseDataKey = "passphrase"
+)
+
 // KeyInfo contains information for passing around
 // or extracting a passphrase for an encrypted container
 type KeyInfo struct {
@@ -58,6 +71,13 @@ type KeyInfo struct {
 	Path     string
 }
 
+// Fingerprint returns the SHA-256 fingerprint of an RSA public key, it
+// identifies the recipients of the data key of an encrypted image.
+func Fingerprint(pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(pub))
+	return hex.EncodeToString(sum[:])
+}
+
 func getRandomBytes(size int) ([]byte, error) {
 	buf := make([]byte, size)
 	_, err := rand.Read(buf)
@@ -67,24 +87,32 @@ func getRandomBytes(size int) ([]byte, error) {
 	return buf, nil
 }
 
+// NewPlaintextKey returns a new random data key for an image encrypted with
+// k. The data key is encrypted with the PEM key, or with the passphrase in
+// the descriptor returned by NewPassphraseKeyInput, so that the passphrase
+// can be changed without re-encrypting the image.
 func NewPlaintextKey(k KeyInfo) ([]byte, error) {
 	switch k.Format {
-	case PEM:
-		// in this case we will generate a random secret and
-		// encrypt it using the PEM key.use the PEM key to
-		// encrypt a secret
+	case PEM, Passphrase:
 		return getRandomBytes(64)
 
-	case Passphrase:
-		// return the original value unmodified
-		return []byte(k.Material), nil
-
 	default:
 		return nil, ErrUnsupportedKeyURI
 	}
 }
 
 func EncryptKey(k KeyInfo, plaintext []byte) ([]byte, error) {
+	return encryptKey(k, plaintext, map[string]string{})
+}
+
+// EncryptPassphraseKey returns the PEM message holding the passphrase of an
+// image built with a passphrase by older versions, which is its data key,
+// encrypted for k.
+func EncryptPassphraseKey(k KeyInfo, passphrase []byte) ([]byte, error) {
+	return encryptKey(k, passphrase, map[string]string{dataKeyHeader: passphraseDataKey})
+}
+
+func encryptKey(k KeyInfo, plaintext []byte, headers map[string]string) ([]byte, error) {
 	switch k.Format {
 	case PEM, ENV:
 		pubKey, err := LoadPEMPublicKey(k)
@@ -113,7 +141,8 @@ func EncryptKey(k KeyInfo, plaintext []byte) ([]byte, error) {
 
 		var buf bytes.Buffer
 
-		if err := savePEMMessage(&buf, cipherText.Bytes()); err != nil {
+		headers[recipientHeader] = Fingerprint(pubKey)
+		if err := savePEMMessage(&buf, cipherText.Bytes(), headers); err != nil {
 			return nil, fmt.Errorf("serializing encrypted key: %v", err)
 		}
 
@@ -127,6 +156,9 @@ func EncryptKey(k KeyInfo, plaintext []byte) ([]byte, error) {
 	}
 }
 
+// PlaintextKey returns the data key of the encrypted SIF image decrypted
+// with k. Without image, the data key of a passphrase is the passphrase, as
+// for images built with a passphrase by older versions.
 func PlaintextKey(k KeyInfo, image string) ([]byte, error) {
 	switch k.Format {
 	case PEM, ENV:
@@ -135,42 +167,21 @@ func PlaintextKey(k KeyInfo, image string) ([]byte, error) {
 			return nil, fmt.Errorf("could not load PEM private key: %v", err)
 		}
 
-		pemKey, err := getEncryptionKeyFromImage(image)
+		messages, err := getEncryptionMessages(image, sif.MessageRSAOAEP)
 		if err != nil {
 			return nil, fmt.Errorf("could not get encryption information from SIF: %v", err)
 		}
-
-		pemBuf := bytes.NewReader(pemKey)
-
-		encKey, err := loadPEMMessage(pemBuf)
-		if err != nil {
-			return nil, fmt.Errorf("could not unpack LUKS PEM from SIF: %v", err)
+		if len(messages) == 0 {
+			return nil, fmt.Errorf("could not get encryption information from SIF: could not read LUKS key from %s: %v", image, ErrEncryptedKeyNotFound)
 		}
 
-		msglen := len(encKey)
-		step := privateKey.Size()
-		var plainText bytes.Buffer
-
-		for start := 0; start < msglen; start = start + step {
-			finish := start + step
-			if finish > msglen {
-				finish = msglen
-			}
-			plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encKey[start:finish], nil)
-			if err != nil {
-				return nil, fmt.Errorf("could not decrypt LUKS key: %v", err)
-			}
-
-			_, err = plainText.Write(plaintext)
-			if err != nil {
-				return nil, fmt.Errorf("could not write decrypt LUKS key to buffer: %v", err)
-			}
-		}
-
-		return plainText.Bytes(), nil
+		return decryptRSAMessages(privateKey, messages)
 
 	case Passphrase:
-		return []byte(k.Material), nil
+		if image == "" {
+			return []byte(k.Material), nil
+		}
+		return passphrasePlaintextKey(k.Material, image)
 
 	default:
 		return nil, ErrUnsupportedKeyURI
@@ -279,49 +290,129 @@ func LoadPEMPublicKeyEnvVar(en string) (*rsa.PublicKey, error) {
 	return x509.ParsePKCS1PublicKey(block.Bytes)
 }
 
-func loadPEMMessage(r io.Reader) ([]byte, error) {
+func loadPEMMessage(r io.Reader) ([]byte, map[string]string, error) {
 	b, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	block, _ := pem.Decode(b)
 	if block == nil {
-		return nil, fmt.Errorf("could not load decode PEM key %s: %v", r, ErrNoPEMData)
+		return nil, nil, fmt.Errorf("could not load decode PEM key %s: %v", r, ErrNoPEMData)
 	}
 
 	var buf []byte
 	if _, err := asn1.Unmarshal(block.Bytes, &buf); err != nil {
-		return nil, fmt.Errorf("could not unmarshal key asn1 data: %v", err)
+		return nil, nil, fmt.Errorf("could not unmarshal key asn1 data: %v", err)
 	}
 
-	return buf, nil
+	return buf, block.Headers, nil
 }
 
-func savePEMMessage(w io.Writer, msg []byte) error {
+func savePEMMessage(w io.Writer, msg []byte, headers map[string]string) error {
 	asn1Bytes, err := asn1.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
 	b := &pem.Block{
-		Type:  "MESSAGE",
-		Bytes: asn1Bytes,
+		Type:    "MESSAGE",
+		Headers: headers,
+		Bytes:   asn1Bytes,
 	}
 
 	return pem.Encode(w, b)
 }
 
-func getEncryptionKeyFromImage(fn string) ([]byte, error) {
+// decryptRSAMessages returns the data key of the first RSA message which
+// can be decrypted with the private key, messages for other recipients
+// are skipped.
+func decryptRSAMessages(privateKey *rsa.PrivateKey, messages [][]byte) ([]byte, error) {
+	fingerprint := Fingerprint(&privateKey.PublicKey)
+	err := fmt.Errorf("could not read LUKS key: %v", ErrEncryptedKeyNotFound)
+
+	for _, m := range messages {
+		encKey, headers, perr := loadPEMMessage(bytes.NewReader(m))
+		if perr != nil {
+			err = fmt.Errorf("could not unpack LUKS PEM from SIF: %v", perr)
+			continue
+		}
+		// messages created by older versions don't identify
+		// their recipient
+		if r, ok := headers[recipientHeader]; ok && r != fingerprint {
+			continue
+		}
+		plaintext, derr := decryptRSAMessage(privateKey, encKey)
+		if derr == nil {
+			return plaintext, nil
+		}
+		err = fmt.Errorf("could not decrypt LUKS key: %v", derr)
+	}
+
+	return nil, err
+}
+
+func decryptRSAMessage(privateKey *rsa.PrivateKey, encKey []byte) ([]byte, error) {
+	msglen := len(encKey)
+	step := privateKey.Size()
+	var plainText bytes.Buffer
+
+	for start := 0; start < msglen; start = start + step {
+		finish := start + step
+		if finish > msglen {
+			finish = msglen
+		}
+		plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encKey[start:finish], nil)
+		if err != nil {
+			return nil, err
+		}
+		plainText.Write(plaintext)
+	}
+
+	return plainText.Bytes(), nil
+}
+
+// getEncryptionMessages returns the PEM crypto messages of the given type
+// linked to the primary system partition of a SIF image.
+func getEncryptionMessages(fn string, message sif.MessageType) ([][]byte, error) {
 	img, err := sif.LoadContainerFromPath(fn, sif.OptLoadWithFlag(os.O_RDONLY))
 	if err != nil {
 		return nil, fmt.Errorf("could not load container: %w", err)
 	}
 	defer img.UnloadContainer()
 
+	_, descr, err := getCryptoMessages(img, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages [][]byte
+	for _, d := range descr {
+		if d.message != message {
+			continue
+		}
+		key, err := d.GetData()
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve LUKS key data from %s: %w", fn, err)
+		}
+		messages = append(messages, key)
+	}
+
+	return messages, nil
+}
+
+// cryptoMessage is a PEM crypto message descriptor.
+type cryptoMessage struct {
+	sif.Descriptor
+	message sif.MessageType
+}
+
+// getCryptoMessages returns the primary system partition descriptor of a
+// SIF image and its linked PEM crypto message descriptors.
+func getCryptoMessages(img *sif.FileImage, fn string) (sif.Descriptor, []cryptoMessage, error) {
 	primDescr, err := img.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve primary system partition from '%s': %w", fn, err)
+		return primDescr, nil, fmt.Errorf("could not retrieve primary system partition from '%s': %w", fn, err)
 	}
 
 	descr, err := img.GetDescriptors(
@@ -329,30 +420,19 @@ func getEncryptionKeyFromImage(fn string) ([]byte, error) {
 		sif.WithDataType(sif.DataCryptoMessage),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve linked descriptors for primary system partition from %s: %w", fn, err)
+		return primDescr, nil, fmt.Errorf("could not retrieve linked descriptors for primary system partition from %s: %w", fn, err)
 	}
 
+	var messages []cryptoMessage
 	for _, d := range descr {
 		format, message, err := d.CryptoMessageMetadata()
 		if err != nil {
-			return nil, fmt.Errorf("could not get crypto message metadata: %w", err)
+			return primDescr, nil, fmt.Errorf("could not get crypto message metadata: %w", err)
 		}
-
-		// currently only support one type of message
-		if format != sif.FormatPEM || message != sif.MessageRSAOAEP {
-			continue
+		if format == sif.FormatPEM {
+			messages = append(messages, cryptoMessage{Descriptor: d, message: message})
 		}
-
-		// TODO(ian): For now, assume the first linked message is what we
-		// are looking for. We should consider what we want to do in the
-		// case of multiple linked messages
-		key, err := d.GetData()
-		if err != nil {
-			return nil, fmt.Errorf("could not retrieve LUKS key data from %s: %w", fn, err)
-		}
-
-		return key, nil
 	}
 
-	return nil, fmt.Errorf("could not read LUKS key from %s: %v", fn, ErrEncryptedKeyNotFound)
+	return primDescr, messages, nil
 }
@@ -0,0 +1,199 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cryptkey
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"golang.org/x/crypto/scrypt"
+)
+
+// passphraseKeyName is the name of the generic SIF descriptors, linked to
+// the encrypted partition, holding its data key encrypted with AES-256-GCM
+// and a key derived from a passphrase with scrypt. SIF crypto messages are
+// only defined for OpenPGP and RSA-OAEP, the versions not supporting
+// passphrase keys ignore these descriptors.
+const passphraseKeyName = "passphrase-key.pem"
+
+const (
+	kdfHeader   = "Key-Derivation"
+	saltHeader  = "Salt"
+	nonceHeader = "Nonce"
+
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+	scryptMaxN = 1 << 20
+	saltSize   = 32
+)
+
+var errBadPassphraseMessage = errors.New("invalid passphrase message")
+
+func passphraseCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptKeyWithPassphrase returns the PEM message holding the data key
+// encrypted with the passphrase.
+func EncryptKeyWithPassphrase(passphrase string, plaintext []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+
+	salt, err := getRandomBytes(saltSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate salt: %v", err)
+	}
+	aead, err := passphraseCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive key from passphrase: %v", err)
+	}
+	nonce, err := getRandomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %v", err)
+	}
+
+	headers := map[string]string{
+		kdfHeader:   fmt.Sprintf("scrypt,%d,%d,%d", scryptN, scryptR, scryptP),
+		saltHeader:  base64.StdEncoding.EncodeToString(salt),
+		nonceHeader: base64.StdEncoding.EncodeToString(nonce),
+	}
+
+	var buf bytes.Buffer
+	if err := savePEMMessage(&buf, aead.Seal(nil, nonce, plaintext, nil), headers); err != nil {
+		return nil, fmt.Errorf("serializing encrypted key: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// NewPassphraseKeyInput returns the descriptor input holding the data key
+// encrypted with the passphrase, linked to the encrypted partition id.
+func NewPassphraseKeyInput(passphrase string, plaintext []byte, id uint32) (sif.DescriptorInput, error) {
+	data, err := EncryptKeyWithPassphrase(passphrase, plaintext)
+	if err != nil {
+		return sif.DescriptorInput{}, err
+	}
+	di, err := sif.NewDescriptorInput(sif.DataGeneric, bytes.NewReader(data),
+		sif.OptLinkedID(id),
+		sif.OptObjectName(passphraseKeyName),
+	)
+	if err != nil {
+		return sif.DescriptorInput{}, fmt.Errorf("while creating passphrase key descriptor: %w", err)
+	}
+	return di, nil
+}
+
+// decryptPassphraseMessage returns the data key of a passphrase message.
+func decryptPassphraseMessage(passphrase string, msg []byte) ([]byte, error) {
+	encKey, headers, err := loadPEMMessage(bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	var n, r, p int
+	if _, err := fmt.Sscanf(headers[kdfHeader], "scrypt,%d,%d,%d", &n, &r, &p); err != nil {
+		return nil, fmt.Errorf("%w: unsupported key derivation %q", errBadPassphraseMessage, headers[kdfHeader])
+	}
+	// don't let an image require an unbounded amount of memory
+	if n <= 1 || n > scryptMaxN || r <= 0 || r > 32 || p <= 0 || p > 16 {
+		return nil, fmt.Errorf("%w: invalid key derivation parameters", errBadPassphraseMessage)
+	}
+	salt, err := base64.StdEncoding.DecodeString(headers[saltHeader])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid salt: %v", errBadPassphraseMessage, err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(headers[nonceHeader])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid nonce: %v", errBadPassphraseMessage, err)
+	}
+
+	aead, err := passphraseCipher(passphrase, salt, n, r, p)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive key from passphrase: %v", err)
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce size", errBadPassphraseMessage)
+	}
+	return aead.Open(nil, nonce, encKey, nil)
+}
+
+// getPassphraseKeys returns the passphrase key descriptors linked to the
+// primary system partition of a SIF image.
+func getPassphraseKeys(img *sif.FileImage, primDescr sif.Descriptor) ([]sif.Descriptor, error) {
+	descr, err := img.GetDescriptors(
+		sif.WithLinkedID(primDescr.ID()),
+		sif.WithDataType(sif.DataGeneric),
+		func(d sif.Descriptor) (bool, error) { return d.Name() == passphraseKeyName, nil },
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve passphrase keys: %w", err)
+	}
+	return descr, nil
+}
+
+// passphrasePlaintextKey returns the data key of an image decrypted with
+// the passphrase. Without passphrase key, the image was built by an older
+// version with the passphrase as data key.
+func passphrasePlaintextKey(passphrase string, fn string) ([]byte, error) {
+	img, err := sif.LoadContainerFromPath(fn, sif.OptLoadWithFlag(os.O_RDONLY))
+	if err != nil {
+		return nil, fmt.Errorf("could not load container: %w", err)
+	}
+	defer img.UnloadContainer()
+
+	primDescr, messages, err := getCryptoMessages(img, fn)
+	if err != nil {
+		return nil, err
+	}
+	descr, err := getPassphraseKeys(img, primDescr)
+	if err != nil {
+		return nil, err
+	}
+	if len(descr) == 0 {
+		// the RSA messages of images built with a passphrase are
+		// marked as holding the passphrase
+		for _, m := range messages {
+			if m.message == sif.MessageRSAOAEP && !isPassphraseDataKey(m) {
+				return nil, fmt.Errorf("could not decrypt LUKS key: %s is not encrypted with a passphrase", fn)
+			}
+		}
+		return []byte(passphrase), nil
+	}
+
+	err = fmt.Errorf("could not decrypt LUKS key with the passphrase")
+	for _, d := range descr {
+		msg, gerr := d.GetData()
+		if gerr != nil {
+			return nil, fmt.Errorf("could not retrieve passphrase key data from %s: %w", fn, gerr)
+		}
+		plaintext, derr := decryptPassphraseMessage(passphrase, msg)
+		if derr == nil {
+			return plaintext, nil
+		}
+		if errors.Is(derr, errBadPassphraseMessage) {
+			err = derr
+		}
+	}
+	return nil, err
+}
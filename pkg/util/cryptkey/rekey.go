@@ -0,0 +1,185 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cryptkey
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// RekeyOptions holds the changes applied by Rekey to the data key
+// messages of an encrypted image.
+type RekeyOptions struct {
+	// AddRecipients are the PEM public keys to encrypt the data key for.
+	AddRecipients []KeyInfo
+	// RemoveRecipients are the PEM public keys whose data key
+	// messages are removed.
+	RemoveRecipients []KeyInfo
+	// NewPassphrase replaces the passphrase protecting the data key.
+	NewPassphrase string
+	// RemovePassphrase removes the passphrase protecting the data key.
+	RemovePassphrase bool
+}
+
+// Rekey changes the recipients and the passphrase able to decrypt the
+// encrypted root filesystem of a SIF image, the data key is decrypted with
+// k and only its encrypted copies are rewritten, not the partition itself.
+// New messages are added before the removed ones are deleted, so an
+// interrupted rekey doesn't lose access to the image.
+func Rekey(image string, k KeyInfo, opts RekeyOptions) error {
+	plaintext, err := PlaintextKey(k, image)
+	if err != nil {
+		return fmt.Errorf("could not decrypt data key: %v", err)
+	}
+
+	img, err := sif.LoadContainerFromPath(image, sif.OptLoadWithFlag(os.O_RDWR))
+	if err != nil {
+		return fmt.Errorf("could not load container: %w", err)
+	}
+	defer img.UnloadContainer()
+
+	primDescr, messages, err := getCryptoMessages(img, image)
+	if err != nil {
+		return err
+	}
+	if fs, _, _, err := primDescr.PartitionMetadata(); err != nil {
+		return fmt.Errorf("could not get primary partition metadata: %w", err)
+	} else if fs != sif.FsEncryptedSquashfs && fs != sif.FsGocryptfsSquashfs {
+		return fmt.Errorf("%s is not an encrypted image", image)
+	}
+
+	passphraseKeys, err := getPassphraseKeys(img, primDescr)
+	if err != nil {
+		return err
+	}
+
+	// without passphrase key, the passphrase of an image built with a
+	// passphrase by an older version is its data key, it would still
+	// decrypt the image after being changed or removed
+	legacyPassphrase := false
+	if len(passphraseKeys) == 0 {
+		legacyPassphrase = k.Format == Passphrase
+		for _, m := range messages {
+			if m.message == sif.MessageRSAOAEP && isPassphraseDataKey(m) {
+				legacyPassphrase = true
+			}
+		}
+	}
+	if legacyPassphrase && (opts.NewPassphrase != "" || opts.RemovePassphrase) {
+		return fmt.Errorf("the passphrase of %s is its data key and can't be changed or removed, rebuild the image instead", image)
+	}
+
+	remove := make(map[uint32]bool)
+	for _, r := range opts.RemoveRecipients {
+		pubKey, err := LoadPEMPublicKey(r)
+		if err != nil {
+			return err
+		}
+		fingerprint := Fingerprint(pubKey)
+		found := false
+		for _, m := range messages {
+			if m.message == sif.MessageRSAOAEP && messageHeader(m, recipientHeader) == fingerprint {
+				remove[m.ID()] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no data key encrypted for the public key %s found in %s", fingerprint, image)
+		}
+	}
+	if opts.NewPassphrase != "" || opts.RemovePassphrase {
+		for _, d := range passphraseKeys {
+			remove[d.ID()] = true
+		}
+	}
+
+	var add []sif.DescriptorInput
+	for _, r := range opts.AddRecipients {
+		pubKey, err := LoadPEMPublicKey(r)
+		if err != nil {
+			return err
+		}
+		fingerprint := Fingerprint(pubKey)
+		exists := false
+		for _, m := range messages {
+			if !remove[m.ID()] && m.message == sif.MessageRSAOAEP && messageHeader(m, recipientHeader) == fingerprint {
+				exists = true
+			}
+		}
+		if exists {
+			sylog.Infof("Data key already encrypted for the public key %s", fingerprint)
+			continue
+		}
+		encrypt := EncryptKey
+		if legacyPassphrase {
+			encrypt = EncryptPassphraseKey
+		}
+		data, err := encrypt(r, plaintext)
+		if err != nil {
+			return err
+		}
+		di, err := sif.NewDescriptorInput(sif.DataCryptoMessage, bytes.NewReader(data),
+			sif.OptLinkedID(primDescr.ID()),
+			sif.OptCryptoMessageMetadata(sif.FormatPEM, sif.MessageRSAOAEP),
+		)
+		if err != nil {
+			return fmt.Errorf("while creating data key descriptor: %w", err)
+		}
+		add = append(add, di)
+	}
+	if opts.NewPassphrase != "" {
+		di, err := NewPassphraseKeyInput(opts.NewPassphrase, plaintext, primDescr.ID())
+		if err != nil {
+			return err
+		}
+		add = append(add, di)
+	}
+
+	if len(messages)+len(passphraseKeys)-len(remove)+len(add) == 0 && !legacyPassphrase {
+		return fmt.Errorf("refusing to remove the last key able to decrypt %s", image)
+	}
+
+	for _, di := range add {
+		if err := img.AddObject(di); err != nil {
+			return fmt.Errorf("while adding data key to %s: %w", image, err)
+		}
+	}
+	for id := range remove {
+		if err := img.DeleteObject(id, sif.OptDeleteZero(true), sif.OptDeleteCompact(true)); err != nil {
+			return fmt.Errorf("while removing data key from %s: %w", image, err)
+		}
+	}
+
+	return nil
+}
+
+// messageHeader returns the value of a PEM header of an RSA message, or an
+// empty string if it's not set, messages created by older versions don't
+// identify their recipient.
+func messageHeader(m cryptoMessage, name string) string {
+	data, err := m.GetData()
+	if err != nil {
+		return ""
+	}
+	_, headers, err := loadPEMMessage(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	return headers[name]
+}
+
+// isPassphraseDataKey returns whether an RSA message holds the passphrase
+// the image was built with.
+func isPassphraseDataKey(m cryptoMessage) bool {
+	return messageHeader(m, dataKeyHeader) == passphraseDataKey
+}
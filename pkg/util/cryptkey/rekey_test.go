@@ -0,0 +1,286 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cryptkey
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// createEncryptedImage creates a SIF image with a fake encrypted partition
+// and the data key encrypted for the recipient with encrypt.
+func createEncryptedImage(t *testing.T, encrypt func(KeyInfo, []byte) ([]byte, error), recipient KeyInfo, plaintext []byte) string {
+	t.Helper()
+
+	msg, err := encrypt(recipient, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	part, err := sif.NewDescriptorInput(sif.DataPartition, strings.NewReader("encrypted"),
+		sif.OptPartitionMetadata(sif.FsEncryptedSquashfs, sif.PartPrimSys, "amd64"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := sif.NewDescriptorInput(sif.DataCryptoMessage, bytes.NewReader(msg),
+		sif.OptLinkedID(1),
+		sif.OptCryptoMessageMetadata(sif.FormatPEM, sif.MessageRSAOAEP),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "image.sif")
+	f, err := sif.CreateContainerAtPath(path, sif.OptCreateWithDescriptors(part, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// generateKeys returns the public and private key information of a new
+// RSA key pair.
+func generateKeys(t *testing.T, name string) (KeyInfo, KeyInfo) {
+	t.Helper()
+
+	key, err := GenerateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	pub := filepath.Join(dir, name+".pub")
+	priv := filepath.Join(dir, name+".pem")
+	if err := SavePublicPEM(pub, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePrivatePEM(priv, key); err != nil {
+		t.Fatal(err)
+	}
+	return KeyInfo{Format: PEM, Path: pub}, KeyInfo{Format: PEM, Path: priv}
+}
+
+func TestRekey(t *testing.T) {
+	pub1, priv1 := generateKeys(t, "key1")
+	pub2, priv2 := generateKeys(t, "key2")
+	passphrase := KeyInfo{Format: Passphrase, Material: "rekey passphrase"}
+
+	dataKey := []byte("0123456789abcdef0123456789abcdef")
+	image := createEncryptedImage(t, EncryptKey, pub1, dataKey)
+
+	checkKey := func(k KeyInfo, wantAccess bool) {
+		t.Helper()
+		plaintext, err := PlaintextKey(k, image)
+		if access := err == nil && bytes.Equal(plaintext, dataKey); access != wantAccess {
+			t.Errorf("unexpected data key access %v for %+v: %v", access, k, err)
+		}
+	}
+
+	checkKey(priv1, true)
+	checkKey(priv2, false)
+	// the image wasn't built with a passphrase
+	checkKey(passphrase, false)
+
+	steps := []struct {
+		name    string
+		key     KeyInfo
+		opts    RekeyOptions
+		wantErr bool
+	}{
+		{
+			name:    "WrongKey",
+			key:     priv2,
+			opts:    RekeyOptions{AddRecipients: []KeyInfo{pub2}},
+			wantErr: true,
+		},
+		{
+			name: "AddRecipientAndPassphrase",
+			key:  priv1,
+			opts: RekeyOptions{AddRecipients: []KeyInfo{pub2}, NewPassphrase: passphrase.Material},
+		},
+		{
+			name:    "RemoveUnknownRecipient",
+			key:     priv1,
+			opts:    RekeyOptions{RemoveRecipients: []KeyInfo{pub1, {Format: ENV, Material: goodPemData}}},
+			wantErr: true,
+		},
+		{
+			name: "RemoveRecipient",
+			key:  passphrase,
+			opts: RekeyOptions{RemoveRecipients: []KeyInfo{pub1}},
+		},
+		{
+			name:    "RemoveAll",
+			key:     priv2,
+			opts:    RekeyOptions{RemoveRecipients: []KeyInfo{pub2}, RemovePassphrase: true},
+			wantErr: true,
+		},
+	}
+
+	for _, s := range steps {
+		if err := Rekey(image, s.key, s.opts); (err != nil) != s.wantErr {
+			t.Fatalf("step %s: unexpected error: %v (want error %v)", s.name, err, s.wantErr)
+		}
+	}
+
+	checkKey(priv1, false)
+	checkKey(priv2, true)
+	checkKey(passphrase, true)
+	checkKey(KeyInfo{Format: Passphrase, Material: "wrong"}, false)
+
+	messages, err := getEncryptionMessages(image, sif.MessageRSAOAEP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("unexpected number of RSA messages: %d", len(messages))
+	}
+
+	// the passphrase key is stored in a generic descriptor
+	img, err := sif.LoadContainerFromPath(image, sif.OptLoadWithFlag(os.O_RDONLY))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.UnloadContainer()
+	d, err := img.GetDescriptor(sif.WithDataType(sif.DataGeneric))
+	if err != nil {
+		t.Fatalf("passphrase key not found: %v", err)
+	}
+	if d.Name() != passphraseKeyName {
+		t.Errorf("unexpected passphrase key descriptor name %q", d.Name())
+	}
+}
+
+func TestRekeyPassphrase(t *testing.T) {
+	pub1, priv1 := generateKeys(t, "key1")
+	passphrase := KeyInfo{Format: Passphrase, Material: "build passphrase"}
+	newPassphrase := KeyInfo{Format: Passphrase, Material: "new passphrase"}
+
+	// images built with a passphrase have a random data key encrypted
+	// with the passphrase
+	dataKey, err := NewPlaintextKey(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(dataKey, []byte(passphrase.Material)) {
+		t.Fatalf("passphrase used as data key")
+	}
+	part, err := sif.NewDescriptorInput(sif.DataPartition, strings.NewReader("encrypted"),
+		sif.OptPartitionMetadata(sif.FsEncryptedSquashfs, sif.PartPrimSys, "amd64"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewPassphraseKeyInput(passphrase.Material, dataKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(t.TempDir(), "image.sif")
+	f, err := sif.CreateContainerAtPath(image, sif.OptCreateWithDescriptors(part, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkKey := func(k KeyInfo, wantAccess bool) {
+		t.Helper()
+		plaintext, err := PlaintextKey(k, image)
+		if access := err == nil && bytes.Equal(plaintext, dataKey); access != wantAccess {
+			t.Errorf("unexpected data key access %v for %+v: %v", access, k, err)
+		}
+	}
+
+	checkKey(passphrase, true)
+	checkKey(newPassphrase, false)
+
+	if err := Rekey(image, passphrase, RekeyOptions{NewPassphrase: newPassphrase.Material}); err != nil {
+		t.Fatalf("unexpected error changing the passphrase: %v", err)
+	}
+	checkKey(passphrase, false)
+	checkKey(newPassphrase, true)
+
+	if err := Rekey(image, newPassphrase, RekeyOptions{AddRecipients: []KeyInfo{pub1}, RemovePassphrase: true}); err != nil {
+		t.Fatalf("unexpected error removing the passphrase: %v", err)
+	}
+	checkKey(newPassphrase, false)
+	checkKey(priv1, true)
+
+	// without image, the passphrase is the data key of older versions
+	if plaintext, err := PlaintextKey(passphrase, ""); err != nil || string(plaintext) != passphrase.Material {
+		t.Errorf("unexpected data key %q: %v", plaintext, err)
+	}
+}
+
+func TestRekeyLegacyPassphrase(t *testing.T) {
+	pub1, priv1 := generateKeys(t, "key1")
+	pub2, priv2 := generateKeys(t, "key2")
+	passphrase := KeyInfo{Format: Passphrase, Material: "legacy passphrase"}
+
+	// images built with a passphrase by older versions use it as data key
+	image := createEncryptedImage(t, EncryptPassphraseKey, pub1, []byte(passphrase.Material))
+
+	if plaintext, err := PlaintextKey(passphrase, image); err != nil || string(plaintext) != passphrase.Material {
+		t.Fatalf("unexpected data key %q: %v", plaintext, err)
+	}
+
+	// the passphrase can't be changed or removed without rebuilding
+	for _, opts := range []RekeyOptions{{NewPassphrase: "new passphrase"}, {RemovePassphrase: true}} {
+		for _, k := range []KeyInfo{passphrase, priv1} {
+			if err := Rekey(image, k, opts); err == nil {
+				t.Errorf("unexpected success changing the passphrase with %+v", opts)
+			}
+		}
+	}
+
+	// recipients can be changed
+	if err := Rekey(image, passphrase, RekeyOptions{AddRecipients: []KeyInfo{pub2}, RemoveRecipients: []KeyInfo{pub1}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plaintext, err := PlaintextKey(priv2, image); err != nil || string(plaintext) != passphrase.Material {
+		t.Errorf("unexpected data key %q: %v", plaintext, err)
+	}
+	if err := Rekey(image, priv2, RekeyOptions{NewPassphrase: "new passphrase"}); err == nil {
+		t.Errorf("unexpected success changing the passphrase with an added recipient")
+	}
+}
+
+func TestPassphraseMessage(t *testing.T) {
+	dataKey := []byte("data key")
+
+	msg, err := EncryptKeyWithPassphrase(testPassphrase, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := decryptPassphraseMessage(testPassphrase, msg); err != nil || !bytes.Equal(plaintext, dataKey) {
+		t.Errorf("unexpected data key %q: %v", plaintext, err)
+	}
+	if _, err := decryptPassphraseMessage("wrong", msg); err == nil {
+		t.Errorf("unexpected success with a wrong passphrase")
+	}
+
+	// images can't require an unbounded amount of memory
+	tampered := bytes.Replace(msg, []byte(fmt.Sprintf("scrypt,%d,", scryptN)), []byte("scrypt,1073741824,"), 1)
+	if _, err := decryptPassphraseMessage(testPassphrase, tampered); err == nil {
+		t.Errorf("unexpected success with excessive key derivation parameters")
+	}
+	if _, err := EncryptKeyWithPassphrase("", dataKey); err == nil {
+		t.Errorf("unexpected success with an empty passphrase")
+	}
+}